@@ -0,0 +1,136 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/log"
+)
+
+// AccessLogFormat selects whether and how requests are logged
+type AccessLogFormat int
+
+// These constants identify the access log formats
+const (
+	// AccessLogOff disables the access log, and is the default
+	AccessLogOff AccessLogFormat = iota
+	// AccessLogText logs each request as a line of text:
+	//	GET /users 200 1.2ms 10.0.0.1 in=0 out=512 [tenant=acme]
+	AccessLogText
+	// AccessLogJSON logs each request as a JSON object
+	AccessLogJSON
+)
+
+func (f AccessLogFormat) String() string {
+	switch f {
+	case AccessLogText:
+		return "text"
+	case AccessLogJSON:
+		return "json"
+	default:
+		return "off"
+	}
+}
+
+// accessLogEntry is an access log line in the JSON format
+type accessLogEntry struct {
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Status    int               `json:"status"`
+	LatencyMS float64           `json:"latencyMs"`
+	RemoteIP  string            `json:"remoteIp"`
+	BytesIn   int64             `json:"bytesIn"`
+	BytesOut  int64             `json:"bytesOut"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// AccessLogger returns Middleware that logs every request through the log
+// package once it has been served. Requests for the operational routes, such
+// as /_heartbeat, are logged at DEBUG so that health checks do not flood the
+// log, and all others at INFO. Requests cancelled by the client are logged
+// with StatusClientClosedRequest, whatever the handler wrote.
+func AccessLogger(format AccessLogFormat) Middleware {
+	return func(next http.Handler) http.Handler {
+		if format == AccessLogOff {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+
+			req = withTags(req)
+			body := &countingReader{ReadCloser: req.Body}
+			if req.Body != nil {
+				req.Body = body
+			}
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, req)
+
+			status := rw.Status()
+			if ClientCancelled(req) {
+				status = StatusClientClosedRequest
+			}
+
+			e := accessLogEntry{
+				Method:    req.Method,
+				Path:      req.URL.Path,
+				Status:    status,
+				LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+				RemoteIP:  requestIP(req),
+				BytesIn:   atomic.LoadInt64(&body.n),
+				BytesOut:  rw.bytes,
+				Tags:      Tags(req.Context()),
+			}
+
+			var line string
+			if format == AccessLogJSON {
+				b, _ := json.Marshal(e)
+				line = string(b)
+			} else {
+				line = fmt.Sprintf(
+					"%s %s %d %.1fms %s in=%d out=%d",
+					e.Method, e.Path, e.Status, e.LatencyMS, e.RemoteIP,
+					e.BytesIn, e.BytesOut,
+				)
+				if tags := tagString(req.Context()); tags != "" {
+					line += " [" + tags + "]"
+				}
+			}
+
+			if isAdminRoute(req.URL.Path) {
+				log.Debug(line)
+			} else {
+				log.Info(line)
+			}
+		})
+	}
+}
+
+// requestIP returns the IP address of the client that sent the request
+func requestIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	atomic.AddInt64(&r.n, int64(n))
+
+	return n, err
+}
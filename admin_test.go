@@ -0,0 +1,51 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAddr(t *testing.T) {
+	ws := NewWebService()
+	ws.AdminAddr = "127.0.0.1:0"
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(wc)
+
+	public := serve(ws.Handler(), ws.AdminAddr == "", "")
+	admin := serve(ws.AdminHandler(), true, "")
+
+	tests := []struct {
+		path   string
+		public int
+		admin  int
+	}{
+		{"/things", http.StatusOK, http.StatusNotFound},
+		{HeartbeatRoute, http.StatusNotFound, http.StatusOK},
+		{VersionRoute, http.StatusNotFound, http.StatusOK},
+		{"/_metrics", http.StatusNotFound, http.StatusOK},
+		{"/_debug/pprof/", http.StatusNotFound, http.StatusOK},
+		{pprofPrefix, http.StatusNotFound, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		for _, l := range []struct {
+			name   string
+			h      http.Handler
+			status int
+		}{
+			{"public", public, test.public},
+			{"admin", admin, test.admin},
+		} {
+			rec := httptest.NewRecorder()
+			l.h.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+			if rec.Code != l.status {
+				t.Errorf("GET %s on the %s listener = %d, expected %d", test.path, l.name, rec.Code, l.status)
+			}
+		}
+	}
+}
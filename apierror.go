@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/service/render"
+)
+
+// FieldError is a problem with one field of a request, see APIError.Fields
+type FieldError = render.FieldError
+
+// APIError is an error that clients can act upon: the status it is written
+// with, a machine-readable code that does not change when the message is
+// reworded, i.e. "insufficient_funds", and optional details and per-field
+// problems. render.Error, and so Handle, write it as a render.ErrorBody.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Fields  []FieldError
+
+	// Err is the cause, which is not written to clients
+	Err error
+}
+
+// NewAPIError returns an APIError. An empty code is derived from the status.
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// ValidationError returns a 400 Bad Request APIError with the code
+// "validation_failed" listing the problems with the fields of a request
+func ValidationError(fields ...FieldError) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    "validation_failed",
+		Message: fmt.Sprintf("%d fields are not valid", len(fields)),
+		Fields:  fields,
+	}
+}
+
+// WithField adds a problem with a field
+func (e *APIError) WithField(field string, code string, message string) *APIError {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+	return e
+}
+
+// WithDetails sets the details, which are rendered as JSON
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+// Wrap sets the cause
+func (e *APIError) Wrap(err error) *APIError {
+	e.Err = err
+	return e
+}
+
+// Error is part of the error interface
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+
+	return e.Message
+}
+
+// Unwrap returns the cause
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status, or 500 if none is set
+func (e *APIError) StatusCode() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+
+	return e.Status
+}
+
+// Describe is part of the render.Describer interface
+func (e *APIError) Describe() render.ErrorBody {
+	code := e.Code
+	if code == "" {
+		code = render.StatusCode(e.StatusCode())
+	}
+
+	return render.ErrorBody{
+		Message: e.Message,
+		Code:    code,
+		Details: e.Details,
+		Fields:  e.Fields,
+	}
+}
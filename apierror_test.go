@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/service/render"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		body   render.ErrorBody
+	}{
+		{
+			fmt.Errorf("charge: %w", NewAPIError(http.StatusPaymentRequired, "insufficient_funds", "balance too low").Wrap(errors.New("ledger says 0"))),
+			http.StatusPaymentRequired,
+			render.ErrorBody{Message: "balance too low", Code: "insufficient_funds"},
+		},
+		{
+			ValidationError(FieldError{Field: "name", Code: "required", Message: "name is required"}),
+			http.StatusBadRequest,
+			render.ErrorBody{Message: "1 fields are not valid", Code: "validation_failed", Fields: []FieldError{{Field: "name", Code: "required", Message: "name is required"}}},
+		},
+		{
+			errors.New("no such thing"),
+			http.StatusNotFound,
+			render.ErrorBody{Message: "no such thing", Code: "not_found"},
+		},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		render.Error(rec, http.StatusNotFound, test.err)
+
+		if rec.Code != test.status {
+			t.Errorf("Error(%v) = %d, expected %d", test.err, rec.Code, test.status)
+		}
+
+		var body render.ErrorBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Message != test.body.Message || body.Code != test.body.Code || len(body.Fields) != len(test.body.Fields) {
+			t.Errorf("Error(%v) = %+v, expected %+v", test.err, body, test.body)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/render"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// none of the credentials it checks, so that the next may be tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrForbidden may be wrapped by the error of an Authenticator to refuse a
+// caller whose credentials are valid, i.e. a disabled key, with 403 Forbidden
+// rather than 401 Unauthorized
+var ErrForbidden = errors.New("forbidden")
+
+// Authenticator identifies the caller of a request from its credentials. It
+// returns ErrNoCredentials if the request has none of the kind it checks, and
+// another error if they are not valid.
+type Authenticator interface {
+	Authenticate(req *http.Request) (Identity, error)
+}
+
+// Challenger may be implemented by an Authenticator to give the
+// WWW-Authenticate header of a 401 Unauthorized response, i.e. "Bearer"
+type Challenger interface {
+	Challenge() string
+}
+
+// RequireAuth declares that every request to the controller, other than
+// OPTIONS, must be authenticated by one of the authenticators, tried in order.
+// The Identity of the caller is stored in the request context, where scopes
+// declared with RequireScope are checked against it. Requests without valid
+// credentials receive 401 Unauthorized.
+func (wc *WebController) RequireAuth(authenticators ...Authenticator) {
+	wc.authenticators = append(wc.authenticators, authenticators...)
+}
+
+// Authenticate returns Middleware that identifies the callers of every
+// request that carries credentials for one of the authenticators, and
+// refuses those whose credentials are not valid. Requests without credentials
+// are passed on, so that controllers may be public or require authentication
+// with RequireAuth or RequireScope. It can be added with WebService.Use.
+func Authenticate(authenticators ...Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id, err := authenticate(req, authenticators)
+			switch {
+			case err == nil:
+				req = WithIdentity(req, id)
+			case !errors.Is(err, ErrNoCredentials):
+				renderAuthError(w, err, authenticators)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// authenticate returns the identity from the first of the authenticators
+// that finds credentials, or ErrNoCredentials if none does
+func authenticate(req *http.Request, authenticators []Authenticator) (Identity, error) {
+	for _, a := range authenticators {
+		id, err := a.Authenticate(req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return id, err
+	}
+
+	return Identity{}, ErrNoCredentials
+}
+
+// requireAuth authenticates a request to the controller if it requires
+// authentication, returning the request carrying the identity. When it fails
+// the response has been written and false is returned.
+func (wc *WebController) requireAuth(w http.ResponseWriter, req *http.Request, m int) (*http.Request, bool) {
+	if len(wc.authenticators) == 0 || m == Options {
+		return req, true
+	}
+
+	id, err := authenticate(req, wc.authenticators)
+	if err != nil {
+		renderAuthError(w, err, wc.authenticators)
+		return req, false
+	}
+
+	return WithIdentity(req, id), true
+}
+
+// renderAuthError renders 401 Unauthorized, with the challenges of the
+// authenticators, or 403 Forbidden if err wraps ErrForbidden
+func renderAuthError(w http.ResponseWriter, err error, authenticators []Authenticator) {
+	if errors.Is(err, ErrForbidden) {
+		render.Error(w, http.StatusForbidden, err)
+		return
+	}
+
+	for _, a := range authenticators {
+		if c, ok := a.(Challenger); ok {
+			w.Header().Add("WWW-Authenticate", c.Challenge())
+		}
+	}
+
+	if errors.Is(err, ErrNoCredentials) {
+		render.Error(w, http.StatusUnauthorized, fmt.Errorf("authentication required"))
+		return
+	}
+
+	render.Error(w, http.StatusUnauthorized, err)
+}
+
+// APIKeys is an Authenticator of static API keys, sent in a header
+type APIKeys struct {
+	// Header holds the key, or X-Api-Key if empty
+	Header string
+
+	// Keys maps each key to the identity of its holder
+	Keys map[string]Identity
+}
+
+// Authenticate is part of the Authenticator interface
+func (a APIKeys) Authenticate(req *http.Request) (Identity, error) {
+	header := a.Header
+	if header == "" {
+		header = "X-Api-Key"
+	}
+
+	key := req.Header.Get(header)
+	if key == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	// Every key is compared, in constant time, so that the time taken does
+	// not reveal how much of a key matched
+	sum := sha256.Sum256([]byte(key))
+	found := false
+	var id Identity
+	for k, holder := range a.Keys {
+		ks := sha256.Sum256([]byte(k))
+		if subtle.ConstantTimeCompare(sum[:], ks[:]) == 1 {
+			found = true
+			id = holder
+		}
+	}
+
+	if !found {
+		return Identity{}, fmt.Errorf("invalid API key")
+	}
+
+	return id, nil
+}
+
+// bearerToken returns the token of a Bearer Authorization header, or ""
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(auth[7:])
+}
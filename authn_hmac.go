@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMACScheme is the scheme of the Authorization header of requests signed
+// for HMACKeys, which is of the form
+//
+//	HMAC-SHA256 Credential=<key id>, Signature=<hex>
+//
+// The signature is the HMAC-SHA256, with the secret of the key, of
+//
+//	<method>\n<path and query>\n<X-Auth-Timestamp>\n<hex SHA-256 of the body>
+//
+// where X-Auth-Timestamp is the time of signing in Unix seconds. See
+// SignRequest.
+const HMACScheme = "HMAC-SHA256"
+
+// HMACTimestampHeader holds the time at which a request was signed
+const HMACTimestampHeader = "X-Auth-Timestamp"
+
+// HMACKey is a key that may sign requests
+type HMACKey struct {
+	Secret   []byte
+	Identity Identity
+}
+
+// HMACKeys is an Authenticator of requests signed with a shared secret, so
+// that the secret itself is never sent and a request cannot be altered
+// or, once MaxSkew has passed, replayed
+type HMACKeys struct {
+	// Keys maps each key ID to its key
+	Keys map[string]HMACKey
+
+	// MaxSkew is how far the timestamp of a request may be from now, or 5
+	// minutes if zero
+	MaxSkew time.Duration
+
+	// MaxBody limits the size of the body that is read to verify the
+	// signature, or 10MB if zero
+	MaxBody int64
+}
+
+// Challenge is part of the Challenger interface
+func (a HMACKeys) Challenge() string {
+	return HMACScheme
+}
+
+// Authenticate is part of the Authenticator interface. The body of the
+// request is read, and replaced so that the handler may read it.
+func (a HMACKeys) Authenticate(req *http.Request) (Identity, error) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, HMACScheme+" ") {
+		return Identity{}, ErrNoCredentials
+	}
+
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(auth, HMACScheme+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+
+	key, ok := a.Keys[params["Credential"]]
+	if !ok {
+		return Identity{}, fmt.Errorf("invalid signature: unknown credential")
+	}
+
+	ts, err := strconv.ParseInt(req.Header.Get(HMACTimestampHeader), 10, 64)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid signature: %s is required", HMACTimestampHeader)
+	}
+
+	skew := a.MaxSkew
+	if skew == 0 {
+		skew = 5 * time.Minute
+	}
+
+	switch d := time.Since(time.Unix(ts, 0)); {
+	case d > skew:
+		return Identity{}, fmt.Errorf("invalid signature: the timestamp is too old")
+	case d < -skew:
+		return Identity{}, fmt.Errorf("invalid signature: the timestamp is too far in the future")
+	}
+
+	maxBody := a.MaxBody
+	if maxBody == 0 {
+		maxBody = 10 << 20
+	}
+
+	body := []byte{}
+	if req.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxBody+1))
+		if err != nil {
+			return Identity{}, fmt.Errorf("invalid signature: the body cannot be read")
+		}
+		if int64(len(body)) > maxBody {
+			return Identity{}, fmt.Errorf("invalid signature: the body is too large to verify")
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := hmacSignature(key.Secret, req.Method, req.URL.RequestURI(), ts, body)
+	if !hmac.Equal([]byte(params["Signature"]), []byte(expected)) {
+		return Identity{}, fmt.Errorf("invalid signature")
+	}
+
+	return key.Identity, nil
+}
+
+// SignRequest signs a request for HMACKeys with a key, setting its
+// Authorization and X-Auth-Timestamp headers. The body is read, and replaced
+// so that the request can be sent.
+func SignRequest(req *http.Request, keyID string, secret []byte) error {
+	body := []byte{}
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set(HMACTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s, Signature=%s",
+		HMACScheme, keyID, hmacSignature(secret, req.Method, req.URL.RequestURI(), ts, body),
+	))
+
+	return nil
+}
+
+// hmacSignature returns the signature of a request
+func hmacSignature(secret []byte, method string, uri string, ts int64, body []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", method, uri, ts, hex.EncodeToString(bodySum[:]))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
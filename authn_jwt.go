@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTBearer is an Authenticator of JSON Web Tokens sent as Bearer tokens. The
+// subject of the token is the Subject of the Identity, its space-delimited
+// scope claim, or scopes array, are the Scopes, and all of its claims are the
+// Claims.
+//
+// HS256, HS384 and HS512 tokens are verified with a []byte key, RS256 with a
+// *rsa.PublicKey and ES256 with an *ecdsa.PublicKey, and a token whose
+// algorithm does not match the type of its key is refused.
+type JWTBearer struct {
+	// Keys maps the kid of tokens to the key that verifies them
+	Keys map[string]interface{}
+
+	// Key verifies tokens without a kid, or with a kid not in Keys
+	Key interface{}
+
+	// Issuer and Audience, if set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+
+	// Leeway allows for clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// Challenge is part of the Challenger interface
+func (a JWTBearer) Challenge() string {
+	return "Bearer"
+}
+
+// Authenticate is part of the Authenticator interface
+func (a JWTBearer) Authenticate(req *http.Request) (Identity, error) {
+	token := bearerToken(req)
+	if token == "" || strings.Count(token, ".") != 2 {
+		return Identity{}, ErrNoCredentials
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %s", err)
+	}
+
+	id := Identity{Claims: claims}
+	id.Subject, _ = claims["sub"].(string)
+
+	if scopes, ok := claims["scope"].(string); ok {
+		id.Scopes = strings.Fields(scopes)
+	}
+	if scopes, ok := claims["scopes"].([]interface{}); ok {
+		for _, s := range scopes {
+			if s, ok := s.(string); ok {
+				id.Scopes = append(id.Scopes, s)
+			}
+		}
+	}
+
+	return id, nil
+}
+
+// verify checks the signature and registered claims of a token, returning
+// its claims
+func (a JWTBearer) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header")
+	}
+
+	key := a.Key
+	if k, ok := a.Keys[header.Kid]; ok && header.Kid != "" {
+		key = k
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown key")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims")
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(a.Leeway)) {
+		return nil, fmt.Errorf("expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-a.Leeway)) {
+		return nil, fmt.Errorf("not yet valid")
+	}
+
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return nil, fmt.Errorf("issuer not accepted")
+	}
+
+	if a.Audience != "" && !hasAudience(claims["aud"], a.Audience) {
+		return nil, fmt.Errorf("audience not accepted")
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature of a token with the key for its
+// algorithm
+func verifySignature(alg string, key interface{}, signed []byte, sig []byte) error {
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the key", alg)
+		}
+
+		var h func() hash.Hash
+		switch alg {
+		case "HS256":
+			h = sha256.New
+		case "HS384":
+			h = sha512.New384
+		default:
+			h = sha512.New
+		}
+
+		mac := hmac.New(h, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("bad signature")
+		}
+
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the key", alg)
+		}
+
+		sum := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+			return fmt.Errorf("bad signature")
+		}
+
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return fmt.Errorf("algorithm %s does not match the key", alg)
+		}
+
+		sum := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, sum[:], r, s) {
+			return fmt.Errorf("bad signature")
+		}
+
+	default:
+		return fmt.Errorf("algorithm %q is not supported", alg)
+	}
+
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// hasAudience returns true if the aud claim, a string or an array, holds
+// audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT returns an HS256 token for claims, which are JSON
+func signJWT(secret []byte, claims string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestRequireAuth(t *testing.T) {
+	secret := []byte("jwt secret")
+	hmacSecret := []byte("hmac secret")
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Post, func(w http.ResponseWriter, req *http.Request) {
+		id, _ := IdentityFromContext(req.Context())
+		w.Write([]byte(id.Subject))
+	})
+	wc.RequireAuth(
+		APIKeys{Keys: map[string]Identity{"key-1": {Subject: "robot"}}},
+		HMACKeys{Keys: map[string]HMACKey{"partner": {Secret: hmacSecret, Identity: Identity{Subject: "partner", Scopes: []string{"things:*"}}}}},
+		JWTBearer{Key: secret, Audience: "things"},
+	)
+	wc.RequireMethodScope(Post, "things:write")
+
+	ws := NewWebService()
+	ws.AddWebController(wc)
+	h := ws.Handler()
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := signJWT(secret, `{"sub":"alice","aud":"things","scope":"things:write","exp":`+strconv.FormatInt(exp, 10)+`}`)
+	noScope := signJWT(secret, `{"sub":"bob","aud":"things","exp":`+strconv.FormatInt(exp, 10)+`}`)
+	expired := signJWT(secret, `{"sub":"alice","aud":"things","scope":"things:write","exp":1}`)
+
+	tests := []struct {
+		name    string
+		prepare func(req *http.Request)
+		status  int
+		subject string
+	}{
+		{"no credentials", func(req *http.Request) {}, http.StatusUnauthorized, ""},
+		{"bad API key", func(req *http.Request) { req.Header.Set("X-Api-Key", "key-2") }, http.StatusUnauthorized, ""},
+		{"JWT", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+valid) }, http.StatusOK, "alice"},
+		{"expired JWT", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+expired) }, http.StatusUnauthorized, ""},
+		{"JWT without scope", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+noScope) }, http.StatusForbidden, ""},
+		{"HMAC", func(req *http.Request) { SignRequest(req, "partner", hmacSecret) }, http.StatusOK, "partner"},
+		{"tampered HMAC", func(req *http.Request) {
+			SignRequest(req, "partner", hmacSecret)
+			req.URL.RawQuery = "admin=true"
+		}, http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(`{"name":"thing"}`))
+		test.prepare(req)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: POST = %d %s, expected %d", test.name, rec.Code, rec.Body.String(), test.status)
+		}
+		if test.subject != "" && rec.Body.String() != test.subject {
+			t.Errorf("%s: the identity was %q, expected %q", test.name, rec.Body.String(), test.subject)
+		}
+	}
+}
+
+func TestAuthBeforeControllerMiddleware(t *testing.T) {
+	var seen []string
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {})
+	wc.RequireAuth(APIKeys{Keys: map[string]Identity{"key-1": {Subject: "robot"}}})
+	wc.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id, _ := IdentityFromContext(req.Context())
+			seen = append(seen, id.Subject)
+			next.ServeHTTP(w, req)
+		})
+	})
+
+	ws := NewWebService()
+	ws.AddWebController(wc)
+	h := ws.Handler()
+
+	for _, key := range []string{"", "key-2", "key-1"} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(seen) != 1 || seen[0] != "robot" {
+		t.Errorf("controller middleware saw %q, expected only the authenticated caller", seen)
+	}
+}
+
+func TestHMACTimestamp(t *testing.T) {
+	a := HMACKeys{Keys: map[string]HMACKey{"partner": {Secret: []byte("hmac secret")}}}
+
+	tests := []struct {
+		offset   time.Duration
+		expected string
+	}{
+		{-10 * time.Minute, "too old"},
+		{10 * time.Minute, "too far in the future"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(`{}`))
+		SignRequest(req, "partner", []byte("hmac secret"))
+		req.Header.Set(HMACTimestampHeader, strconv.FormatInt(time.Now().Add(test.offset).Unix(), 10))
+
+		if _, err := a.Authenticate(req); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("a timestamp %s from now = %v, expected it to be %s", test.offset, err, test.expected)
+		}
+	}
+}
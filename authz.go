@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/render"
+)
+
+// Identity describes the authenticated caller of a request. It is stored in
+// the request context by authentication middleware, i.e. from a verified JWT
+// or API key, and is used to authorize access to controllers.
+type Identity struct {
+	Subject string                 `json:"subject"`
+	Scopes  []string               `json:"scopes,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// WithIdentity returns the request with the identity of the caller stored in
+// its context
+func WithIdentity(req *http.Request, id Identity) *http.Request {
+	req = req.WithContext(context.WithValue(req.Context(), identityKey, id))
+	return SetTag(req, "subject", id.Subject)
+}
+
+// IdentityFromContext returns the identity of the caller stored by
+// authentication middleware
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
+}
+
+// anyMethod keys declarations that apply to every method of a controller
+const anyMethod = -1
+
+// Authorizer decides whether an identity holds a scope
+type Authorizer func(ctx context.Context, id Identity, scope string) bool
+
+// Authorize is the Authorizer used to check the scopes required by
+// controllers. It may be replaced to consult an external policy.
+var Authorize Authorizer = HasScope
+
+// HasScope is an Authorizer that checks whether the identity's scopes include
+// the scope, where a scope ending in * grants every scope sharing its prefix,
+// i.e. "zones:*" grants "zones:edit"
+func HasScope(ctx context.Context, id Identity, scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+
+		if strings.HasSuffix(s, "*") && strings.HasPrefix(scope, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireScope declares scopes that the caller must hold to use any method of
+// the controller
+func (wc *WebController) RequireScope(scopes ...string) {
+	wc.RequireMethodScope(anyMethod, scopes...)
+}
+
+// RequireMethodScope declares scopes that the caller must hold to use a single
+// method of the controller, i.e. RequireMethodScope(Put, "zones:edit")
+func (wc *WebController) RequireMethodScope(m int, scopes ...string) {
+	if wc.scopes == nil {
+		wc.scopes = make(map[int][]string)
+	}
+
+	wc.scopes[m] = append(wc.scopes[m], scopes...)
+}
+
+// requiredScopes returns the scopes required for a method
+func (wc *WebController) requiredScopes(m int) []string {
+	if len(wc.scopes) == 0 {
+		return nil
+	}
+
+	return append(append([]string{}, wc.scopes[anyMethod]...), wc.scopes[m]...)
+}
+
+// scopeError is rendered when a caller lacks a required scope
+type scopeError struct {
+	Message string `json:"error"`
+	Scope   string `json:"requiredScope"`
+}
+
+// authorize checks that the caller of the request holds the scopes required
+// for the method. When it does not the response has been written and false is
+// returned.
+func (wc *WebController) authorize(w http.ResponseWriter, req *http.Request, m int) bool {
+	// Preflight and automatic responses reveal nothing of the resource
+	if len(wc.scopes) == 0 || m == Options {
+		return true
+	}
+
+	required := wc.requiredScopes(m)
+	if len(required) == 0 {
+		return true
+	}
+
+	id, ok := IdentityFromContext(req.Context())
+	if !ok {
+		render.Error(w, http.StatusUnauthorized, fmt.Errorf("authentication required"))
+		return false
+	}
+
+	for _, scope := range required {
+		if !Authorize(req.Context(), id, scope) {
+			render.JSON(w, http.StatusForbidden, scopeError{
+				Message: fmt.Sprintf("scope %s is required", scope),
+				Scope:   scope,
+			})
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,218 @@
+// Package bench drives a WebService in-process to measure the overhead of
+// middleware, so that the cost of metrics, logging and tracing can be known
+// before they are enabled everywhere.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudflare/service"
+)
+
+// Config describes the load to apply
+type Config struct {
+	// Concurrency is the number of requests in flight at once, or 1 if zero
+	Concurrency int
+
+	// Requests is the total number of requests to make, or 10000 if zero
+	Requests int
+
+	// NewRequest returns the request to make, and is called once per request.
+	// If nil every request is a GET of /.
+	NewRequest func() *http.Request
+}
+
+// Stack is a named combination of middleware to measure
+type Stack struct {
+	Name       string
+	Middleware []service.Middleware
+}
+
+// Result is the outcome of driving a handler
+type Result struct {
+	Name       string
+	Requests   int
+	Duration   time.Duration
+	Throughput float64
+
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+
+	AllocsPerRequest float64
+	BytesPerRequest  float64
+
+	Statuses map[int]int
+}
+
+// Compare drives the WebService once without additional middleware, as a
+// baseline, and then once with each stack applied around it
+func Compare(ws *service.WebService, cfg Config, stacks ...Stack) []Result {
+	h := ws.Handler()
+
+	results := []Result{Run("baseline", h, cfg)}
+	for _, s := range stacks {
+		results = append(results, Run(s.Name, wrap(h, s.Middleware), cfg))
+	}
+
+	return results
+}
+
+// Run drives the handler with the configured load and measures it
+func Run(name string, h http.Handler, cfg Config) Result {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Requests < 1 {
+		cfg.Requests = 10000
+	}
+	if cfg.NewRequest == nil {
+		cfg.NewRequest = func() *http.Request {
+			return httptest.NewRequest("GET", "/", nil)
+		}
+	}
+
+	latencies := make([]time.Duration, cfg.Requests)
+	statuses := make([]int, cfg.Requests)
+	var next int64 = -1
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n := int(atomic.AddInt64(&next, 1))
+				if n >= cfg.Requests {
+					return
+				}
+
+				w := &discardWriter{header: http.Header{}}
+				req := cfg.NewRequest()
+
+				t := time.Now()
+				h.ServeHTTP(w, req)
+				latencies[n] = time.Since(t)
+				statuses[n] = w.status()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	r := Result{
+		Name:       name,
+		Requests:   cfg.Requests,
+		Duration:   elapsed,
+		Throughput: float64(cfg.Requests) / elapsed.Seconds(),
+		AllocsPerRequest: float64(after.Mallocs-before.Mallocs) /
+			float64(cfg.Requests),
+		BytesPerRequest: float64(after.TotalAlloc-before.TotalAlloc) /
+			float64(cfg.Requests),
+		Statuses: map[int]int{},
+	}
+
+	for _, s := range statuses {
+		r.Statuses[s]++
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	r.P50 = percentile(latencies, 50)
+	r.P90 = percentile(latencies, 90)
+	r.P99 = percentile(latencies, 99)
+	r.Max = latencies[len(latencies)-1]
+
+	return r
+}
+
+// Report writes the results as a table, with the overhead of each relative to
+// the first result
+func Report(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "stack\treq/s\tp50\tp90\tp99\tmax\tallocs/req\tB/req\toverhead\t")
+
+	for _, r := range results {
+		overhead := "-"
+		if r.Name != results[0].Name {
+			overhead = fmt.Sprintf(
+				"%+.1f%%",
+				(results[0].Throughput/r.Throughput-1)*100,
+			)
+		}
+
+		fmt.Fprintf(tw, "%s\t%.0f\t%s\t%s\t%s\t%s\t%.1f\t%.0f\t%s\t\n",
+			r.Name, r.Throughput, r.P50, r.P90, r.P99, r.Max,
+			r.AllocsPerRequest, r.BytesPerRequest, overhead,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// wrap applies the middleware so that mw[0] is the outermost handler
+func wrap(h http.Handler, mw []service.Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// percentile returns the pth percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := len(sorted) * p / 100
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+// discardWriter is a http.ResponseWriter that records only the status, so
+// that the cost of recording a response is not attributed to the handler
+type discardWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.code == 0 {
+		w.code = status
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+func (w *discardWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+
+	return w.code
+}
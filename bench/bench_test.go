@@ -0,0 +1,48 @@
+package bench
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/service"
+)
+
+func TestCompare(t *testing.T) {
+	ws := service.NewWebService()
+
+	calls := 0
+	counter := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	results := Compare(
+		&ws,
+		Config{Requests: 100},
+		Stack{Name: "counter", Middleware: []service.Middleware{counter}},
+	)
+
+	if len(results) != 2 {
+		t.Fatalf("%d results, expected 2", len(results))
+	}
+	if calls != 100 {
+		t.Errorf("middleware called %d times, expected 100", calls)
+	}
+	for _, r := range results {
+		if r.Statuses[http.StatusOK] != 100 {
+			t.Errorf("%s: statuses %v, expected 100 OK", r.Name, r.Statuses)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Report(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "counter") {
+		t.Errorf("report does not include the stack:\n%s", buf.String())
+	}
+}
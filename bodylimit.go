@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// SetMaxBodySize sets the size in bytes of the largest request body the
+// controller accepts, overriding WebService.MaxBodySize. A larger body is
+// refused with 413 Request Entity Too Large. A negative size means no limit,
+// i.e. for an upload controller of a service that otherwise limits bodies.
+func (wc *WebController) SetMaxBodySize(n int64) {
+	wc.maxBody = n
+}
+
+// SetMaxJSONDepth sets how deeply the JSON bodies that the controller's
+// handlers decode with decoder.Decode may be nested, overriding
+// WebService.MaxJSONDepth. A negative depth means no limit.
+func (wc *WebController) SetMaxJSONDepth(depth int) {
+	wc.maxJSONDepth = depth
+}
+
+// limitBody applies the controller's request body limits to req, and
+// responds 413 Request Entity Too Large if the body is declared to be larger
+// than allowed. A body that is larger than declared fails to read with a
+// *http.MaxBytesError, which render.Error also writes as a 413.
+func (wc *WebController) limitBody(
+	w http.ResponseWriter,
+	req *http.Request,
+) (*http.Request, bool) {
+	if wc.maxJSONDepth != 0 {
+		req = decoder.WithMaxJSONDepth(req, wc.maxJSONDepth)
+	}
+
+	if wc.maxBody <= 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+
+	if req.ContentLength > wc.maxBody {
+		metrics.Inc("request_too_large", "route", wc.Route)
+		render.Error(
+			w,
+			http.StatusRequestEntityTooLarge,
+			fmt.Errorf("request body of %d bytes exceeds the limit of %d", req.ContentLength, wc.maxBody),
+		)
+		return req, false
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, wc.maxBody)
+	return req, true
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	type thing struct {
+		Name string      `json:"name"`
+		Tags interface{} `json:"tags"`
+	}
+	create := Handle(func(ctx context.Context, t thing) (thing, error) {
+		return t, nil
+	})
+
+	things := NewWebController("/things")
+	things.AddMethodHandler(Post, create)
+
+	uploads := NewWebController("/uploads")
+	uploads.AddMethodHandler(Post, create)
+	uploads.SetMaxBodySize(-1)
+	uploads.SetMaxJSONDepth(-1)
+
+	ws := NewWebService()
+	ws.MaxBodySize = 64
+	ws.MaxJSONDepth = 3
+	ws.AddWebController(things)
+	ws.AddWebController(uploads)
+	h := ws.Handler()
+
+	long := `{"name":"` + strings.Repeat("a", 100) + `"}`
+	deep := `{"tags":[[[["a"]]]]}`
+
+	tests := []struct {
+		route  string
+		body   io.Reader
+		status int
+	}{
+		{"/things", strings.NewReader(`{"name":"foo"}`), http.StatusOK},
+		{"/things", strings.NewReader(long), http.StatusRequestEntityTooLarge},
+		{"/things", io.MultiReader(strings.NewReader(long)), http.StatusRequestEntityTooLarge},
+		{"/things", strings.NewReader(deep), http.StatusBadRequest},
+		{"/uploads", strings.NewReader(long), http.StatusOK},
+		{"/uploads", strings.NewReader(deep), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", test.route, test.body)
+		req.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("POST %s (length %d) = %d %s, expected %d", test.route, req.ContentLength, rec.Code, rec.Body.String(), test.status)
+		}
+	}
+}
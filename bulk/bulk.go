@@ -0,0 +1,175 @@
+// Package bulk helps to implement batch endpoints which accept an array of
+// operations in a single request and report the outcome of each.
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+)
+
+const (
+	// DefaultConcurrency is the number of operations executed at once when no
+	// concurrency is specified
+	DefaultConcurrency = 4
+
+	// DefaultMaxOperations is the maximum number of operations accepted in a
+	// single request when no maximum is specified
+	DefaultMaxOperations = 100
+)
+
+// Func performs a single operation, given its JSON, and returns the result to
+// report along with the HTTP status of the operation
+type Func func(ctx context.Context, op json.RawMessage) (interface{}, int, error)
+
+// Result describes the outcome of a single operation
+type Result struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// Response is rendered for a bulk request, with one Result per operation in
+// the order in which the operations were given
+type Response struct {
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Results   []Result `json:"results"`
+}
+
+// Options configures a bulk Handler. Zero values take the defaults.
+type Options struct {
+	Concurrency   int
+	MaxOperations int
+}
+
+// Handler returns a HTTP handler that decodes a JSON array of operations from
+// the request body and executes each via fn, at most opts.Concurrency at a
+// time. The response is 207 Multi-Status with a Result per operation, unless
+// the request itself is invalid.
+func Handler(fn Func, opts Options) func(w http.ResponseWriter, req *http.Request) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	if opts.MaxOperations < 1 {
+		opts.MaxOperations = DefaultMaxOperations
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ops := []json.RawMessage{}
+		if err := decoder.Decode(req, &ops); err != nil {
+			render.Error(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if len(ops) == 0 {
+			render.Error(w, http.StatusBadRequest, fmt.Errorf("no operations were provided"))
+			return
+		}
+
+		if len(ops) > opts.MaxOperations {
+			render.Error(
+				w,
+				http.StatusRequestEntityTooLarge,
+				fmt.Errorf("operations (%d) cannot exceed %d", len(ops), opts.MaxOperations),
+			)
+			return
+		}
+
+		render.JSON(w, http.StatusMultiStatus, Execute(req.Context(), ops, fn, opts.Concurrency))
+	}
+}
+
+// Execute runs fn for each operation with at most concurrency running at once
+// and collects the results. Operations that have not started when ctx is
+// cancelled are not run and report the context error, and an operation that
+// panics reports 500 Internal Server Error.
+func Execute(
+	ctx context.Context,
+	ops []json.RawMessage,
+	fn Func,
+	concurrency int,
+) Response {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+
+	resp := Response{Results: make([]Result, len(ops))}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i, op := range ops {
+		resp.Results[i].Index = i
+
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			// Both may be ready, and select chooses at random
+			if ctx.Err() != nil {
+				<-sem
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			resp.Results[i].Status = http.StatusServiceUnavailable
+			resp.Results[i].Error = err.Error()
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *Result, op json.RawMessage) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// A panic fails the operation alone, rather than the server
+			defer func() {
+				if p := recover(); p != nil {
+					log.ErrorKV("panic in bulk operation", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+					r.Status = http.StatusInternalServerError
+					r.Error = "internal server error"
+					r.Result = nil
+				}
+			}()
+
+			result, status, err := fn(ctx, op)
+			if err != nil {
+				if status == 0 {
+					status = http.StatusInternalServerError
+				}
+				r.Status = status
+				r.Error = err.Error()
+				return
+			}
+
+			if status == 0 {
+				status = http.StatusOK
+			}
+			r.Status = status
+			r.Result = result
+		}(&resp.Results[i], op)
+	}
+
+	wg.Wait()
+
+	for _, r := range resp.Results {
+		if r.Error == "" && r.Status < http.StatusBadRequest {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	return resp
+}
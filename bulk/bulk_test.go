@@ -0,0 +1,84 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestExecute(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	fn := func(ctx context.Context, op json.RawMessage) (interface{}, int, error) {
+		var name string
+		if err := json.Unmarshal(op, &name); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		switch name {
+		case "panic":
+			panic("malformed operation")
+		case "fail":
+			return nil, 0, errors.New("failed")
+		}
+
+		return name, http.StatusCreated, nil
+	}
+
+	ops := []json.RawMessage{
+		json.RawMessage(`"a"`),
+		json.RawMessage(`"panic"`),
+		json.RawMessage(`"fail"`),
+		json.RawMessage(`1`),
+		json.RawMessage(`"b"`),
+	}
+
+	resp := Execute(context.Background(), ops, fn, 2)
+
+	expected := []Result{
+		{Index: 0, Status: http.StatusCreated, Result: "a"},
+		{Index: 1, Status: http.StatusInternalServerError, Error: "internal server error"},
+		{Index: 2, Status: http.StatusInternalServerError, Error: "failed"},
+		{Index: 3, Status: http.StatusBadRequest},
+		{Index: 4, Status: http.StatusCreated, Result: "b"},
+	}
+
+	if len(resp.Results) != len(expected) {
+		t.Fatalf("%d results, expected %d", len(resp.Results), len(expected))
+	}
+	for i, r := range resp.Results {
+		e := expected[i]
+		if r.Index != e.Index || r.Status != e.Status || r.Result != e.Result ||
+			(e.Error != "" && r.Error != e.Error) || (e.Status >= 400 && r.Error == "") {
+			t.Errorf("result %d = %+v, expected %+v", i, r, e)
+		}
+	}
+
+	if !strings.Contains(out.String(), "malformed operation") {
+		t.Errorf("the panic should be logged: %q", out.String())
+	}
+	if resp.Succeeded != 2 || resp.Failed != 3 {
+		t.Errorf("%d succeeded and %d failed, expected 2 and 3", resp.Succeeded, resp.Failed)
+	}
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp := Execute(ctx, []json.RawMessage{json.RawMessage(`1`)}, func(ctx context.Context, op json.RawMessage) (interface{}, int, error) {
+		return nil, http.StatusOK, nil
+	}, 1)
+
+	if r := resp.Results[0]; r.Status != http.StatusServiceUnavailable || r.Error != context.Canceled.Error() {
+		t.Errorf("an operation after cancellation = %+v", r)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy describes how the responses of a controller method may be
+// cached, and is rendered into the Cache-Control and Expires headers
+type CachePolicy struct {
+	// MaxAge is how long a response may be cached for
+	MaxAge time.Duration
+
+	// Public allows shared caches (i.e. CDNs) to store the response, otherwise
+	// it is private to the client
+	Public bool
+
+	// MustRevalidate prevents a stale response being used without checking
+	// with the service
+	MustRevalidate bool
+
+	// NoStore prevents the response being cached at all, and takes precedence
+	// over the other fields
+	NoStore bool
+}
+
+// header returns the Cache-Control header for the policy
+func (p CachePolicy) header() string {
+	if p.NoStore {
+		return "no-store"
+	}
+
+	directives := []string{"private"}
+	if p.Public {
+		directives[0] = "public"
+	}
+
+	directives = append(directives, "max-age="+strconv.FormatInt(int64(p.MaxAge/time.Second), 10))
+
+	if p.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// apply sets the caching headers for the policy that the handler has not
+// set itself
+func (p CachePolicy) apply(h http.Header) {
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", p.header())
+	}
+
+	if h.Get("Expires") != "" {
+		return
+	}
+
+	if p.NoStore {
+		h.Set("Expires", "0")
+		return
+	}
+
+	h.Set("Expires", time.Now().Add(p.MaxAge).UTC().Format(http.TimeFormat))
+}
+
+// SetCache declares the caching policy for GET (and so HEAD) requests to the
+// controller
+func (wc *WebController) SetCache(p CachePolicy) {
+	wc.SetMethodCache(Get, p)
+}
+
+// SetMethodCache declares the caching policy for a method of the controller
+func (wc *WebController) SetMethodCache(m int, p CachePolicy) {
+	if wc.cache == nil {
+		wc.cache = make(map[int]CachePolicy)
+	}
+
+	wc.cache[m] = p
+}
+
+// withCache returns w wrapped so that the caching headers declared for a
+// method, if any, are set on the responses that may be cached, being those
+// with a 2xx or 304 status, so that shared caches never store an error.
+// Handlers may set the headers themselves to override them.
+func (wc *WebController) withCache(w http.ResponseWriter, m int) http.ResponseWriter {
+	if m == Head {
+		m = Get
+	}
+
+	p, ok := wc.cache[m]
+	if !ok {
+		return w
+	}
+
+	return &cacheWriter{ResponseWriter: w, policy: p}
+}
+
+// cacheWriter sets the headers of a CachePolicy when the status is written
+type cacheWriter struct {
+	http.ResponseWriter
+	policy  CachePolicy
+	written bool
+}
+
+// WriteHeader is part of the http.ResponseWriter interface
+func (cw *cacheWriter) WriteHeader(status int) {
+	if !cw.written {
+		cw.written = true
+		if (status >= 200 && status < 300) || status == http.StatusNotModified {
+			cw.policy.apply(cw.Header())
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write is part of the http.ResponseWriter interface
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.written {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush is part of the http.Flusher interface
+func (cw *cacheWriter) Flush() {
+	if !cw.written {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is part of the http.Hijacker interface
+func (cw *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.Hijacker is not supported by the response writer")
+	}
+
+	return h.Hijack()
+}
+
+// ReadFrom is part of the io.ReaderFrom interface, which allows net/http to
+// send files with sendfile
+func (cw *cacheWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !cw.written {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+
+	return io.Copy(writerOnly{cw.ResponseWriter}, r)
+}
+
+// Push is part of the http.Pusher interface
+func (cw *cacheWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+)
+
+// DefaultCanaryHeader is the header that selects the variant of a request
+// when a Canary does not name one
+const DefaultCanaryHeader = "X-Canary"
+
+// Canary decides which requests are served by the canary handler of a method
+// rather than the stable handler
+type Canary struct {
+	// Percent is the percentage of requests, from 0 to 100, that are served
+	// by the canary
+	Percent float64
+
+	// Header, or DefaultCanaryHeader if empty, selects the variant of a
+	// request: a true value such as "1" or "true" selects the canary, and a
+	// false value the stable handler, regardless of Percent
+	Header string
+
+	// Sticky serves each client, identified by CallerKey, with the same
+	// variant, rather than choosing at random for each request
+	Sticky bool
+}
+
+// canaryHandler is a canary handler of a method and its Canary
+type canaryHandler struct {
+	canary Canary
+	h      func(w http.ResponseWriter, req *http.Request)
+}
+
+// AddCanaryHandler adds an alternate handler for a method, i.e. a rewrite of
+// the handler added with AddMethodHandler, which must be added first. The
+// Canary decides which requests each serves. Requests are counted by the
+// canary_requests and canary_errors metrics, the latter counting responses
+// of 500 and above, and their durations summed by canary_duration_us, each
+// labelled with the route, method and variant, "canary" or "stable", so
+// that the two can be compared.
+func (wc *WebController) AddCanaryHandler(m int, h func(w http.ResponseWriter, req *http.Request), c Canary) {
+	checkMethod(m)
+
+	if _, ok := wc.handlers[m]; !ok {
+		log.Fatalf("%s %s has a canary handler but no handler", GetMethodName(m), wc.Route)
+	}
+
+	if c.Header == "" {
+		c.Header = DefaultCanaryHeader
+	}
+
+	if wc.canaries == nil {
+		wc.canaries = make(map[int]canaryHandler)
+	}
+	wc.canaries[m] = canaryHandler{canary: c, h: h}
+}
+
+// useCanary returns true if the request is to be served by the canary
+func (c Canary) useCanary(req *http.Request) bool {
+	if v := req.Header.Get(c.Header); v != "" {
+		if canary, err := strconv.ParseBool(v); err == nil {
+			return canary
+		}
+	}
+
+	if c.Percent <= 0 {
+		return false
+	}
+
+	if c.Sticky {
+		h := fnv.New32a()
+		h.Write([]byte(CallerKey(req)))
+		return float64(h.Sum32()%10000) < c.Percent*100
+	}
+
+	return rand.Float64()*100 < c.Percent
+}
+
+// withCanary wraps the handler of a method so that the requests chosen by
+// its Canary are served by the canary handler, if it has one
+func (wc *WebController) withCanary(
+	m int,
+	h func(w http.ResponseWriter, req *http.Request),
+) func(w http.ResponseWriter, req *http.Request) {
+	ch, ok := wc.canaries[m]
+	if !ok {
+		return h
+	}
+
+	route := wc.Route
+	method := GetMethodName(m)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		variant, serve := "stable", h
+		if ch.canary.useCanary(req) {
+			variant, serve = "canary", ch.h
+		}
+
+		start := time.Now()
+		rw := newResponseWriter(w)
+		serve(rw, req)
+
+		metrics.Inc("canary_requests", "route", route, "method", method, "variant", variant)
+		if rw.Status() >= http.StatusInternalServerError {
+			metrics.Inc("canary_errors", "route", route, "method", method, "variant", variant)
+		}
+		metrics.Add("canary_duration_us", time.Since(start).Microseconds(), "route", route, "method", method, "variant", variant)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	wc := NewWebController("/canary/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("stable"))
+	})
+	wc.AddCanaryHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("canary"))
+	}, Canary{Percent: 0})
+	h := http.HandlerFunc(GetHandler(wc))
+
+	tests := []struct {
+		header string
+		body   string
+	}{
+		{"", "stable"},
+		{"true", "canary"},
+		{"0", "stable"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/canary/things", nil)
+		if test.header != "" {
+			req.Header.Set(DefaultCanaryHeader, test.header)
+		}
+		h.ServeHTTP(rec, req)
+
+		if rec.Body.String() != test.body {
+			t.Errorf("GET with %s %q = %q, expected %q", DefaultCanaryHeader, test.header, rec.Body.String(), test.body)
+		}
+	}
+
+	published := expvar.Get("metrics").String()
+	for _, variant := range []string{"canary", "stable"} {
+		if !strings.Contains(published, "variant="+variant) {
+			t.Errorf("canary_requests should be published for the %s variant", variant)
+		}
+	}
+}
+
+func TestCanaryPercent(t *testing.T) {
+	c := Canary{Percent: 25, Header: DefaultCanaryHeader}
+
+	canaries := 0
+	for i := 0; i < 4000; i++ {
+		if c.useCanary(httptest.NewRequest("GET", "/", nil)) {
+			canaries++
+		}
+	}
+
+	if canaries < 800 || canaries > 1200 {
+		t.Errorf("%d of 4000 requests were canaries, expected about 1000", canaries)
+	}
+}
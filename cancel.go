@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the status recorded in the access log for a
+// request whose client disconnected before the response was written. It is
+// never sent, and follows the convention of nginx.
+const StatusClientClosedRequest = 499
+
+// ClientCancelled returns true if the client that sent the request has gone
+// away, having closed the connection or cancelled the HTTP/2 stream.
+//
+// The request context is cancelled when this happens, and handlers should
+// pass req.Context() to any database queries or outbound requests so that
+// they are abandoned too. Cancelled requests are counted by the
+// requests_cancelled metric rather than as errors, are logged with
+// StatusClientClosedRequest, and are not reported to Sentry.
+func ClientCancelled(req *http.Request) bool {
+	return req.Context().Err() == context.Canceled
+}
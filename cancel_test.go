@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestClientCancelled checks that a request abandoned by the client is counted
+// as cancelled rather than by the status the handler wrote, and that a
+// controller timeout does not mistake it for a timeout
+func TestClientCancelled(t *testing.T) {
+	stats := newRequestStats()
+
+	wc := NewWebController("/slow")
+	wc.SetTimeout(time.Second)
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	h := stats.middleware(http.HandlerFunc(GetHandler(wc)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	h.ServeHTTP(rec, req)
+
+	if rec.Code == TimeoutStatus && rec.Body.Len() > 0 {
+		t.Errorf("a cancelled request should not be sent a timeout error")
+	}
+
+	counts := stats.byClass()
+	if counts["cancelled"] != 1 || counts["5xx"] != 0 {
+		t.Errorf("byClass() = %v should count 1 cancelled and no 5xx", counts)
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// These headers carry the budget of a request to the services it calls.
+// DeadlineHeader is the time remaining before the caller gives up, in
+// milliseconds, and RetryBudgetHeader the number of retries the caller will
+// still make.
+const (
+	DeadlineHeader    = "X-Request-Deadline-Ms"
+	RetryBudgetHeader = "X-Retry-Budget"
+)
+
+const retryBudgetKey contextKey = 1
+
+// Remaining returns the time remaining before the deadline of ctx, and false
+// if it has no deadline
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	return time.Until(deadline), true
+}
+
+// WithRetryBudget returns a context that allows n retries between all of the
+// calls made with it, and with contexts derived from it
+func WithRetryBudget(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, retryBudgetKey, &n)
+}
+
+// RetryBudget returns the number of retries that remain for ctx, and false if
+// it has no retry budget
+func RetryBudget(ctx context.Context) (int64, bool) {
+	n, ok := ctx.Value(retryBudgetKey).(*int64)
+	if !ok {
+		return 0, false
+	}
+
+	return atomic.LoadInt64(n), true
+}
+
+// TakeRetry uses one retry of the budget of ctx, returning false if none
+// remain. A context without a retry budget allows every retry.
+func TakeRetry(ctx context.Context) bool {
+	n, ok := ctx.Value(retryBudgetKey).(*int64)
+	if !ok {
+		return true
+	}
+
+	for {
+		remaining := atomic.LoadInt64(n)
+		if remaining <= 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(n, remaining, remaining-1) {
+			return true
+		}
+	}
+}
+
+// setBudgetHeaders sets the DeadlineHeader and RetryBudgetHeader of an
+// outbound request from its context
+func setBudgetHeaders(req *http.Request) {
+	if remaining, ok := Remaining(req.Context()); ok {
+		ms := remaining.Milliseconds()
+		if ms < 0 {
+			ms = 0
+		}
+		req.Header.Set(DeadlineHeader, strconv.FormatInt(ms, 10))
+	}
+
+	if n, ok := RetryBudget(req.Context()); ok {
+		req.Header.Set(RetryBudgetHeader, strconv.FormatInt(n, 10))
+	}
+}
+
+// AcceptBudget is middleware that applies the budget sent by the caller of a
+// request: the request context is given the deadline of the DeadlineHeader,
+// so that work and calls stop once the caller has given up, and the retry
+// budget of the RetryBudgetHeader. A request whose caller has already given
+// up is refused with 503 Service Unavailable and counted as shed. It can be
+// added with WebService.Use.
+func AcceptBudget(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if v := req.Header.Get(DeadlineHeader); v != "" {
+			ms, err := strconv.ParseInt(v, 10, 64)
+			if err == nil {
+				if ms <= 0 {
+					metrics.Inc("requests_shed", "reason", "budget")
+					render.Error(w, http.StatusServiceUnavailable,
+						fmt.Errorf("the caller's deadline has passed"))
+					return
+				}
+
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+				defer cancel()
+			}
+		}
+
+		if v := req.Header.Get(RetryBudgetHeader); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+				ctx = WithRetryBudget(ctx, n)
+			}
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
@@ -0,0 +1,21 @@
+// Package client provides an HTTP client for calling other services, which
+// logs each call, records metrics per host and propagates request IDs and
+// trace headers from the request being served.
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is the timeout of clients returned by New
+var DefaultTimeout = 30 * time.Second
+
+// New returns a http.Client that uses a Transport wrapping
+// http.DefaultTransport
+func New() *http.Client {
+	return &http.Client{
+		Transport: &Transport{},
+		Timeout:   DefaultTimeout,
+	}
+}
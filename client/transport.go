@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/tracing"
+)
+
+// PropagatedHeaders are copied from the request being served to the calls it
+// makes, so that a request can be followed across services
+var PropagatedHeaders = []string{
+	"X-Request-Id",
+	"Traceparent",
+	"Tracestate",
+	"Cf-Ray",
+}
+
+// contextKey is the type of the keys this package stores in a context
+type contextKey int
+
+const propagatedKey contextKey = 0
+
+// WithPropagation returns a context that carries the PropagatedHeaders of h,
+// which Transport adds to requests made with the context
+func WithPropagation(ctx context.Context, h http.Header) context.Context {
+	p := http.Header{}
+	for _, name := range PropagatedHeaders {
+		if v := h.Get(name); v != "" {
+			p.Set(name, v)
+		}
+	}
+
+	if len(p) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, propagatedKey, p)
+}
+
+// Propagate is middleware that stores the PropagatedHeaders of each request in
+// its context, so that calls made with the request context carry them. It can
+// be added with WebService.Use.
+func Propagate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(WithPropagation(req.Context(), req.Header)))
+	})
+}
+
+// Transport is a http.RoundTripper that logs each call and records the
+// client_requests, client_errors and client_latency_ms metrics, labelled by
+// host. It adds the headers stored by WithPropagation to each request, and
+// the budget of its context, see AcceptBudget.
+type Transport struct {
+	// Base is the RoundTripper that makes the calls, or
+	// http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+// RoundTrip is part of the http.RoundTripper interface
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// A RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+
+	if p, ok := req.Context().Value(propagatedKey).(http.Header); ok {
+		for name, values := range p {
+			if req.Header.Get(name) == "" {
+				req.Header[name] = values
+			}
+		}
+	}
+
+	setBudgetHeaders(req)
+
+	host := req.URL.Host
+
+	if tracing.FromContext(req.Context()) != nil {
+		// The call is a child span of the request being served
+		ctx, span := tracing.StartClient(req.Context(), req.Method+" "+host)
+		defer span.End()
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("server.address", host)
+
+		req = req.Clone(ctx)
+		tracing.Inject(ctx, req.Header)
+
+		resp, err := t.roundTrip(base, req)
+		if err != nil {
+			span.SetError(err)
+		} else {
+			span.SetAttribute("http.response.status_code", resp.StatusCode)
+		}
+
+		return resp, err
+	}
+
+	return t.roundTrip(base, req)
+}
+
+// roundTrip makes the call with base, logging it and recording its metrics
+func (t *Transport) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	latency := time.Since(start)
+
+	metrics.Add("client_latency_ms", latency.Milliseconds(), "host", host)
+
+	if err != nil {
+		metrics.Inc("client_errors", "host", host)
+		log.Warningf("%s %s failed after %s: %s", req.Method, req.URL.Redacted(), latency, err)
+		return nil, err
+	}
+
+	class := strconv.Itoa(resp.StatusCode/100) + "xx"
+	metrics.Inc("client_requests", "host", host, "status", class)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		log.Warningf("%s %s %d %s", req.Method, req.URL.Redacted(), resp.StatusCode, latency)
+	} else {
+		log.Debugf("%s %s %d %s", req.Method, req.URL.Redacted(), resp.StatusCode, latency)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/servtest"
+)
+
+func TestTransportPropagates(t *testing.T) {
+	upstream := servtest.NewUpstream(t)
+	upstream.Expect("GET", "/things").WithHeader("X-Request-Id", "abc")
+
+	h := Propagate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		out, _ := http.NewRequestWithContext(req.Context(), "GET", upstream.URL+"/things", nil)
+		resp, err := New().Do(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	upstream.AssertExpectations()
+}
+
+func TestTransportBudget(t *testing.T) {
+	upstream := servtest.NewUpstream(t)
+	upstream.Expect("GET", "/things").WithHeader(RetryBudgetHeader, "2")
+
+	h := AcceptBudget(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if remaining, ok := Remaining(req.Context()); !ok || remaining > 5*time.Second {
+			t.Errorf("Remaining() = %s, %t, expected the caller's deadline", remaining, ok)
+		}
+		if !TakeRetry(req.Context()) {
+			t.Errorf("TakeRetry() should use one of 3 retries")
+		}
+
+		out, _ := http.NewRequestWithContext(req.Context(), "GET", upstream.URL+"/things", nil)
+		resp, err := New().Do(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DeadlineHeader, "5000")
+	req.Header.Set(RetryBudgetHeader, "3")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	upstream.AssertExpectations()
+	if ms, _ := strconv.Atoi(upstream.Calls()[0].Header.Get(DeadlineHeader)); ms <= 0 || ms > 5000 {
+		t.Errorf("the call carried %s %d, expected the remaining deadline", DeadlineHeader, ms)
+	}
+
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DeadlineHeader, "0")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("a request whose caller has given up = %d, expected %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
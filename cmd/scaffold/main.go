@@ -0,0 +1,150 @@
+// Command scaffold writes the main.go of a new service, wiring a WebService
+// with flags, logging, health checks, metrics and an example controller in
+// the way this package recommends, so that new services start consistent:
+//
+//	go run github.com/cloudflare/service/cmd/scaffold -name widgets
+//
+// The file is written to the current directory, or the -out directory, and
+// an existing main.go is only replaced with -force.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+)
+
+var (
+	name  = flag.String("name", "", "the name of the service, i.e. widgets")
+	out   = flag.String("out", ".", "the directory to write main.go to")
+	force = flag.Bool("force", false, "replace an existing main.go")
+)
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+func main() {
+	flag.Parse()
+
+	if err := scaffold(*name, *out, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "scaffold: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// scaffold writes main.go for the named service to dir
+func scaffold(name string, dir string, force bool) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("name (%s) must be lower case letters, digits, - and _", name)
+	}
+
+	path := filepath.Join(dir, "main.go")
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s exists, use -force to replace it", path)
+	}
+
+	src, err := generate(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, src, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+// generate returns the formatted source of main.go
+func generate(name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := mainTemplate.Execute(&buf, struct{ Name string }{name}); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+var mainTemplate = template.Must(template.New("main.go").Parse(`// Command {{.Name}} serves the {{.Name}} API.
+//
+// Build with the revision and date so that /_heartbeat and /_version report
+// them:
+//
+//	go build -ldflags "-X main.buildTag=$(git log --pretty=format:'%h' -n 1) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/service"
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+	"github.com/gorilla/mux"
+)
+
+var buildTag = "dev"
+var buildDate = "0001-01-01T00:00:00Z"
+
+var (
+	addr      = flag.String("addr", ":8080", "the address of the public listener")
+	adminAddr = flag.String("admin_addr", "127.0.0.1:8081", "the address of the listener for the operational /_ routes, i.e. /_heartbeat and /_metrics")
+)
+
+func main() {
+	// service/log is configured by flags, i.e. -v and -log_format
+	flag.Parse()
+
+	service.BuildTag = buildTag
+	service.BuildDate = buildDate
+	log.Startup(buildTag)
+
+	ws := service.NewWebService()
+
+	// The operational routes, including the /_metrics counters, are served
+	// on an internal listener rather than to the public
+	ws.AdminAddr = *adminAddr
+	ws.AccessLog = service.AccessLogJSON
+	ws.ShutdownTimeout = 30 * time.Second
+
+	// Replace with checks of the dependencies of the service, i.e. a ping of
+	// its database. A failed critical check takes the instance out of service.
+	ws.AddHealthCheck(service.HealthCheck("example", func(ctx context.Context) error {
+		return nil
+	}), false)
+
+	ws.AddWebController(helloController())
+
+	ws.Run(*addr)
+}
+
+// helloController handles the /hello/{name} route
+func helloController() service.WebController {
+	wc := service.NewWebController("/hello/{name}")
+	wc.AddMethodHandler(service.Get, helloGet)
+
+	return wc
+}
+
+// helloGet handles GET for /hello/{name}
+func helloGet(w http.ResponseWriter, req *http.Request) {
+	type hello struct {
+		Hello string ` + "`json:\"hello\"`" + `
+	}
+
+	log.DebugContext(req.Context(), "saying hello to", mux.Vars(req)["name"])
+
+	render.JSON(w, http.StatusOK, hello{Hello: mux.Vars(req)["name"]})
+}
+`))
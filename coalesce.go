@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// CoalesceKeyFunc returns the key that identifies identical requests. Requests
+// with the same key that arrive while one is in flight share its response.
+type CoalesceKeyFunc func(req *http.Request) string
+
+// CoalesceTimeout limits the time a shared execution of a handler may take.
+// It does not end when the client that started it goes away, as other
+// clients may be waiting for it, but a controller's SetTimeout still applies.
+var CoalesceTimeout = 30 * time.Second
+
+// DefaultCoalesceKey identifies a request by its URL, the authenticated
+// Identity, the credentials it carries, its tenant and the headers that
+// responses are negotiated by, so that responses are never shared between
+// different callers, or between a caller and a request that has not been
+// authenticated, or in a representation the caller did not ask for
+func DefaultCoalesceKey(req *http.Request) string {
+	tenant, _ := TenantFromContext(req.Context())
+
+	subject := ""
+	if id, ok := IdentityFromContext(req.Context()); ok {
+		subject = "id:" + id.Subject
+	}
+
+	return strings.Join([]string{
+		req.URL.RequestURI(),
+		subject,
+		req.Header.Get("Authorization"),
+		req.Header.Get("X-Api-Key"),
+		req.Header.Get("Cookie"),
+		tenant,
+		req.Header.Get("Accept"),
+		req.Header.Get("Accept-Language"),
+		req.Header.Get("Accept-Encoding"),
+	}, "\x00")
+}
+
+// Coalesce returns Middleware that lets concurrent identical GET requests
+// share a single execution of the handler, protecting expensive endpoints
+// when many clients ask for the same thing at once. It is intended to be
+// added to the controllers of designated routes via wc.Use, which runs it
+// after the request has been authenticated. A nil key uses
+// DefaultCoalesceKey.
+//
+// Handlers behind Coalesce must not stream, as the response is buffered so
+// that it can be copied to each waiting request.
+func Coalesce(key CoalesceKeyFunc) Middleware {
+	if key == nil {
+		key = DefaultCoalesceKey
+	}
+
+	g := &flightGroup{calls: make(map[string]*flightCall)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			resp, shared := g.do(key(req), func() *bufferedResponse {
+				// The waiting requests must not fail because the request
+				// that started the execution was cancelled
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), CoalesceTimeout)
+				defer cancel()
+
+				rec := newBufferedResponse()
+				next.ServeHTTP(rec, req.WithContext(ctx))
+				return rec
+			})
+
+			if shared {
+				metrics.Inc("coalesced_requests")
+			}
+
+			resp.writeTo(w)
+		})
+	}
+}
+
+// flightGroup tracks the calls in flight for each key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	resp *bufferedResponse
+}
+
+// do executes fn once for all concurrent callers with the same key, returning
+// the response and whether it was shared from another caller's execution
+func (g *flightGroup) do(key string, fn func() *bufferedResponse) (*bufferedResponse, bool) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.resp, true
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// If fn panics the waiting callers receive a 500 while the panic
+	// continues up the leader's stack
+	c.resp = newBufferedResponse()
+	render.Error(c.resp, http.StatusInternalServerError, fmt.Errorf("internal server error"))
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.resp = fn()
+
+	return c.resp, false
+}
+
+// bufferedResponse is a http.ResponseWriter that records a response so that
+// it can be written to many clients
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+// Header is part of the http.ResponseWriter interface
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader is part of the http.ResponseWriter interface
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// Write is part of the http.ResponseWriter interface
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	return b.body.Write(p)
+}
+
+// writeTo copies the recorded response to w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+
+	status := b.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+	w.Write(b.body.Bytes())
+}
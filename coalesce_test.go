@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalesceSeparatesCallers(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		id, _ := IdentityFromContext(req.Context())
+		w.Write([]byte(id.Subject))
+	})
+	wc.Use(Coalesce(nil))
+
+	ws := NewWebService()
+	ws.Use(Authenticate(APIKeys{Keys: map[string]Identity{"key-1": {Subject: "robot"}}}))
+	ws.AddWebController(wc)
+	h := ws.Handler()
+
+	tests := []struct {
+		header string
+		value  string
+		body   string
+	}{
+		{"X-Api-Key", "key-1", "robot"},
+		{"", "", ""},
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, len(tests))
+	for i, test := range tests {
+		wg.Add(1)
+		go func(i int, header string, value string) {
+			defer wg.Done()
+
+			req := httptest.NewRequest("GET", "/things", nil)
+			if header != "" {
+				req.Header.Set(header, value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			bodies[i] = rec.Body.String()
+		}(i, test.header, test.value)
+
+		// Each request must start its own flight while the other is held
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("request %d joined another flight", i)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	for i, test := range tests {
+		if bodies[i] != test.body {
+			t.Errorf("request with %s %q = %q, expected %q", test.header, test.value, bodies[i], test.body)
+		}
+	}
+}
+
+func TestDefaultCoalesceKey(t *testing.T) {
+	plain := httptest.NewRequest("GET", "/things", nil)
+
+	for _, header := range []string{"Authorization", "X-Api-Key", "Cookie", "Accept", "Accept-Language"} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		req.Header.Set(header, "secret")
+		if DefaultCoalesceKey(req) == DefaultCoalesceKey(plain) {
+			t.Errorf("a request with %s has the key of one without", header)
+		}
+	}
+
+	req := WithIdentity(httptest.NewRequest("GET", "/things", nil), Identity{Subject: "robot"})
+	if DefaultCoalesceKey(req) == DefaultCoalesceKey(plain) {
+		t.Error("an authenticated request has the key of an unauthenticated one")
+	}
+}
+
+func TestCoalesceOutlivesLeader(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	h := Coalesce(nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			w.Write([]byte("done"))
+		case <-req.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan struct{})
+	go func() {
+		defer close(leader)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things", nil).WithContext(ctx))
+	}()
+	<-started
+
+	follower := httptest.NewRecorder()
+	followed := make(chan struct{})
+	go func() {
+		defer close(followed)
+		h.ServeHTTP(follower, httptest.NewRequest("GET", "/things", nil))
+	}()
+
+	// The follower joins the flight, and the leader goes away
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-leader
+	<-followed
+
+	if follower.Code != http.StatusOK || follower.Body.String() != "done" {
+		t.Errorf("a follower of a cancelled leader = %d %q, expected the shared response", follower.Code, follower.Body.String())
+	}
+	select {
+	case <-started:
+		t.Error("the follower should have joined the flight")
+	default:
+	}
+}
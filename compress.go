@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/service/metrics"
+)
+
+// DefaultCompressionMinSize is the size in bytes below which responses are
+// not compressed when no minimum is given
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionSkipTypes are the content types, or prefixes of them,
+// that are already compressed and so are not compressed again
+var DefaultCompressionSkipTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff",
+	"application/gzip", "application/x-gzip", "application/zip",
+	"application/zstd", "application/x-bzip2", "application/x-xz",
+	"application/x-7z-compressed", "application/x-rar-compressed",
+	"application/pdf", "application/octet-stream",
+}
+
+// Compression compresses responses with gzip or deflate, as accepted by the
+// client in Accept-Encoding
+type Compression struct {
+	// MinSize is the size in bytes below which a response is sent as is, or
+	// DefaultCompressionMinSize if zero. Responses that are flushed before
+	// reaching it are compressed regardless, as their size is not known.
+	MinSize int
+
+	// Level is the compression level from gzip.BestSpeed to
+	// gzip.BestCompression, or gzip.DefaultCompression if zero or invalid
+	Level int
+
+	// SkipTypes are the content types that are not compressed, or
+	// DefaultCompressionSkipTypes if nil
+	SkipTypes []string
+}
+
+// Compress returns Middleware that compresses responses. Responses that
+// already have a Content-Encoding, responses to HEAD requests, and partial,
+// 204 and 304 responses are sent as is. A strong ETag of a compressed
+// response is made weak. Each compressed response is counted by the
+// responses_compressed metric.
+func Compress(c Compression) Middleware {
+	if c.MinSize <= 0 {
+		c.MinSize = DefaultCompressionMinSize
+	}
+	if c.Level == 0 || c.Level < gzip.HuffmanOnly || c.Level > gzip.BestCompression {
+		c.Level = gzip.DefaultCompression
+	}
+	if c.SkipTypes == nil {
+		c.SkipTypes = DefaultCompressionSkipTypes
+	}
+
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() interface{} {
+			zw, _ := gzip.NewWriterLevel(io.Discard, c.Level)
+			return zw
+		}},
+		"deflate": {New: func() interface{} {
+			zw, _ := flate.NewWriter(io.Discard, c.Level)
+			return zw
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptedEncoding(req.Header.Get("Accept-Encoding"))
+			if encoding == "" || req.Method == http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       encoding,
+				pool:           pools[encoding],
+			}
+
+			// A response is not completed if the handler panics, so that
+			// Recover can still send an error
+			next.ServeHTTP(cw, req)
+			cw.close()
+		})
+	}
+}
+
+// acceptedEncoding returns the encoding to compress with, preferring gzip, or
+// "" if the client accepts neither gzip nor deflate
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		accepted[name] = q > 0
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, declared := accepted[encoding]; ok || (!declared && accepted["*"]) {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// compressor is implemented by gzip.Writer and flate.Writer
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter holds back the start of a response until MinSize bytes are
+// written, or it is flushed or complete, and then decides whether to
+// compress it
+type compressWriter struct {
+	http.ResponseWriter
+	c        Compression
+	encoding string
+	pool     *sync.Pool
+
+	status  int
+	buf     []byte
+	decided bool
+	zw      compressor
+}
+
+// WriteHeader is part of the http.ResponseWriter interface. Informational
+// responses are sent at once, the status of the response is held back.
+func (cw *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+// Write is part of the http.ResponseWriter interface
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		size := len(cw.buf) + len(b)
+		if cl, err := strconv.Atoi(cw.Header().Get("Content-Length")); err == nil && cl > size {
+			size = cl
+		}
+
+		if size < cw.c.MinSize {
+			cw.buf = append(cw.buf, b...)
+			return len(b), nil
+		}
+
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush is part of the http.Flusher interface
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is part of the http.Hijacker interface
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.Hijacker is not supported by the response writer")
+	}
+
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide sends the header, compressing the response if compress is true and
+// the response is eligible, and then what has been held back
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// Once compressed the content can no longer be sniffed by net/http
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if compress && cw.compressible() {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// The compressed bytes differ from those the strong ETag names
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.zw = cw.pool.Get().(compressor)
+		cw.zw.Reset(cw.ResponseWriter)
+
+		metrics.Inc("responses_compressed", "encoding", cw.encoding)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+
+	return err
+}
+
+// compressible returns true if the response may be compressed
+func (cw *compressWriter) compressible() bool {
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, skip := range cw.c.SkipTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// close sends a response that was too small to be compressed, or completes a
+// compressed one
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// Nothing was written, leave the default response to net/http
+			cw.decided = true
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.zw != nil {
+		cw.zw.Close()
+		cw.zw.Reset(io.Discard)
+		cw.pool.Put(cw.zw)
+		cw.zw = nil
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"thing"},`, 200)
+
+	h := Compress(Compression{})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, large)
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{}`)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, large)
+		}
+	}))
+
+	tests := []struct {
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"/large", "gzip, deflate", "gzip"},
+		{"/large", "gzip;q=0, deflate", "deflate"},
+		{"/large", "", ""},
+		{"/small", "gzip", ""},
+		{"/image", "gzip", ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("GET %s with Accept-Encoding %q: Content-Encoding = %q, expected %q",
+				test.path, test.accept, got, test.encoding)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("GET %s: Vary = %q", test.path, rec.Header().Get("Vary"))
+		}
+
+		if test.path == "/large" {
+			expected := `"v1"`
+			if test.encoding != "" {
+				expected = `W/"v1"`
+			}
+			if etag := rec.Header().Get("ETag"); etag != expected {
+				t.Errorf("GET %s with Accept-Encoding %q: ETag = %s, expected %s", test.path, test.accept, etag, expected)
+			}
+		}
+
+		if test.encoding != "gzip" {
+			continue
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil || string(body) != large {
+			t.Errorf("GET %s: decompressed body does not match: %v", test.path, err)
+		}
+	}
+}
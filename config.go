@@ -0,0 +1,325 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/service/log"
+)
+
+// ServiceConfig holds the options of a WebService that are set in one place
+// with Configure or RunWith, rather than field by field
+type ServiceConfig struct {
+	// Addr is the address of the public listener, and AdminAddr of the
+	// internal listener if any, see WebService.AdminAddr
+	Addr      string
+	AdminAddr string
+
+	Timeouts Timeouts
+
+	// SocketOptions tune the sockets of the listeners, see
+	// WebService.SocketOptions
+	SocketOptions SocketOptions
+
+	// TLSConfig terminates TLS on the public listener, see
+	// WebService.TLSConfig. CertFile and KeyFile are the files it was
+	// loaded from, if any.
+	TLSConfig *tls.Config
+	CertFile  string
+	KeyFile   string
+
+	// DisableDebugRoutes omits the profiler and pprof routes, see
+	// WebService.DisableDebugRoutes
+	DisableDebugRoutes bool
+
+	// DebugToken is required of requests to the profiler routes, see
+	// WebService.DebugToken
+	DebugToken string
+
+	// Middleware is added with WebService.Use
+	Middleware []Middleware
+
+	// LogOutput, if set, is where the log package writes, see log.SetOutput
+	LogOutput io.Writer
+}
+
+// Timeouts are the timeouts of the listeners and of shutdown, see the
+// WebService fields of the same names. A zero timeout is not changed.
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+	Shutdown   time.Duration
+}
+
+// Option sets an option of a ServiceConfig
+type Option func(c *ServiceConfig) error
+
+// WithAddr sets the address of the public listener, i.e. ":8080"
+func WithAddr(addr string) Option {
+	return func(c *ServiceConfig) error {
+		c.Addr = addr
+		return nil
+	}
+}
+
+// WithAdminAddr sets the address of the internal listener for the
+// operational routes
+func WithAdminAddr(addr string) Option {
+	return func(c *ServiceConfig) error {
+		c.AdminAddr = addr
+		return nil
+	}
+}
+
+// WithTimeouts sets the timeouts that are not zero
+func WithTimeouts(t Timeouts) Option {
+	return func(c *ServiceConfig) error {
+		if t.ReadHeader != 0 {
+			c.Timeouts.ReadHeader = t.ReadHeader
+		}
+		if t.Read != 0 {
+			c.Timeouts.Read = t.Read
+		}
+		if t.Write != 0 {
+			c.Timeouts.Write = t.Write
+		}
+		if t.Idle != 0 {
+			c.Timeouts.Idle = t.Idle
+		}
+		if t.Shutdown != 0 {
+			c.Timeouts.Shutdown = t.Shutdown
+		}
+		return nil
+	}
+}
+
+// WithSocketOptions sets the options of the sockets of the listeners, i.e.
+// the listen backlog, TCP_NODELAY, the keep-alive period and the buffer sizes
+func WithSocketOptions(o SocketOptions) Option {
+	return func(c *ServiceConfig) error {
+		if o.Backlog < 0 || o.ReceiveBuffer < 0 || o.SendBuffer < 0 {
+			return fmt.Errorf("socket options: negative backlog or buffer size")
+		}
+
+		c.SocketOptions = o
+		return nil
+	}
+}
+
+// WithTLS terminates TLS on the public listener with the configuration
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *ServiceConfig) error {
+		c.TLSConfig = cfg
+		return nil
+	}
+}
+
+// WithTLSFiles terminates TLS on the public listener with the certificate
+// and key in the files, which are PEM encoded. Any configuration set with
+// WithTLS is used as the basis, so client certificates can be verified.
+func WithTLSFiles(certFile string, keyFile string) Option {
+	return func(c *ServiceConfig) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("TLS certificate %s and key %s: %s", certFile, keyFile, err)
+		}
+
+		cfg := &tls.Config{}
+		if c.TLSConfig != nil {
+			cfg = c.TLSConfig.Clone()
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+
+		c.TLSConfig = cfg
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+		return nil
+	}
+}
+
+// WithDisabledDebugRoutes omits the profiler and pprof routes
+func WithDisabledDebugRoutes() Option {
+	return func(c *ServiceConfig) error {
+		c.DisableDebugRoutes = true
+		return nil
+	}
+}
+
+// WithDebugToken requires the token of requests to the profiler routes
+func WithDebugToken(token string) Option {
+	return func(c *ServiceConfig) error {
+		c.DebugToken = token
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware to every request, as WebService.Use
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *ServiceConfig) error {
+		c.Middleware = append(c.Middleware, mw...)
+		return nil
+	}
+}
+
+// WithLogger sets where the log package writes. The log package is shared by
+// the whole process, and so this affects every WebService.
+func WithLogger(w io.Writer) Option {
+	return func(c *ServiceConfig) error {
+		c.LogOutput = w
+		return nil
+	}
+}
+
+// WithEnv sets the options that are given by environment variables, each
+// named with the prefix, i.e. with the prefix "SERVICE_":
+//
+//	SERVICE_ADDR                  the address of the public listener
+//	SERVICE_ADMIN_ADDR            the address of the internal listener
+//	SERVICE_READ_HEADER_TIMEOUT   the timeouts, as durations such as 10s
+//	SERVICE_READ_TIMEOUT
+//	SERVICE_WRITE_TIMEOUT
+//	SERVICE_IDLE_TIMEOUT
+//	SERVICE_SHUTDOWN_TIMEOUT
+//	SERVICE_TLS_CERT_FILE         the certificate and key to terminate TLS
+//	SERVICE_TLS_KEY_FILE
+//	SERVICE_DISABLE_DEBUG_ROUTES  true to omit the profiler and pprof routes
+//	SERVICE_DEBUG_TOKEN           the token the profiler routes require
+//
+// Variables that are not set leave the options unchanged, so options that
+// follow WithEnv override the environment, and options before it are
+// defaults.
+func WithEnv(prefix string) Option {
+	return func(c *ServiceConfig) error {
+		if v := os.Getenv(prefix + "ADDR"); v != "" {
+			c.Addr = v
+		}
+		if v := os.Getenv(prefix + "ADMIN_ADDR"); v != "" {
+			c.AdminAddr = v
+		}
+
+		durations := []struct {
+			name string
+			d    *time.Duration
+		}{
+			{"READ_HEADER_TIMEOUT", &c.Timeouts.ReadHeader},
+			{"READ_TIMEOUT", &c.Timeouts.Read},
+			{"WRITE_TIMEOUT", &c.Timeouts.Write},
+			{"IDLE_TIMEOUT", &c.Timeouts.Idle},
+			{"SHUTDOWN_TIMEOUT", &c.Timeouts.Shutdown},
+		}
+		for _, d := range durations {
+			v := os.Getenv(prefix + d.name)
+			if v == "" {
+				continue
+			}
+
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %s", prefix, d.name, err)
+			}
+			*d.d = parsed
+		}
+
+		if v := os.Getenv(prefix + "DISABLE_DEBUG_ROUTES"); v != "" {
+			disable, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%sDISABLE_DEBUG_ROUTES: %s", prefix, err)
+			}
+			c.DisableDebugRoutes = disable
+		}
+
+		if v := os.Getenv(prefix + "DEBUG_TOKEN"); v != "" {
+			c.DebugToken = v
+		}
+
+		certFile := os.Getenv(prefix + "TLS_CERT_FILE")
+		keyFile := os.Getenv(prefix + "TLS_KEY_FILE")
+		if certFile != "" || keyFile != "" {
+			return WithTLSFiles(certFile, keyFile)(c)
+		}
+
+		return nil
+	}
+}
+
+// currentConfig returns the ServiceConfig of the current options of the WebService
+func (ws *WebService) currentConfig() ServiceConfig {
+	c := ServiceConfig{
+		AdminAddr: ws.AdminAddr,
+		Timeouts: Timeouts{
+			ReadHeader: ws.ReadHeaderTimeout,
+			Read:       ws.ReadTimeout,
+			Write:      ws.WriteTimeout,
+			Idle:       ws.IdleTimeout,
+			Shutdown:   ws.ShutdownTimeout,
+		},
+		SocketOptions:      ws.SocketOptions,
+		TLSConfig:          ws.TLSConfig,
+		DisableDebugRoutes: ws.DisableDebugRoutes,
+		DebugToken:         ws.DebugToken,
+	}
+
+	if ws.config != nil {
+		c.Addr = ws.config.Addr
+		c.CertFile = ws.config.CertFile
+		c.KeyFile = ws.config.KeyFile
+		c.LogOutput = ws.config.LogOutput
+	}
+
+	return c
+}
+
+// Configure applies the options, in order, to the current options of the
+// WebService. Nothing is changed if an option fails.
+func (ws *WebService) Configure(opts ...Option) error {
+	c := ws.currentConfig()
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return err
+		}
+	}
+
+	ws.AdminAddr = c.AdminAddr
+	ws.ReadHeaderTimeout = c.Timeouts.ReadHeader
+	ws.ReadTimeout = c.Timeouts.Read
+	ws.WriteTimeout = c.Timeouts.Write
+	ws.IdleTimeout = c.Timeouts.Idle
+	ws.ShutdownTimeout = c.Timeouts.Shutdown
+	ws.SocketOptions = c.SocketOptions
+	ws.TLSConfig = c.TLSConfig
+	ws.DisableDebugRoutes = c.DisableDebugRoutes
+	ws.DebugToken = c.DebugToken
+	ws.Use(c.Middleware...)
+
+	if c.LogOutput != nil {
+		log.SetOutput(c.LogOutput)
+	}
+
+	// The middleware has been added and is not kept, so that configuring
+	// again does not add it twice
+	c.Middleware = nil
+	ws.config = &c
+
+	return nil
+}
+
+// RunWith configures the WebService with the options and then runs it as
+// Run does, on the address given by WithAddr or WithEnv. It exits if an
+// option fails or no address is given.
+func (ws *WebService) RunWith(opts ...Option) {
+	if err := ws.Configure(opts...); err != nil {
+		log.Fatalf("configuration: %s", err)
+	}
+
+	if ws.config.Addr == "" {
+		log.Fatal("configuration: no address to listen on, see WithAddr")
+	}
+
+	ws.run(ws.config.Addr, ws.TLSConfig)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConfigure(t *testing.T) {
+	os.Setenv("TEST_SERVICE_ADDR", ":9090")
+	os.Setenv("TEST_SERVICE_WRITE_TIMEOUT", "30s")
+	os.Setenv("TEST_SERVICE_DISABLE_DEBUG_ROUTES", "true")
+	defer os.Unsetenv("TEST_SERVICE_ADDR")
+	defer os.Unsetenv("TEST_SERVICE_WRITE_TIMEOUT")
+	defer os.Unsetenv("TEST_SERVICE_DISABLE_DEBUG_ROUTES")
+
+	ws := NewWebService()
+	err := ws.Configure(
+		WithAddr(":8080"),
+		WithEnv("TEST_SERVICE_"),
+		WithTimeouts(Timeouts{Read: 5 * time.Second}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ws.config.Addr != ":9090" || ws.WriteTimeout != 30*time.Second || ws.ReadTimeout != 5*time.Second {
+		t.Errorf("configured %+v, expected the environment to override the defaults", *ws.config)
+	}
+
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/_debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /_debug/pprof/ with the debug routes disabled = %d, expected 404", rec.Code)
+	}
+
+	os.Setenv("TEST_SERVICE_WRITE_TIMEOUT", "soon")
+	if err := ws.Configure(WithEnv("TEST_SERVICE_")); err == nil {
+		t.Error("an invalid duration in the environment should fail")
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/render"
+)
+
+// ConfigRoute is the path to the endpoint that reports the effective
+// configuration of the running instance. It requires the DebugToken if that
+// is set, and is only served on AdminAddr or with the DebugToken.
+var ConfigRoute string = `/_config`
+
+// SecretMask replaces the values of secret fields in the configuration
+// reported by ConfigRoute
+const SecretMask = "********"
+
+// DefaultSecretFields are the names of the fields that are always masked.
+// Names are compared ignoring case, "_" and "-", and a field is masked if its
+// name contains a secret name, so "apiKey" also masks "API_KEY" and
+// "password" masks "DBPassword".
+var DefaultSecretFields = []string{
+	"password", "passwd", "secret", "token", "apiKey", "privateKey",
+	"dsn", "credentials", "authorization",
+}
+
+// configValues holds the configuration added with AddConfig and the secret
+// fields to mask. It is shared by copies of the WebService.
+type configValues struct {
+	mu      sync.RWMutex
+	names   []string
+	values  map[string]interface{}
+	secrets map[string]bool
+}
+
+// EffectiveConfig is the configuration of the WebService reported by
+// ConfigRoute, with defaults applied
+type EffectiveConfig struct {
+	Addr      string `json:"addr,omitempty"`
+	AdminAddr string `json:"adminAddr,omitempty"`
+
+	Timeouts map[string]string `json:"timeouts"`
+
+	TLS *TLSReport `json:"tls,omitempty"`
+
+	DebugRoutes   bool   `json:"debugRoutes"`
+	DebugToken    bool   `json:"debugToken"`
+	Middleware    int    `json:"middleware"`
+	AccessLog     string `json:"accessLog"`
+	TailLog       bool   `json:"tailLog"`
+	Tracing       bool   `json:"tracing"`
+	Compression   bool   `json:"compression"`
+	RateLimit     bool   `json:"rateLimit"`
+	CORS          bool   `json:"cors"`
+	NotAcceptable string `json:"notAcceptable"`
+	Heartbeat     string `json:"heartbeat"`
+
+	MaxConnections      int `json:"maxConnections,omitempty"`
+	MaxConnectionsPerIP int `json:"maxConnectionsPerIp,omitempty"`
+	MaxHeaderBytes      int `json:"maxHeaderBytes"`
+
+	MaxBodySize  int64 `json:"maxBodySize,omitempty"`
+	MaxJSONDepth int   `json:"maxJsonDepth"`
+}
+
+// TLSReport describes the TLS configuration of the public listener
+type TLSReport struct {
+	CertFile     string `json:"certFile,omitempty"`
+	Certificates int    `json:"certificates"`
+	ClientAuth   string `json:"clientAuth"`
+	MinVersion   string `json:"minVersion,omitempty"`
+}
+
+// ConfigReport is the response of ConfigRoute
+type ConfigReport struct {
+	Service EffectiveConfig        `json:"service"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+// AddConfig adds a value to the configuration reported by ConfigRoute under
+// name, i.e. the configuration struct of the service as loaded. The value is
+// rendered as JSON when requested, so it should not be modified concurrently.
+// Fields named by DefaultSecretFields or MaskConfigFields are masked.
+func (ws *WebService) AddConfig(name string, v interface{}) {
+	if ws.configs == nil {
+		ws.configs = &configValues{}
+	}
+
+	ws.configs.mu.Lock()
+	defer ws.configs.mu.Unlock()
+
+	if ws.configs.values == nil {
+		ws.configs.values = make(map[string]interface{})
+	}
+	if _, ok := ws.configs.values[name]; !ok {
+		ws.configs.names = append(ws.configs.names, name)
+	}
+	ws.configs.values[name] = v
+}
+
+// MaskConfigFields adds to the names of the fields that are masked in the
+// configuration reported by ConfigRoute, at any depth, which are compared as
+// DefaultSecretFields are
+func (ws *WebService) MaskConfigFields(names ...string) {
+	if ws.configs == nil {
+		ws.configs = &configValues{}
+	}
+
+	ws.configs.mu.Lock()
+	defer ws.configs.mu.Unlock()
+
+	if ws.configs.secrets == nil {
+		ws.configs.secrets = make(map[string]bool)
+	}
+	for _, name := range names {
+		ws.configs.secrets[normalizeFieldName(name)] = true
+	}
+}
+
+// normalizeFieldName returns the name of a field as compared when masking
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "_", "", -1)
+	return strings.Replace(name, "-", "", -1)
+}
+
+// isSecret returns true if the field is masked
+func (c *configValues) isSecret(name string) bool {
+	name = normalizeFieldName(name)
+	for secret := range c.secrets {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+
+	for _, secret := range DefaultSecretFields {
+		if strings.Contains(name, normalizeFieldName(secret)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mask returns the JSON representation of v with the secret fields masked
+func (c *configValues) mask(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return c.maskDoc(doc), nil
+}
+
+// maskDoc replaces the values of the secret fields of doc that are not empty
+func (c *configValues) maskDoc(doc interface{}) interface{} {
+	switch d := doc.(type) {
+	case []interface{}:
+		for i := range d {
+			d[i] = c.maskDoc(d[i])
+		}
+	case map[string]interface{}:
+		for k, v := range d {
+			if c.isSecret(k) && v != nil && v != "" {
+				d[k] = SecretMask
+				continue
+			}
+			d[k] = c.maskDoc(v)
+		}
+	}
+
+	return doc
+}
+
+// effectiveConfig returns the configuration of the WebService with defaults
+// applied
+func (ws *WebService) effectiveConfig() EffectiveConfig {
+	c := ws.currentConfig()
+
+	readHeader := c.Timeouts.ReadHeader
+	if readHeader == 0 {
+		readHeader = DefaultReadHeaderTimeout
+	}
+	idle := c.Timeouts.Idle
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	shutdown := c.Timeouts.Shutdown
+	if shutdown == 0 {
+		shutdown = DefaultShutdownTimeout
+	}
+
+	maxHeaderBytes := ws.MaxHeaderBytes
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	maxJSONDepth := ws.MaxJSONDepth
+	if maxJSONDepth == 0 {
+		maxJSONDepth = decoder.MaxJSONDepth
+	}
+
+	e := EffectiveConfig{
+		Addr:      c.Addr,
+		AdminAddr: c.AdminAddr,
+		Timeouts: map[string]string{
+			"readHeader": readHeader.String(),
+			"read":       c.Timeouts.Read.String(),
+			"write":      c.Timeouts.Write.String(),
+			"idle":       idle.String(),
+			"shutdown":   shutdown.String(),
+		},
+		DebugRoutes:         !c.DisableDebugRoutes,
+		DebugToken:          c.DebugToken != "",
+		Middleware:          len(ws.middleware),
+		AccessLog:           ws.AccessLog.String(),
+		TailLog:             ws.TailLog,
+		Tracing:             ws.Tracing,
+		Compression:         ws.Compression != nil,
+		RateLimit:           ws.RateLimit != nil,
+		CORS:                ws.CORS != nil,
+		NotAcceptable:       ws.NotAcceptable.String(),
+		Heartbeat:           ws.HeartbeatFormat.String(),
+		MaxConnections:      ws.MaxConnections,
+		MaxConnectionsPerIP: ws.MaxConnectionsPerIP,
+		MaxHeaderBytes:      maxHeaderBytes,
+		MaxBodySize:         ws.MaxBodySize,
+		MaxJSONDepth:        maxJSONDepth,
+	}
+
+	if c.TLSConfig != nil {
+		e.TLS = &TLSReport{
+			CertFile:     c.CertFile,
+			Certificates: len(c.TLSConfig.Certificates),
+			ClientAuth:   c.TLSConfig.ClientAuth.String(),
+		}
+		if c.TLSConfig.MinVersion != 0 {
+			e.TLS.MinVersion = tls.VersionName(c.TLSConfig.MinVersion)
+		}
+	}
+
+	return e
+}
+
+// configHandler serves ConfigRoute
+func (ws *WebService) configHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := ConfigReport{Service: ws.effectiveConfig()}
+
+		ws.configs.mu.RLock()
+		defer ws.configs.mu.RUnlock()
+
+		if len(ws.configs.names) > 0 {
+			report.Values = make(map[string]interface{}, len(ws.configs.names))
+		}
+		for _, name := range ws.configs.names {
+			v, err := ws.configs.mask(ws.configs.values[name])
+			if err != nil {
+				render.Error(w, http.StatusInternalServerError, fmt.Errorf("config %s: %s", name, err))
+				return
+			}
+			report.Values[name] = v
+		}
+
+		render.JSON(w, http.StatusOK, report)
+	})
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigDump(t *testing.T) {
+	ws := NewWebService()
+	ws.AccessLog = AccessLogJSON
+
+	type database struct {
+		Host     string `json:"host"`
+		Password string `json:"password"`
+		Replica  string `json:"replica_password"`
+	}
+	ws.AddConfig("db", struct {
+		Primary database `json:"primary"`
+		APIKey  string   `json:"API_KEY"`
+		Empty   string   `json:"token"`
+		AWS     string   `json:"AWSSecretKey"`
+		GitHub  string   `json:"github_token"`
+		Session string   `json:"session_cookie"`
+	}{
+		Primary: database{Host: "db.internal", Password: "hunter2", Replica: "hunter3"},
+		APIKey:  "abc123",
+		AWS:     "aws123",
+		GitHub:  "ghp123",
+		Session: "cookie123",
+	})
+	ws.MaskConfigFields("cookie")
+
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, httptest.NewRequest("GET", ConfigRoute, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s on the public listener without a DebugToken = %d, expected 404", ConfigRoute, rec.Code)
+	}
+
+	ws.AdminAddr = ":9000"
+	rec = httptest.NewRecorder()
+	ws.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", ConfigRoute, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", ConfigRoute, rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	for _, secret := range []string{"hunter2", "hunter3", "abc123", "aws123", "ghp123", "cookie123"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("GET %s should mask %q: %s", ConfigRoute, secret, body)
+		}
+	}
+
+	var report ConfigReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Service.AccessLog != "json" || report.Service.Timeouts["idle"] != DefaultIdleTimeout.String() {
+		t.Errorf("service config = %+v, expected the effective settings", report.Service)
+	}
+
+	db := report.Values["db"].(map[string]interface{})
+	if db["primary"].(map[string]interface{})["host"] != "db.internal" || db["token"] != "" {
+		t.Errorf("db config = %v, expected fields that are not secret, or are empty, as is", db)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/service/log"
+)
+
+// RouteConflictError lists the conflicting routes and handlers found when the
+// router is built
+type RouteConflictError struct {
+	Conflicts []string
+}
+
+func (e RouteConflictError) Error() string {
+	return "route conflicts: " + strings.Join(e.Conflicts, "; ")
+}
+
+// ValidateRoutes returns a RouteConflictError if the controllers register the
+// same route more than once, if a route can never match because an earlier
+// route matches every request for it, or if a method handler was replaced.
+func (ws *WebService) ValidateRoutes() error {
+	return routeConflicts(ws.routes())
+}
+
+// checkRoutes logs a warning if the controllers conflict, or exits if
+// StrictRoutes is set
+func (ws *WebService) checkRoutes(controllers []WebController) {
+	err := routeConflicts(controllers)
+	if err == nil {
+		return
+	}
+
+	if ws.StrictRoutes {
+		log.Fatal(err)
+	}
+
+	log.Warning(err)
+}
+
+// routeConflicts returns the conflicts between controllers, which are in the
+// order their routes are matched
+func routeConflicts(controllers []WebController) error {
+	conflicts := []string{}
+
+	for i, wc := range controllers {
+		conflicts = append(conflicts, wc.duplicates...)
+
+		for _, earlier := range controllers[:i] {
+			switch {
+			case earlier.Route == wc.Route:
+				conflicts = append(conflicts, fmt.Sprintf("%s is registered more than once", wc.Route))
+			case overlaps(earlier.Route, wc.Route):
+				conflicts = append(conflicts, fmt.Sprintf("%s is unreachable as %s matches first", wc.Route, earlier.Route))
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	return RouteConflictError{Conflicts: conflicts}
+}
+
+// overlaps returns true if the earlier route certainly matches every request
+// that the later route does. Variables constrained by a regular expression,
+// or that share a segment with other text, are not considered.
+func overlaps(earlier string, later string) bool {
+	e := strings.Split(earlier, "/")
+	l := strings.Split(later, "/")
+	if len(e) != len(l) {
+		return false
+	}
+
+	for i := range e {
+		switch {
+		case e[i] == l[i]:
+		case isPlainVar(e[i]) && (isPlainVar(l[i]) || !strings.Contains(l[i], "{")) && l[i] != "":
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPlainVar returns true if a route segment is a single unconstrained
+// variable, i.e. {id}
+func isPlainVar(segment string) bool {
+	return strings.HasPrefix(segment, "{") &&
+		strings.HasSuffix(segment, "}") &&
+		strings.Count(segment, "{") == 1 &&
+		!strings.Contains(segment, ":")
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// contextKey is the type of the keys this package stores in a request context
+type contextKey int
+
+const (
+	tagsKey contextKey = iota
+	tenantKey
+	fieldsKey
+	expandKey
+	identityKey
+	varsKey
+	requestIDKey
+	healthKey
+)
+
+// requestTags holds the tags for a single request. It is stored as a pointer
+// in the request context so that tags added by inner handlers are visible to
+// outer middleware.
+type requestTags struct {
+	mu   sync.Mutex
+	tags map[string]string
+}
+
+// SetTag attaches a key/value tag to a request and returns the request that
+// should be passed on. Tags are added to Sentry reports and the log lines that
+// the framework writes for the request.
+func SetTag(req *http.Request, key string, value string) *http.Request {
+	req = withTags(req)
+	rt := req.Context().Value(tagsKey).(*requestTags)
+
+	rt.mu.Lock()
+	rt.tags[key] = value
+	rt.mu.Unlock()
+
+	return req
+}
+
+// withTags returns a request whose context holds a set of tags, so that
+// outer middleware can see the tags set by inner handlers
+func withTags(req *http.Request) *http.Request {
+	if _, ok := req.Context().Value(tagsKey).(*requestTags); ok {
+		return req
+	}
+
+	rt := &requestTags{tags: make(map[string]string)}
+	return req.WithContext(context.WithValue(req.Context(), tagsKey, rt))
+}
+
+// Tags returns a copy of the tags that have been set on the request context
+func Tags(ctx context.Context) map[string]string {
+	tags := make(map[string]string)
+
+	rt, ok := ctx.Value(tagsKey).(*requestTags)
+	if !ok {
+		return tags
+	}
+
+	rt.mu.Lock()
+	for k, v := range rt.tags {
+		tags[k] = v
+	}
+	rt.mu.Unlock()
+
+	return tags
+}
+
+// tagString formats the tags of a request context as a stable, space
+// delimited list of key=value pairs for use in log lines
+func tagString(ctx context.Context) string {
+	tags := Tags(ctx)
+
+	pairs := []string{}
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, " ")
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/cloudflare/service/render"
 )
@@ -12,9 +13,35 @@ import (
 // WebController describes the HTTP method handlers for a given route.
 // Create a WebController with service.NewController(route)
 type WebController struct {
-	Route    string
-	handlers map[int]func(w http.ResponseWriter, req *http.Request)
-	allowed  string
+	Route      string
+	handlers   map[int]func(w http.ResponseWriter, req *http.Request)
+	allowed    string
+	middleware []Middleware
+	fields     []string
+	expand     []string
+	scopes     map[int][]string
+	cache      map[int]CachePolicy
+	deprecated map[int]bool
+	timeout    time.Duration
+	examples   map[int][]Example
+	duplicates []string
+	paths      []string
+	subPaths   map[string]map[int]func(w http.ResponseWriter, req *http.Request)
+	cors       *CORSPolicy
+	rateLimit  *RateLimit
+	slo        *SLO
+	headers    []headerRule
+
+	featureFlag string
+	canaries    map[int]canaryHandler
+
+	authenticators []Authenticator
+
+	maxResponse       int64
+	maxResponsePolicy ResponseSizePolicy
+
+	maxBody      int64
+	maxJSONDepth int
 }
 
 // NewWebController creates a new controller for a given route
@@ -49,6 +76,61 @@ func (wc *WebController) GetAllowedMethods() string {
 
 // AddMethodHandler adds a HTTP handler to a given HTTP method
 func (wc *WebController) AddMethodHandler(m int, h func(w http.ResponseWriter, req *http.Request)) {
+	checkMethod(m)
+
+	if _, ok := wc.handlers[m]; ok {
+		wc.duplicates = append(wc.duplicates, fmt.Sprintf("%s %s has more than one handler", GetMethodName(m), wc.Route))
+	}
+
+	wc.handlers[m] = h
+	wc.allowed = ""
+}
+
+// AddMethodHandlerWithMiddleware adds a HTTP handler to a given HTTP method,
+// wrapped in middleware that only applies to that method, i.e. validation of
+// a POST body or caching of a GET. The middleware runs after the controller's
+// middleware and checks, the first given being the outermost.
+func (wc *WebController) AddMethodHandlerWithMiddleware(
+	m int,
+	h func(w http.ResponseWriter, req *http.Request),
+	mw ...Middleware,
+) {
+	wc.AddMethodHandler(m, chain(http.HandlerFunc(h), mw).ServeHTTP)
+}
+
+// AddMethodHandlerForPath adds a HTTP handler to a given HTTP method for a path
+// beneath the controller's route, i.e. "/{id}" beneath "/users", so that one
+// controller can own a resource hierarchy. Path variables are available via
+// Vars. The controller's middleware, scopes and policies apply to every path.
+func (wc *WebController) AddMethodHandlerForPath(
+	m int,
+	path string,
+	h func(w http.ResponseWriter, req *http.Request),
+) {
+	checkMethod(m)
+
+	if !strings.HasPrefix(path, "/") {
+		log.Fatalf("Path %s must begin with /", path)
+	}
+
+	if wc.subPaths == nil {
+		wc.subPaths = make(map[string]map[int]func(w http.ResponseWriter, req *http.Request))
+	}
+
+	if _, ok := wc.subPaths[path]; !ok {
+		wc.paths = append(wc.paths, path)
+		wc.subPaths[path] = make(map[int]func(w http.ResponseWriter, req *http.Request))
+	}
+
+	if _, ok := wc.subPaths[path][m]; ok {
+		wc.duplicates = append(wc.duplicates, fmt.Sprintf("%s %s%s has more than one handler", GetMethodName(m), wc.Route, path))
+	}
+
+	wc.subPaths[path][m] = h
+}
+
+// checkMethod exits if m cannot be given a handler
+func checkMethod(m int) {
 	if !IsMethod(m) {
 		log.Fatalf("Method iota %d not recognised", m)
 	}
@@ -60,9 +142,32 @@ func (wc *WebController) AddMethodHandler(m int, h func(w http.ResponseWriter, r
 	if m == Head {
 		log.Fatal("Cannot set HEAD, this is provided for you")
 	}
+}
 
-	wc.handlers[m] = h
-	wc.allowed = ""
+// withSubPaths returns the controller followed by a controller for each of
+// its sub-paths, in the order they were added. The controller itself is
+// omitted if it only has handlers for sub-paths.
+func (wc WebController) withSubPaths() []WebController {
+	controllers := []WebController{}
+	if len(wc.handlers) > 0 || len(wc.paths) == 0 {
+		controllers = append(controllers, wc)
+	}
+
+	for _, path := range wc.paths {
+		sub := wc
+		sub.Route = strings.TrimSuffix(wc.Route, "/") + path
+		sub.handlers = wc.subPaths[path]
+		sub.allowed = ""
+		sub.examples = nil
+		sub.duplicates = nil
+		sub.paths = nil
+		sub.subPaths = nil
+		sub.canaries = nil
+
+		controllers = append(controllers, sub)
+	}
+
+	return controllers
 }
 
 // GetMethodHandler returns the appropriate method handler for the request or a
@@ -70,6 +175,7 @@ func (wc *WebController) AddMethodHandler(m int, h func(w http.ResponseWriter, r
 func (wc *WebController) GetMethodHandler(m int) func(w http.ResponseWriter, req *http.Request) {
 	if m == Options {
 		return func(w http.ResponseWriter, req *http.Request) {
+			render.SetHeaders(w)
 			w.Header().Set("Allow", wc.GetAllowedMethods())
 			w.Header().Set("Content-Length", "0")
 			w.WriteHeader(http.StatusOK)
@@ -78,6 +184,7 @@ func (wc *WebController) GetMethodHandler(m int) func(w http.ResponseWriter, req
 
 	if m == Head {
 		return func(w http.ResponseWriter, req *http.Request) {
+			render.SetHeaders(w)
 			w.Header().Set("Allow", wc.GetAllowedMethods())
 			w.Header().Set("Content-Length", "0")
 			w.WriteHeader(http.StatusOK)
@@ -101,11 +208,65 @@ func (wc *WebController) GetMethodHandler(m int) func(w http.ResponseWriter, req
 }
 
 // GetHandler returns a global handler for this route, to be used by the server
-// mux
+// mux. Requests are authenticated and authorized before the controller's rate
+// limit and middleware, so that they act on the Identity of the caller and
+// never on credentials that have not been checked.
 func GetHandler(
 	wc WebController,
 ) func(w http.ResponseWriter, req *http.Request) {
+	h := chain(http.HandlerFunc(wc.serveMethod), wc.middleware)
+	if wc.rateLimit != nil {
+		h = Throttle(*wc.rateLimit)(h)
+	}
+
 	return func(w http.ResponseWriter, req *http.Request) {
-		wc.GetMethodHandler(GetHTTPMethod(req))(w, req)
+		// Preflight requests carry no credentials, and so are answered
+		// before authorization
+		if wc.applyCORS(w, req) {
+			return
+		}
+
+		m := GetHTTPMethod(req)
+		req, ok := wc.requireAuth(w, req, m)
+		if !ok {
+			return
+		}
+
+		if !wc.authorize(w, req, m) {
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	}
+}
+
+// serveMethod checks a request that has been authorized and calls the handler
+// of its method
+func (wc *WebController) serveMethod(w http.ResponseWriter, req *http.Request) {
+	m := GetHTTPMethod(req)
+
+	if !wc.checkHeaders(w, req) {
+		return
+	}
+
+	req, ok := wc.limitBody(w, req)
+	if !ok {
+		return
+	}
+
+	req, status, err := wc.withFields(req)
+	if err != nil {
+		render.Error(w, status, err)
+		return
 	}
+
+	req, status, err = wc.withExpand(req)
+	if err != nil {
+		render.Error(w, status, err)
+		return
+	}
+
+	w = wc.withCache(w, m)
+	wc.applyDeprecation(w, m)
+	wc.withTimeout(wc.withMaxResponseSize(wc.withCanary(m, wc.GetMethodHandler(m))))(w, req)
 }
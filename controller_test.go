@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/render"
+)
+
+func TestAddMethodHandlerWithMiddleware(t *testing.T) {
+	tag := func(value string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Add("X-Order", value)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wc.AddMethodHandlerWithMiddleware(Post, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}, tag("first"), tag("second"))
+	h := http.HandlerFunc(GetHandler(wc))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/things", nil))
+	if order := rec.Header()["X-Order"]; rec.Code != http.StatusCreated || len(order) != 2 || order[0] != "first" {
+		t.Errorf("POST = %d with X-Order %v, expected 201 with first, second", rec.Code, order)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/things", nil))
+	if order := rec.Header()["X-Order"]; len(order) != 0 {
+		t.Errorf("GET should not run the middleware of POST: X-Order %v", order)
+	}
+}
+
+func TestCachePolicyOnlyOnCacheableResponses(t *testing.T) {
+	status := http.StatusOK
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	})
+	wc.SetCache(CachePolicy{MaxAge: time.Minute, Public: true})
+	h := http.HandlerFunc(GetHandler(wc))
+
+	for _, status = range []int{http.StatusOK, http.StatusNotModified, http.StatusNotFound, http.StatusInternalServerError} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/things", nil))
+
+		cacheable := status == http.StatusOK || status == http.StatusNotModified
+		if got := rec.Header().Get("Cache-Control") != "" || rec.Header().Get("Expires") != ""; got != cacheable {
+			t.Errorf("%d has Cache-Control %q and Expires %q", status, rec.Header().Get("Cache-Control"), rec.Header().Get("Expires"))
+		}
+	}
+}
+
+func TestNotAcceptablePerService(t *testing.T) {
+	handler := func(p render.NotAcceptablePolicy) http.Handler {
+		wc := NewWebController("/things")
+		wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+			render.Negotiate(w, req, http.StatusOK, map[string]int{"a": 1})
+		})
+
+		ws := NewWebService()
+		ws.NotAcceptable = p
+		ws.AddWebController(wc)
+		return ws.Handler()
+	}
+
+	// Both are built before either serves, so that a policy set by building
+	// one cannot leak into the other
+	reject := handler(render.NotAcceptableReject)
+	fallback := handler(render.NotAcceptableFallback)
+
+	for _, test := range []struct {
+		h      http.Handler
+		status int
+	}{
+		{reject, http.StatusNotAcceptable},
+		{fallback, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/things", nil)
+		req.Header.Set("Accept", "image/png")
+		test.h.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("Accept image/png = %d, expected %d", rec.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes the cross-origin requests that browsers may make to a
+// controller, and is rendered into the Access-Control-* headers of its
+// responses and of the preflight OPTIONS requests that precede them
+type CORSPolicy struct {
+	// AllowedOrigins are the origins that may make requests, i.e.
+	// "https://dash.example.com". "*" allows any origin, and a leading
+	// wildcard such as "https://*.example.com" allows any subdomain.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods that may be used, or the methods of the
+	// controller if empty
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers that may be sent, or those
+	// asked for by the preflight request if empty
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that scripts may read
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with cookies or an Authorization
+	// header. It cannot be combined with an AllowedOrigins of "*", as any
+	// website could then make requests as the user and read the responses.
+	AllowCredentials bool
+
+	// MaxAge is how long the result of a preflight request may be cached
+	MaxAge time.Duration
+}
+
+// SetCORS declares the CORS policy of the controller, overriding the CORS
+// policy of the WebService
+func (wc *WebController) SetCORS(p CORSPolicy) {
+	p.check()
+	wc.cors = &p
+}
+
+// check exits if the policy allows credentials from any origin
+func (p *CORSPolicy) check() {
+	if !p.AllowCredentials {
+		return
+	}
+
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			log.Fatal("CORS policy cannot allow credentials from any origin \"*\"")
+		}
+	}
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// an origin, or "" if it is not allowed
+func (p *CORSPolicy) allowOrigin(origin string) string {
+	for _, o := range p.AllowedOrigins {
+		switch {
+		case o == "*":
+			return "*"
+		case strings.EqualFold(o, origin):
+			return origin
+		case strings.Contains(o, "://*."):
+			scheme := o[:strings.Index(o, "*")]
+			suffix := o[strings.Index(o, "*")+1:]
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, suffix) &&
+				len(origin) > len(scheme)+len(suffix) {
+				return origin
+			}
+		}
+	}
+
+	return ""
+}
+
+// applyCORS sets the CORS headers for a request to the controller, and
+// answers a preflight request, returning true if it did
+func (wc *WebController) applyCORS(w http.ResponseWriter, req *http.Request) bool {
+	p := wc.cors
+	if p == nil {
+		return false
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	allowed := p.allowOrigin(origin)
+	if allowed == "" {
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	preflight := req.Method == http.MethodOptions &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+	if !preflight {
+		if len(p.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+		}
+
+		return false
+	}
+
+	methods := strings.Join(p.AllowedMethods, ", ")
+	if methods == "" {
+		methods = wc.GetAllowedMethods()
+	}
+	h.Set("Access-Control-Allow-Methods", methods)
+
+	headers := strings.Join(p.AllowedHeaders, ", ")
+	if headers == "" {
+		headers = req.Header.Get("Access-Control-Request-Headers")
+	}
+	if headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(p.MaxAge/time.Second), 10))
+	}
+
+	h.Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
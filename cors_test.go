@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	ws := NewWebService()
+	ws.CORS = &CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wc.RequireScope("things:read")
+	ws.AddWebController(wc)
+
+	private := NewWebController("/private")
+	private.AddMethodHandler(Post, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	private.SetCORS(CORSPolicy{
+		AllowedOrigins:   []string{"https://dash.example.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	ws.AddWebController(private)
+
+	h := ws.Handler()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/things", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent ||
+		rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		rec.Header().Get("Access-Control-Allow-Headers") != "Authorization" {
+		t.Errorf("preflight = %d %v, expected it to be allowed before authorization", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("OPTIONS", "/private", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight from an origin not allowed by the controller = %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/private", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated ||
+		rec.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("POST = %d %v, expected CORS headers with credentials", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// requireDebugToken returns h, allowing only requests with the token if one
+// is given. Each request refused is counted by the debug_requests_refused
+// metric.
+func requireDebugToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		given := req.Header.Get("X-Debug-Token")
+		if auth := req.Header.Get("Authorization"); given == "" && strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			metrics.Inc("debug_requests_refused")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+			render.Error(w, http.StatusUnauthorized, fmt.Errorf("%s requires the debug token", req.URL.Path))
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// protected returns h for an operational route that must not be open to
+// every client of the service, i.e. one that runs queries or changes how the
+// service behaves, requiring the DebugToken if it is set. If neither the
+// DebugToken nor AdminAddr is set it returns nil, and the route is not
+// registered, as it would be served to anyone on the public listener.
+func (ws *WebService) protected(h http.Handler) http.Handler {
+	if ws.DebugToken == "" && ws.AdminAddr == "" {
+		return nil
+	}
+
+	return requireDebugToken(ws.DebugToken, h)
+}
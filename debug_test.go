@@ -0,0 +1,43 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugToken(t *testing.T) {
+	ws := NewWebService()
+	ws.DebugToken = "s3cret"
+	h := ws.Handler()
+
+	tests := []struct {
+		header string
+		value  string
+		status int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{"Authorization", "Bearer s3cret", http.StatusOK},
+		{"X-Debug-Token", "s3cret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/_debug/pprof/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("GET /_debug/pprof/ with %s %q = %d, expected %d", test.header, test.value, rec.Code, test.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	serve(http.NotFoundHandler(), true, "s3cret").ServeHTTP(rec, httptest.NewRequest("GET", pprofPrefix, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET %s without the token = %d, expected 401", pprofPrefix, rec.Code)
+	}
+}
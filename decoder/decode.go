@@ -2,9 +2,13 @@ package decoder
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"net/http"
 	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 )
 
 var (
@@ -13,29 +17,73 @@ var (
 	ErrContentTypeUndefined = fmt.Errorf("Content-Type is undefined")
 
 	// ErrDecoderNotImplemented is returned if the Content-Type does not match
-	// one of the defined decoders, i.e.
+	// one of the registered decoders, i.e.
 	//    "application/json" => jsonDecode
-	//    "application/xml" => undefined and this error is return
+	//    "text/csv" => undefined and this error is returned
+	// render.Error responds to it with 415 Unsupported Media Type, listing
+	// the ContentTypes, whatever the status it is given.
 	ErrDecoderNotImplemented = fmt.Errorf("Decoding is not yet implement")
 )
 
+// DecodeFunc reads the body of a HTTP request into the supplied interface
+type DecodeFunc func(req *http.Request, v interface{}) error
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]DecodeFunc{
+		"application/json":                  jsonDecode,
+		"application/xml":                   xmlDecode,
+		"text/xml":                          xmlDecode,
+		"application/x-www-form-urlencoded": formDecode,
+		"multipart/form-data":               multipartDecode,
+	}
+)
+
+// Register adds a decoder for a Content-Type, i.e. "text/csv", replacing any
+// existing decoder for it
+func Register(contentType string, fn DecodeFunc) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[strings.ToLower(contentType)] = fn
+}
+
+// ContentTypes returns the Content-Types that have a decoder, sorted
+func ContentTypes() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	types := make([]string, 0, len(decoders))
+	for contentType := range decoders {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
 // Decode will ready the body of the HTTP request and attempt to unmarshall the
 // content into the supplied interface. If the content-type of the request is
 // not one that matches a known decoder, then an error will be thrown
 func Decode(req *http.Request, v interface{}) error {
+	if req.Header.Get("Content-Type") == "" {
+		return ErrContentTypeUndefined
+	}
+
 	contentType, err := getContentType(req)
 	if err != nil {
 		return err
 	}
 
-	switch contentType {
-	case "application/json":
-		return jsonDecode(req, v)
-	case "":
-		return ErrContentTypeUndefined
-	default:
+	decodersMu.RLock()
+	fn, ok := decoders[contentType]
+	decodersMu.RUnlock()
+
+	if !ok {
 		return ErrDecoderNotImplemented
 	}
+
+	return fn(req, v)
 }
 
 func getContentType(req *http.Request) (contentType string, err error) {
@@ -46,5 +94,15 @@ func getContentType(req *http.Request) (contentType string, err error) {
 func jsonDecode(req *http.Request, v interface{}) error {
 	defer req.Body.Close()
 
+	if depth := maxJSONDepth(req); depth > 0 {
+		return json.NewDecoder(&depthReader{r: req.Body, max: depth}).Decode(&v)
+	}
+
 	return json.NewDecoder(req.Body).Decode(&v)
 }
+
+func xmlDecode(req *http.Request, v interface{}) error {
+	defer req.Body.Close()
+
+	return xml.NewDecoder(req.Body).Decode(v)
+}
@@ -0,0 +1,113 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type widget struct {
+	Name  string   `json:"name"`
+	Count int      `form:"count"`
+	Tags  []string `json:"tags"`
+	Image *multipart.FileHeader
+}
+
+func TestDecodeForm(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("name=foo&count=3&tags=a&tags=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var w widget
+	if err := Decode(req, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Name != "foo" || w.Count != 3 || len(w.Tags) != 2 {
+		t.Errorf("decoded %+v", w)
+	}
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "foo")
+	fw, _ := mw.CreateFormFile("Image", "image.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var w widget
+	if err := Decode(req, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Name != "foo" || w.Image == nil || w.Image.Filename != "image.png" {
+		t.Errorf("decoded %+v", w)
+	}
+}
+
+func TestDecodeMultipartRemovesFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	defer func(max int64) { MaxMultipartMemory = max }(MaxMultipartMemory)
+	MaxMultipartMemory = 1
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("Image", "image.png")
+	fw.Write([]byte("a png stored on disk"))
+	mw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/", &body).WithContext(ctx)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var w widget
+	if err := Decode(req, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("the upload should be stored on disk, found %d files", len(files))
+	}
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		if files, _ := os.ReadDir(dir); len(files) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the upload should be removed once the request is done")
+}
+
+func TestDecodeXML(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("<widget><Name>foo</Name></widget>"))
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	var w widget
+	if err := Decode(req, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Name != "foo" {
+		t.Errorf("decoded %+v", w)
+	}
+}
+
+func TestDecodeNotImplemented(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("a,b"))
+	req.Header.Set("Content-Type", "text/csv")
+
+	if err := Decode(req, &widget{}); err != ErrDecoderNotImplemented {
+		t.Errorf("expected ErrDecoderNotImplemented, got %v", err)
+	}
+}
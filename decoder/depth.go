@@ -0,0 +1,78 @@
+package decoder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxJSONDepth limits the nesting of the objects and arrays of a JSON body,
+// so that a small document cannot exhaust the stack or memory of the decoder.
+// Zero means no limit. See WithMaxJSONDepth for the limit of one request.
+var MaxJSONDepth = 100
+
+// ErrTooDeep is returned when a JSON body is nested more deeply than
+// MaxJSONDepth
+var ErrTooDeep = fmt.Errorf("JSON is nested too deeply")
+
+// contextKey is the type of the keys this package stores in a request context
+type contextKey int
+
+const maxJSONDepthKey contextKey = iota
+
+// WithMaxJSONDepth returns a request whose JSON body may be nested depth
+// deep, overriding MaxJSONDepth. A negative depth means no limit.
+func WithMaxJSONDepth(req *http.Request, depth int) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), maxJSONDepthKey, depth))
+}
+
+// maxJSONDepth returns the limit on the nesting of the JSON body of req
+func maxJSONDepth(req *http.Request) int {
+	if depth, ok := req.Context().Value(maxJSONDepthKey).(int); ok {
+		return depth
+	}
+
+	return MaxJSONDepth
+}
+
+// depthReader scans the JSON read through it and fails with ErrTooDeep once
+// it is nested more than max deep, before the decoder has built the values
+type depthReader struct {
+	r   io.Reader
+	max int
+
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// Read is part of the io.Reader interface
+func (d *depthReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+
+	for _, c := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString:
+			switch c {
+			case '\\':
+				d.escaped = true
+			case '"':
+				d.inString = false
+			}
+		case c == '"':
+			d.inString = true
+		case c == '{' || c == '[':
+			d.depth++
+			if d.depth > d.max {
+				return 0, ErrTooDeep
+			}
+		case c == '}' || c == ']':
+			d.depth--
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,35 @@
+package decoder
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMaxJSONDepth(t *testing.T) {
+	tests := []struct {
+		body  string
+		depth int
+		err   error
+	}{
+		{`{"name":"foo","tags":["a"]}`, 2, nil},
+		{`{"name":"foo","tags":[["a"]]}`, 2, ErrTooDeep},
+		{`{"name":"[[[{{{","tags":["\"[[["]}`, 2, nil},
+		{strings.Repeat("[", 1000) + strings.Repeat("]", 1000), 0, ErrTooDeep},
+		{`{"tags":[[["a"]]]}`, -1, nil},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		if test.depth != 0 {
+			req = WithMaxJSONDepth(req, test.depth)
+		}
+
+		var v interface{}
+		if err := Decode(req, &v); !errors.Is(err, test.err) {
+			t.Errorf("Decode(%.40s) depth %d = %v, expected %v", test.body, test.depth, err, test.err)
+		}
+	}
+}
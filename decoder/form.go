@@ -0,0 +1,177 @@
+package decoder
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MaxMultipartMemory is the number of bytes of a multipart/form-data body
+// that are held in memory, the remainder of any files being stored on disk
+var MaxMultipartMemory int64 = 32 << 20
+
+var fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+
+// formDecode decodes an application/x-www-form-urlencoded body. v may be a
+// *url.Values, a *map[string]string or a pointer to a struct, see setForm.
+func formDecode(req *http.Request, v interface{}) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+
+	return setForm(v, req.PostForm, nil)
+}
+
+// multipartDecode decodes a multipart/form-data body as formDecode does, and
+// also sets struct fields of type *multipart.FileHeader or
+// []*multipart.FileHeader from the uploaded files. Files stored on disk are
+// removed once the context of the request is done, which is when the server
+// has served it, as net/http only removes those of the request it passed to
+// the handler and not of copies made with WithContext.
+func multipartDecode(req *http.Request, v interface{}) error {
+	if err := req.ParseMultipartForm(MaxMultipartMemory); err != nil {
+		return err
+	}
+
+	if done := req.Context().Done(); done != nil {
+		form := req.MultipartForm
+		go func() {
+			<-done
+			form.RemoveAll()
+		}()
+	}
+
+	return setForm(v, req.MultipartForm.Value, req.MultipartForm.File)
+}
+
+// setForm sets v from the form values and files. The fields of a struct are
+// named by a form tag, or else a json tag, or else the field name, and may
+// be strings, bools, numbers or slices of them.
+func setForm(
+	v interface{},
+	values url.Values,
+	files map[string][]*multipart.FileHeader,
+) error {
+	switch t := v.(type) {
+	case *url.Values:
+		*t = values
+		return nil
+	case *map[string]string:
+		if *t == nil {
+			*t = make(map[string]string)
+		}
+		for k := range values {
+			(*t)[k] = values.Get(k)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode a form into %T", v)
+	}
+	rv = rv.Elem()
+
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := formName(field)
+		if name == "-" {
+			continue
+		}
+
+		f := rv.Field(i)
+		if fh, ok := files[name]; ok && len(fh) > 0 {
+			switch {
+			case f.Type() == fileHeaderType:
+				f.Set(reflect.ValueOf(fh[0]))
+				continue
+			case f.Kind() == reflect.Slice && f.Type().Elem() == fileHeaderType:
+				f.Set(reflect.ValueOf(fh))
+				continue
+			}
+		}
+
+		vs, ok := values[name]
+		if !ok || len(vs) == 0 {
+			continue
+		}
+
+		if f.Kind() == reflect.Slice {
+			s := reflect.MakeSlice(f.Type(), len(vs), len(vs))
+			for j, value := range vs {
+				if err := setValue(s.Index(j), value); err != nil {
+					return fmt.Errorf("%s: %s", name, err)
+				}
+			}
+			f.Set(s)
+			continue
+		}
+
+		if err := setValue(f, vs[0]); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// formName returns the name of the form value for a struct field
+func formName(field reflect.StructField) string {
+	for _, tag := range []string{"form", "json"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// setValue parses a form value into a field
+func setValue(f reflect.Value, value string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Ptr:
+		p := reflect.New(f.Type().Elem())
+		if err := setValue(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+	default:
+		return fmt.Errorf("cannot decode a form value into %s", f.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+)
+
+// HealthCheckInterval, if not zero, is the interval at which Run runs the
+// health checks in the background, so that the degraded state of each
+// dependency stays current when /_heartbeat is not polled
+var HealthCheckInterval time.Duration
+
+// Degraded returns true if the dependency is degraded for the WebService
+// serving the request of ctx: its health check failed when last run, or it
+// was marked degraded with SetDegraded. Handlers use it to serve cached or
+// partial responses instead of failing during partial outages, i.e.
+//
+//	if service.Degraded(req.Context(), "billing-db") {
+//		render.JSON(w, http.StatusOK, cachedInvoices)
+//		return
+//	}
+func Degraded(ctx context.Context, dependency string) bool {
+	h, ok := ctx.Value(healthKey).(*healthChecks)
+	if !ok {
+		return false
+	}
+
+	return h.isDegraded(dependency)
+}
+
+// Degraded returns true if the dependency is degraded, for code that does not
+// serve a request, such as a worker
+func (ws *WebService) Degraded(dependency string) bool {
+	if ws.health == nil {
+		return false
+	}
+
+	return ws.health.isDegraded(dependency)
+}
+
+// SetDegraded marks a dependency degraded, or not, regardless of its health
+// check, i.e. from a circuit breaker or by an operator during an incident
+func (ws *WebService) SetDegraded(dependency string, degraded bool) {
+	if ws.health == nil {
+		ws.health = &healthChecks{critical: make(map[string]bool)}
+	}
+
+	ws.health.mu.Lock()
+	defer ws.health.mu.Unlock()
+
+	if ws.health.forced == nil {
+		ws.health.forced = make(map[string]bool)
+	}
+	if degraded {
+		ws.health.forced[dependency] = true
+	} else {
+		delete(ws.health.forced, dependency)
+	}
+
+	ws.health.publish(dependency)
+}
+
+// isDegraded returns true if the dependency is degraded
+func (h *healthChecks) isDegraded(dependency string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.failed[dependency] || h.forced[dependency]
+}
+
+// degraded returns the names of the degraded dependencies, sorted
+func (h *healthChecks) degraded() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	names := []string{}
+	for name, failed := range h.failed {
+		if failed && !h.forced[name] {
+			names = append(names, name)
+		}
+	}
+	for name := range h.forced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// setFailed records the outcome of the health check of a dependency, logging
+// the dependency entering and leaving the degraded state. The caller holds
+// the write lock.
+func (h *healthChecks) setFailed(dependency string, failed bool) {
+	if h.failed == nil {
+		h.failed = make(map[string]bool)
+	}
+
+	if h.failed[dependency] != failed {
+		if failed {
+			log.Warningf("dependency %s is degraded", dependency)
+		} else {
+			log.Infof("dependency %s has recovered", dependency)
+		}
+	}
+	h.failed[dependency] = failed
+
+	h.publish(dependency)
+}
+
+// publish sets the dependency_degraded metric of a dependency. The caller
+// holds the write lock.
+func (h *healthChecks) publish(dependency string) {
+	var v int64
+	if h.failed[dependency] || h.forced[dependency] {
+		v = 1
+	}
+
+	metrics.Set("dependency_degraded", v, "dependency", dependency)
+}
+
+// middleware returns the handler with the health checks in the context of
+// each request, for Degraded
+func (h *healthChecks) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), healthKey, h)))
+	})
+}
+
+// poll runs the checks every interval until stop is closed
+func (h *healthChecks) poll(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			h.run(context.Background())
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDegraded(t *testing.T) {
+	ws := NewWebService()
+
+	var failing error
+	ws.AddHealthCheck(HealthCheck("billing-db", func(ctx context.Context) error {
+		return failing
+	}), false)
+
+	wc := NewWebController("/invoices")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		if Degraded(req.Context(), "billing-db") {
+			w.WriteHeader(http.StatusNonAuthoritativeInfo)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(wc)
+
+	h := ws.Handler()
+	get := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/invoices", nil))
+		return rec.Code
+	}
+
+	if code := get(); code != http.StatusOK {
+		t.Errorf("GET before any check = %d, expected 200", code)
+	}
+
+	failing = errors.New("connection refused")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", HeartbeatRoute, nil))
+	if code := get(); code != http.StatusNonAuthoritativeInfo {
+		t.Errorf("GET after a failed check = %d, expected the degraded response", code)
+	}
+
+	failing = nil
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", HeartbeatRoute, nil))
+	if code := get(); code != http.StatusOK {
+		t.Errorf("GET after the check recovered = %d, expected 200", code)
+	}
+
+	ws.SetDegraded("billing-db", true)
+	if code := get(); code != http.StatusNonAuthoritativeInfo || !ws.Degraded("billing-db") {
+		t.Errorf("GET when marked degraded = %d, expected the degraded response", code)
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Deprecate marks a method of the controller as deprecated. Responses to the
+// method carry a "Deprecation: true" header and the method is listed as
+// deprecated in the endpoint index.
+func (wc *WebController) Deprecate(m int) {
+	if wc.deprecated == nil {
+		wc.deprecated = make(map[int]bool)
+	}
+
+	wc.deprecated[m] = true
+}
+
+// deprecatedMethods returns the names of the deprecated methods, sorted
+func (wc *WebController) deprecatedMethods() []string {
+	names := []string{}
+	for m := range wc.deprecated {
+		names = append(names, GetMethodName(m))
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	return names
+}
+
+// applyDeprecation sets the Deprecation header if the method is deprecated
+func (wc *WebController) applyDeprecation(w http.ResponseWriter, m int) {
+	if m == Head {
+		m = Get
+	}
+
+	if wc.deprecated[m] {
+		w.Header().Set("Deprecation", "true")
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/service/render"
+)
+
+// DocsRoute is the path to the generated documentation of the controllers
+var DocsRoute string = `/_docs`
+
+// Example is an example request to a controller and the response to it, which
+// is published at DocsRoute
+type Example struct {
+	Description string `json:"description,omitempty"`
+
+	// Path is the path requested, i.e. /users/42, or the route if empty
+	Path string `json:"path,omitempty"`
+
+	// Request and Response are the bodies, which are rendered as JSON
+	Request  interface{} `json:"request,omitempty"`
+	Status   int         `json:"status"`
+	Response interface{} `json:"response,omitempty"`
+}
+
+// AddExample attaches an example of a method of the controller to the
+// documentation
+func (wc *WebController) AddExample(m int, e Example) {
+	if wc.examples == nil {
+		wc.examples = make(map[int][]Example)
+	}
+
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+
+	wc.examples[m] = append(wc.examples[m], e)
+}
+
+// MethodDoc documents a method of a route
+type MethodDoc struct {
+	Method     string    `json:"method"`
+	Deprecated bool      `json:"deprecated,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	Examples   []Example `json:"examples,omitempty"`
+}
+
+// RouteDoc documents a route
+type RouteDoc struct {
+	URL     string      `json:"href"`
+	Methods []MethodDoc `json:"methods"`
+}
+
+// docs returns the documentation of the service's own routes, in the order
+// they are matched
+func (ws *WebService) docs() []RouteDoc {
+	docs := []RouteDoc{}
+
+	for _, wc := range ws.routes() {
+		if isAdminRoute(wc.Route) {
+			continue
+		}
+
+		names := strings.Split(wc.GetAllowedMethods(), ",")
+		sort.Strings(names)
+
+		d := RouteDoc{URL: wc.Route, Methods: []MethodDoc{}}
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			m := GetMethodID(name)
+
+			md := MethodDoc{
+				Method:     name,
+				Deprecated: wc.deprecated[m],
+				Scopes:     wc.requiredScopes(m),
+				Examples:   wc.examples[m],
+			}
+			d.Methods = append(d.Methods, md)
+		}
+
+		docs = append(docs, d)
+	}
+
+	return docs
+}
+
+// docsHandler serves the documentation as JSON, or as HTML to browsers and
+// for ?format=html
+func (ws *WebService) docsHandler() http.Handler {
+	docs := ws.docs()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("format") != "html" &&
+			!strings.Contains(req.Header.Get("Accept"), "text/html") {
+			render.JSON(w, http.StatusOK, docs)
+			return
+		}
+
+		render.SetHeaders(w)
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		if err := docsTemplate.Execute(w, docs); err != nil {
+			ReportError(req, err)
+		}
+	})
+}
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"json": func(v interface{}) string {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		return string(b)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>API documentation</title></head>
+<body>
+{{range .}}<h2>{{.URL}}</h2>
+{{range .Methods}}<h3>{{.Method}}{{if .Deprecated}} (deprecated){{end}}</h3>
+{{if .Scopes}}<p>Requires scopes: {{range .Scopes}}<code>{{.}}</code> {{end}}</p>{{end}}
+{{range .Examples}}<h4>{{if .Description}}{{.Description}}{{else}}Example{{end}}</h4>
+{{if .Path}}<p><code>{{.Path}}</code></p>{{end}}
+{{if .Request}}<pre>{{json .Request}}</pre>{{end}}
+<p>{{.Status}}</p>
+{{if .Response}}<pre>{{json .Response}}</pre>{{end}}
+{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
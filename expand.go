@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Expansions is the set of related resources that a request has asked to be
+// embedded in the response via the ?expand=owner,rules query parameter
+type Expansions map[string]bool
+
+// Has returns true if the named resource should be embedded
+func (e Expansions) Has(name string) bool {
+	return e[name]
+}
+
+// AllowExpand declares the related resources that clients may ask to have
+// embedded with the ?expand= query parameter. Requests naming other resources
+// are rejected with 400 Bad Request. The allowed expansions are listed in the
+// endpoint index, and handlers retrieve the request's expansions with
+// service.Expand(req).
+func (wc *WebController) AllowExpand(names ...string) {
+	wc.expand = append(wc.expand, names...)
+}
+
+// ParseExpand returns the expansions requested by the expand query parameter,
+// validated against the allowed expansions
+func ParseExpand(query url.Values, allowed []string) (Expansions, int, error) {
+	names, status, err := parseList(query, "expand", allowed)
+	if err != nil {
+		return nil, status, err
+	}
+
+	e := make(Expansions, len(names))
+	for _, name := range names {
+		e[name] = true
+	}
+
+	return e, status, nil
+}
+
+// Expand returns the expansions requested by the request. It is never nil.
+func Expand(req *http.Request) Expansions {
+	if e, ok := req.Context().Value(expandKey).(Expansions); ok {
+		return e
+	}
+
+	return Expansions{}
+}
+
+// withExpand parses and validates the expansions requested for the
+// controller, storing them in the request context
+func (wc *WebController) withExpand(req *http.Request) (*http.Request, int, error) {
+	if len(wc.expand) == 0 {
+		return req, http.StatusOK, nil
+	}
+
+	e, status, err := ParseExpand(req.URL.Query(), wc.expand)
+	if err != nil {
+		return req, status, err
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), expandKey, e)), status, nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// ExpectContinue returns Middleware that runs check before the body of a
+// request is read. net/http only sends "100 Continue" once a handler first
+// reads the body, so a client that sent "Expect: 100-continue" and fails the
+// check is rejected without uploading the body. check returns the status and
+// error to reject the request with, or a nil error to allow it.
+//
+// Add ExpectContinue after any authentication middleware so that both run
+// before the upload begins. Controller scopes are checked before the
+// handler runs, and so also before the body is read.
+func ExpectContinue(check func(req *http.Request) (int, error)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			status, err := check(req)
+			if err == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if expectsContinue(req) && req.ContentLength > 0 {
+				metrics.Inc("expect_continue_rejected")
+				metrics.Add("expect_continue_bytes_saved", req.ContentLength)
+			}
+
+			render.Error(w, status, err)
+		})
+	}
+}
+
+// MaxContentLength returns a check for ExpectContinue that rejects requests
+// that declare a body larger than n bytes with a 413
+func MaxContentLength(n int64) func(req *http.Request) (int, error) {
+	return func(req *http.Request) (int, error) {
+		if req.ContentLength > n {
+			return http.StatusRequestEntityTooLarge,
+				fmt.Errorf("Content-Length %d exceeds the maximum of %d", req.ContentLength, n)
+		}
+
+		return http.StatusOK, nil
+	}
+}
+
+// expectsContinue returns true if the client is waiting for "100 Continue"
+// before sending the body
+func expectsContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+}
@@ -0,0 +1,262 @@
+// Package exports serves large exports, such as reports, as files that can be
+// downloaded in parts. A handler or a job writes the export to a Spool, and
+// the Spool serves it at a signed URL that expires, with support for Range
+// requests so that an interrupted download can be resumed.
+package exports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service"
+	"github.com/cloudflare/service/render"
+)
+
+// Artifact describes an export that has been written to a Spool
+type Artifact struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Created     time.Time `json:"created"`
+	Expires     time.Time `json:"expires"`
+	URL         string    `json:"href"`
+}
+
+// Spool holds exports in a directory until they expire. A directory shared
+// by the instances of a service, with the same secret, allows any instance to
+// serve an export.
+type Spool struct {
+	route  string
+	dir    string
+	secret []byte
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewSpool returns a Spool that writes exports to dir and serves them beneath
+// route, i.e. "/exports", for ttl. Download URLs are signed with secret, so
+// that only those given the URL may download an export.
+func NewSpool(route string, dir string, secret []byte, ttl time.Duration) (*Spool, error) {
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("secret must be at least 16 bytes")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Spool{
+		route:  strings.TrimSuffix(route, "/"),
+		dir:    dir,
+		secret: secret,
+		ttl:    ttl,
+	}, nil
+}
+
+// Export writes an export named name, i.e. "report.json", by calling write,
+// and returns the Artifact with its download URL. If write fails nothing is
+// kept. It may be called by a handler, or by a job for a slow export.
+func (s *Spool) Export(
+	ctx context.Context,
+	name string,
+	contentType string,
+	write func(ctx context.Context, w io.Writer) error,
+) (Artifact, error) {
+	s.sweep()
+
+	id, err := newID()
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	f, err := os.CreateTemp(s.dir, "."+id+"-*")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(ctx, f); err != nil {
+		f.Close()
+		return Artifact{}, err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		f.Close()
+		return Artifact{}, err
+	}
+
+	if err := f.Close(); err != nil {
+		return Artifact{}, err
+	}
+
+	now := time.Now().UTC()
+	a := Artifact{
+		ID:          id,
+		Name:        filepath.Base(name),
+		ContentType: contentType,
+		Size:        size,
+		Created:     now,
+		Expires:     now.Add(s.ttl),
+	}
+
+	meta, err := json.Marshal(a)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if err := os.WriteFile(s.path(id, ".json"), meta, 0600); err != nil {
+		return Artifact{}, err
+	}
+
+	if err := os.Rename(f.Name(), s.path(id, ".data")); err != nil {
+		os.Remove(s.path(id, ".json"))
+		return Artifact{}, err
+	}
+
+	a.URL = s.url(a)
+	return a, nil
+}
+
+// Controller returns a WebController for the route "{route}/{id}" that
+// serves exports to requests with a valid signature. Range and If-Range
+// requests are supported. Expired exports are 410 Gone.
+func (s *Spool) Controller() service.WebController {
+	wc := service.NewWebController(s.route + "/{id}")
+
+	wc.AddMethodHandler(service.Get, func(w http.ResponseWriter, req *http.Request) {
+		id := service.Vars(req)["id"]
+
+		expires, err := strconv.ParseInt(req.URL.Query().Get("expires"), 10, 64)
+		if err != nil || !hmac.Equal([]byte(req.URL.Query().Get("signature")), []byte(s.sign(id, expires))) {
+			render.Error(w, http.StatusForbidden, fmt.Errorf("the download URL is not valid"))
+			return
+		}
+
+		if time.Now().Unix() > expires {
+			render.Error(w, http.StatusGone, fmt.Errorf("export %s has expired", id))
+			return
+		}
+
+		a, ok, err := s.load(id)
+		if err != nil {
+			service.ReportError(req, err)
+			render.Error(w, http.StatusInternalServerError, fmt.Errorf("export could not be loaded"))
+			return
+		}
+
+		if !ok {
+			render.Error(w, http.StatusNotFound, fmt.Errorf("export %s not found", id))
+			return
+		}
+
+		f, err := os.Open(s.path(id, ".data"))
+		if err != nil {
+			render.Error(w, http.StatusNotFound, fmt.Errorf("export %s not found", id))
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.Name))
+		w.Header().Set("ETag", `"`+a.ID+`"`)
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		// ServeContent handles Range, If-Range and the conditional headers
+		http.ServeContent(w, req, a.Name, a.Created, f)
+	})
+
+	return wc
+}
+
+// load returns the Artifact with the id, if it exists and has not expired
+func (s *Spool) load(id string) (Artifact, bool, error) {
+	b, err := os.ReadFile(s.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return Artifact{}, false, nil
+	}
+	if err != nil {
+		return Artifact{}, false, err
+	}
+
+	a := Artifact{}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return Artifact{}, false, err
+	}
+
+	if time.Now().After(a.Expires) {
+		return Artifact{}, false, nil
+	}
+
+	a.URL = s.url(a)
+	return a, true, nil
+}
+
+// sweep removes expired exports, at most once a minute
+func (s *Spool) sweep() {
+	s.mu.Lock()
+	if time.Since(s.swept) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.swept = time.Now()
+	s.mu.Unlock()
+
+	metas, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, meta := range metas {
+		id := strings.TrimSuffix(filepath.Base(meta), ".json")
+		if _, ok, err := s.load(id); err == nil && !ok {
+			os.Remove(s.path(id, ".data"))
+			os.Remove(meta)
+		}
+	}
+}
+
+// path returns the path of a file of an export
+func (s *Spool) path(id string, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// url returns the signed download URL of an export
+func (s *Spool) url(a Artifact) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(a.Expires.Unix(), 10))
+	q.Set("signature", s.sign(a.ID, a.Expires.Unix()))
+
+	return s.route + "/" + a.ID + "?" + q.Encode()
+}
+
+// sign returns the signature of a download URL
+func (s *Spool) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + ":" + strconv.FormatInt(expires, 10)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newID returns a random export identifier
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
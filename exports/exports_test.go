@@ -0,0 +1,61 @@
+package exports
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service"
+)
+
+func TestSpool(t *testing.T) {
+	spool, err := NewSpool("/exports", t.TempDir(), []byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := spool.Export(context.Background(), "report.json", "application/json",
+		func(ctx context.Context, w io.Writer) error {
+			_, err := io.WriteString(w, `[1,2,3,4,5,6,7,8,9]`)
+			return err
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size != 19 || !strings.HasPrefix(a.URL, "/exports/"+a.ID+"?") {
+		t.Errorf("Export() = %+v", a)
+	}
+
+	ws := service.NewWebService()
+	ws.AddWebController(spool.Controller())
+	h := ws.Handler()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", a.URL, nil)
+	req.Header.Set("Range", "bytes=3-6")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2,3," {
+		t.Errorf("GET with Range = %d %q, expected %d %q", rec.Code, rec.Body.String(), http.StatusPartialContent, "2,3,")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", strings.Replace(a.URL, "signature=", "signature=0", 1), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET with a bad signature = %d, expected %d", rec.Code, http.StatusForbidden)
+	}
+
+	_, err = spool.Export(context.Background(), "failed.json", "application/json",
+		func(ctx context.Context, w io.Writer) error {
+			return fmt.Errorf("query failed")
+		},
+	)
+	if err == nil {
+		t.Errorf("Export() should return the error of write")
+	}
+}
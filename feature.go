@@ -0,0 +1,41 @@
+package service
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/cloudflare/service/log"
+)
+
+// FeatureEnabled returns true if the feature flag is on. By default a flag is
+// the name of an environment variable that is on when set to a true value
+// such as "true" or "1". Replace it to use another source of flags. It is
+// consulted when the router is built.
+var FeatureEnabled = func(flag string) bool {
+	on, _ := strconv.ParseBool(os.Getenv(flag))
+	return on
+}
+
+// SetFeatureFlag gates the controller behind a feature flag, see
+// FeatureEnabled, so that an experimental endpoint can ship dark and be
+// enabled per environment. When the flag is off the controller's routes are
+// not registered, and so respond 404 Not Found, and are omitted from the
+// endpoint index and documentation.
+func (wc *WebController) SetFeatureFlag(flag string) {
+	wc.featureFlag = flag
+}
+
+// enabled returns true if the controller is not gated by a feature flag, or
+// its flag is on
+func (wc *WebController) enabled() bool {
+	return wc.featureFlag == "" || FeatureEnabled(wc.featureFlag)
+}
+
+// logDisabled logs the controllers that are disabled by their feature flags
+func (ws *WebService) logDisabled() {
+	for _, wc := range ws.controllers {
+		if !wc.enabled() {
+			log.Infof("%s is disabled by feature flag %s", wc.Route, wc.featureFlag)
+		}
+	}
+}
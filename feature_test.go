@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFeatureFlag(t *testing.T) {
+	newService := func() http.Handler {
+		ws := NewWebService()
+		wc := NewWebController("/search")
+		wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		wc.SetFeatureFlag("TEST_FEATURE_SEARCH")
+		ws.AddWebController(wc)
+		return ws.Handler()
+	}
+
+	os.Unsetenv("TEST_FEATURE_SEARCH")
+	h := newService()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/search", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /search with the flag off = %d, expected 404", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(rec.Body.String(), "/search") {
+		t.Errorf("the index should omit a disabled route: %s", rec.Body.String())
+	}
+
+	os.Setenv("TEST_FEATURE_SEARCH", "true")
+	defer os.Unsetenv("TEST_FEATURE_SEARCH")
+	h = newService()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/search", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /search with the flag on = %d, expected 200", rec.Code)
+	}
+}
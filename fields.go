@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowFields declares the fields of the resource that clients may select with
+// the ?fields=name,id query parameter. Requests naming other fields are
+// rejected with 400 Bad Request. Handlers retrieve the selection with
+// service.Fields(req) and render with render.JSONFields.
+func (wc *WebController) AllowFields(fields ...string) {
+	wc.fields = append(wc.fields, fields...)
+}
+
+// ParseFields returns the fields selected by the fields query parameter,
+// validated against the allowed fields. No selection returns nil, meaning all
+// fields.
+func ParseFields(query url.Values, allowed []string) ([]string, int, error) {
+	return parseList(query, "fields", allowed)
+}
+
+// parseList returns the comma-delimited values of a query parameter, each
+// validated against the allowed values. An absent parameter returns nil.
+func parseList(query url.Values, param string, allowed []string) ([]string, int, error) {
+	if query.Get(param) == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	permitted := make(map[string]bool, len(allowed))
+	for _, a := range allowed {
+		permitted[a] = true
+	}
+
+	values := []string{}
+	for _, v := range strings.Split(query.Get(param), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !permitted[v] {
+			return nil, http.StatusBadRequest,
+				fmt.Errorf("%s (%s) is not one of: %s", param, v, strings.Join(allowed, ","))
+		}
+
+		values = append(values, v)
+	}
+
+	return values, http.StatusOK, nil
+}
+
+// Fields returns the fields selected by the request, or nil if the request
+// did not select fields and all fields should be rendered
+func Fields(req *http.Request) []string {
+	fields, _ := req.Context().Value(fieldsKey).([]string)
+	return fields
+}
+
+// withFields parses and validates the fields selected by a request for the
+// controller, storing them in the request context
+func (wc *WebController) withFields(req *http.Request) (*http.Request, int, error) {
+	if len(wc.fields) == 0 {
+		return req, http.StatusOK, nil
+	}
+
+	fields, status, err := ParseFields(req.URL.Query(), wc.fields)
+	if err != nil || fields == nil {
+		return req, status, err
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), fieldsKey, fields)), status, nil
+}
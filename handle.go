@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/render"
+)
+
+// Validator is implemented by request bodies that validate themselves. Handle
+// rejects a body that fails validation with 400 Bad Request.
+type Validator interface {
+	Validate() error
+}
+
+// StatusCoder is implemented by errors and responses that choose the status
+// that Handle writes them with
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Handle adapts a typed function to a handler for AddMethodHandler. The body
+// of the request, if any, is decoded into a Req with decoder.Decode and
+// validated if Req is a Validator, then fn is called with the request context
+// and the Resp rendered as JSON with the render options of the request, i.e.
+//
+//	wc.AddMethodHandler(service.Post, service.Handle(createThing))
+//
+//	func createThing(ctx context.Context, t Thing) (Thing, error)
+//
+// The response is written with 200 OK unless Resp is a StatusCoder. An error
+// is written with the status of a StatusCoder, or 504 Gateway Timeout if the
+// deadline of the request was exceeded, and 500 otherwise. The path
+// variables are available to fn with VarsFromContext.
+func Handle[Req any, Resp any](
+	fn func(ctx context.Context, req Req) (Resp, error),
+) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var in Req
+		if hasBody(req) {
+			if err := decoder.Decode(req, &in); err != nil {
+				render.Error(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		if v, ok := any(&in).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				render.Error(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		req = WithVars(req, Vars(req))
+
+		out, err := fn(req.Context(), in)
+		if err != nil {
+			render.Error(w, errorStatus(err), err)
+			return
+		}
+
+		status := http.StatusOK
+		if sc, ok := any(out).(StatusCoder); ok {
+			status = sc.StatusCode()
+		}
+
+		render.Request(w, req, status, out)
+	}
+}
+
+// errorStatus returns the status to write an error from a handler with
+func errorStatus(err error) int {
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
+
+// VarsFromContext returns the path variables of the route that matched the
+// request of a function adapted by Handle
+func VarsFromContext(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(varsKey).(map[string]string)
+	return vars
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createWidget struct {
+	Name string `json:"name"`
+}
+
+func (c *createWidget) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type widgetCreated struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (widgetCreated) StatusCode() int {
+	return http.StatusCreated
+}
+
+type conflict struct{}
+
+func (conflict) Error() string   { return "widget exists" }
+func (conflict) StatusCode() int { return http.StatusConflict }
+
+func TestHandle(t *testing.T) {
+	h := Handle(func(ctx context.Context, c createWidget) (widgetCreated, error) {
+		if c.Name == "taken" {
+			return widgetCreated{}, fmt.Errorf("create: %w", conflict{})
+		}
+		return widgetCreated{ID: VarsFromContext(ctx)["shop"] + "-1", Name: c.Name}, nil
+	})
+
+	wc := NewWebController("/shops/{shop}/widgets")
+	wc.AddMethodHandler(Post, h)
+	ws := NewWebService()
+	ws.AddWebController(wc)
+	handler := ws.Handler()
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+		contains    string
+	}{
+		{"application/json", `{"name":"sprocket"}`, http.StatusCreated, `"id": "acme-1"`},
+		{"application/json", `{}`, http.StatusBadRequest, "name is required"},
+		{"application/json", `{"name":`, http.StatusBadRequest, "error"},
+		{"text/csv", `name`, http.StatusUnsupportedMediaType, "supported"},
+		{"application/json", `{"name":"taken"}`, http.StatusConflict, "widget exists"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/shops/acme/widgets", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.status || !strings.Contains(rec.Body.String(), test.contains) {
+			t.Errorf("POST %s %s = %d %s, expected %d with %q",
+				test.contentType, test.body, rec.Code, rec.Body.String(), test.status, test.contains)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// headerRule is a requirement on a request header declared with
+// RequireHeader, ForbidHeader or RequireContentType
+type headerRule struct {
+	name      string
+	values    []string
+	forbidden bool
+	bodyOnly  bool
+}
+
+// HeaderError is the response to a request that fails a header requirement
+// of a controller. Reason is one of "missing", "forbidden" or "invalid", and
+// Allowed lists the values the header may take, if restricted.
+type HeaderError struct {
+	Message string   `json:"error"`
+	Header  string   `json:"header"`
+	Reason  string   `json:"reason"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// RequireHeader declares a header that requests to the controller must have,
+// i.e. X-Api-Version, and if values are given the values it may take, which
+// are compared case-insensitively. Requests without it are rejected with 400
+// Bad Request before the handler runs.
+func (wc *WebController) RequireHeader(name string, values ...string) {
+	wc.headers = append(wc.headers, headerRule{
+		name:   http.CanonicalHeaderKey(name),
+		values: values,
+	})
+}
+
+// ForbidHeader declares a header that requests to the controller must not
+// have. Requests with it are rejected with 400 Bad Request.
+func (wc *WebController) ForbidHeader(name string) {
+	wc.headers = append(wc.headers, headerRule{
+		name:      http.CanonicalHeaderKey(name),
+		forbidden: true,
+	})
+}
+
+// RequireContentType declares the media types of the bodies the controller
+// accepts, i.e. application/json. Requests with a body of another type, or
+// without a Content-Type, are rejected with 415 Unsupported Media Type.
+// Parameters such as charset are ignored. Requests without a body are not
+// checked.
+func (wc *WebController) RequireContentType(types ...string) {
+	wc.headers = append(wc.headers, headerRule{
+		name:     "Content-Type",
+		values:   types,
+		bodyOnly: true,
+	})
+}
+
+// checkHeaders validates a request against the controller's header
+// requirements, writing a HeaderError and returning false if it fails one.
+// Each rejection is counted by the requests_header_rejected metric.
+func (wc *WebController) checkHeaders(w http.ResponseWriter, req *http.Request) bool {
+	for _, rule := range wc.headers {
+		if rule.bodyOnly && !hasBody(req) {
+			continue
+		}
+
+		status, e := rule.check(req.Header)
+		if e == nil {
+			continue
+		}
+
+		metrics.Inc("requests_header_rejected", "route", wc.Route, "header", rule.name, "reason", e.Reason)
+		render.JSON(w, status, e)
+
+		return false
+	}
+
+	return true
+}
+
+// check returns the status and HeaderError to reject a request with, or a nil
+// HeaderError if the headers satisfy the rule
+func (rule headerRule) check(h http.Header) (int, *HeaderError) {
+	status := http.StatusBadRequest
+	if rule.name == "Content-Type" {
+		status = http.StatusUnsupportedMediaType
+	}
+
+	value := h.Get(rule.name)
+	_, present := h[rule.name]
+
+	if rule.forbidden {
+		if !present {
+			return http.StatusOK, nil
+		}
+
+		return http.StatusBadRequest, &HeaderError{
+			Message: fmt.Sprintf("header %s is not allowed", rule.name),
+			Header:  rule.name,
+			Reason:  "forbidden",
+		}
+	}
+
+	if !present {
+		return status, &HeaderError{
+			Message: fmt.Sprintf("header %s is required", rule.name),
+			Header:  rule.name,
+			Reason:  "missing",
+			Allowed: rule.values,
+		}
+	}
+
+	if len(rule.values) == 0 {
+		return http.StatusOK, nil
+	}
+
+	if rule.name == "Content-Type" {
+		if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+			value = mediaType
+		}
+	}
+
+	for _, v := range rule.values {
+		if strings.EqualFold(strings.TrimSpace(value), v) {
+			return http.StatusOK, nil
+		}
+	}
+
+	return status, &HeaderError{
+		Message: fmt.Sprintf("header %s (%s) is not one of: %s", rule.name, value, strings.Join(rule.values, ",")),
+		Header:  rule.name,
+		Reason:  "invalid",
+		Allowed: rule.values,
+	}
+}
+
+// hasBody returns true if the request has a body, or may have one as its
+// length is unknown
+func hasBody(req *http.Request) bool {
+	return req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderRequirements(t *testing.T) {
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Post, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	wc.RequireContentType("application/json")
+	wc.RequireHeader("X-Api-Version", "1", "2")
+	wc.ForbidHeader("X-Legacy")
+	h := http.HandlerFunc(GetHandler(wc))
+
+	tests := []struct {
+		headers map[string]string
+		status  int
+		reason  string
+	}{
+		{map[string]string{"Content-Type": "application/json; charset=utf-8", "X-Api-Version": "2"}, http.StatusCreated, ""},
+		{map[string]string{"Content-Type": "text/plain", "X-Api-Version": "2"}, http.StatusUnsupportedMediaType, "invalid"},
+		{map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest, "missing"},
+		{map[string]string{"Content-Type": "application/json", "X-Api-Version": "3"}, http.StatusBadRequest, "invalid"},
+		{map[string]string{"Content-Type": "application/json", "X-Api-Version": "1", "X-Legacy": "yes"}, http.StatusBadRequest, "forbidden"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(`{}`))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("POST with %v = %d, expected %d", test.headers, rec.Code, test.status)
+			continue
+		}
+		if test.reason == "" {
+			continue
+		}
+
+		var e HeaderError
+		if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Reason != test.reason {
+			t.Errorf("POST with %v = %s, expected reason %q", test.headers, rec.Body.String(), test.reason)
+		}
+	}
+}
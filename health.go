@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheckTimeout limits the time that the checks behind /_heartbeat may
+// take
+var HealthCheckTimeout = 5 * time.Second
+
+// HealthChecker checks a dependency of the service, such as a database or an
+// upstream API. Check returns nil if the dependency is healthy.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// healthCheckFunc adapts a function to a HealthChecker
+type healthCheckFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (h healthCheckFunc) Name() string {
+	return h.name
+}
+
+func (h healthCheckFunc) Check(ctx context.Context) error {
+	return h.fn(ctx)
+}
+
+// HealthCheck returns a HealthChecker named name that calls fn
+func HealthCheck(name string, fn func(ctx context.Context) error) HealthChecker {
+	return healthCheckFunc{name: name, fn: fn}
+}
+
+// CheckResult is the outcome of a single health check
+type CheckResult struct {
+	Healthy    bool    `json:"healthy"`
+	Critical   bool    `json:"critical"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"durationMs"`
+}
+
+// Health is the response of /_heartbeat. Status is "ok" when every check
+// passes, "degraded" when only non-critical checks fail and "failed" when a
+// critical check fails.
+type Health struct {
+	Version
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+
+	// Degraded lists the dependencies that are degraded, see Degraded
+	Degraded []string `json:"degraded,omitempty"`
+}
+
+// healthChecks holds the checks registered with a WebService. It is shared by
+// copies of the WebService so that checks added after NewWebService are seen
+// by the heartbeat controller.
+type healthChecks struct {
+	mu       sync.RWMutex
+	checks   []HealthChecker
+	critical map[string]bool
+
+	// failed holds the dependencies whose checks failed when last run, and
+	// forced those marked degraded with SetDegraded
+	failed map[string]bool
+	forced map[string]bool
+
+	// format is the WebService.HeartbeatFormat
+	format HeartbeatFormat
+
+	// status is the Health.Status of the last run, or "" if none
+	status string
+}
+
+// AddHealthCheck registers a check that is run on every request to
+// /_heartbeat. If a critical check fails /_heartbeat responds 503 Service
+// Unavailable, so that the instance is taken out of service. A dependency
+// whose check fails is Degraded until it passes again.
+func (ws *WebService) AddHealthCheck(c HealthChecker, critical bool) {
+	if ws.health == nil {
+		ws.health = &healthChecks{critical: make(map[string]bool)}
+	}
+
+	ws.health.mu.Lock()
+	defer ws.health.mu.Unlock()
+
+	ws.health.checks = append(ws.health.checks, c)
+	ws.health.critical[c.Name()] = critical
+}
+
+// run runs the checks concurrently and returns their combined result
+func (h *healthChecks) run(ctx context.Context) Health {
+	h.mu.RLock()
+	checks := make([]HealthChecker, len(h.checks))
+	copy(checks, h.checks)
+	h.mu.RUnlock()
+
+	health := Health{Status: "ok"}
+	health.Hydrate()
+
+	if len(checks) == 0 {
+		health.Degraded = h.degraded()
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c HealthChecker) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.Check(ctx)
+			results[i] = CheckResult{
+				Healthy:    err == nil,
+				DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	health.Checks = make(map[string]CheckResult, len(checks))
+	for i, c := range checks {
+		r := results[i]
+		r.Critical = h.critical[c.Name()]
+		health.Checks[c.Name()] = r
+		h.setFailed(c.Name(), !r.Healthy)
+
+		switch {
+		case r.Healthy:
+		case r.Critical:
+			health.Status = "failed"
+		case health.Status == "ok":
+			health.Status = "degraded"
+		}
+	}
+	h.status = health.Status
+	h.mu.Unlock()
+
+	health.Degraded = h.degraded()
+
+	return health
+}
+
+// heartbeat is the handler of the heartbeat controller
+func (h *healthChecks) heartbeat(w http.ResponseWriter, req *http.Request) {
+	health := h.run(req.Context())
+
+	status := http.StatusOK
+	if health.Status == "failed" {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.mu.RLock()
+	format := h.format
+	h.mu.RUnlock()
+
+	writeHeartbeat(w, status, health, heartbeatFormat(req, format))
+}
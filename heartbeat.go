@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/service/render"
+)
+
+// HeartbeatFormat is a format of the response of /_heartbeat
+type HeartbeatFormat int
+
+// These constants identify the heartbeat formats
+const (
+	// HeartbeatJSON is the Health as JSON, and is the default
+	HeartbeatJSON HeartbeatFormat = iota
+	// HeartbeatText is "ok" or "fail" as text/plain, for monitors that only
+	// understand a plain OK
+	HeartbeatText
+	// HeartbeatPrometheus is the Health as Prometheus gauges in the text
+	// exposition format: service_up, and service_health_check and
+	// service_health_check_duration_seconds for each check
+	HeartbeatPrometheus
+)
+
+func (f HeartbeatFormat) String() string {
+	switch f {
+	case HeartbeatText:
+		return "text"
+	case HeartbeatPrometheus:
+		return "prometheus"
+	default:
+		return "json"
+	}
+}
+
+// heartbeatFormat returns the format of the response to a heartbeat request:
+// that of the format query parameter, i.e. ?format=text, or else of the
+// Accept header, or else def
+func heartbeatFormat(req *http.Request, def HeartbeatFormat) HeartbeatFormat {
+	switch req.URL.Query().Get("format") {
+	case "json":
+		return HeartbeatJSON
+	case "text":
+		return HeartbeatText
+	case "prometheus":
+		return HeartbeatPrometheus
+	}
+
+	// Prometheus scrapers accept OpenMetrics or the versioned text format
+	accept := strings.ToLower(req.Header.Get("Accept"))
+	switch {
+	case strings.Contains(accept, "application/openmetrics-text"),
+		strings.Contains(accept, "version=0.0.4"):
+		return HeartbeatPrometheus
+	case strings.HasPrefix(accept, "application/json"):
+		return HeartbeatJSON
+	case strings.HasPrefix(accept, "text/plain"):
+		return HeartbeatText
+	}
+
+	return def
+}
+
+// writeHeartbeat writes the health in the format
+func writeHeartbeat(w http.ResponseWriter, status int, health Health, format HeartbeatFormat) {
+	switch format {
+	case HeartbeatText:
+		render.SetHeaders(w)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			fmt.Fprint(w, "ok")
+		} else {
+			fmt.Fprint(w, "fail")
+		}
+
+	case HeartbeatPrometheus:
+		render.SetHeaders(w)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(status)
+		writePrometheusHealth(w, status, health)
+
+	default:
+		render.JSON(w, status, health)
+	}
+}
+
+// writePrometheusHealth writes the health as Prometheus gauges
+func writePrometheusHealth(w http.ResponseWriter, status int, health Health) {
+	up := 0
+	if status == http.StatusOK {
+		up = 1
+	}
+
+	fmt.Fprintln(w, "# HELP service_up Whether no critical health check is failing.")
+	fmt.Fprintln(w, "# TYPE service_up gauge")
+	fmt.Fprintf(w, "service_up{status=%q} %d\n", health.Status, up)
+
+	if len(health.Checks) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(health.Checks))
+	for name := range health.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP service_health_check Whether the health check passed.")
+	fmt.Fprintln(w, "# TYPE service_health_check gauge")
+	for _, name := range names {
+		c := health.Checks[name]
+		healthy := 0
+		if c.Healthy {
+			healthy = 1
+		}
+		fmt.Fprintf(w, "service_health_check{check=%q,critical=\"%t\"} %d\n", name, c.Critical, healthy)
+	}
+
+	fmt.Fprintln(w, "# HELP service_health_check_duration_seconds The time the health check took.")
+	fmt.Fprintln(w, "# TYPE service_health_check_duration_seconds gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "service_health_check_duration_seconds{check=%q} %g\n", name, health.Checks[name].DurationMS/1000)
+	}
+}
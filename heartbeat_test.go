@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeartbeatFormats(t *testing.T) {
+	ws := NewWebService()
+	ws.HeartbeatFormat = HeartbeatText
+	ws.AddHealthCheck(HealthCheck("db", func(ctx context.Context) error {
+		return errors.New("down")
+	}), true)
+	h := ws.Handler()
+
+	tests := []struct {
+		path   string
+		accept string
+		body   string
+	}{
+		{HeartbeatRoute, "", "fail"},
+		{HeartbeatRoute, "*/*", "fail"},
+		{HeartbeatRoute, "application/json", `"status": "failed"`},
+		{HeartbeatRoute + "?format=json", "", `"status": "failed"`},
+		{HeartbeatRoute, "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", `service_health_check{check="db",critical="true"} 0`},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s with Accept %q = %d, expected 503", test.path, test.accept, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("GET %s with Accept %q = %q, expected %q", test.path, test.accept, rec.Body.String(), test.body)
+		}
+	}
+}
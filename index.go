@@ -0,0 +1,39 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+)
+
+// endpointIndex returns the handler for the listing of endpoints at /. The
+// listing cannot change once the router is built, so it is serialized once
+// and served with an ETag and Last-Modified to allow conditional requests.
+func endpointIndex(links EndPoints) http.Handler {
+	sort.Sort(links)
+
+	body, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		log.Fatalf("endpoint index could not be serialized: %s", err)
+	}
+
+	sum := sha1.Sum(body)
+	etag := fmt.Sprintf(`"%x"`, sum[:8])
+	modified := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		render.SetHeaders(w)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("ETag", etag)
+
+		// ServeContent handles HEAD, If-None-Match and If-Modified-Since
+		http.ServeContent(w, req, "", modified, bytes.NewReader(body))
+	})
+}
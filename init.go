@@ -4,6 +4,9 @@ import (
 	"os"
 
 	"github.com/getsentry/raven-go"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/tracing"
 )
 
 func init() {
@@ -12,4 +15,23 @@ func init() {
 		"environment": os.Getenv("APP_ENV"),
 		"version":     os.Getenv("APP_VERSION"),
 	})
+
+	// Send a final event to Sentry when the process dies on a fatal log, with
+	// the stacks of every goroutine, waiting for it to be sent before the
+	// process exits
+	log.CrashReporter = func(message string, stacks []byte) {
+		if os.Getenv("SENTRY_DSN") != "" {
+			packet := raven.NewPacketWithExtra(message, raven.Extra{"stacks": string(stacks)})
+			_, sent := raven.Capture(packet, map[string]string{"fatal": "true"})
+			<-sent
+		}
+	}
+
+	// Export spans if an OpenTelemetry collector is configured
+	e, err := tracing.NewOTLPExporterFromEnv()
+	if err != nil {
+		log.Warningf("tracing: %s", err)
+	} else if e != nil {
+		tracing.SetExporter(e)
+	}
 }
@@ -0,0 +1,237 @@
+// Package jobs turns slow operations into asynchronous jobs. The request that
+// starts a job receives 202 Accepted with the location of a status resource,
+// and the work is run by a worker.Pool.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service"
+	"github.com/cloudflare/service/render"
+	"github.com/cloudflare/service/worker"
+)
+
+// Status is the state of a job
+type Status string
+
+// Job states
+const (
+	Pending   Status = "pending"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// Job describes an asynchronous job and, once finished, its outcome
+type Job struct {
+	ID       string      `json:"id"`
+	Status   Status      `json:"status"`
+	Created  time.Time   `json:"created"`
+	Updated  time.Time   `json:"updated"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Location string      `json:"href"`
+}
+
+// Store persists jobs so that their status can be served. Implementations
+// backed by a shared store allow any instance of a service to answer for a
+// job.
+type Store interface {
+	Save(ctx context.Context, job Job) error
+	Load(ctx context.Context, id string) (Job, bool, error)
+}
+
+// Func performs the work of a job, returning the result to serve once the job
+// has succeeded
+type Func func(ctx context.Context) (interface{}, error)
+
+// PrepareFunc reads everything a job needs from the request and returns the
+// work to run. The work must not use the request as the response will have
+// been sent before it runs. If the request is invalid the HTTP status and
+// error to return are given.
+type PrepareFunc func(req *http.Request) (Func, int, error)
+
+// Manager starts jobs and serves their status
+type Manager struct {
+	route string
+	pool  *worker.Pool
+	store Store
+}
+
+// NewManager returns a Manager that serves job status beneath route, i.e.
+// "/jobs", running jobs on pool and persisting them in store
+func NewManager(route string, pool *worker.Pool, store Store) *Manager {
+	return &Manager{
+		route: strings.TrimSuffix(route, "/"),
+		pool:  pool,
+		store: store,
+	}
+}
+
+// Handler returns a HTTP handler that prepares a job from the request, queues
+// it, and responds 202 Accepted with the job and a Location header for the
+// status resource. If the pool cannot accept the job the response is 503.
+func (m *Manager) Handler(prepare PrepareFunc) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		fn, status, err := prepare(req)
+		if err != nil {
+			render.Error(w, status, err)
+			return
+		}
+
+		id, err := newID()
+		if err != nil {
+			render.Error(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		now := time.Now().UTC()
+		job := Job{
+			ID:       id,
+			Status:   Pending,
+			Created:  now,
+			Updated:  now,
+			Location: m.route + "/" + id,
+		}
+
+		if err := m.store.Save(req.Context(), job); err != nil {
+			service.ReportError(req, err)
+			render.Error(w, http.StatusInternalServerError, fmt.Errorf("job could not be saved"))
+			return
+		}
+
+		err = m.pool.Submit(func(ctx context.Context) {
+			m.run(ctx, job, fn)
+		})
+		if err != nil {
+			job.Status = Failed
+			job.Error = err.Error()
+			job.Updated = time.Now().UTC()
+			m.store.Save(req.Context(), job)
+
+			render.Error(w, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		w.Header().Set("Location", job.Location)
+		render.JSON(w, http.StatusAccepted, job)
+	}
+}
+
+// run executes a job, saving its state as it progresses. A job that panics
+// has failed.
+func (m *Manager) run(ctx context.Context, job Job, fn Func) {
+	job.Status = Running
+	job.Updated = time.Now().UTC()
+	m.store.Save(ctx, job)
+
+	defer func() {
+		if r := recover(); r != nil {
+			job.Status = Failed
+			job.Error = fmt.Sprintf("panic: %v", r)
+			job.Updated = time.Now().UTC()
+			m.store.Save(context.Background(), job)
+
+			// The pool reports the panic
+			panic(r)
+		}
+	}()
+
+	result, err := fn(ctx)
+
+	job.Updated = time.Now().UTC()
+	if err != nil {
+		job.Status = Failed
+		job.Error = err.Error()
+	} else {
+		job.Status = Succeeded
+		job.Result = result
+	}
+
+	// The job context may have been cancelled by shutdown, but the outcome
+	// should still be recorded
+	m.store.Save(context.Background(), job)
+}
+
+// Controller returns a WebController for the route "{route}/{id}" that serves
+// the status of a job
+func (m *Manager) Controller() service.WebController {
+	wc := service.NewWebController(m.route + "/{id}")
+
+	wc.AddMethodHandler(service.Get, func(w http.ResponseWriter, req *http.Request) {
+		id := service.Vars(req)["id"]
+
+		job, ok, err := m.store.Load(req.Context(), id)
+		if err != nil {
+			service.ReportError(req, err)
+			render.Error(w, http.StatusInternalServerError, fmt.Errorf("job could not be loaded"))
+			return
+		}
+
+		if !ok {
+			render.Error(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+			return
+		}
+
+		render.JSON(w, http.StatusOK, job)
+	})
+
+	return wc
+}
+
+// newID returns a random job identifier
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryStore is a Store that holds jobs in memory for a limited time
+type MemoryStore struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore returns a MemoryStore which forgets jobs that have not been
+// updated for ttl
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, jobs: make(map[string]Job)}
+}
+
+// Save is part of the Store interface
+func (s *MemoryStore) Save(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, j := range s.jobs {
+		if now.Sub(j.Updated) > s.ttl {
+			delete(s.jobs, id)
+		}
+	}
+
+	s.jobs[job.ID] = job
+
+	return nil
+}
+
+// Load is part of the Store interface
+func (s *MemoryStore) Load(ctx context.Context, id string) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+
+	return job, ok, nil
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/worker"
+)
+
+// start starts a job running fn and returns its ID
+func start(t *testing.T, m *Manager, fn Func) string {
+	t.Helper()
+
+	h := m.Handler(func(req *http.Request) (Func, int, error) {
+		return fn, http.StatusOK, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/things", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("starting a job = %d, expected %d", rec.Code, http.StatusAccepted)
+	}
+
+	loc := rec.Header().Get("Location")
+	return loc[len("/jobs/"):]
+}
+
+// await returns the job once it has finished
+func await(t *testing.T, store Store, id string) Job {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		job, _, _ := store.Load(context.Background(), id)
+		if job.Status == Succeeded || job.Status == Failed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestRun(t *testing.T) {
+	pool := worker.NewPool(1, 4)
+	defer pool.Stop()
+	store := NewMemoryStore(time.Minute)
+	m := NewManager("/jobs", pool, store)
+
+	tests := []struct {
+		fn     Func
+		status Status
+		err    string
+	}{
+		{func(ctx context.Context) (interface{}, error) { return "done", nil }, Succeeded, ""},
+		{func(ctx context.Context) (interface{}, error) { return nil, errors.New("broken") }, Failed, "broken"},
+		{func(ctx context.Context) (interface{}, error) { panic("malformed") }, Failed, "panic: malformed"},
+	}
+
+	for _, test := range tests {
+		job := await(t, store, start(t, m, test.fn))
+		if job.Status != test.status || job.Error != test.err {
+			t.Errorf("job = %s %q, expected %s %q", job.Status, job.Error, test.status, test.err)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	pool := worker.NewPool(1, 1)
+	store := NewMemoryStore(time.Minute)
+	m := NewManager("/jobs", pool, store)
+
+	started := make(chan struct{})
+	id := start(t, m, func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	<-started
+	pool.Stop()
+
+	if job := await(t, store, id); job.Status != Failed || job.Error != context.Canceled.Error() {
+		t.Errorf("a cancelled job = %s %q, expected failed", job.Status, job.Error)
+	}
+}
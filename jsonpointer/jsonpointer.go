@@ -0,0 +1,257 @@
+// Package jsonpointer implements JSON Pointer (RFC 6901) for documents decoded
+// into interface{} values, i.e. by encoding/json, where objects are
+// map[string]interface{} and arrays are []interface{}.
+package jsonpointer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSyntax is returned when a pointer is not a valid JSON Pointer
+	ErrSyntax = errors.New("jsonpointer: pointer must be empty or begin with /")
+
+	// ErrNotFound is returned when a pointer refers to a location that does
+	// not exist within a document
+	ErrNotFound = errors.New("jsonpointer: location does not exist")
+)
+
+// Pointer is a parsed JSON Pointer, holding its unescaped reference tokens.
+// The empty Pointer refers to the whole document.
+type Pointer []string
+
+// Parse parses a JSON Pointer such as "/a/b~1c/0"
+func Parse(pointer string) (Pointer, error) {
+	if pointer == "" {
+		return Pointer{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrSyntax
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = Unescape(t)
+	}
+
+	return Pointer(tokens), nil
+}
+
+// String returns the escaped form of the pointer
+func (p Pointer) String() string {
+	var b strings.Builder
+	for _, t := range p {
+		b.WriteByte('/')
+		b.WriteString(Escape(t))
+	}
+
+	return b.String()
+}
+
+// Parent returns the pointer to the value that contains the value p refers
+// to, and the final reference token of p. The whole document has no parent.
+func (p Pointer) Parent() (Pointer, string, bool) {
+	if len(p) == 0 {
+		return nil, "", false
+	}
+
+	return p[:len(p)-1], p[len(p)-1], true
+}
+
+// Escape escapes a reference token, replacing ~ with ~0 and / with ~1
+func Escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// Unescape reverses Escape
+func Unescape(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
+
+// Index returns the array index referred to by token within an array of
+// length n. RFC 6901 permits only "0" or digits without a leading zero, so
+// signs, leading zeros and "-0" are rejected.
+func Index(token string, n int) (int, error) {
+	if !isIndex(token) {
+		return 0, fmt.Errorf("jsonpointer: %q is not a valid array index", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("jsonpointer: %q is not a valid array index", token)
+	}
+
+	if i >= n {
+		return 0, fmt.Errorf("%w: array index %d is out of range", ErrNotFound, i)
+	}
+
+	return i, nil
+}
+
+// isIndex returns true if token matches the array-index rule of RFC 6901,
+// which is "0" or a digit from 1 to 9 followed by any digits
+func isIndex(token string) bool {
+	if token == "" || (token[0] == '0' && len(token) > 1) {
+		return false
+	}
+
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get returns the value within doc that p refers to
+func Get(doc interface{}, p Pointer) (interface{}, error) {
+	for _, t := range p {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[t]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrNotFound, t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := Index(t, len(d))
+			if err != nil {
+				return nil, err
+			}
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse %q of a scalar value", ErrNotFound, t)
+		}
+	}
+
+	return doc, nil
+}
+
+// Set sets the value that p refers to and returns the resulting document. An
+// object member is created if it does not exist, an array element must exist
+// unless the token is "-" which appends to the array.
+func Set(doc interface{}, p Pointer, value interface{}) (interface{}, error) {
+	return update(doc, p, func(parent interface{}, token string) (interface{}, error) {
+		switch t := parent.(type) {
+		case map[string]interface{}:
+			t[token] = value
+			return t, nil
+		case []interface{}:
+			if token == "-" {
+				return append(t, value), nil
+			}
+
+			i, err := Index(token, len(t))
+			if err != nil {
+				return nil, err
+			}
+			t[i] = value
+			return t, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse %q of a scalar value", ErrNotFound, token)
+		}
+	}, value)
+}
+
+// Replace replaces the existing value that p refers to and returns the
+// resulting document
+func Replace(doc interface{}, p Pointer, value interface{}) (interface{}, error) {
+	if _, err := Get(doc, p); err != nil {
+		return nil, err
+	}
+
+	return Set(doc, p, value)
+}
+
+// Add adds value at the location p refers to with the semantics of the JSON
+// Patch (RFC 6902) add operation: object members are created or replaced, and
+// array elements are inserted before the given index, or appended for "-" or
+// an index equal to the length of the array.
+func Add(doc interface{}, p Pointer, value interface{}) (interface{}, error) {
+	return update(doc, p, func(parent interface{}, token string) (interface{}, error) {
+		switch t := parent.(type) {
+		case map[string]interface{}:
+			t[token] = value
+			return t, nil
+		case []interface{}:
+			i := len(t)
+			if token != "-" {
+				var err error
+				if i, err = Index(token, len(t)+1); err != nil {
+					return nil, err
+				}
+			}
+
+			t = append(t, nil)
+			copy(t[i+1:], t[i:])
+			t[i] = value
+			return t, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse %q of a scalar value", ErrNotFound, token)
+		}
+	}, value)
+}
+
+// Delete removes the value that p refers to and returns the resulting
+// document. The whole document cannot be deleted.
+func Delete(doc interface{}, p Pointer) (interface{}, error) {
+	if len(p) == 0 {
+		return nil, fmt.Errorf("jsonpointer: cannot delete the whole document")
+	}
+
+	return update(doc, p, func(parent interface{}, token string) (interface{}, error) {
+		switch t := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := t[token]; !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrNotFound, token)
+			}
+			delete(t, token)
+			return t, nil
+		case []interface{}:
+			i, err := Index(token, len(t))
+			if err != nil {
+				return nil, err
+			}
+			return append(t[:i], t[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse %q of a scalar value", ErrNotFound, token)
+		}
+	}, nil)
+}
+
+// update applies fn to the parent of the location p refers to, storing the
+// returned parent in its own parent as arrays may change length. When p refers
+// to the whole document root replaces it.
+func update(
+	doc interface{},
+	p Pointer,
+	fn func(parent interface{}, token string) (interface{}, error),
+	root interface{},
+) (interface{}, error) {
+	parentPointer, token, ok := p.Parent()
+	if !ok {
+		return root, nil
+	}
+
+	parent, err := Get(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err = fn(parent, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parentPointer) == 0 {
+		return parent, nil
+	}
+
+	// Store the updated parent, which exists as it was just retrieved
+	return Set(doc, parentPointer, parent)
+}
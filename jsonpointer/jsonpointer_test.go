@@ -0,0 +1,126 @@
+package jsonpointer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func encode(t *testing.T, doc interface{}) string {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse("/a~1b/m~0n/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 3 || p[0] != "a/b" || p[1] != "m~n" || p[2] != "0" {
+		t.Errorf("Parse() = %q", p)
+	}
+
+	if p.String() != "/a~1b/m~0n/0" {
+		t.Errorf("Pointer.String() = %s should round trip", p.String())
+	}
+
+	if _, err := Parse("a"); err != ErrSyntax {
+		t.Errorf("Parse(a) = %v should be %v", err, ErrSyntax)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected int
+		valid    bool
+	}{
+		{"0", 0, true},
+		{"2", 2, true},
+		{"10", 10, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"-0", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{"01", 0, false},
+		{"00", 0, false},
+		{" 1", 0, false},
+		{"1e1", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+
+	for _, test := range tests {
+		i, err := Index(test.token, 20)
+		if (err == nil) != test.valid || i != test.expected {
+			t.Errorf("Index(%q) = %d, %v, expected %d and valid %t", test.token, i, err, test.expected, test.valid)
+		}
+	}
+
+	if _, err := Index("20", 20); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Index(20) of 20 = %v should be %v", err, ErrNotFound)
+	}
+}
+
+func TestGetSetAddDelete(t *testing.T) {
+	doc := decode(t, `{"a":{"b":[1,2]}}`)
+
+	v, err := Get(doc, Pointer{"a", "b", "1"})
+	if err != nil || v.(float64) != 2 {
+		t.Errorf("Get(/a/b/1) = %v, %v should be 2", v, err)
+	}
+
+	if _, err := Get(doc, Pointer{"a", "c"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(/a/c) = %v should be %v", err, ErrNotFound)
+	}
+
+	if _, err := Get(doc, Pointer{"a", "b", "01"}); err == nil {
+		t.Errorf("Get(/a/b/01) should reject leading zeros")
+	}
+
+	doc, err = Add(doc, Pointer{"a", "b", "0"}, 0.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err = Set(doc, Pointer{"a", "b", "-"}, 3.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err = Set(doc, Pointer{"c"}, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"a":{"b":[0,1,2,3]},"c":"d"}`
+	if encode(t, doc) != expected {
+		t.Errorf("document = %s should be %s", encode(t, doc), expected)
+	}
+
+	doc, err = Delete(doc, Pointer{"a", "b", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Replace(doc, Pointer{"x"}, 1.0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Replace(/x) = %v should be %v", err, ErrNotFound)
+	}
+
+	expected = `{"a":{"b":[0,2,3]},"c":"d"}`
+	if encode(t, doc) != expected {
+		t.Errorf("document = %s should be %s", encode(t, doc), expected)
+	}
+}
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBatchInterval is the longest a line is held by batching when no
+// interval is given.
+const DefaultBatchInterval = 100 * time.Millisecond
+
+// batcher coalesces log lines into fewer writes. Lines are held until size
+// bytes are pending for a writer or the interval passes, and lines of ERROR
+// and above flush all pending lines before they are written.
+type batcher struct {
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	writers []io.Writer // the writers with pending lines, in order
+	pending map[io.Writer]*bytes.Buffer
+	stopped bool
+	stop    chan struct{}
+}
+
+func newBatcher(size int, interval time.Duration) *batcher {
+	b := &batcher{
+		size:     size,
+		interval: interval,
+		pending:  make(map[io.Writer]*bytes.Buffer),
+		stop:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// run flushes the pending lines every interval until stopped.
+func (b *batcher) run() {
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// add holds a line for w, flushing the lines for w if size bytes are
+// pending. Once the batcher is stopped lines are written at once, as a line
+// may be added by a goroutine that read logging.batch before it was replaced.
+func (b *batcher) add(w io.Writer, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		write(w, logging.fallbackWriter(), data)
+		return
+	}
+	p, ok := b.pending[w]
+	if !ok {
+		p = &bytes.Buffer{}
+		b.pending[w] = p
+		b.writers = append(b.writers, w)
+	}
+	p.Write(data)
+	if p.Len() >= b.size {
+		write(w, logging.fallbackWriter(), p.Bytes())
+		p.Reset()
+	}
+}
+
+// flush writes all pending lines.
+func (b *batcher) flush() {
+	fallback := logging.fallbackWriter()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writePending(fallback)
+}
+
+// writePending writes all pending lines, and must be called with b.mu held.
+func (b *batcher) writePending(fallback io.Writer) {
+	for _, w := range b.writers {
+		if p := b.pending[w]; p.Len() > 0 {
+			write(w, fallback, p.Bytes())
+			p.Reset()
+		}
+	}
+}
+
+// close stops the batcher and writes all pending lines.
+func (b *batcher) close() {
+	fallback := logging.fallbackWriter()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return
+	}
+	b.stopped = true
+	close(b.stop)
+	b.writePending(fallback)
+}
+
+// fallbackWriter returns the fallback writer.
+func (l *loggingT) fallbackWriter() io.Writer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fallback
+}
+
+// SetBatching coalesces log lines into writes of up to size bytes, holding
+// each line for at most interval, which improves throughput when tens of
+// thousands of lines are logged each second. Lines of ERROR and above are
+// written at once, after any held lines. A size of zero or less disables
+// batching, which is the default, and writes any held lines. See also the
+// -log_batch flag, and Flush, which should be called before the process
+// exits.
+func SetBatching(size int, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	var b *batcher
+	if size > 0 {
+		b = newBatcher(size, interval)
+	}
+
+	logging.mu.Lock()
+	old := logging.batch
+	logging.batch = b
+	logging.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+}
+
+// Flush writes any log lines held by batching.
+func Flush() {
+	logging.mu.Lock()
+	b := logging.batch
+	logging.mu.Unlock()
+	if b != nil {
+		b.flush()
+	}
+}
+
+// batchSpec represents the setting of the -log_batch flag.
+type batchSpec struct {
+	value string
+}
+
+// String is part of the flag.Value interface.
+func (s *batchSpec) String() string {
+	return s.value
+}
+
+// Get is part of the flag.Value interface.
+func (s *batchSpec) Get() interface{} {
+	return s.value
+}
+
+var errBatchSyntax = errors.New("syntax error: expect size in bytes and an optional interval, such as 65536,100ms")
+
+// Syntax: -log_batch=65536,100ms
+func (s *batchSpec) Set(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) > 2 {
+		return errBatchSyntax
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return errBatchSyntax
+	}
+	var interval time.Duration
+	if len(parts) == 2 {
+		interval, err = time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("%s: %s", errBatchSyntax, err)
+		}
+	}
+	s.value = value
+	SetBatching(size, interval)
+	return nil
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+// contextKey is the type of the keys this package stores in a context.
+type contextKey int
+
+const (
+	verbosityKey contextKey = iota
+	tailKey
+	loggerKey
+)
+
+// WithVerbosity returns a copy of ctx in which logs written with the Context
+// functions, such as DebugContext, are enabled from the named severity, i.e.
+// "debug", as well as by -v and -vmodule. It is used to capture detail for a
+// single request without raising the verbosity of the whole process.
+func WithVerbosity(ctx context.Context, level string) (context.Context, error) {
+	s, ok := severityByName(level)
+	if !ok {
+		return ctx, errSeverity
+	}
+	return context.WithValue(ctx, verbosityKey, s), nil
+}
+
+// NewContext returns a copy of ctx that carries logger, so that code handed
+// the context logs with its fields, i.e. the ID of the request being served.
+// The fields are also added to the lines of the Context functions.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the Logger carried by ctx, or a Logger without fields
+// if there is none, which logs for ctx like the Context functions, i.e.
+//
+//	log.FromContext(req.Context()).Info("user updated", "user_id", id)
+func FromContext(ctx context.Context) *Logger {
+	return &Logger{fields: contextFields(ctx), ctx: ctx}
+}
+
+// contextFields returns the fields of the Logger carried by ctx, if any.
+func contextFields(ctx context.Context) []interface{} {
+	if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return l.fields
+	}
+	return nil
+}
+
+// enabledContext reports whether a log of severity s is enabled for ctx.
+func (l *loggingT) enabledContext(ctx context.Context, s severity, depth int) bool {
+	if v, ok := ctx.Value(verbosityKey).(severity); ok && s >= v {
+		return true
+	}
+	return l.enabled(s, depth+1)
+}
+
+func TraceContext(ctx context.Context, args ...interface{}) {
+	if logging.enabledContext(ctx, traceLog, 0) {
+		logging.kv(traceLog, fmt.Sprintf("%s", args...), contextFields(ctx), nil)
+	} else if t := tailFrom(ctx); t != nil {
+		t.hold(traceLog, fmt.Sprintf("%s", args...), contextFields(ctx))
+	}
+}
+
+func TracefContext(ctx context.Context, format string, args ...interface{}) {
+	if logging.enabledContext(ctx, traceLog, 0) {
+		logging.kv(traceLog, fmt.Sprintf(format, args...), contextFields(ctx), nil)
+	} else if t := tailFrom(ctx); t != nil {
+		t.hold(traceLog, fmt.Sprintf(format, args...), contextFields(ctx))
+	}
+}
+
+func DebugContext(ctx context.Context, args ...interface{}) {
+	if logging.enabledContext(ctx, debugLog, 0) {
+		logging.kv(debugLog, fmt.Sprintf("%s", args...), contextFields(ctx), nil)
+	} else if t := tailFrom(ctx); t != nil {
+		t.hold(debugLog, fmt.Sprintf("%s", args...), contextFields(ctx))
+	}
+}
+
+func DebugfContext(ctx context.Context, format string, args ...interface{}) {
+	if logging.enabledContext(ctx, debugLog, 0) {
+		logging.kv(debugLog, fmt.Sprintf(format, args...), contextFields(ctx), nil)
+	} else if t := tailFrom(ctx); t != nil {
+		t.hold(debugLog, fmt.Sprintf(format, args...), contextFields(ctx))
+	}
+}
+
+func InfoContext(ctx context.Context, args ...interface{}) {
+	if logging.enabledContext(ctx, infoLog, 0) {
+		logging.kv(infoLog, fmt.Sprintf("%s", args...), contextFields(ctx), nil)
+	}
+}
+
+func InfofContext(ctx context.Context, format string, args ...interface{}) {
+	if logging.enabledContext(ctx, infoLog, 0) {
+		logging.kv(infoLog, fmt.Sprintf(format, args...), contextFields(ctx), nil)
+	}
+}
@@ -0,0 +1,184 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// destination represents the setting of the -log_dest flag.
+type destination struct {
+	name string
+}
+
+// String is part of the flag.Value interface.
+func (d *destination) String() string {
+	if d.name == "" {
+		return "stderr"
+	}
+	return d.name
+}
+
+// Get is part of the flag.Value interface.
+func (d *destination) Get() interface{} {
+	return d.String()
+}
+
+// Set is part of the flag.Value interface.
+func (d *destination) Set(value string) error {
+	return SetDestination(value)
+}
+
+var errDestination = fmt.Errorf("valid values are: stderr, syslog, journald")
+
+// SetDestination sends logs to one of the backends, overriding the -log_dest
+// flag and replacing any writers set with SetOutput and SetOutputBySeverity:
+//
+//	stderr    the default
+//	syslog    the local syslog daemon, with the severities mapped to the
+//	          syslog priorities debug, info, warning, err and crit
+//	journald  the systemd journal, with the severities mapped to its
+//	          priorities and, with the JSON format, the file, line and
+//	          fields of each line as journal fields
+func SetDestination(name string) error {
+	var writers [fatalLog + 1]io.Writer
+	switch strings.ToLower(name) {
+	case "", "stderr":
+	case "syslog":
+		w, err := newSyslogWriters()
+		if err != nil {
+			return err
+		}
+		writers = w
+	case "journald":
+		w, err := newJournalWriters()
+		if err != nil {
+			return err
+		}
+		writers = w
+	default:
+		return errDestination
+	}
+
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.out = nil
+	logging.outBySeverity = writers
+	logging.dest.name = strings.ToLower(name)
+	return nil
+}
+
+// journalSocket is where the systemd journal receives native protocol
+// messages.
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalPriority maps the severities to the syslog priorities used by the
+// journal.
+var journalPriority = [fatalLog + 1]int{
+	traceLog:   7, // debug
+	debugLog:   7, // debug
+	infoLog:    6, // info
+	warningLog: 4, // warning
+	errorLog:   3, // err
+	fatalLog:   2, // crit
+}
+
+// journalWriter writes log lines of one severity to the systemd journal.
+type journalWriter struct {
+	conn     net.Conn
+	priority int
+}
+
+func newJournalWriters() ([fatalLog + 1]io.Writer, error) {
+	var writers [fatalLog + 1]io.Writer
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return writers, err
+	}
+	for s := range writers {
+		writers[s] = &journalWriter{conn: conn, priority: journalPriority[s]}
+	}
+	return writers, nil
+}
+
+// Write is part of the io.Writer interface. A JSON line is sent with its
+// fields as journal fields, and any other line as the message.
+func (j *journalWriter) Write(b []byte) (int, error) {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(j.priority))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", filepath.Base(os.Args[0]))
+
+	var line struct {
+		Severity string                 `json:"severity"`
+		File     string                 `json:"file"`
+		Line     int                    `json:"line"`
+		Message  string                 `json:"message"`
+		Fields   map[string]interface{} `json:"fields"`
+		Stack    string                 `json:"stack"`
+	}
+	if err := json.Unmarshal(b, &line); err == nil && line.Severity != "" {
+		writeJournalField(&buf, "MESSAGE", line.Message)
+		writeJournalField(&buf, "CODE_FILE", line.File)
+		writeJournalField(&buf, "CODE_LINE", strconv.Itoa(line.Line))
+		if line.Stack != "" {
+			writeJournalField(&buf, "STACK", line.Stack)
+		}
+		for k, v := range line.Fields {
+			if key := journalKey(k); key != "" {
+				writeJournalField(&buf, key, fmt.Sprint(v))
+			}
+		}
+	} else {
+		writeJournalField(&buf, "MESSAGE", string(bytes.TrimSuffix(b, []byte("\n"))))
+	}
+
+	if _, err := j.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeJournalField writes a field in the native journal protocol, which
+// has a binary form for values that contain a newline.
+func writeJournalField(buf *bytes.Buffer, key string, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalKey returns a field name as a valid journal field name, being
+// upper case letters, digits and underscores not beginning with an
+// underscore, or an empty string if there is no such name.
+func journalKey(k string) string {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return unicode.ToUpper(r)
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+	key = strings.TrimLeft(key, "_")
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return ""
+	}
+	return key
+}
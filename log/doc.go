@@ -4,7 +4,7 @@
 //
 // It provides functions Info, Warning, Error, Fatal, plus formatting variants such as
 // Infof. These functions are protected by the verbosity set via the -v flag.
-// All logs are sent to standard error.
+// All logs are sent to standard error by default.
 //
 // Basic examples:
 //
@@ -12,7 +12,33 @@
 //
 //	log.Fatalf("Initialization failed: %s", err)
 //
-// All log statements are written to standard error.
+// A fatal log exits the process with code 255 once it is written. Teardown can
+// be run first with OnFatal, and the exit replaced with SetExitFunc.
+//
+// Structured fields are added with the KV functions, or to every line of a
+// Logger:
+//
+//	log.InfoKV("user updated", "user_id", id)
+//
+//	logger := log.With("request_id", reqID)
+//	logger.Warning("retrying", "attempt", n)
+//
+// The TRACE and DEBUG lines logged for a context with the Context functions,
+// such as DebugContext, are held rather than dropped when they are not enabled
+// if the context has a Tail, and can be written once it is known that they are
+// needed, i.e. when a request fails:
+//
+//	ctx, tail := log.WithTail(ctx)
+//	...
+//	if failed {
+//		tail.Flush()
+//	}
+//
+// All log statements are written to standard error, unless another writer is
+// set with SetOutput, or for a single severity with SetOutputBySeverity:
+//
+//	log.SetOutputBySeverity("ERROR", errorSink)
+//
 // This package uses flags for configuration. As a result, flag.Parse must be called.
 //
 //	-log_backtrace_at=""
@@ -22,7 +48,41 @@
 //		a stack trace will be written to the Info log whenever execution
 //		hits that statement. (Unlike with -vmodule, the ".go" must be
 //		present.)
+//	-log_batch=""
+//		When set to a size in bytes and an optional interval, such as
+//			-log_batch=65536,100ms
+//		lines are written in batches of up to that size, each held for
+//		at most the interval. Lines of ERROR and above are written at
+//		once. See also SetBatching and Flush.
+//	-log_crash_file=""
+//		When set, a fatal log and the stacks of all goroutines are
+//		appended to this file before the process exits, so that they
+//		survive if stderr is not captured. See also SetCrashFile.
+//	-log_header=""
+//		A comma-separated list of optional fields for the header of
+//		each line: time for an RFC 3339 timestamp, glogtime for a
+//		timestamp in the layout of glog, pid and goroutine. See also
+//		SetHeaderFields.
+//	-log_dest="stderr"
+//		Set to "syslog" to send logs to the local syslog daemon, or
+//		"journald" to send them to the systemd journal, which with
+//		-log_format=json receives the file, line and fields of each
+//		line as journal fields. See also SetDestination.
+//	-log_format="text"
+//		Set to "json" to write each log line as a JSON object with
+//		timestamp, severity, file, line and message fields. See also
+//		SetFormat.
+//	-log_rate_limit=0
+//		When greater than zero, the number of identical lines, being
+//		those with the same severity, file, line and message, written
+//		each second. See also SetRateLimit and Sampled.
 //	-v="info"
 //		Enable logging at the specified level and above.
-//
+//	-vmodule=""
+//		Enable logging at a lower level for some files, as a
+//		comma-separated list of pattern=level settings. The pattern
+//		is matched against the file name without the ".go", or the
+//		full path if it contains a "/", such as
+//			-vmodule=router*=debug,db*=trace
+//		See also SetVModule.
 package log
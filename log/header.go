@@ -0,0 +1,139 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// HeaderField is an optional field of the header of each log line. It also
+// implements the flag.Value interface for the -log_header flag.
+type HeaderField int32 // sync/atomic int32
+
+// These constants identify the optional header fields. A text header with all
+// of them, using the RFC 3339 timestamp, is:
+//
+//	I 2006-01-02T15:04:05.000000Z 1234 g56 file.go:123] message
+//
+// and with the glog timestamp instead, as glog writes it:
+//
+//	I0102 15:04:05.000000 1234 file.go:123] message
+//
+// JSON lines always have a timestamp, and have pid and goroutine fields when
+// those are enabled.
+const (
+	// HeaderTimestamp adds an RFC 3339 timestamp in UTC with microseconds
+	HeaderTimestamp HeaderField = 1 << iota
+	// HeaderGlogTimestamp adds a timestamp in the layout of glog,
+	// mmdd hh:mm:ss.uuuuuu in local time, and takes precedence over
+	// HeaderTimestamp
+	HeaderGlogTimestamp
+	// HeaderPID adds the process ID
+	HeaderPID
+	// HeaderGoroutine adds the ID of the goroutine that logged, prefixed g
+	HeaderGoroutine
+)
+
+var headerFieldName = map[string]HeaderField{
+	"time":      HeaderTimestamp,
+	"glogtime":  HeaderGlogTimestamp,
+	"pid":       HeaderPID,
+	"goroutine": HeaderGoroutine,
+}
+
+// get returns the value of the header fields.
+func (f *HeaderField) get() HeaderField {
+	return HeaderField(atomic.LoadInt32((*int32)(f)))
+}
+
+// set sets the value of the header fields.
+func (f *HeaderField) set(val HeaderField) {
+	atomic.StoreInt32((*int32)(f), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (f *HeaderField) String() string {
+	v := f.get()
+	names := []string{}
+	for _, name := range []string{"time", "glogtime", "pid", "goroutine"} {
+		if v&headerFieldName[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Get is part of the flag.Value interface.
+func (f *HeaderField) Get() interface{} {
+	return f.get()
+}
+
+var errHeaderField = fmt.Errorf("valid values are a comma-separated list of: time, glogtime, pid, goroutine")
+
+// Syntax: -log_header=time,pid
+func (f *HeaderField) Set(value string) error {
+	var v HeaderField
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		field, ok := headerFieldName[name]
+		if !ok {
+			return errHeaderField
+		}
+		v |= field
+	}
+	f.set(v)
+	return nil
+}
+
+// SetHeaderFields sets the optional fields of the header of subsequent log
+// lines, overriding the -log_header flag. With no fields the header is only
+// the severity, file and line.
+func SetHeaderFields(fields ...HeaderField) {
+	var v HeaderField
+	for _, f := range fields {
+		v |= f
+	}
+	logging.headerFields.set(v)
+}
+
+// writeHeaderFields writes the optional fields of a text header to buf,
+// after the severity character.
+func writeHeaderFields(buf *buffer, fields HeaderField) {
+	if fields&HeaderGlogTimestamp != 0 {
+		now := timeNow()
+		_, month, day := now.Date()
+		hour, minute, second := now.Clock()
+		fmt.Fprintf(buf, "%02d%02d %02d:%02d:%02d.%06d",
+			int(month), day, hour, minute, second, now.Nanosecond()/1000)
+	} else if fields&HeaderTimestamp != 0 {
+		buf.WriteString(" ")
+		buf.WriteString(timeNow().UTC().Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+	if fields&HeaderPID != 0 {
+		buf.WriteString(" ")
+		buf.WriteString(strconv.Itoa(pid))
+	}
+	if fields&HeaderGoroutine != 0 {
+		buf.WriteString(" g")
+		buf.WriteString(strconv.FormatUint(goroutineID(), 10))
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, which the runtime
+// only exposes in the first line of its stack, or zero if it cannot be read.
+func goroutineID() uint64 {
+	var b [64]byte
+	s := b[:runtime.Stack(b[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+	if i := bytes.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	id, _ := strconv.ParseUint(string(s), 10, 64)
+	return id
+}
@@ -0,0 +1,183 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Logger writes logs with a set of key/value fields, such as a request ID. In
+// the text format the fields follow the message as key=value pairs:
+//
+//	I handler.go:42] user updated request_id=abc zone_id=123
+//
+// and in the JSON format they are the fields object of each line.
+//
+// A Logger returned by FromContext logs for its context like the Context
+// functions: the verbosity of WithVerbosity applies, and TRACE and DEBUG
+// lines that are not enabled are held by the Tail of WithTail.
+type Logger struct {
+	fields []interface{}
+	ctx    context.Context
+}
+
+// With returns a Logger that adds the keys and values, which alternate, to
+// each line, i.e.
+//
+//	logger := log.With("request_id", id)
+//	logger.Info("user updated", "user_id", user.ID)
+func With(keysAndValues ...interface{}) *Logger {
+	return &Logger{fields: keysAndValues}
+}
+
+// With returns a Logger with the fields of l and the keys and values.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return &Logger{fields: append(fields, keysAndValues...), ctx: l.ctx}
+}
+
+// context returns the context the Logger logs for.
+func (l *Logger) context() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+func (l *Logger) Trace(msg string, keysAndValues ...interface{}) {
+	if logging.enabledContext(l.context(), traceLog, 0) {
+		logging.kv(traceLog, msg, l.fields, keysAndValues)
+	} else if t := tailFrom(l.context()); t != nil {
+		t.hold(traceLog, msg, joinFields(l.fields, keysAndValues))
+	}
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	if logging.enabledContext(l.context(), debugLog, 0) {
+		logging.kv(debugLog, msg, l.fields, keysAndValues)
+	} else if t := tailFrom(l.context()); t != nil {
+		t.hold(debugLog, msg, joinFields(l.fields, keysAndValues))
+	}
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	if logging.enabledContext(l.context(), infoLog, 0) {
+		logging.kv(infoLog, msg, l.fields, keysAndValues)
+	}
+}
+
+func (l *Logger) Warning(msg string, keysAndValues ...interface{}) {
+	if logging.enabledContext(l.context(), warningLog, 0) {
+		logging.kv(warningLog, msg, l.fields, keysAndValues)
+	}
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	if logging.enabledContext(l.context(), errorLog, 0) {
+		logging.kv(errorLog, msg, l.fields, keysAndValues)
+	}
+}
+
+func TraceKV(msg string, keysAndValues ...interface{}) {
+	if logging.enabled(traceLog, 0) {
+		logging.kv(traceLog, msg, nil, keysAndValues)
+	}
+}
+
+func DebugKV(msg string, keysAndValues ...interface{}) {
+	if logging.enabled(debugLog, 0) {
+		logging.kv(debugLog, msg, nil, keysAndValues)
+	}
+}
+
+func InfoKV(msg string, keysAndValues ...interface{}) {
+	if logging.enabled(infoLog, 0) {
+		logging.kv(infoLog, msg, nil, keysAndValues)
+	}
+}
+
+func WarningKV(msg string, keysAndValues ...interface{}) {
+	if logging.enabled(warningLog, 0) {
+		logging.kv(warningLog, msg, nil, keysAndValues)
+	}
+}
+
+func ErrorKV(msg string, keysAndValues ...interface{}) {
+	if logging.enabled(errorLog, 0) {
+		logging.kv(errorLog, msg, nil, keysAndValues)
+	}
+}
+
+// kv writes a message with the fields of a Logger and of the call.
+func (l *loggingT) kv(s severity, msg string, fields []interface{}, keysAndValues []interface{}) {
+	fields = joinFields(fields, keysAndValues)
+
+	buf, file, line := l.header(s, 0)
+	// Remove new lines from the message to ensure log lines are just lines
+	buf.WriteString(strings.Replace(msg, "\n", "", -1))
+	l.writeFields(buf, fields)
+	buf.WriteByte('\n')
+	l.outputFields(s, buf, file, line, fields)
+}
+
+// joinFields returns the fields of a Logger followed by those of a call.
+func joinFields(fields []interface{}, keysAndValues []interface{}) []interface{} {
+	if len(fields) > 0 && len(keysAndValues) > 0 {
+		return append(append(make([]interface{}, 0, len(fields)+len(keysAndValues)), fields...), keysAndValues...)
+	} else if len(keysAndValues) > 0 {
+		return keysAndValues
+	}
+	return fields
+}
+
+// writeFields writes the fields of a line as key=value pairs in the text
+// format. In the JSON format they are added by outputFields.
+func (l *loggingT) writeFields(buf *buffer, fields []interface{}) {
+	if l.format.get() == JSON {
+		return
+	}
+	for i := 0; i < len(fields); i += 2 {
+		k, v := kvPair(fields, i)
+		buf.WriteString(" " + k + "=" + quoteValue(fmt.Sprint(v)))
+	}
+}
+
+// kvPair returns the key and value at i of alternating keys and values. A
+// key without a value is given the value "(MISSING)".
+func kvPair(fields []interface{}, i int) (string, interface{}) {
+	k := fmt.Sprint(fields[i])
+	if i+1 >= len(fields) {
+		return k, "(MISSING)"
+	}
+	return k, fields[i+1]
+}
+
+// quoteValue quotes a value in the text format if it would otherwise be
+// ambiguous.
+func quoteValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\n\t") {
+		return fmt.Sprintf("%q", v)
+	}
+	return v
+}
+
+// kvMap returns the fields of a JSON line. Errors are written as their
+// message, and values that cannot be marshalled as text.
+func kvMap(fields []interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(fields)/2+1)
+	for i := 0; i < len(fields); i += 2 {
+		k, v := kvPair(fields, i)
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		} else if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimit holds the state of the -log_rate_limit flag, being the number of
+// identical lines written each second, and the lines seen this second.
+type rateLimit struct {
+	perSecond int64 // read atomically
+
+	mu     sync.Mutex
+	second int64
+	seen   map[string]int64
+}
+
+// String is part of the flag.Value interface.
+func (r *rateLimit) String() string {
+	return strconv.FormatInt(atomic.LoadInt64(&r.perSecond), 10)
+}
+
+// Get is part of the flag.Value interface.
+func (r *rateLimit) Get() interface{} {
+	return atomic.LoadInt64(&r.perSecond)
+}
+
+// Set is part of the flag.Value interface.
+func (r *rateLimit) Set(value string) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&r.perSecond, n)
+	return nil
+}
+
+// SetRateLimit limits the number of identical lines, being those with the
+// same severity, file, line and message, that are written each second, so
+// that an error in a hot path cannot flood the log. Lines beyond the limit
+// are counted in Stats.Suppressed. Zero, the default, means no limit. FATAL
+// lines are never limited. See also the -log_rate_limit flag.
+func SetRateLimit(perSecond int) {
+	atomic.StoreInt64(&logging.limit.perSecond, int64(perSecond))
+}
+
+// allow reports whether an identical line has been written fewer than
+// perSecond times this second.
+func (r *rateLimit) allow(s severity, file string, line int, msg []byte) bool {
+	limit := atomic.LoadInt64(&r.perSecond)
+	if limit <= 0 || s == fatalLog {
+		return true
+	}
+
+	key := string(severityChar[s]) + file + ":" + strconv.Itoa(line) + "]" + string(msg)
+	now := time.Now().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now != r.second || r.seen == nil {
+		// Forget the previous second, which also bounds the memory used
+		r.second = now
+		r.seen = make(map[string]int64)
+	}
+	r.seen[key]++
+	return r.seen[key] <= limit
+}
+
+// suppress counts a line that was not written.
+func suppress(n int) {
+	atomic.AddInt64(&Stats.Suppressed.lines, 1)
+	atomic.AddInt64(&Stats.Suppressed.bytes, int64(n))
+}
+
+// samples counts the calls to Sampled from each call site.
+var samples sync.Map // map[uintptr]*int64
+
+// Sampled returns true for the first and then every nth call from its call
+// site, so that a log in a hot path can be sampled:
+//
+//	if log.Sampled(100) {
+//		log.Errorf("cache miss for %s", key)
+//	}
+//
+// The calls for which it returns false are counted in Stats.Suppressed.
+func Sampled(n int) bool {
+	if n <= 1 {
+		return true
+	}
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return true
+	}
+	c, _ := samples.LoadOrStore(pcs[0], new(int64))
+	if (atomic.AddInt64(c.(*int64), 1)-1)%int64(n) == 0 {
+		return true
+	}
+	suppress(0)
+	return false
+}
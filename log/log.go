@@ -2,9 +2,11 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strconv"
@@ -94,6 +96,69 @@ func severityByName(s string) (severity, bool) {
 	return 0, false
 }
 
+// Format identifies how log lines are written. It also implements the
+// flag.Value interface for the -log_format flag.
+type Format int32 // sync/atomic int32
+
+// These constants identify the log formats.
+const (
+	// Text is the default format, a terse header followed by the message:
+	//	I file.go:123] message
+	Text Format = iota
+	// JSON writes each line as a JSON object with timestamp, severity, file,
+	// line and message fields, for log aggregation pipelines.
+	JSON
+)
+
+var formatName = []string{
+	Text: "text",
+	JSON: "json",
+}
+
+// get returns the value of the format.
+func (f *Format) get() Format {
+	return Format(atomic.LoadInt32((*int32)(f)))
+}
+
+// set sets the value of the format.
+func (f *Format) set(val Format) {
+	atomic.StoreInt32((*int32)(f), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (f *Format) String() string {
+	v := f.get()
+	if v < 0 || int(v) >= len(formatName) {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return formatName[v]
+}
+
+// Get is part of the flag.Value interface.
+func (f *Format) Get() interface{} {
+	return f.get()
+}
+
+var errFormat = fmt.Errorf("valid values are: %v", formatName)
+
+// Set is part of the flag.Value interface.
+func (f *Format) Set(value string) error {
+	value = strings.ToLower(value)
+	for i, name := range formatName {
+		if name == value {
+			f.set(Format(i))
+			return nil
+		}
+	}
+	return errFormat
+}
+
+// SetFormat sets the format of subsequent log lines, overriding the
+// -log_format flag.
+func SetFormat(f Format) {
+	logging.format.set(f)
+}
+
 // OutputStats tracks the number of output lines and bytes written.
 type OutputStats struct {
 	lines int64
@@ -114,8 +179,44 @@ func (s *OutputStats) Bytes() int64 {
 // per severity level. Values must be read with atomic.LoadInt64.
 var Stats struct {
 	Trace, Debug, Info, Warning, Error OutputStats
+
+	// Writes counts the writes of log lines that were slow or failed
+	Writes WriteStats
+
+	// Suppressed counts the lines that were not written because of the
+	// rate limit or Sampled
+	Suppressed OutputStats
+}
+
+// WriteStats tracks the writes of log lines that were slow or failed, such as
+// when stderr is a broken pipe or the disk is full.
+type WriteStats struct {
+	slow      int64
+	failures  int64
+	fallbacks int64
 }
 
+// Slow returns the number of writes that took longer than
+// SlowWriteThreshold, which blocked the goroutine that logged.
+func (s *WriteStats) Slow() int64 {
+	return atomic.LoadInt64(&s.slow)
+}
+
+// Failures returns the number of writes that failed.
+func (s *WriteStats) Failures() int64 {
+	return atomic.LoadInt64(&s.failures)
+}
+
+// Fallbacks returns the number of failed writes that were written to the
+// fallback writer instead, see SetFallbackOutput.
+func (s *WriteStats) Fallbacks() int64 {
+	return atomic.LoadInt64(&s.fallbacks)
+}
+
+// SlowWriteThreshold is the time after which a write of a log line is
+// counted as slow.
+var SlowWriteThreshold = 100 * time.Millisecond
+
 var severityStats = [numSeverity]*OutputStats{
 	traceLog:   &Stats.Trace,
 	debugLog:   &Stats.Debug,
@@ -198,6 +299,13 @@ func init() {
 	logging.verbosity = infoLog
 	flag.Var(&logging.verbosity, "v", "log level")
 	flag.Var(&logging.traceLocation, "log_backtrace_at", "when logging hits line file:N, emit a stack trace")
+	flag.Var(&logging.format, "log_format", "log format: text or json")
+	flag.Var(&logging.batchSpec, "log_batch", "batch log writes: size in bytes and an optional interval, such as 65536,100ms")
+	flag.Var(&logging.limit, "log_rate_limit", "the number of identical log lines written each second, or 0 for no limit")
+	flag.Var(&logging.dest, "log_dest", "log destination: stderr, syslog or journald")
+	flag.Var(&logging.headerFields, "log_header", "optional log header fields: time, glogtime, pid, goroutine")
+	flag.Var(&logging.vmodule, "vmodule", "comma-separated list of pattern=level settings for file-filtered logging")
+	flag.StringVar(&logging.crashFile, "log_crash_file", "", "file to which fatal logs and all goroutine stacks are written")
 }
 
 // loggingT collects all the global state of the logging setup.
@@ -206,12 +314,11 @@ type loggingT struct {
 	// does not let us avoid the =true, and that shorthand is necessary for
 	// compatibility. TODO: does this matter enough to fix? Seems unlikely.
 
-	// freeList is a list of byte buffers, maintained under freeListMu.
-	freeList *buffer
-	// freeListMu maintains the free list. It is separate from the main mutex
-	// so buffers can be grabbed and printed to without holding the main lock,
-	// for better parallelization.
-	freeListMu sync.Mutex
+	// buffers holds byte buffers for reuse, with a pool for each severity
+	// as the lines of a severity tend to be of similar sizes. They can be
+	// grabbed and printed to without holding the main lock, for better
+	// parallelization.
+	buffers [fatalLog + 1]sync.Pool
 
 	// mu protects the remaining elements of this structure and is
 	// used to synchronize logging.
@@ -223,43 +330,73 @@ type loggingT struct {
 	// These flags are modified only under lock, although verbosity may be fetched
 	// safely using atomic.LoadInt32.
 	verbosity severity // logging level, the value of the -v flag
+	// format may be fetched safely using atomic.LoadInt32.
+	format Format // log format, the value of the -log_format flag
+	// headerFields may be fetched safely using atomic.LoadInt32.
+	headerFields HeaderField // the value of the -log_header flag
+	// out is where logs are written, unless overridden for the severity in
+	// outBySeverity. A nil out means os.Stderr.
+	out           io.Writer
+	outBySeverity [fatalLog + 1]io.Writer
+	// fallback is where lines are written if writing them to out fails.
+	fallback io.Writer
+	// dest is the state of the -log_dest flag.
+	dest destination
+	// batch, if set, holds lines to write them in batches, and batchSpec
+	// is the state of the -log_batch flag.
+	batch     *batcher
+	batchSpec batchSpec
+	// limit is the state of the -log_rate_limit flag.
+	limit rateLimit
+	// fatal holds the OnFatal hooks and the exit function.
+	fatal fatal
+	// crashFile is the value of the -log_crash_file flag.
+	crashFile string
+
+	// vmodule is the state of the -vmodule flag, and vmap caches the
+	// severity of each call site. filterLength is the number of filters
+	// and is read atomically so that callers need not take the lock when
+	// -vmodule is not set.
+	vmodule      moduleSpec
+	vmap         map[uintptr]severity
+	filterLength int32
 }
 
 // buffer holds a byte Buffer for reuse. The zero value is ready for use.
 type buffer struct {
 	bytes.Buffer
-	next *buffer
+	s severity
+	// header is the length of the header, which the message follows.
+	header int
+	// at is the time the line was logged, if not now, i.e. for a line
+	// held by a Tail.
+	at time.Time
 }
 
+// maxPooledBuffer is the capacity beyond which buffers are not reused, so
+// that one very long line does not pin its memory.
+const maxPooledBuffer = 32 << 10
+
 var logging loggingT
 
-// getBuffer returns a new, ready-to-use buffer.
-func (l *loggingT) getBuffer() *buffer {
-	l.freeListMu.Lock()
-	b := l.freeList
-	if b != nil {
-		l.freeList = b.next
-	}
-	l.freeListMu.Unlock()
-	if b == nil {
-		b = new(buffer)
-	} else {
-		b.next = nil
+// getBuffer returns a new, ready-to-use buffer for a line of severity s.
+func (l *loggingT) getBuffer(s severity) *buffer {
+	if b, ok := l.buffers[s].Get().(*buffer); ok {
 		b.Reset()
+		b.header = 0
+		b.at = time.Time{}
+		return b
 	}
-	return b
+	return &buffer{s: s}
 }
 
-// putBuffer returns a buffer to the free list.
+// putBuffer returns a buffer to the pool for its severity.
 func (l *loggingT) putBuffer(b *buffer) {
-	if b.Len() >= 256 {
+	if b.Cap() > maxPooledBuffer {
 		// Let big buffers die a natural death.
 		return
 	}
-	l.freeListMu.Lock()
-	b.next = l.freeList
-	l.freeList = b
-	l.freeListMu.Unlock()
+	l.buffers[b.s].Put(b)
 }
 
 var timeNow = time.Now // Stubbed out for testing.
@@ -285,9 +422,17 @@ func (l *loggingT) formatHeader(s severity, file string, line int) *buffer {
 	if s > fatalLog {
 		s = infoLog // for safety.
 	}
-	buf := l.getBuffer()
-	// Lfile:line]
-	buf.WriteString(string(severityChar[s]) + " " + file + ":" + strconv.Itoa(line) + "] ")
+	buf := l.getBuffer(s)
+	buf.header = 0
+	if l.format.get() == JSON {
+		// The header fields are added by output
+		return buf
+	}
+	// L[time] [pid] [goroutine] file:line]
+	buf.WriteByte(severityChar[s])
+	writeHeaderFields(buf, l.headerFields.get())
+	buf.WriteString(" " + file + ":" + strconv.Itoa(line) + "] ")
+	buf.header = buf.Len()
 	return buf
 }
 
@@ -349,24 +494,269 @@ func (l *loggingT) pWithFileLine(s severity, file string, line int, args ...inte
 
 // output writes the data to the log files and releases the buffer.
 func (l *loggingT) output(s severity, buf *buffer, file string, line int) {
+	l.outputFields(s, buf, file, line, nil)
+}
+
+// outputFields is output for a line with key/value fields, which are written
+// to the text of buf in the text format but added to a JSON line here. The
+// line is written without holding the main lock, so that a slow writer does
+// not stop other goroutines from preparing their lines.
+func (l *loggingT) outputFields(s severity, buf *buffer, file string, line int, fields []interface{}) {
+	if !l.limit.allow(s, file, line, buf.Bytes()[buf.header:]) {
+		suppress(buf.Len())
+		l.putBuffer(buf)
+		return
+	}
 	l.mu.Lock()
+	var trace []byte
 	if l.traceLocation.isSet() {
 		if l.traceLocation.match(file, line) {
-			buf.Write(stacks(false))
+			trace = stacks(false)
 		}
 	}
-	data := buf.Bytes()
-	os.Stderr.Write(data)
+	w, fallback, crashFile, batch := l.writer(s), l.fallback, l.crashFile, l.batch
+	l.mu.Unlock()
+
+	var msg []byte
 	if s == fatalLog {
-		os.Stderr.Write(stacks(true))
-		os.Exit(255)
+		msg = append(msg, buf.Bytes()...)
+		trace = append(trace, stacks(true)...)
+	}
+	var data []byte
+	if l.format.get() == JSON {
+		data = jsonLine(s, file, line, buf.at, buf.Bytes(), trace, l.headerFields.get(), fields)
+	} else {
+		buf.Write(trace)
+		data = buf.Bytes()
+	}
+	switch {
+	case batch == nil:
+		write(w, fallback, data)
+	case s < errorLog:
+		batch.add(w, data)
+	default:
+		batch.flush()
+		write(w, fallback, data)
+	}
+	if s == fatalLog {
+		crash(crashFile, msg, trace)
+		l.exit(255)
+		// Only reached if the exit func returns, as in tests
+		l.putBuffer(buf)
+		return
 	}
-	l.putBuffer(buf)
-	l.mu.Unlock()
 	if stats := severityStats[s]; stats != nil {
 		atomic.AddInt64(&stats.lines, 1)
 		atomic.AddInt64(&stats.bytes, int64(len(data)))
 	}
+	l.putBuffer(buf)
+}
+
+// writer returns the writer for logs of severity s.
+// logging.mu is held.
+func (l *loggingT) writer(s severity) io.Writer {
+	if w := l.outBySeverity[s]; w != nil {
+		return w
+	}
+	if l.out != nil {
+		return l.out
+	}
+	return os.Stderr
+}
+
+// write writes a log line to w, counting slow and failed writes and retrying
+// failed writes on the fallback writer.
+func write(w io.Writer, fallback io.Writer, data []byte) {
+	start := time.Now()
+	_, err := w.Write(data)
+	if time.Since(start) > SlowWriteThreshold {
+		atomic.AddInt64(&Stats.Writes.slow, 1)
+	}
+	if err == nil {
+		return
+	}
+	atomic.AddInt64(&Stats.Writes.failures, 1)
+	if fallback != nil {
+		if _, err := fallback.Write(data); err == nil {
+			atomic.AddInt64(&Stats.Writes.fallbacks, 1)
+		}
+	}
+}
+
+// SetFallbackOutput sets a writer for the log lines that cannot be written to
+// their usual writer, i.e. a file for when stderr is a broken pipe. A nil
+// writer, the default, means such lines are lost, though they are counted
+// in Stats.Writes.
+func SetFallbackOutput(w io.Writer) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.fallback = w
+}
+
+// SetOutput sets the writer for logs of every severity that has not been
+// given its own writer by SetOutputBySeverity. The default is os.Stderr. Lines
+// are written from the goroutine that logs them, so the writer must be safe
+// for concurrent use, and should write each line with a single write.
+func SetOutput(w io.Writer) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.out = w
+}
+
+// SetOutputBySeverity sets the writer for logs of the named severity, such
+// as "ERROR", overriding SetOutput. A nil writer removes the override.
+func SetOutputBySeverity(name string, w io.Writer) error {
+	s, ok := severityByName(name)
+	if !ok {
+		return errSeverity
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.outBySeverity[s] = w
+	return nil
+}
+
+// SetCrashFile sets the file to which a fatal log and the stacks of all
+// goroutines are appended before the process exits, overriding the
+// -log_crash_file flag. An empty path disables the crash file.
+func SetCrashFile(path string) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.crashFile = path
+}
+
+// CrashReporter, if set, is called with the message of a fatal log and the
+// stacks of all goroutines before the process exits, i.e. to send a final
+// event to an error tracker. It must not return until the event is sent.
+var CrashReporter func(message string, stacks []byte)
+
+// fatal holds the hooks run and the function called to exit after a fatal
+// log.
+type fatal struct {
+	mu      sync.Mutex
+	hooks   []func()
+	exit    func(code int)
+	exiting bool
+}
+
+// OnFatal adds a hook that is run after a fatal log is written and before
+// the process exits, i.e. to close database pools or flush an error tracker.
+// Hooks are run in the reverse order they were added, and a hook that panics
+// or logs a fatal error does not stop the others or the exit.
+func OnFatal(hook func()) {
+	logging.fatal.mu.Lock()
+	defer logging.fatal.mu.Unlock()
+	logging.fatal.hooks = append(logging.fatal.hooks, hook)
+}
+
+// SetExitFunc sets the function called with the exit code, 255, once a fatal
+// log has been written and the OnFatal hooks have run. It may exit with
+// another code. A nil function, the default, means os.Exit.
+func SetExitFunc(exit func(code int)) {
+	logging.fatal.mu.Lock()
+	defer logging.fatal.mu.Unlock()
+	logging.fatal.exit = exit
+}
+
+// exit runs the OnFatal hooks and exits. A fatal log from a hook exits at
+// once rather than running the hooks again.
+func (l *loggingT) exit(code int) {
+	l.fatal.mu.Lock()
+	hooks, exit, exiting := l.fatal.hooks, l.fatal.exit, l.fatal.exiting
+	l.fatal.exiting = true
+	l.fatal.mu.Unlock()
+	if exit == nil {
+		exit = os.Exit
+	}
+
+	if !exiting {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			runHook(hooks[i])
+		}
+		l.fatal.mu.Lock()
+		l.fatal.exiting = false
+		l.fatal.mu.Unlock()
+	}
+
+	exit(code)
+}
+
+// runHook runs an OnFatal hook, recovering from a panic.
+func runHook(hook func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(os.Stderr, "log: OnFatal hook panicked: %v\n", p)
+		}
+	}()
+	hook()
+}
+
+// crash writes a fatal log to the crash file, if any, and calls the
+// CrashReporter. Failures are written to stderr as nothing else can be done.
+func crash(path string, msg []byte, trace []byte) {
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log: cannot write crash file: %s\n", err)
+		} else {
+			fmt.Fprintf(f, "%s pid=%d %s\n", timeNow().UTC().Format(time.RFC3339Nano), pid, os.Args[0])
+			f.Write(msg)
+			f.Write(trace)
+			f.Write([]byte("\n"))
+			f.Close()
+		}
+	}
+
+	if CrashReporter != nil {
+		CrashReporter(string(bytes.TrimSuffix(msg, []byte("\n"))), trace)
+	}
+}
+
+// jsonLine formats a log line as a JSON object terminated by a newline. The
+// timestamp is at, or now if at is zero.
+func jsonLine(s severity, file string, line int, at time.Time, msg []byte, trace []byte, fields HeaderField, kv []interface{}) []byte {
+	if s > fatalLog {
+		s = infoLog // for safety.
+	}
+	if at.IsZero() {
+		at = timeNow()
+	}
+	var (
+		linePid   int
+		goroutine uint64
+	)
+	if fields&HeaderPID != 0 {
+		linePid = pid
+	}
+	if fields&HeaderGoroutine != 0 {
+		goroutine = goroutineID()
+	}
+	data, err := json.Marshal(struct {
+		Timestamp string                 `json:"timestamp"`
+		Severity  string                 `json:"severity"`
+		Pid       int                    `json:"pid,omitempty"`
+		Goroutine uint64                 `json:"goroutine,omitempty"`
+		File      string                 `json:"file"`
+		Line      int                    `json:"line"`
+		Message   string                 `json:"message"`
+		Fields    map[string]interface{} `json:"fields,omitempty"`
+		Stack     string                 `json:"stack,omitempty"`
+	}{
+		Fields:    kvMap(kv),
+		Pid:       linePid,
+		Goroutine: goroutine,
+		Timestamp: at.UTC().Format(time.RFC3339Nano),
+		Severity:  severityName[s],
+		File:      file,
+		Line:      line,
+		Message:   string(bytes.TrimSuffix(msg, []byte("\n"))),
+		Stack:     string(trace),
+	})
+	if err != nil {
+		// Strings always marshal, but never lose a log line
+		data = []byte(strconv.Quote(string(msg)))
+	}
+	return append(data, '\n')
 }
 
 // stacks is a wrapper for runtime.Stack that attempts to recover the data for all goroutines.
@@ -395,154 +785,200 @@ func stacks(all bool) []byte {
 var logExitFunc func(error)
 
 func Trace(args ...interface{}) {
-	if traceLog >= logging.verbosity {
+	if logging.enabled(traceLog, 0) {
 		logging.p(traceLog, args...)
 	}
 }
 
 func TraceDepth(depth int, args ...interface{}) {
-	if traceLog >= logging.verbosity {
+	if logging.enabled(traceLog, depth) {
 		logging.pDepth(traceLog, depth, args...)
 	}
 }
 
 func Traceln(args ...interface{}) {
-	if traceLog >= logging.verbosity {
+	if logging.enabled(traceLog, 0) {
 		logging.pln(traceLog, args...)
 	}
 }
 
 func Tracef(format string, args ...interface{}) {
-	if traceLog >= logging.verbosity {
+	if logging.enabled(traceLog, 0) {
 		logging.pf(traceLog, format, args...)
 	}
 }
 
 func Debug(args ...interface{}) {
-	if debugLog >= logging.verbosity {
+	if logging.enabled(debugLog, 0) {
 		logging.p(debugLog, args...)
 	}
 }
 
 func DebugDepth(depth int, args ...interface{}) {
-	if debugLog >= logging.verbosity {
+	if logging.enabled(debugLog, depth) {
 		logging.pDepth(debugLog, depth, args...)
 	}
 }
 
 func Debugln(args ...interface{}) {
-	if debugLog >= logging.verbosity {
+	if logging.enabled(debugLog, 0) {
 		logging.pln(debugLog, args...)
 	}
 }
 
 func Debugf(format string, args ...interface{}) {
-	if debugLog >= logging.verbosity {
+	if logging.enabled(debugLog, 0) {
 		logging.pf(debugLog, format, args...)
 	}
 }
 
 func Info(args ...interface{}) {
-	if infoLog >= logging.verbosity {
+	if logging.enabled(infoLog, 0) {
 		logging.p(infoLog, args...)
 	}
 }
 
 func InfoDepth(depth int, args ...interface{}) {
-	if infoLog >= logging.verbosity {
+	if logging.enabled(infoLog, depth) {
 		logging.pDepth(infoLog, depth, args...)
 	}
 }
 
 func Infoln(args ...interface{}) {
-	if infoLog >= logging.verbosity {
+	if logging.enabled(infoLog, 0) {
 		logging.pln(infoLog, args...)
 	}
 }
 
 func Infof(format string, args ...interface{}) {
-	if infoLog >= logging.verbosity {
+	if logging.enabled(infoLog, 0) {
 		logging.pf(infoLog, format, args...)
 	}
 }
 
 func Warning(args ...interface{}) {
-	if warningLog >= logging.verbosity {
+	if logging.enabled(warningLog, 0) {
 		logging.p(warningLog, args...)
 	}
 }
 
 func WarningDepth(depth int, args ...interface{}) {
-	if warningLog >= logging.verbosity {
+	if logging.enabled(warningLog, depth) {
 		logging.pDepth(warningLog, depth, args...)
 	}
 }
 
 func Warningln(args ...interface{}) {
-	if warningLog >= logging.verbosity {
+	if logging.enabled(warningLog, 0) {
 		logging.pln(warningLog, args...)
 	}
 }
 
 func Warningf(format string, args ...interface{}) {
-	if warningLog >= logging.verbosity {
+	if logging.enabled(warningLog, 0) {
 		logging.pf(warningLog, format, args...)
 	}
 }
 
 func Error(args ...interface{}) {
-	if errorLog >= logging.verbosity {
+	if logging.enabled(errorLog, 0) {
 		logging.p(errorLog, args...)
 	}
 }
 
 func ErrorDepth(depth int, args ...interface{}) {
-	if errorLog >= logging.verbosity {
+	if logging.enabled(errorLog, depth) {
 		logging.pDepth(errorLog, depth, args...)
 	}
 }
 
 func Errorln(args ...interface{}) {
-	if errorLog >= logging.verbosity {
+	if logging.enabled(errorLog, 0) {
 		logging.pln(errorLog, args...)
 	}
 }
 
 func Errorf(format string, args ...interface{}) {
-	if errorLog >= logging.verbosity {
+	if logging.enabled(errorLog, 0) {
 		logging.pf(errorLog, format, args...)
 	}
 }
 
 func Fatal(args ...interface{}) {
-	if fatalLog >= logging.verbosity {
+	if logging.enabled(fatalLog, 0) {
 		logging.p(fatalLog, args...)
 	}
 }
 
 func FatalDepth(depth int, args ...interface{}) {
-	if fatalLog >= logging.verbosity {
+	if logging.enabled(fatalLog, depth) {
 		logging.pDepth(fatalLog, depth, args...)
 	}
 }
 
 func Fatalln(args ...interface{}) {
-	if fatalLog >= logging.verbosity {
+	if logging.enabled(fatalLog, 0) {
 		logging.pln(fatalLog, args...)
 	}
 }
 
 func Fatalf(format string, args ...interface{}) {
-	if fatalLog >= logging.verbosity {
+	if logging.enabled(fatalLog, 0) {
 		logging.pf(fatalLog, format, args...)
 	}
 }
 
+// Always logs at INFO whatever the -v and -vmodule flags, for the few lines
+// that must always be written, such as those that record how the process was
+// started.
+func Always(args ...interface{}) {
+	logging.p(infoLog, args...)
+}
+
+// Alwaysf is Always with formatting.
+func Alwaysf(format string, args ...interface{}) {
+	logging.pf(infoLog, format, args...)
+}
+
+// Atrace logs at TRACE whatever the -v flag.
+//
+// Deprecated: use Always.
 func Atrace(ln string) {
 	logging.p(traceLog, ln)
 }
 
+// StartupInfo describes the binary and how it was started.
+type StartupInfo struct {
+	Binary    string   `json:"binary"`
+	Revision  string   `json:"revision"`
+	GoVersion string   `json:"goVersion"`
+	PID       int      `json:"pid"`
+	Args      []string `json:"args"`
+}
+
+// Startup logs a StartupInfo for the revision with Always, as the word
+// startup followed by the StartupInfo as JSON, and returns it.
+func Startup(revision string) StartupInfo {
+	return logStartup(revision)
+}
+
+// Version logs the binary, revision and Go version.
+//
+// Deprecated: use Startup, which writes a StartupInfo.
 func Version(revision string) {
-	ln := fmt.Sprintf("%s %s %s", os.Args[0], revision, runtime.Version())
-	logging.p(infoLog, ln)
+	logStartup(revision)
+}
+
+// logStartup logs the StartupInfo for the caller of Startup or Version.
+func logStartup(revision string) StartupInfo {
+	info := StartupInfo{
+		Binary:    os.Args[0],
+		Revision:  revision,
+		GoVersion: runtime.Version(),
+		PID:       pid,
+		Args:      os.Args[1:],
+	}
+	b, _ := json.Marshal(info)
+	logging.pDepth(infoLog, 1, "startup "+string(b))
+	return info
 }
@@ -0,0 +1,516 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetOutputBySeverity(t *testing.T) {
+	var all, errs bytes.Buffer
+	SetOutput(&all)
+	if err := SetOutputBySeverity("error", &errs); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		SetOutput(nil)
+		SetOutputBySeverity("error", nil)
+	}()
+
+	Info("to all")
+	Error("to errs")
+
+	if !strings.Contains(all.String(), "to all") ||
+		strings.Contains(all.String(), "to errs") {
+		t.Errorf("unexpected default output: %q", all.String())
+	}
+	if !strings.Contains(errs.String(), "to errs") ||
+		strings.Contains(errs.String(), "to all") {
+		t.Errorf("unexpected error output: %q", errs.String())
+	}
+
+	if err := SetOutputBySeverity("loud", &errs); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
+
+func TestCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crash.log")
+
+	var reported string
+	CrashReporter = func(message string, stacks []byte) { reported = message }
+	defer func() { CrashReporter = nil }()
+
+	crash(path, []byte("F main.go:1] boom\n"), stacks(true))
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "boom") || !strings.Contains(string(b), "goroutine") {
+		t.Errorf("crash file should hold the message and stacks: %q", b)
+	}
+	if reported != "F main.go:1] boom" {
+		t.Errorf("CrashReporter was called with %q", reported)
+	}
+}
+
+func TestOnFatal(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	order := []string{}
+	OnFatal(func() { order = append(order, "first") })
+	OnFatal(func() { panic("broken hook") })
+	OnFatal(func() {
+		order = append(order, "last")
+		Fatal("from a hook")
+	})
+	code := 0
+	SetExitFunc(func(c int) { code = c })
+	defer func() {
+		logging.fatal.hooks = nil
+		SetExitFunc(nil)
+	}()
+
+	Fatal("boom")
+
+	if strings.Join(order, ",") != "last,first" {
+		t.Errorf("hooks ran in the order %v, expected last,first", order)
+	}
+	if code != 255 {
+		t.Errorf("the exit func was called with %d, expected 255", code)
+	}
+	if !strings.Contains(out.String(), "boom") {
+		t.Errorf("the fatal log should be written before the hooks run: %q", out.String())
+	}
+}
+
+func TestVModule(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	if err := SetVModule("log_test=debug"); err != nil {
+		t.Fatal(err)
+	}
+	Debug("from this file")
+	Trace("below the module level")
+
+	if err := SetVModule("router*=debug"); err != nil {
+		t.Fatal(err)
+	}
+	Debug("from another file")
+	SetVModule("")
+
+	if !strings.Contains(out.String(), "from this file") {
+		t.Errorf("debug log from a matching file should be written: %q", out.String())
+	}
+	if strings.Contains(out.String(), "below the module level") ||
+		strings.Contains(out.String(), "from another file") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	if err := SetVModule("router*"); err == nil {
+		t.Errorf("SetVModule() should reject a setting without a level")
+	}
+}
+
+func TestSetHeaderFields(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	timeNow = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 123456000, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	SetHeaderFields(HeaderTimestamp, HeaderPID)
+	Info("with time")
+	SetHeaderFields(HeaderGlogTimestamp)
+	Info("with glog time")
+	SetHeaderFields()
+
+	lines := strings.Split(out.String(), "\n")
+	expected := fmt.Sprintf("I 2006-01-02T15:04:05.123456Z %d log_test.go:", os.Getpid())
+	if !strings.HasPrefix(lines[0], expected) {
+		t.Errorf("header %q should begin %q", lines[0], expected)
+	}
+	if !strings.HasPrefix(lines[1], "I0102 15:04:05.123456 log_test.go:") {
+		t.Errorf("header %q should be in the glog layout", lines[1])
+	}
+}
+
+func TestStartup(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	info := Startup("abc123")
+
+	line := out.String()
+	if !strings.Contains(line, "log_test.go:") {
+		t.Errorf("%q should give the caller's file", line)
+	}
+
+	var logged StartupInfo
+	payload := line[strings.Index(line, "startup ")+len("startup "):]
+	if err := json.Unmarshal([]byte(payload), &logged); err != nil {
+		t.Fatalf("%q should end with a StartupInfo: %s", line, err)
+	}
+	if logged.Revision != "abc123" || logged.GoVersion != info.GoVersion {
+		t.Errorf("logged %+v, expected %+v", logged, info)
+	}
+}
+
+func TestKV(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	logger := With("request_id", "abc")
+	logger.Info("user updated", "name", "a b", "err", errors.New("x"))
+
+	expected := `] user updated request_id=abc name="a b" err=x` + "\n"
+	if !strings.HasSuffix(out.String(), expected) || !strings.Contains(out.String(), "log_test.go:") {
+		t.Errorf("%q should end %q", out.String(), expected)
+	}
+
+	out.Reset()
+	SetFormat(JSON)
+	defer SetFormat(Text)
+	InfoKV("odd", "zone_id", 123, "dangling")
+
+	var line struct {
+		Message string                 `json:"message"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Message != "odd" || line.Fields["zone_id"] != 123.0 || line.Fields["dangling"] != "(MISSING)" {
+		t.Errorf("unexpected JSON line %s", out.String())
+	}
+}
+
+// failingWriter fails every write, as stderr does when it is a broken pipe
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteFailures(t *testing.T) {
+	var fallback bytes.Buffer
+	SetOutput(failingWriter{})
+	SetFallbackOutput(&fallback)
+	defer func() {
+		SetOutput(nil)
+		SetFallbackOutput(nil)
+	}()
+
+	failures, fallbacks := Stats.Writes.Failures(), Stats.Writes.Fallbacks()
+	Info("not lost")
+
+	if Stats.Writes.Failures() != failures+1 || Stats.Writes.Fallbacks() != fallbacks+1 {
+		t.Errorf("the failed write should be counted and written to the fallback")
+	}
+	if !strings.Contains(fallback.String(), "not lost") {
+		t.Errorf("fallback output %q should have the line", fallback.String())
+	}
+}
+
+func BenchmarkInfoParallel(b *testing.B) {
+	SetOutput(io.Discard)
+	defer SetOutput(nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			Infof("request served in %dms", 42)
+		}
+	})
+}
+
+func TestJournald(t *testing.T) {
+	journalSocket = filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenPacket("unixgram", journalSocket)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	if err := SetDestination("journald"); err != nil {
+		t.Fatal(err)
+	}
+	SetFormat(JSON)
+	defer func() {
+		SetDestination("stderr")
+		SetFormat(Text)
+	}()
+
+	WarningKV("disk full", "zone_id", 7)
+
+	b := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(b[:n])
+
+	for _, field := range []string{"PRIORITY=4\n", "CODE_FILE=log_test.go\n", "ZONE_ID=7\n", "MESSAGE=disk full\n"} {
+		if !strings.Contains(msg, field) {
+			t.Errorf("journal message %q should contain %q", msg, field)
+		}
+	}
+}
+
+// countingWriter counts the writes made to it
+type countingWriter struct {
+	mu     sync.Mutex
+	writes int
+	buf    bytes.Buffer
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	return c.buf.Write(b)
+}
+
+func TestBatching(t *testing.T) {
+	var out countingWriter
+	SetOutput(&out)
+	SetBatching(1<<20, time.Hour)
+	defer func() {
+		SetBatching(0, 0)
+		SetOutput(nil)
+	}()
+
+	for i := 0; i < 100; i++ {
+		Infof("line %d", i)
+	}
+	out.mu.Lock()
+	if out.writes != 0 {
+		t.Errorf("%d writes were made before the batch was full", out.writes)
+	}
+	out.mu.Unlock()
+
+	Error("flushes")
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.writes != 2 {
+		t.Errorf("an error should be written with one write after one for the batch, made %d", out.writes)
+	}
+	if !strings.HasSuffix(out.buf.String(), "flushes\n") || !strings.Contains(out.buf.String(), "line 99\n") {
+		t.Errorf("the lines should be written in order: %q", out.buf.String())
+	}
+}
+
+func TestSetBatchingWhileLogging(t *testing.T) {
+	var out countingWriter
+	SetOutput(&out)
+	defer func() {
+		SetBatching(0, 0)
+		SetOutput(nil)
+	}()
+
+	const goroutines = 4
+	done := make(chan struct{})
+	logged := make(chan int, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			n := 0
+			for {
+				select {
+				case <-done:
+					logged <- n
+					return
+				default:
+				}
+				Infof("goroutine %d line %d", g, n)
+				n++
+			}
+		}(g)
+	}
+
+	for i := 0; i < 500; i++ {
+		SetBatching(1<<20, time.Hour)
+		SetBatching(0, 0)
+	}
+	SetBatching(1<<20, time.Hour)
+	close(done)
+	total := 0
+	for g := 0; g < goroutines; g++ {
+		total += <-logged
+	}
+	SetBatching(0, 0)
+
+	out.mu.Lock()
+	if n := strings.Count(out.buf.String(), "\n"); n != total {
+		t.Errorf("%d of %d lines were written, none should be lost when batching is changed", n, total)
+	}
+	out.mu.Unlock()
+
+	// A line added by a goroutine that read the batcher before it was
+	// replaced is written rather than held forever
+	b := newBatcher(1<<20, time.Hour)
+	b.close()
+	b.add(&out, []byte("late\n"))
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if !strings.HasSuffix(out.buf.String(), "late\n") {
+		t.Error("a line added after the batcher is stopped should be written")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetRateLimit(2)
+	defer func() {
+		SetRateLimit(0)
+		SetOutput(nil)
+	}()
+
+	suppressed := Stats.Suppressed.Lines()
+	for i := 0; i < 5; i++ {
+		Error("the same error")
+		Errorf("error %d", i)
+	}
+
+	if n := strings.Count(out.String(), "the same error"); n != 2 {
+		t.Errorf("%d identical lines were written, expected 2", n)
+	}
+	if n := strings.Count(out.String(), "] error "); n != 5 {
+		t.Errorf("%d distinct lines were written, expected 5", n)
+	}
+
+	sampled := 0
+	for i := 0; i < 10; i++ {
+		if Sampled(5) {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Errorf("Sampled(5) was true %d times in 10 calls, expected 2", sampled)
+	}
+
+	if Stats.Suppressed.Lines() != suppressed+3+8 {
+		t.Errorf("Stats.Suppressed.Lines() = %d, expected %d", Stats.Suppressed.Lines(), suppressed+11)
+	}
+}
+
+func TestTail(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	ctx, tail := WithTail(context.Background())
+	DebugContext(ctx, "first detail")
+	DebugfContext(ctx, "second %s", "detail")
+	if out.Len() != 0 || tail.Len() != 2 {
+		t.Fatalf("the lines should be held, not written: %q", out.String())
+	}
+
+	tail.Flush()
+	if !strings.Contains(out.String(), "first detail") || !strings.Contains(out.String(), "second detail") {
+		t.Errorf("Flush should write the held lines: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "log_test.go") {
+		t.Errorf("the held lines should have the file of the caller: %q", out.String())
+	}
+
+	out.Reset()
+	TraceContext(ctx, "more detail")
+	tail.Discard()
+	tail.Flush()
+	if out.Len() != 0 {
+		t.Errorf("Discard should drop the held lines: %q", out.String())
+	}
+}
+
+func TestTailFlushAfterLongHeader(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	ctx, tail := WithTail(context.Background())
+	DebugContext(ctx, "held")
+
+	// A line with a long header returns its buffer to the pool that Flush
+	// takes from
+	SetHeaderFields(HeaderTimestamp, HeaderPID, HeaderGoroutine)
+	defer SetHeaderFields()
+	debug, _ := WithVerbosity(context.Background(), "debug")
+	DebugfContext(debug, "a %s", "line")
+
+	out.Reset()
+	tail.Flush()
+	if !strings.Contains(out.String(), "held") {
+		t.Errorf("Flush should write the held line: %q", out.String())
+	}
+}
+
+func TestTailFlushTime(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+	SetFormat(JSON)
+	defer SetFormat(Text)
+
+	logged := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return logged }
+	defer func() { timeNow = time.Now }()
+
+	ctx, tail := WithTail(context.Background())
+	DebugContext(ctx, "held")
+
+	timeNow = func() time.Time { return logged.Add(time.Minute) }
+	tail.Flush()
+	if !strings.Contains(out.String(), `"timestamp":"2006-01-02T15:04:05Z"`) {
+		t.Errorf("the flushed line should have the time it was logged: %q", out.String())
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(nil)
+
+	ctx, tail := WithTail(NewContext(context.Background(), With("request_id", "abc")))
+	FromContext(ctx).Debug("held", "user_id", 1)
+	DebugContext(ctx, "also held")
+	if out.Len() != 0 || tail.Len() != 2 {
+		t.Fatalf("the lines should be held, not written: %q", out.String())
+	}
+
+	tail.Flush()
+	if !strings.Contains(out.String(), "held request_id=abc user_id=1") || !strings.Contains(out.String(), "also held request_id=abc") {
+		t.Errorf("the held lines should have the fields of the context: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "log_test.go") {
+		t.Errorf("the held lines should have the file of the caller: %q", out.String())
+	}
+
+	out.Reset()
+	debug, _ := WithVerbosity(ctx, "debug")
+	FromContext(debug).Debug("written")
+	InfoContext(debug, "info")
+	if !strings.Contains(out.String(), "written request_id=abc") || !strings.Contains(out.String(), "info request_id=abc") || tail.Len() != 0 {
+		t.Errorf("the verbosity of the context should apply: %q", out.String())
+	}
+}
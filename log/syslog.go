@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+)
+
+// syslogWriter writes log lines of one severity to syslog.
+type syslogWriter struct {
+	w     *syslog.Writer
+	write func(w *syslog.Writer, m string) error
+}
+
+// Write is part of the io.Writer interface.
+func (s *syslogWriter) Write(b []byte) (int, error) {
+	if err := s.write(s.w, string(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func newSyslogWriters() ([fatalLog + 1]io.Writer, error) {
+	var writers [fatalLog + 1]io.Writer
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, filepath.Base(os.Args[0]))
+	if err != nil {
+		return writers, err
+	}
+	writers[traceLog] = &syslogWriter{w: w, write: (*syslog.Writer).Debug}
+	writers[debugLog] = &syslogWriter{w: w, write: (*syslog.Writer).Debug}
+	writers[infoLog] = &syslogWriter{w: w, write: (*syslog.Writer).Info}
+	writers[warningLog] = &syslogWriter{w: w, write: (*syslog.Writer).Warning}
+	writers[errorLog] = &syslogWriter{w: w, write: (*syslog.Writer).Err}
+	writers[fatalLog] = &syslogWriter{w: w, write: (*syslog.Writer).Crit}
+	return writers, nil
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriters() ([fatalLog + 1]io.Writer, error) {
+	return [fatalLog + 1]io.Writer{}, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxTailLines limits the number of lines a Tail holds. Once it is full the
+// oldest lines are dropped, and counted in Stats.Suppressed.
+var MaxTailLines = 1000
+
+// Tail holds the TRACE and DEBUG lines logged for a context with the Context
+// functions, or a Logger from FromContext, that are not enabled, so that they
+// can be written if something goes wrong, i.e. a request fails, and discarded
+// otherwise.
+type Tail struct {
+	mu    sync.Mutex
+	lines []heldLine
+}
+
+// heldLine is a formatted line held by a Tail.
+type heldLine struct {
+	s      severity
+	data   []byte
+	header int
+	at     time.Time
+	file   string
+	line   int
+	fields []interface{}
+}
+
+// WithTail returns a copy of ctx that holds the TRACE and DEBUG lines logged
+// for it with the Context functions, such as DebugContext, when they are not
+// enabled, and the Tail that holds them. Call Flush to write the lines, or
+// Discard to drop them.
+func WithTail(ctx context.Context) (context.Context, *Tail) {
+	t := &Tail{}
+	return context.WithValue(ctx, tailKey, t), t
+}
+
+// tailFrom returns the Tail of ctx, if any.
+func tailFrom(ctx context.Context) *Tail {
+	t, _ := ctx.Value(tailKey).(*Tail)
+	return t
+}
+
+// hold formats a line as it would be written and holds it. It must be called
+// directly by the Context functions or a Logger so that the file and line are
+// those of their caller.
+func (t *Tail) hold(s severity, msg string, fields []interface{}) {
+	at := timeNow()
+	buf, file, line := logging.header(s, 0)
+	header := buf.header
+	buf.WriteString(strings.Replace(msg, "\n", "", -1))
+	logging.writeFields(buf, fields)
+	buf.WriteByte('\n')
+	data := append([]byte(nil), buf.Bytes()...)
+	logging.putBuffer(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.lines) >= MaxTailLines && len(t.lines) > 0 {
+		suppress(len(t.lines[0].data))
+		t.lines = t.lines[1:]
+	}
+	t.lines = append(t.lines, heldLine{s: s, data: data, header: header, at: at, file: file, line: line, fields: fields})
+}
+
+// Len returns the number of lines held.
+func (t *Tail) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.lines)
+}
+
+// Flush writes the lines held, in the order they were logged, and empties
+// the Tail.
+func (t *Tail) Flush() {
+	t.mu.Lock()
+	lines := t.lines
+	t.lines = nil
+	t.mu.Unlock()
+
+	for _, h := range lines {
+		buf := logging.getBuffer(h.s)
+		buf.Write(h.data)
+		buf.header = h.header
+		buf.at = h.at
+		logging.outputFields(h.s, buf, h.file, h.line, h.fields)
+	}
+}
+
+// Discard drops the lines held, counting them in Stats.Suppressed.
+func (t *Tail) Discard() {
+	t.mu.Lock()
+	lines := t.lines
+	t.lines = nil
+	t.mu.Unlock()
+
+	for _, h := range lines {
+		suppress(len(h.data))
+	}
+}
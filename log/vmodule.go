@@ -0,0 +1,148 @@
+package log
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// modulePat contains a filter for the -vmodule flag.
+// It holds a file name pattern and the severity from which logs are written.
+type modulePat struct {
+	pattern string
+	full    bool // the pattern contains a "/" and so matches the full path
+	level   severity
+}
+
+// match reports whether the file matches the pattern. The file is the full
+// path of the source file without the ".go" suffix.
+func (m *modulePat) match(file string) bool {
+	if !m.full {
+		file = filepath.Base(file)
+	}
+	match, _ := filepath.Match(m.pattern, file)
+	return match
+}
+
+// moduleSpec represents the setting of the -vmodule flag.
+type moduleSpec struct {
+	filter []modulePat
+}
+
+// String is part of the flag.Value interface.
+func (m *moduleSpec) String() string {
+	// Lock because the type is not atomic.
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	parts := []string{}
+	for _, f := range m.filter {
+		parts = append(parts, f.pattern+"="+strings.ToLower(severityName[f.level]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Get is part of the (Go 1.2) flag.Getter interface. It always returns nil
+// for this flag type since the struct is not exported.
+func (m *moduleSpec) Get() interface{} {
+	return nil
+}
+
+var errVmoduleSyntax = errors.New("syntax error: expect comma-separated list of filename=level")
+
+// Syntax: -vmodule=router*=debug,db*=trace
+func (m *moduleSpec) Set(value string) error {
+	var filter []modulePat
+	for _, pat := range strings.Split(value, ",") {
+		if len(pat) == 0 {
+			// Empty strings such as from a trailing comma can be ignored.
+			continue
+		}
+		patLev := strings.Split(pat, "=")
+		if len(patLev) != 2 || len(patLev[0]) == 0 || len(patLev[1]) == 0 {
+			return errVmoduleSyntax
+		}
+		pattern := strings.TrimSuffix(patLev[0], ".go")
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errVmoduleSyntax
+		}
+		level, ok := severityByName(patLev[1])
+		if !ok {
+			return errSeverity
+		}
+		filter = append(filter, modulePat{
+			pattern: pattern,
+			full:    strings.Contains(pattern, "/"),
+			level:   level,
+		})
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.setVState(filter)
+	return nil
+}
+
+// SetVModule sets the per-file verbosity, overriding the -vmodule flag, i.e.
+//
+//	log.SetVModule("router*=debug,db*=trace")
+//
+// An empty spec removes all of the overrides.
+func SetVModule(spec string) error {
+	return logging.vmodule.Set(spec)
+}
+
+// setVState sets the filters of the -vmodule flag and clears the cache of
+// the severity of each call site.
+// logging.mu is held.
+func (l *loggingT) setVState(filter []modulePat) {
+	// Turn off the filters while they are changed.
+	atomic.StoreInt32(&l.filterLength, 0)
+	l.vmodule.filter = filter
+	l.vmap = make(map[uintptr]severity)
+	atomic.StoreInt32(&l.filterLength, int32(len(filter)))
+}
+
+// enabled reports whether a log of severity s from the caller depth frames
+// above the caller of the logging function is written, being when s is at
+// least the -v severity, or the severity given by -vmodule for the file.
+func (l *loggingT) enabled(s severity, depth int) bool {
+	if s >= l.verbosity.get() {
+		return true
+	}
+	if atomic.LoadInt32(&l.filterLength) == 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if runtime.Callers(3+depth, l.pcs[:]) == 0 {
+		return false
+	}
+	v, ok := l.vmap[l.pcs[0]]
+	if !ok {
+		v = l.setV(l.pcs[0])
+	}
+	return s >= v
+}
+
+// noFilter is the severity of call sites in files that match no filter. It
+// is above every severity, so that they are governed by -v alone.
+const noFilter = severity(fatalLog + 1)
+
+// setV computes and remembers the severity for the call site at pc.
+// logging.mu is held.
+func (l *loggingT) setV(pc uintptr) severity {
+	fn := runtime.FuncForPC(pc)
+	file, _ := fn.FileLine(pc)
+	file = strings.TrimSuffix(file, ".go")
+	v := noFilter
+	for _, filter := range l.vmodule.filter {
+		if filter.match(file) {
+			v = filter.level
+			break
+		}
+	}
+	l.vmap[pc] = v
+	return v
+}
@@ -0,0 +1,78 @@
+// Package metrics provides simple labelled counters and gauges. Values are
+// published via expvar so that they can be read as JSON without the service
+// depending upon a particular metrics system.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+)
+
+// published holds every counter and gauge, keyed by name and labels, i.e.
+//
+//	requests{status=2xx,tenant=acme}
+var published = expvar.NewMap("metrics")
+
+// key returns the published key for a metric name and a list of label
+// key/value pairs. An unpaired trailing label is ignored.
+func key(name string, labels []string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteByte('=')
+		b.WriteString(labels[i+1])
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// Add adds delta to the counter identified by name and labels, where labels
+// are key/value pairs, i.e. Add("requests", 1, "tenant", "acme")
+func Add(name string, delta int64, labels ...string) {
+	published.Add(key(name, labels), delta)
+}
+
+// Inc increments the counter identified by name and labels by one
+func Inc(name string, labels ...string) {
+	Add(name, 1, labels...)
+}
+
+// Set sets the gauge identified by name and labels to value
+func Set(name string, value int64, labels ...string) {
+	k := key(name, labels)
+
+	// Add ensures that the value exists before we set it
+	published.Add(k, 0)
+	if v, ok := published.Get(k).(*expvar.Int); ok {
+		v.Set(value)
+	}
+}
+
+// Get returns the current value of the counter or gauge identified by name
+// and labels, or zero if it has never been set
+func Get(name string, labels ...string) int64 {
+	if v, ok := published.Get(key(name, labels)).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+// Handler returns a http.Handler that serves all published metrics as JSON
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(published.String()))
+	})
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	Inc("test_requests", "tenant", "acme", "status")
+	Add("test_requests", 2, "tenant", "acme")
+	Inc("test_requests", "tenant", "initech")
+	Set("test_queue", 5)
+	Set("test_queue", 3)
+
+	tests := []struct {
+		name     string
+		labels   []string
+		expected int64
+	}{
+		{"test_requests", []string{"tenant", "acme"}, 3},
+		{"test_requests", []string{"tenant", "initech"}, 1},
+		{"test_requests", nil, 0},
+		{"test_queue", nil, 3},
+	}
+
+	for _, test := range tests {
+		if v := Get(test.name, test.labels...); v != test.expected {
+			t.Errorf("%s%v = %d, expected %d", test.name, test.labels, v, test.expected)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/_metrics", nil))
+
+	var published map[string]int64
+	if err := json.Unmarshal(rec.Body.Bytes(), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published["test_requests{tenant=acme}"] != 3 || published["test_queue"] != 3 {
+		t.Errorf("the handler should publish every metric by key: %s", rec.Body.String())
+	}
+}
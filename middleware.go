@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http"
+	gopprof "net/http/pprof"
+	"strings"
+)
+
+// Middleware wraps a http.Handler and returns a http.Handler that may act
+// before and/or after calling the wrapped handler
+type Middleware func(http.Handler) http.Handler
+
+// Use adds middleware that will be applied to every request served by the
+// WebService, including the framework routes. Middleware is applied in the
+// order in which it is added, the first added being the outermost.
+func (ws *WebService) Use(mw ...Middleware) {
+	ws.middleware = append(ws.middleware, mw...)
+}
+
+// Use adds middleware that will only be applied to requests for this
+// controller's route. Controller middleware runs after the WebService
+// middleware, and after the request has been authenticated and authorized
+// by RequireAuth and RequireScope, so that it sees the Identity of the
+// caller.
+func (wc *WebController) Use(mw ...Middleware) {
+	wc.middleware = append(wc.middleware, mw...)
+}
+
+// chain wraps h with the middleware so that mw[0] is the outermost handler
+func chain(h http.Handler, mw []Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// pprofPrefix is where pprof tools expect to find the net/http/pprof handlers
+const pprofPrefix = "/debug/pprof/"
+
+// pprofMiddleware returns Middleware that serves the net/http/pprof handlers
+// beneath pprofPrefix, to requests with the debug token if one is given, and
+// passes all other requests to next
+func pprofMiddleware(debugToken string) Middleware {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPrefix, gopprof.Index)
+	mux.HandleFunc(pprofPrefix+"cmdline", gopprof.Cmdline)
+	mux.HandleFunc(pprofPrefix+"profile", gopprof.Profile)
+	mux.HandleFunc(pprofPrefix+"symbol", gopprof.Symbol)
+	mux.HandleFunc(pprofPrefix+"trace", gopprof.Trace)
+	pprof := requireDebugToken(debugToken, mux)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if strings.HasPrefix(req.URL.Path, pprofPrefix) {
+				pprof.ServeHTTP(w, req)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
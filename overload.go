@@ -0,0 +1,201 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// ShedLogInterval is the interval at which a summary of shed requests is
+// logged, rather than logging each shed request
+var ShedLogInterval = 10 * time.Second
+
+// Unavailable is rendered when a request is refused with 503 Service
+// Unavailable because the service is overloaded or in maintenance
+type Unavailable struct {
+	Message    string `json:"error"`
+	Reason     string `json:"reason"`
+	RetryAfter int64  `json:"retryAfter"`
+	QueueDepth int64  `json:"queueDepth"`
+}
+
+// RenderUnavailable refuses a request with 503 Service Unavailable, setting
+// the Retry-After header and rendering an Unavailable body. Shed requests are
+// counted and a summary is logged at most once per ShedLogInterval.
+func RenderUnavailable(
+	w http.ResponseWriter,
+	reason string,
+	retryAfter time.Duration,
+	queueDepth int64,
+) {
+	secs := int64(retryAfter / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	metrics.Inc("requests_shed", "reason", reason)
+	shedLog.record(reason)
+
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	render.JSON(w, http.StatusServiceUnavailable, Unavailable{
+		Message:    "service unavailable",
+		Reason:     reason,
+		RetryAfter: secs,
+		QueueDepth: queueDepth,
+	})
+}
+
+// shedLog counts shed requests and logs a single line summarising them once
+// per ShedLogInterval
+var shedLog = &sampledLog{counts: make(map[string]int64), totals: make(map[string]int64)}
+
+// sampledLog holds the counts since the last summary, and the totals since
+// the process started. Requests shed within ShedLogInterval of a summary are
+// summarised by a timer once the interval has passed, so that the last of a
+// burst is logged even if no more requests are shed.
+type sampledLog struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	totals map[string]int64
+	since  time.Time
+	last   time.Time
+	timer  *time.Timer
+}
+
+func (s *sampledLog) record(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.counts) == 0 {
+		s.since = now
+	}
+	s.counts[reason]++
+	s.totals[reason]++
+
+	if wait := ShedLogInterval - now.Sub(s.last); wait > 0 {
+		if s.timer == nil {
+			s.timer = time.AfterFunc(wait, s.flushPending)
+		}
+		return
+	}
+
+	s.flush(now)
+}
+
+// flushPending logs the summary of the requests shed since the last one, and
+// is called by the timer set by record
+func (s *sampledLog) flushPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timer = nil
+	s.flush(time.Now())
+}
+
+// flush logs the summary of the requests shed since the last one, if any, and
+// must be called with the lock held
+func (s *sampledLog) flush(now time.Time) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	if len(s.counts) == 0 {
+		return
+	}
+
+	for r, n := range s.counts {
+		log.Warningf("shed %d requests (reason: %s) in %s", n, r, now.Sub(s.since).Round(time.Millisecond))
+		delete(s.counts, r)
+	}
+	s.last = now
+}
+
+// byReason returns a copy of the totals by reason
+func (s *sampledLog) byReason() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := make(map[string]int64, len(s.totals))
+	for r, n := range s.totals {
+		totals[r] = n
+	}
+
+	return totals
+}
+
+// LoadShed returns Middleware that refuses requests with 503 Service
+// Unavailable while more than maxInFlight requests are being served,
+// suggesting that clients retry after retryAfter. The operational routes are
+// never shed so that the service can still be observed.
+func LoadShed(maxInFlight int64, retryAfter time.Duration) Middleware {
+	var inFlight int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if isAdminRoute(req.URL.Path) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+
+			if n > maxInFlight {
+				RenderUnavailable(w, "overload", retryAfter, n-1)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// maintenance holds the current maintenance state, if any
+var maintenance atomic.Value
+
+type maintenanceState struct {
+	reason     string
+	retryAfter time.Duration
+}
+
+// EnterMaintenance causes the Maintenance middleware to refuse requests with
+// 503 Service Unavailable giving the reason, i.e. "database migration", and
+// suggesting that clients retry after retryAfter
+func EnterMaintenance(reason string, retryAfter time.Duration) {
+	maintenance.Store(&maintenanceState{reason: reason, retryAfter: retryAfter})
+}
+
+// ExitMaintenance ends maintenance mode
+func ExitMaintenance() {
+	maintenance.Store((*maintenanceState)(nil))
+}
+
+// InMaintenance returns true if maintenance mode is on
+func InMaintenance() bool {
+	m, _ := maintenance.Load().(*maintenanceState)
+	return m != nil
+}
+
+// Maintenance returns Middleware that refuses requests while maintenance mode
+// is on, see EnterMaintenance. The operational routes remain available.
+func Maintenance() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			m, _ := maintenance.Load().(*maintenanceState)
+			if m != nil && !isAdminRoute(req.URL.Path) {
+				RenderUnavailable(w, m.reason, m.retryAfter, 0)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestLoadShed(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := LoadShed(1, 2*time.Second)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("a request over the limit = %d with Retry-After %q, expected 503 with 2", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	<-done
+}
+
+func TestShedLogSampling(t *testing.T) {
+	var out syncBuffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	interval := ShedLogInterval
+	ShedLogInterval = 50 * time.Millisecond
+	defer func() { ShedLogInterval = interval }()
+
+	s := &sampledLog{counts: make(map[string]int64), totals: make(map[string]int64)}
+
+	s.record("overload")
+	if !strings.Contains(out.String(), "shed 1 requests (reason: overload)") {
+		t.Errorf("the first shed request should be logged: %q", out.String())
+	}
+
+	s.record("overload")
+	s.record("overload")
+	s.record("maintenance")
+	if n := strings.Count(out.String(), "shed "); n != 1 {
+		t.Errorf("requests shed within the interval should not be logged yet, got %d lines: %q", n, out.String())
+	}
+
+	// No more requests are shed, so the summary must be logged by the timer
+	for i := 0; i < 100 && strings.Count(out.String(), "shed ") < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "shed 2 requests (reason: overload)") ||
+		!strings.Contains(out.String(), "shed 1 requests (reason: maintenance)") {
+		t.Errorf("the suppressed requests should be summarised once the interval passes: %q", out.String())
+	}
+
+	if totals := s.byReason(); totals["overload"] != 3 || totals["maintenance"] != 1 {
+		t.Errorf("totals = %v, expected 3 overload and 1 maintenance", totals)
+	}
+}
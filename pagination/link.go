@@ -0,0 +1,146 @@
+package pagination
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/service/render"
+)
+
+// LinkHeader returns an RFC 5988 Link header value with the first, prev, next
+// and last pages of a collection, i.e.
+//
+//	<https://api/things?limit=25&offset=0>; rel="first", <https://api/things?limit=25&offset=50>; rel="next"
+//
+// The links are baseURL with the limit and offset query parameters replacing
+// any pagination parameters already present. prev is omitted on the first
+// page and next on the last, and an empty string is returned if baseURL
+// cannot be parsed.
+func LinkHeader(baseURL string, core Core) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	limit := core.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	link := func(offset int64, rel string) string {
+		q := u.Query()
+		q.Del("page")
+		q.Del("per_page")
+		q.Set("limit", strconv.FormatInt(limit, 10))
+		q.Set("offset", strconv.FormatInt(offset, 10))
+
+		l := *u
+		l.RawQuery = q.Encode()
+
+		return "<" + l.String() + `>; rel="` + rel + `"`
+	}
+
+	last := int64(0)
+	if core.Total > 0 {
+		last = MaxOffset(core.Total, limit)
+	}
+
+	links := []string{link(0, "first")}
+
+	if core.Offset > 0 {
+		prev := core.Offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		if prev > last {
+			prev = last
+		}
+		links = append(links, link(prev, "prev"))
+	}
+
+	if core.Offset+limit < core.Total {
+		links = append(links, link(core.Offset+limit, "next"))
+	}
+
+	links = append(links, link(last, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// BaseURL, if set, is the scheme and host of the links written by
+// RenderJSON, and any path the request path is beneath, i.e.
+// "https://api.example.com/v4". It is for services whose public URL differs
+// from that of the requests they receive. Otherwise the scheme is that of the
+// Forwarded or X-Forwarded-Proto header set by a proxy that terminates TLS,
+// and the host that of the request.
+var BaseURL string
+
+// RenderJSON renders a page of a collection as JSON with a Link header for
+// the first, prev, next and last pages, derived from the request URL
+func RenderJSON(w http.ResponseWriter, req *http.Request, status int, p Pagination) {
+	if link := LinkHeader(requestURL(req), p.Core); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	render.JSON(w, status, p)
+}
+
+// requestURL returns the public URL of a request
+func requestURL(req *http.Request) string {
+	u := *req.URL
+
+	if BaseURL != "" {
+		if base, err := url.Parse(BaseURL); err == nil {
+			u.Scheme = base.Scheme
+			u.Host = base.Host
+			u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+			u.RawPath = ""
+			return u.String()
+		}
+	}
+
+	if u.Host == "" {
+		u.Host = req.Host
+		u.Scheme = requestScheme(req)
+	}
+
+	return u.String()
+}
+
+// requestScheme returns the scheme of a request as received by the first
+// proxy, or else by the service
+func requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+
+	// Forwarded: for=192.0.2.60;proto=https;by=203.0.113.43, for=...
+	if forwarded := req.Header.Get("Forwarded"); forwarded != "" {
+		for _, pair := range strings.Split(strings.Split(forwarded, ",")[0], ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "proto") {
+				if scheme := knownScheme(strings.Trim(kv[1], `"`)); scheme != "" {
+					return scheme
+				}
+			}
+		}
+	}
+
+	if scheme := knownScheme(strings.Split(req.Header.Get("X-Forwarded-Proto"), ",")[0]); scheme != "" {
+		return scheme
+	}
+
+	return "http"
+}
+
+// knownScheme returns http or https if proto is either, or ""
+func knownScheme(proto string) string {
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "http", "https":
+		return proto
+	}
+
+	return ""
+}
@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
 )
 
 const (
@@ -15,6 +18,41 @@ const (
 	DefaultOffset int64 = 0
 )
 
+// Policy describes the rules applied when reading pagination parameters from
+// a request. The zero value applies the rules of LimitAndOffset: a default
+// limit of 25, and limits that are a multiple of 5 up to 250.
+type Policy struct {
+	// DefaultLimit is the limit when none is given, or DefaultLimit if zero
+	DefaultLimit int64
+
+	// MaxLimit is the largest limit allowed, or 250 if zero
+	MaxLimit int64
+
+	// LimitStep is the number that limits must be a multiple of, or 5 if
+	// zero
+	LimitStep int64
+
+	// AllowedLimits, if set, are the only limits allowed other than the
+	// default, i.e. 10, 50 and 100
+	AllowedLimits []int64
+
+	// AllowArbitrary allows any limit from 1 to MaxLimit, ignoring LimitStep
+	// and AllowedLimits
+	AllowArbitrary bool
+
+	// MaxOffsetAllowed rejects offsets beyond this depth when greater than
+	// zero, protecting databases from the cost of scanning deep into large
+	// result sets, i.e. when crawlers walk every page
+	MaxOffsetAllowed int64
+}
+
+// DefaultPolicy is the Policy applied by LimitAndOffset
+var DefaultPolicy = Policy{}
+
+// DeepOffsetThreshold is the offset beyond which requests are counted and
+// logged as deep pagination, which is expensive for most databases
+var DeepOffsetThreshold int64 = 10000
+
 // Core contains the fields that encapsulate pagination of arrays
 type Core struct {
 	Total     int64  `json:"total"`
@@ -77,42 +115,47 @@ func CurrentPage(offset int64, limit int64) int64 {
 
 // LimitAndOffset returns the Limit and Offset for a given request querystring
 func LimitAndOffset(query url.Values) (int64, int64, int, error) {
+	return LimitAndOffsetWithPolicy(query, DefaultPolicy)
+}
+
+// LimitAndOffsetWithPolicy returns the Limit and Offset for a given request
+// querystring, validated against the given Policy
+func LimitAndOffsetWithPolicy(query url.Values, policy Policy) (int64, int64, int, error) {
 	var (
 		limit  int64
 		offset int64
 	)
 
-	limit = DefaultLimit
+	defaultLimit := DefaultLimit
+	if policy.DefaultLimit > 0 {
+		defaultLimit = policy.DefaultLimit
+	}
+
+	limit = defaultLimit
 	limitParam := "limit"
 
 	if query.Get("per_page") != "" {
 		limitParam = "per_page"
+		metrics.Inc("pagination_legacy_params", "param", "per_page")
 	}
 
 	if query.Get(limitParam) != "" {
 		inLimit, err := strconv.ParseInt(query.Get(limitParam), 10, 64)
 		if err != nil {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("%s (%s) is not a number", limitParam, query.Get(limitParam))
+			return 0, 0, http.StatusBadRequest, rejected(limitParam,
+				fmt.Errorf("%s (%s) is not a number", limitParam, query.Get(limitParam)))
 		}
 		limit = inLimit
 	}
 
-	if limit != DefaultLimit {
+	if limit != defaultLimit {
 		if limit < 1 {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("%s (%d) cannot be zero or negative", limitParam, limit)
-		}
-
-		if limit%5 != 0 {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("%s (%d) must be a multiple of 5", limitParam, limit)
+			return 0, 0, http.StatusBadRequest, rejected(limitParam,
+				fmt.Errorf("%s (%d) cannot be zero or negative", limitParam, limit))
 		}
 
-		const maxLimit = 250
-		if limit > maxLimit {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("%s (%d) cannot exceed %d", limitParam, limit, maxLimit)
+		if status, err := policy.checkLimit(limitParam, limit); err != nil {
+			return 0, 0, status, rejected(limitParam, err)
 		}
 	}
 
@@ -120,46 +163,114 @@ func LimitAndOffset(query url.Values) (int64, int64, int, error) {
 	if query.Get("offset") != "" {
 		inOffset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
 		if err != nil {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("offset (%s) is not a number", query.Get("offset"))
+			return 0, 0, http.StatusBadRequest, rejected("offset",
+				fmt.Errorf("offset (%s) is not a number", query.Get("offset")))
 		}
 
 		if inOffset < 0 {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("offset (%d) cannot be negative", inOffset)
+			return 0, 0, http.StatusBadRequest, rejected("offset",
+				fmt.Errorf("offset (%d) cannot be negative", inOffset))
 		}
 
 		if inOffset%limit != 0 {
-			return 0, 0, http.StatusBadRequest,
+			return 0, 0, http.StatusBadRequest, rejected("offset",
 				fmt.Errorf(
 					"offset (%d) must be a multiple of limit (%d) or zero",
 					inOffset,
 					limit,
-				)
+				))
 		}
 
 		offset = inOffset
 	}
 
+	if query.Get("page") != "" {
+		metrics.Inc("pagination_legacy_params", "param", "page")
+	}
+
 	if offset == DefaultOffset && query.Get("page") != "" {
 		inPage, err := strconv.ParseInt(query.Get("page"), 10, 64)
 		if err != nil {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("page (%s) is not a number", query.Get("page"))
+			return 0, 0, http.StatusBadRequest, rejected("page",
+				fmt.Errorf("page (%s) is not a number", query.Get("page")))
 		}
 
 		if inPage <= 0 {
-			return 0, 0, http.StatusBadRequest,
-				fmt.Errorf("page (%d) must be 1 or higher", inPage)
+			return 0, 0, http.StatusBadRequest, rejected("page",
+				fmt.Errorf("page (%d) must be 1 or higher", inPage))
 		}
 
 		// Calculate offset from page
 		offset = inPage*limit - limit
 	}
 
+	if policy.MaxOffsetAllowed > 0 && offset > policy.MaxOffsetAllowed {
+		return 0, 0, http.StatusBadRequest, rejected("offset",
+			fmt.Errorf(
+				"offset (%d) cannot exceed %d, use cursor pagination to read further",
+				offset,
+				policy.MaxOffsetAllowed,
+			))
+	}
+
+	if DeepOffsetThreshold > 0 && offset > DeepOffsetThreshold {
+		metrics.Inc("pagination_deep_offset")
+		log.Warningf("pagination: offset (%d) exceeds %d", offset, DeepOffsetThreshold)
+	}
+
 	return limit, offset, http.StatusOK, nil
 }
 
+// checkLimit returns an error if a limit other than the default is not
+// allowed by the policy
+func (policy Policy) checkLimit(param string, limit int64) (int, error) {
+	maxLimit := policy.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = 250
+	}
+
+	if limit > maxLimit {
+		return http.StatusBadRequest,
+			fmt.Errorf("%s (%d) cannot exceed %d", param, limit, maxLimit)
+	}
+
+	if policy.AllowArbitrary {
+		return http.StatusOK, nil
+	}
+
+	if len(policy.AllowedLimits) > 0 {
+		for _, l := range policy.AllowedLimits {
+			if limit == l {
+				return http.StatusOK, nil
+			}
+		}
+
+		return http.StatusBadRequest,
+			fmt.Errorf("%s (%d) must be one of %v", param, limit, policy.AllowedLimits)
+	}
+
+	step := policy.LimitStep
+	if step <= 0 {
+		step = 5
+	}
+
+	if limit%step != 0 {
+		return http.StatusBadRequest,
+			fmt.Errorf("%s (%d) must be a multiple of %d", param, limit, step)
+	}
+
+	return http.StatusOK, nil
+}
+
+// rejected records that a pagination parameter was rejected and returns the
+// error describing why
+func rejected(param string, err error) error {
+	metrics.Inc("pagination_rejected", "param", param)
+	log.WarningDepth(1, "pagination: "+err.Error())
+
+	return err
+}
+
 // MaxOffset returns the maximum possible offset for a given number of
 // pages and limit per page
 func MaxOffset(total int64, limit int64) int64 {
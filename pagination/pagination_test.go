@@ -1,6 +1,10 @@
 package pagination
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -322,3 +326,127 @@ func TestOffsetFromPage(t *testing.T) {
 		t.Errorf(message, page, limit, result, expectedOffset)
 	}
 }
+
+func TestMaxOffsetAllowed(t *testing.T) {
+	policy := Policy{MaxOffsetAllowed: 100}
+
+	message := "LimitAndOffsetWithPolicy(%s) status = %d should be %d"
+
+	query := url.Values{"offset": []string{"100"}}
+	_, _, status, _ := LimitAndOffsetWithPolicy(query, policy)
+	if status != http.StatusOK {
+		t.Errorf(message, query.Encode(), status, http.StatusOK)
+	}
+
+	query = url.Values{"offset": []string{"125"}}
+	_, _, status, _ = LimitAndOffsetWithPolicy(query, policy)
+	if status != http.StatusBadRequest {
+		t.Errorf(message, query.Encode(), status, http.StatusBadRequest)
+	}
+
+	// Offsets calculated from a page are also protected
+	query = url.Values{"page": []string{"6"}}
+	_, _, status, _ = LimitAndOffsetWithPolicy(query, policy)
+	if status != http.StatusBadRequest {
+		t.Errorf(message, query.Encode(), status, http.StatusBadRequest)
+	}
+
+	// The default policy allows any offset
+	query = url.Values{"offset": []string{"1000000"}}
+	_, _, status, _ = LimitAndOffset(query)
+	if status != http.StatusOK {
+		t.Errorf(message, query.Encode(), status, http.StatusOK)
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	core := Core{}
+	core.Populate(60, 25, 25, "things")
+
+	expected := `<https://api/things?limit=25&offset=0&q=x>; rel="first", ` +
+		`<https://api/things?limit=25&offset=0&q=x>; rel="prev", ` +
+		`<https://api/things?limit=25&offset=50&q=x>; rel="next", ` +
+		`<https://api/things?limit=25&offset=50&q=x>; rel="last"`
+
+	link := LinkHeader("https://api/things?q=x&page=2", core)
+	if link != expected {
+		t.Errorf("LinkHeader() = %s should be %s", link, expected)
+	}
+
+	core.Populate(60, 25, 50, "things")
+	expected = `<https://api/things?limit=25&offset=0>; rel="first", ` +
+		`<https://api/things?limit=25&offset=25>; rel="prev", ` +
+		`<https://api/things?limit=25&offset=50>; rel="last"`
+
+	link = LinkHeader("https://api/things", core)
+	if link != expected {
+		t.Errorf("LinkHeader() = %s should be %s", link, expected)
+	}
+}
+
+func TestRenderJSONLinks(t *testing.T) {
+	tests := []struct {
+		header  string
+		value   string
+		baseURL string
+		first   string
+	}{
+		{"", "", "", "<http://api/things?limit=25&offset=0>"},
+		{"X-Forwarded-Proto", "https", "", "<https://api/things?limit=25&offset=0>"},
+		{"Forwarded", `for=192.0.2.60;proto="https", for=10.0.0.1;proto=http`, "", "<https://api/things?limit=25&offset=0>"},
+		{"X-Forwarded-Proto", "gopher", "", "<http://api/things?limit=25&offset=0>"},
+		{"", "", "https://example.com/v4/", "<https://example.com/v4/things?limit=25&offset=0>"},
+	}
+
+	defer func() { BaseURL = "" }()
+	for _, test := range tests {
+		BaseURL = test.baseURL
+		req := httptest.NewRequest("GET", "http://api/things", nil)
+		req.URL.Host = ""
+		req.URL.Scheme = ""
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+
+		rec := httptest.NewRecorder()
+		p := Pagination{}
+		p.Core.Populate(60, 25, 0, "things")
+		RenderJSON(rec, req, http.StatusOK, p)
+
+		if link := rec.Header().Get("Link"); !strings.HasPrefix(link, test.first) {
+			t.Errorf("%s: %q with BaseURL %q: Link %s should begin %s", test.header, test.value, test.baseURL, link, test.first)
+		}
+	}
+}
+
+func TestLimitPolicy(t *testing.T) {
+	message := "LimitAndOffsetWithPolicy(%s, %+v) status = %d should be %d"
+
+	tests := []struct {
+		policy Policy
+		limit  string
+		status int
+	}{
+		{Policy{}, "7", http.StatusBadRequest},
+		{Policy{}, "300", http.StatusBadRequest},
+		{Policy{LimitStep: 1, MaxLimit: 1000}, "7", http.StatusOK},
+		{Policy{LimitStep: 1, MaxLimit: 1000}, "1001", http.StatusBadRequest},
+		{Policy{AllowedLimits: []int64{10, 100}}, "100", http.StatusOK},
+		{Policy{AllowedLimits: []int64{10, 100}}, "50", http.StatusBadRequest},
+		{Policy{AllowArbitrary: true}, "13", http.StatusOK},
+		{Policy{AllowArbitrary: true}, "0", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		query := url.Values{"limit": []string{test.limit}}
+		_, _, status, _ := LimitAndOffsetWithPolicy(query, test.policy)
+		if status != test.status {
+			t.Errorf(message, query.Encode(), test.policy, status, test.status)
+		}
+	}
+
+	limit, _, _, _ := LimitAndOffsetWithPolicy(url.Values{}, Policy{DefaultLimit: 7})
+	if limit != 7 {
+		t.Errorf("LimitAndOffsetWithPolicy() limit = %d should be the policy default 7", limit)
+	}
+}
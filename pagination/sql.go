@@ -0,0 +1,128 @@
+package pagination
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SortColumns maps the sort fields that clients may request to the SQL column
+// or expression that each sorts by. Only the mapped values are ever written
+// into SQL, so user input cannot be interpolated into a query.
+type SortColumns map[string]string
+
+// Sort is a validated sort field
+type Sort struct {
+	Field      string
+	Column     string
+	Descending bool
+}
+
+// ParseSort returns the sorts requested by the sort query parameter, i.e.
+// ?sort=name,-created where a leading - sorts descending, validated against
+// the permitted columns
+func ParseSort(query url.Values, columns SortColumns) ([]Sort, int, error) {
+	sorts := []Sort{}
+
+	if query.Get("sort") == "" {
+		return sorts, http.StatusOK, nil
+	}
+
+	for _, field := range strings.Split(query.Get("sort"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		s := Sort{Field: field}
+		if strings.HasPrefix(field, "-") {
+			s.Field = field[1:]
+			s.Descending = true
+		}
+
+		column, ok := columns[s.Field]
+		if !ok {
+			return nil, http.StatusBadRequest,
+				fmt.Errorf("sort (%s) is not a sortable field", s.Field)
+		}
+		s.Column = column
+
+		sorts = append(sorts, s)
+	}
+
+	return sorts, http.StatusOK, nil
+}
+
+// OrderBy returns an ORDER BY clause for the sorts, or an empty string if
+// there are none
+func OrderBy(sorts []Sort) string {
+	if len(sorts) == 0 {
+		return ""
+	}
+
+	terms := make([]string, len(sorts))
+	for i, s := range sorts {
+		if s.Descending {
+			terms[i] = s.Column + " DESC"
+		} else {
+			terms[i] = s.Column + " ASC"
+		}
+	}
+
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// LimitOffsetSQL returns a LIMIT and OFFSET clause using bound parameters
+// numbered from argIndex, i.e. " LIMIT $3 OFFSET $4", and the arguments for
+// those parameters
+func LimitOffsetSQL(limit int64, offset int64, argIndex int) (string, []interface{}) {
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1),
+		[]interface{}{limit, offset}
+}
+
+// SQL returns a LIMIT and OFFSET clause for the page described by Core, see
+// LimitOffsetSQL
+func (m *Core) SQL(argIndex int) (string, []interface{}) {
+	return LimitOffsetSQL(m.Limit, m.Offset, argIndex)
+}
+
+// KeysetSQL returns a WHERE condition that selects the rows following the row
+// whose sort values are given in after, for keyset (seek) pagination which
+// does not degrade with depth as OFFSET does. Parameters are numbered from
+// argIndex.
+//
+// For sorts (a ASC, b DESC) the condition is:
+//
+//	(a > $1) OR (a = $1 AND b < $2)
+func KeysetSQL(sorts []Sort, after []interface{}, argIndex int) (string, []interface{}, error) {
+	if len(sorts) == 0 {
+		return "", nil, fmt.Errorf("keyset pagination requires at least one sort")
+	}
+
+	if len(after) != len(sorts) {
+		return "", nil, fmt.Errorf(
+			"keyset pagination requires %d values, %d given",
+			len(sorts),
+			len(after),
+		)
+	}
+
+	clauses := make([]string, len(sorts))
+	for i := range sorts {
+		terms := make([]string, i+1)
+		for j := 0; j < i; j++ {
+			terms[j] = fmt.Sprintf("%s = $%d", sorts[j].Column, argIndex+j)
+		}
+
+		op := ">"
+		if sorts[i].Descending {
+			op = "<"
+		}
+		terms[i] = fmt.Sprintf("%s %s $%d", sorts[i].Column, op, argIndex+i)
+
+		clauses[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", after, nil
+}
@@ -0,0 +1,55 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	columns := SortColumns{"name": "u.name", "created": "u.created_at"}
+
+	sorts, _, err := ParseSort(url.Values{"sort": []string{"name,-created"}}, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sorts) != 2 || sorts[0].Column != "u.name" || !sorts[1].Descending {
+		t.Errorf("ParseSort(name,-created) = %v", sorts)
+	}
+
+	orderBy := OrderBy(sorts)
+	expected := " ORDER BY u.name ASC, u.created_at DESC"
+	if orderBy != expected {
+		t.Errorf("OrderBy(%v) = %q should be %q", sorts, orderBy, expected)
+	}
+
+	_, _, err = ParseSort(url.Values{"sort": []string{"name;DROP TABLE users"}}, columns)
+	if err == nil {
+		t.Errorf("ParseSort should reject columns that are not permitted")
+	}
+}
+
+func TestKeysetSQL(t *testing.T) {
+	sorts := []Sort{
+		{Field: "name", Column: "name"},
+		{Field: "id", Column: "id", Descending: true},
+	}
+
+	where, args, err := KeysetSQL(sorts, []interface{}{"bob", 7}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "((name > $3) OR (name = $3 AND id < $4))"
+	if where != expected {
+		t.Errorf("KeysetSQL() = %q should be %q", where, expected)
+	}
+
+	if len(args) != 2 {
+		t.Errorf("KeysetSQL() returned %d args, should be 2", len(args))
+	}
+
+	if _, _, err := KeysetSQL(sorts, []interface{}{"bob"}, 1); err == nil {
+		t.Errorf("KeysetSQL() should reject a mismatched number of values")
+	}
+}
@@ -0,0 +1,312 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/cloudflare/service/jsonpointer"
+)
+
+// Error describes the failure of a single operation within a set of patches,
+// or of the patches as a whole when Index is -1. When an operation fails no
+// operation is applied.
+type Error struct {
+	// Index is the position of the failing operation within the patches
+	Index     int
+	Operation string
+	Path      string
+
+	// Status is the HTTP status that best describes the failure
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Index < 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s (operation %d: %s %s)", e.Err, e.Index, e.Operation, e.Path)
+}
+
+// Apply applies patches to a JSON document and returns the patched document.
+// Application is all-or-nothing as required by RFC 6902: if any operation
+// fails the document is left as it was and the returned *Error identifies the
+// failing operation.
+func Apply(document []byte, patches []Patch) ([]byte, error) {
+	patched, _, err := ApplyWithInverse(document, patches)
+	return patched, err
+}
+
+// ApplyWithInverse applies patches to a JSON document as Apply does, and also
+// returns the inverse patches which when applied to the patched document
+// restore the original. These can be recorded for audit trails or to undo a
+// change. The inverse has no operation for a test, which changes nothing.
+func ApplyWithInverse(document []byte, patches []Patch) ([]byte, []Patch, error) {
+	if len(patches) == 0 {
+		_, err := Test(patches)
+		return nil, nil, &Error{Index: -1, Status: http.StatusBadRequest, Err: err}
+	}
+
+	// Each operation must be well formed before any is applied
+	for i, p := range patches {
+		status, err := Test([]Patch{p})
+		if err != nil {
+			return nil, nil, &Error{
+				Index:     i,
+				Operation: p.Operation,
+				Path:      p.Path,
+				Status:    status,
+				Err:       err,
+			}
+		}
+	}
+
+	doc, err := decodeDocument(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The operations are applied to a tree decoded from the document, so a
+	// failure part way through discards the earlier operations with the tree
+	undos := make([][]Patch, 0, len(patches))
+	for i, p := range patches {
+		var undo []Patch
+		doc, undo, err = apply(doc, p)
+		if err != nil {
+			if pe, ok := err.(*Error); ok {
+				pe.Index = i
+				return nil, nil, pe
+			}
+
+			return nil, nil, &Error{
+				Index:     i,
+				Operation: p.Operation,
+				Path:      p.Path,
+				Status:    http.StatusUnprocessableEntity,
+				Err:       err,
+			}
+		}
+		undos = append(undos, undo)
+	}
+
+	// The inverse operations undo the patches in reverse order
+	inverse := make([]Patch, 0, len(patches))
+	for i := len(undos) - 1; i >= 0; i-- {
+		inverse = append(inverse, undos[i]...)
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return patched, inverse, nil
+}
+
+// decodeDocument decodes a JSON document preserving numbers as json.Number
+func decodeDocument(document []byte) (interface{}, error) {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, &Error{
+			Index:  -1,
+			Status: http.StatusBadRequest,
+			Err:    fmt.Errorf("Patch: document is not valid JSON: %s", err),
+		}
+	}
+
+	return doc, nil
+}
+
+// ApplyTo applies patches to the struct (or other value) pointed to by v via
+// its JSON representation. v is only modified if every operation succeeds and
+// the patched document can be decoded into v's type.
+func ApplyTo(v interface{}, patches []Patch) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Patch: ApplyTo requires a non-nil pointer")
+	}
+
+	document, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	patched, err := Apply(document, patches)
+	if err != nil {
+		return err
+	}
+
+	// Decode into a fresh value so that a failure cannot leave v half updated
+	result := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(patched, result.Interface()); err != nil {
+		return &Error{
+			Index:  -1,
+			Status: http.StatusUnprocessableEntity,
+			Err:    fmt.Errorf("Patch: patched document is not valid: %s", err),
+		}
+	}
+
+	rv.Elem().Set(result.Elem())
+
+	return nil
+}
+
+// apply applies a single operation to doc and returns the resulting document
+// and the operations that, applied in order, reverse it
+func apply(doc interface{}, p Patch) (interface{}, []Patch, error) {
+	tokens, err := jsonpointer.Parse(p.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch p.Operation {
+	case "add":
+		undo, err := undoAdd(doc, tokens, p.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err = jsonpointer.Add(doc, tokens, deepCopy(p.RawValue))
+		return doc, []Patch{undo}, err
+
+	case "remove":
+		old, err := jsonpointer.Get(doc, tokens)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err = jsonpointer.Delete(doc, tokens)
+		return doc, []Patch{{Operation: "add", Path: p.Path, RawValue: deepCopy(old)}}, err
+
+	case "replace":
+		old, err := jsonpointer.Get(doc, tokens)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err = jsonpointer.Replace(doc, tokens, deepCopy(p.RawValue))
+		return doc, []Patch{{Operation: "replace", Path: p.Path, RawValue: deepCopy(old)}}, err
+
+	case "move":
+		from, err := jsonpointer.Parse(p.From)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// A value cannot be moved into one of its own children
+		if len(from) < len(tokens) && from.String() == tokens[:len(from)].String() {
+			return nil, nil, fmt.Errorf("Patch: cannot move %s into itself", p.From)
+		}
+
+		value, err := jsonpointer.Get(doc, from)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// A move is a remove followed by an add, and is undone by reversing
+		// the add and then the remove
+		doc, err = jsonpointer.Delete(doc, from)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		undo, err := undoAdd(doc, tokens, p.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err = jsonpointer.Add(doc, tokens, value)
+		return doc, []Patch{undo, {Operation: "add", Path: p.From, RawValue: deepCopy(value)}}, err
+
+	case "copy":
+		from, err := jsonpointer.Parse(p.From)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value, err := jsonpointer.Get(doc, from)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		undo, err := undoAdd(doc, tokens, p.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err = jsonpointer.Add(doc, tokens, deepCopy(value))
+		return doc, []Patch{undo}, err
+
+	case "test":
+		// A test changes nothing and so needs nothing to undo it
+		return doc, nil, test(doc, p)
+
+	default:
+		return nil, nil, &Error{
+			Operation: p.Operation,
+			Path:      p.Path,
+			Status:    http.StatusNotImplemented,
+			Err:       fmt.Errorf("Patch: json-patch '%s' operation not implemented", p.Operation),
+		}
+	}
+}
+
+// undoAdd returns the operation that reverses adding a value at the location
+// given by tokens, being a remove, or a replace if an existing member is
+// overwritten
+func undoAdd(doc interface{}, tokens jsonpointer.Pointer, path string) (Patch, error) {
+	// Adding at the root replaces the whole document
+	if len(tokens) == 0 {
+		return Patch{Operation: "replace", Path: path, RawValue: deepCopy(doc)}, nil
+	}
+
+	undo := Patch{Operation: "remove", Path: path}
+
+	parent, err := jsonpointer.Get(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return Patch{}, err
+	}
+
+	switch t := parent.(type) {
+	case map[string]interface{}:
+		// Adding an existing member replaces it
+		if old, ok := t[tokens[len(tokens)-1]]; ok {
+			undo = Patch{Operation: "replace", Path: path, RawValue: deepCopy(old)}
+		}
+	case []interface{}:
+		// Appending is undone by removing the new last element
+		if tokens[len(tokens)-1] == "-" {
+			undo.Path = path[:len(path)-1] + strconv.Itoa(len(t))
+		}
+	}
+
+	return undo, nil
+}
+
+// deepCopy returns a copy of a decoded JSON value that shares no maps or
+// slices with the original
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, e := range t {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,359 @@
+package patch
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApplyIsAtomic(t *testing.T) {
+	document := []byte(`{"name":"a","enabled":false,"tags":["x","y"]}`)
+
+	patches := []Patch{
+		{Operation: "replace", Path: "/name", RawValue: "b"},
+		{Operation: "replace", Path: "/tags/1", RawValue: "z"},
+		{Operation: "replace", Path: "/missing", RawValue: true},
+	}
+
+	_, err := Apply(document, patches)
+	pe, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Apply() error = %v should be a *Error", err)
+	}
+
+	if pe.Index != 2 || pe.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Apply() failed at %d with %d, should be 2 with %d",
+			pe.Index, pe.Status, http.StatusUnprocessableEntity)
+	}
+
+	patched, err := Apply(document, patches[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"enabled":false,"name":"b","tags":["x","z"]}`
+	if string(patched) != expected {
+		t.Errorf("Apply() = %s should be %s", patched, expected)
+	}
+}
+
+func TestApplyTo(t *testing.T) {
+	type Thing struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+	}
+
+	thing := Thing{Name: "a"}
+
+	err := ApplyTo(&thing, []Patch{
+		{Operation: "replace", Path: "/enabled", RawValue: true},
+		{Operation: "replace", Path: "/name", RawValue: 42.0},
+	})
+	if err == nil {
+		t.Errorf("ApplyTo() should fail when the result does not fit the type")
+	}
+
+	if thing.Enabled {
+		t.Errorf("ApplyTo() should not modify the value when it fails")
+	}
+
+	err = ApplyTo(&thing, []Patch{{Operation: "replace", Path: "/enabled", RawValue: true}})
+	if err != nil || !thing.Enabled {
+		t.Errorf("ApplyTo() = %v, value %+v should be enabled", err, thing)
+	}
+}
+
+func TestDiffAndInverse(t *testing.T) {
+	before := []byte(`{"a":1,"b":{"c":"d"},"list":[1,2,3],"gone":true}`)
+	after := []byte(`{"a":2,"b":{"c":"d","e":"f"},"list":[1,5],"new":"x"}`)
+
+	patches, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, inverse, err := ApplyWithInverse(before, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"a":2,"b":{"c":"d","e":"f"},"list":[1,5],"new":"x"}`
+	if string(patched) != expected {
+		t.Errorf("Apply(Diff()) = %s should be %s", patched, expected)
+	}
+
+	restored, err := Apply(patched, inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `{"a":1,"b":{"c":"d"},"gone":true,"list":[1,2,3]}`
+	if string(restored) != expected {
+		t.Errorf("Apply(inverse) = %s should be %s", restored, expected)
+	}
+}
+
+func TestInverseOfTest(t *testing.T) {
+	patches := []Patch{
+		{Operation: "test", Path: "/version", RawValue: 3.0},
+		{Operation: "replace", Path: "/name", RawValue: "b"},
+	}
+
+	_, inverse, err := ApplyWithInverse([]byte(`{"version":3,"name":"a"}`), patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inverse) != 1 || inverse[0].Operation != "replace" || inverse[0].RawValue != "a" {
+		t.Errorf("ApplyWithInverse() inverse = %v should only undo the replace", inverse)
+	}
+}
+
+func TestMoveAndCopy(t *testing.T) {
+	document := []byte(`{"a":{"b":1},"list":["x","y"],"c":"old"}`)
+
+	patches := []Patch{
+		{Operation: "move", From: "/a/b", Path: "/c"},
+		{Operation: "copy", From: "/list/0", Path: "/list/-"},
+		{Operation: "move", From: "/list/0", Path: "/a/x~1y"},
+	}
+
+	patched, inverse, err := ApplyWithInverse(document, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"a":{"x/y":"x"},"c":1,"list":["y","x"]}`
+	if string(patched) != expected {
+		t.Errorf("Apply() = %s should be %s", patched, expected)
+	}
+
+	restored, err := Apply(patched, inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `{"a":{"b":1},"c":"old","list":["x","y"]}`
+	if string(restored) != expected {
+		t.Errorf("Apply(inverse) = %s should be %s", restored, expected)
+	}
+
+	_, err = Apply(document, []Patch{{Operation: "move", From: "/a", Path: "/a/b/c"}})
+	if err == nil {
+		t.Errorf("Apply() should not move a value into itself")
+	}
+}
+
+func TestCheckTests(t *testing.T) {
+	type Thing struct {
+		Version int64  `json:"version"`
+		Name    string `json:"name"`
+	}
+
+	thing := Thing{Version: 3, Name: "a"}
+	message := "CheckTests(%v) = %d should be %d"
+
+	patches := []Patch{
+		{Operation: "test", Path: "/version", RawValue: 3.0},
+		{Operation: "replace", Path: "/name", RawValue: "b"},
+	}
+	status, err := CheckTests(thing, patches)
+	if err != nil {
+		t.Errorf(message, patches, status, http.StatusOK)
+	}
+
+	patches[0].RawValue = 2.0
+	status, _ = CheckTests(thing, patches)
+	if status != http.StatusPreconditionFailed {
+		t.Errorf(message, patches, status, http.StatusPreconditionFailed)
+	}
+
+	patches[0].Path = "/missing"
+	status, _ = CheckTests([]byte(`{"version":3}`), patches)
+	if status != http.StatusConflict {
+		t.Errorf(message, patches, status, http.StatusConflict)
+	}
+
+	// A failed test within Apply prevents every operation
+	_, err = Apply([]byte(`{"version":3,"name":"a"}`), []Patch{
+		{Operation: "replace", Path: "/name", RawValue: "b"},
+		{Operation: "test", Path: "/version", RawValue: 2.0},
+	})
+	if pe, ok := err.(*Error); !ok || pe.Index != 1 {
+		t.Errorf("Apply() = %v should fail at the test operation", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	limits := Limits{MaxOperations: 2, MaxPathDepth: 2, MaxValueDepth: 2}
+	message := "Decode(%s) = %d should be %d"
+
+	doc := `[{"op":"replace","path":"/a/b","value":{"c":[1]}}]`
+	patches, status, err := Decode(strings.NewReader(doc), limits)
+	if err != nil || len(patches) != 1 || patches[0].Path != "/a/b" {
+		t.Errorf(message, doc, status, http.StatusOK)
+	}
+
+	doc = `[{"op":"test","path":"/a","value":1},{"op":"test","path":"/a","value":1},{"op":"test"`
+	_, status, _ = Decode(strings.NewReader(doc), limits)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf(message, doc, status, http.StatusRequestEntityTooLarge)
+	}
+
+	doc = `[{"op":"replace","path":"/a/b/c","value":1}]`
+	_, status, _ = Decode(strings.NewReader(doc), limits)
+	if status != http.StatusBadRequest {
+		t.Errorf(message, doc, status, http.StatusBadRequest)
+	}
+
+	doc = `[{"op":"replace","path":"/a","value":[[[1]]]}]`
+	_, status, _ = Decode(strings.NewReader(doc), limits)
+	if status != http.StatusBadRequest {
+		t.Errorf(message, doc, status, http.StatusBadRequest)
+	}
+}
+
+func TestRFC6902Appendix(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{"A.1", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"A.2", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"A.3", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"A.4", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"A.5", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"A.6", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"A.7", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"A.8", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"A.9", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ""},
+		{"A.10", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{"A.11", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"baz":"qux","foo":"bar"}`},
+		{"A.12", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ""},
+		{"A.14", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{"A.15", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, ""},
+		{"A.16", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"null value", `{"foo":"bar"}`, `[{"op":"replace","path":"/foo","value":null},{"op":"test","path":"/foo","value":null},{"op":"add","path":"/baz","value":null}]`, `{"baz":null,"foo":null}`},
+		{"root", `{"foo":"bar"}`, `[{"op":"test","path":"","value":{"foo":"bar"}},{"op":"replace","path":"","value":[1]},{"op":"add","path":"/-","value":2}]`, `[1,2]`},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, ""},
+		{"missing path", `{"foo":"bar"}`, `[{"op":"replace","value":1}]`, ""},
+	}
+
+	for _, test := range tests {
+		var patches []Patch
+		if err := json.Unmarshal([]byte(test.patch), &patches); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		patched, err := Apply([]byte(test.doc), patches)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: Apply() = %s should fail", test.name, patched)
+			}
+			continue
+		}
+
+		if err != nil || string(patched) != test.expected {
+			t.Errorf("%s: Apply() = %s, %v should be %s", test.name, patched, err, test.expected)
+		}
+
+		decoded, _, err := Decode(strings.NewReader(test.patch), DefaultLimits)
+		if err != nil {
+			t.Errorf("%s: Decode() = %v", test.name, err)
+			continue
+		}
+		if patched, err := Apply([]byte(test.doc), decoded); err != nil || string(patched) != test.expected {
+			t.Errorf("%s: Apply(Decode()) = %s, %v should be %s", test.name, patched, err, test.expected)
+		}
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	patches := []Patch{
+		{Operation: "replace", Path: "", RawValue: nil},
+		{Operation: "move", From: "/a", Path: "/b"},
+		{Operation: "remove", Path: "/c"},
+	}
+
+	b, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"op":"replace","path":"","value":null},{"op":"move","path":"/b","from":"/a"},{"op":"remove","path":"/c"}]`
+	if string(b) != expected {
+		t.Errorf("json.Marshal() = %s should be %s", b, expected)
+	}
+
+	var decoded []Patch
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Test(decoded); err != nil {
+		t.Errorf("Test() of the marshalled patches = %v", err)
+	}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		before string
+		after  string
+	}{
+		{`{"a":1,"b":null}`, `{"a":null,"b":2}`},
+		{`{"a":null}`, `{"a":null,"c":null}`},
+		{`{"a":{"b":1},"c":[1,2]}`, `{"a":[1],"c":{"d":"e"}}`},
+		{`{"a":"1","list":[null,1]}`, `{"a":1,"list":[true]}`},
+		{`{"a":1}`, `[1,2]`},
+		{`[1,2]`, `"scalar"`},
+		{`null`, `{"a":1}`},
+		{`{"a":1}`, `null`},
+	}
+
+	for _, test := range tests {
+		patches, err := Diff([]byte(test.before), []byte(test.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The patches survive being sent as JSON
+		b, err := json.Marshal(patches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches = nil
+		if err := json.Unmarshal(b, &patches); err != nil {
+			t.Fatal(err)
+		}
+
+		patched, inverse, err := ApplyWithInverse([]byte(test.before), patches)
+		if err != nil {
+			t.Errorf("Apply(%s, Diff()) = %v with %s", test.before, err, b)
+			continue
+		}
+		if !jsonEqual(decode(t, patched), decode(t, []byte(test.after))) {
+			t.Errorf("Apply(%s, Diff()) = %s should be %s", test.before, patched, test.after)
+		}
+
+		restored, err := Apply(patched, inverse)
+		if err != nil {
+			t.Errorf("Apply(%s, inverse) = %v", patched, err)
+			continue
+		}
+		if !jsonEqual(decode(t, restored), decode(t, []byte(test.before))) {
+			t.Errorf("Apply(inverse) = %s should be %s", restored, test.before)
+		}
+	}
+}
+
+// decode decodes a JSON document as Apply does
+func decode(t *testing.T, document []byte) interface{} {
+	doc, err := decodeDocument(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
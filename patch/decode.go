@@ -0,0 +1,223 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Limits bounds the size of a patch document so that pathological payloads
+// are rejected while they are being decoded. A zero limit is not enforced.
+type Limits struct {
+	// MaxOperations is the maximum number of operations in the document
+	MaxOperations int
+
+	// MaxPathDepth is the maximum number of reference tokens in a path or from
+	MaxPathDepth int
+
+	// MaxValueDepth is the maximum nesting of objects and arrays in a value
+	MaxValueDepth int
+}
+
+// DefaultLimits are suitable for patches of typical API resources
+var DefaultLimits = Limits{
+	MaxOperations: 100,
+	MaxPathDepth:  32,
+	MaxValueDepth: 32,
+}
+
+// Decode reads a JSON array of patches from r, enforcing limits as each token
+// is read so that an oversized document is rejected as soon as a limit is
+// crossed, rather than after the whole document has been materialised. Too
+// many operations return 413 Request Entity Too Large, and all other problems
+// return 400 Bad Request.
+func Decode(r io.Reader, limits Limits) ([]Patch, int, error) {
+	d := &limitedDecoder{dec: json.NewDecoder(r), limits: limits}
+
+	patches, err := d.patches()
+	if err != nil {
+		if le, ok := err.(limitError); ok {
+			return nil, le.status, le.err
+		}
+
+		return nil, http.StatusBadRequest, fmt.Errorf("Patch: invalid patch document: %s", err)
+	}
+
+	return patches, http.StatusOK, nil
+}
+
+// limitError is returned when a limit is exceeded
+type limitError struct {
+	status int
+	err    error
+}
+
+func (e limitError) Error() string {
+	return e.err.Error()
+}
+
+// limitedDecoder decodes patches token by token
+type limitedDecoder struct {
+	dec    *json.Decoder
+	limits Limits
+}
+
+// delim reads the next token and checks that it is the expected delimiter
+func (d *limitedDecoder) delim(expected json.Delim) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok != expected {
+		return fmt.Errorf("expected %s but found %v", expected, tok)
+	}
+
+	return nil
+}
+
+func (d *limitedDecoder) patches() ([]Patch, error) {
+	if err := d.delim('['); err != nil {
+		return nil, err
+	}
+
+	patches := []Patch{}
+	for d.dec.More() {
+		if d.limits.MaxOperations > 0 && len(patches) >= d.limits.MaxOperations {
+			return nil, limitError{
+				status: http.StatusRequestEntityTooLarge,
+				err:    fmt.Errorf("Patch: operations cannot exceed %d", d.limits.MaxOperations),
+			}
+		}
+
+		p, err := d.patch()
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, p)
+	}
+
+	if err := d.delim(']'); err != nil {
+		return nil, err
+	}
+
+	return patches, nil
+}
+
+func (d *limitedDecoder) patch() (Patch, error) {
+	p := Patch{noPath: true, noFrom: true, noValue: true}
+
+	if err := d.delim('{'); err != nil {
+		return p, err
+	}
+
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return p, err
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "op":
+			p.Operation, err = d.str()
+		case "path":
+			p.Path, err = d.path()
+			p.noPath = false
+		case "from":
+			p.From, err = d.path()
+			p.noFrom = false
+		case "value":
+			p.RawValue, err = d.value(1)
+			p.noValue = false
+		default:
+			// Unknown members are read, within the limits, and ignored
+			_, err = d.value(1)
+		}
+		if err != nil {
+			return p, err
+		}
+	}
+
+	return p, d.delim('}')
+}
+
+func (d *limitedDecoder) str() (string, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string but found %v", tok)
+	}
+
+	return s, nil
+}
+
+func (d *limitedDecoder) path() (string, error) {
+	s, err := d.str()
+	if err != nil {
+		return "", err
+	}
+
+	if d.limits.MaxPathDepth > 0 && strings.Count(s, "/") > d.limits.MaxPathDepth {
+		return "", limitError{
+			status: http.StatusBadRequest,
+			err:    fmt.Errorf("Patch: path depth cannot exceed %d", d.limits.MaxPathDepth),
+		}
+	}
+
+	return s, nil
+}
+
+// value reads a JSON value at the given depth of nesting
+func (d *limitedDecoder) value(depth int) (interface{}, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	if d.limits.MaxValueDepth > 0 && depth > d.limits.MaxValueDepth {
+		return nil, limitError{
+			status: http.StatusBadRequest,
+			err:    fmt.Errorf("Patch: value nesting cannot exceed %d", d.limits.MaxValueDepth),
+		}
+	}
+
+	switch delim {
+	case '{':
+		m := make(map[string]interface{})
+		for d.dec.More() {
+			key, err := d.str()
+			if err != nil {
+				return nil, err
+			}
+
+			if m[key], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, d.delim('}')
+	case '[':
+		a := []interface{}{}
+		for d.dec.More() {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, d.delim(']')
+	}
+
+	return nil, fmt.Errorf("unexpected %s", delim)
+}
@@ -0,0 +1,101 @@
+package patch
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/cloudflare/service/jsonpointer"
+)
+
+// Diff returns the patches that transform the JSON document before into the
+// JSON document after. Objects are compared member by member and arrays
+// element by element, with elements added to or removed from the end of an
+// array as its length changes. A value whose type changes is replaced, at the
+// path "" if it is the whole document, and null values are kept as null, so
+// that the patches can always be given to Apply.
+func Diff(before []byte, after []byte) ([]Patch, error) {
+	b, err := decodeDocument(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := decodeDocument(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff("", b, a, []Patch{}), nil
+}
+
+// diff appends to patches the operations that transform before into after at
+// the given path
+func diff(path string, before interface{}, after interface{}, patches []Patch) []Patch {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(b)+len(a))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := path + "/" + jsonpointer.Escape(k)
+			bv, inBefore := b[k]
+			av, inAfter := a[k]
+
+			switch {
+			case !inAfter:
+				patches = append(patches, Patch{Operation: "remove", Path: p})
+			case !inBefore:
+				patches = append(patches, Patch{Operation: "add", Path: p, RawValue: av})
+			default:
+				patches = diff(p, bv, av, patches)
+			}
+		}
+
+		return patches
+
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+
+		n := len(b)
+		if len(a) < n {
+			n = len(a)
+		}
+
+		for i := 0; i < n; i++ {
+			patches = diff(path+"/"+strconv.Itoa(i), b[i], a[i], patches)
+		}
+
+		// Remove from the end so that earlier indices remain valid
+		for i := len(b) - 1; i >= n; i-- {
+			patches = append(patches, Patch{Operation: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+
+		for i := n; i < len(a); i++ {
+			patches = append(patches, Patch{Operation: "add", Path: path + "/-", RawValue: a[i]})
+		}
+
+		return patches
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		patches = append(patches, Patch{Operation: "replace", Path: path, RawValue: after})
+	}
+
+	return patches
+}
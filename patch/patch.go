@@ -2,14 +2,18 @@ package patch
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
-	"strings"
 
 	"github.com/lib/pq"
+
+	"github.com/cloudflare/service/jsonpointer"
 )
 
-// Patch describes a JSON PATCH
+// Patch describes a JSON PATCH. The Path "" refers to the whole document,
+// and a nil RawValue is the JSON null.
 type Patch struct {
 	Operation string         `json:"op"`
 	Path      string         `json:"path"`
@@ -19,9 +23,73 @@ type Patch struct {
 	String    sql.NullString `json:"-"`
 	Int64     sql.NullInt64  `json:"-"`
 	Time      pq.NullTime    `json:"-"`
+
+	// noPath, noFrom and noValue record the members that were missing from
+	// a decoded operation, so that they are not mistaken for the root or
+	// null
+	noPath  bool
+	noFrom  bool
+	noValue bool
+}
+
+// patchJSON is the JSON of a Patch, with the members that may be missing
+// as pointers or raw JSON so that their absence can be seen
+type patchJSON struct {
+	Operation string          `json:"op"`
+	Path      *string         `json:"path"`
+	From      *string         `json:"from,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface
+func (p *Patch) UnmarshalJSON(b []byte) error {
+	var j patchJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	*p = Patch{Operation: j.Operation, noPath: j.Path == nil, noFrom: j.From == nil, noValue: j.Value == nil}
+	if j.Path != nil {
+		p.Path = *j.Path
+	}
+	if j.From != nil {
+		p.From = *j.From
+	}
+	if j.Value != nil {
+		return json.Unmarshal(j.Value, &p.RawValue)
+	}
+
+	return nil
 }
 
-// Test partially implements http://tools.ietf.org/html/rfc6902
+// MarshalJSON is part of the json.Marshaler interface. The value of an
+// operation that takes one is written even if it is null.
+func (p Patch) MarshalJSON() ([]byte, error) {
+	j := patchJSON{Operation: p.Operation, Path: &p.Path}
+
+	switch p.Operation {
+	case "move", "copy":
+		j.From = &p.From
+	case "add", "replace", "test":
+		value, err := json.Marshal(p.RawValue)
+		if err != nil {
+			return nil, err
+		}
+		j.Value = value
+	}
+
+	return json.Marshal(j)
+}
+
+// hasValue returns true if the operation has a value, which may be null
+func (p Patch) hasValue() bool {
+	return p.RawValue != nil || !p.noValue
+}
+
+// Test checks that patches are well formed operations as described by
+// http://tools.ietf.org/html/rfc6902: each has a path, which is a JSON
+// Pointer and may be "" for the whole document, and those that need them a
+// value, which may be null, or a from. See Apply to apply them to a document.
 //
 // Patch examples:
 // { "op": "test", "path": "/a/b/c", "value": "foo" },
@@ -36,54 +104,56 @@ func Test(patches []Patch) (int, error) {
 	}
 
 	for _, v := range patches {
+		ok := !v.noPath && validPointer(v.Path)
+
 		switch v.Operation {
-		case "add":
-			if strings.Trim(v.Path, " ") == "" || v.RawValue == nil {
-				return http.StatusBadRequest, fmt.Errorf("Patch: add operation incorrectly specified")
-			}
-			return http.StatusNotImplemented, fmt.Errorf("Patch: json-patch 'add' operation not implemented")
-		case "copy":
-			if strings.Trim(v.Path, " ") == "" || strings.Trim(v.From, " ") == "" {
-				return http.StatusBadRequest, fmt.Errorf("Patch: copy operation incorrectly specified")
-			}
-			return http.StatusNotImplemented, fmt.Errorf("Patch: json-patch 'copy' operation not implemented")
-		case "move":
-			if strings.Trim(v.Path, " ") == "" || strings.Trim(v.From, " ") == "" {
-				return http.StatusBadRequest, fmt.Errorf("Patch: move operation incorrectly specified")
-			}
-			return http.StatusNotImplemented, fmt.Errorf("Patch: json-patch 'move' operation not implemented")
+		case "add", "replace", "test":
+			// Evaluate tests against the resource with CheckTests or Apply
+			ok = ok && v.hasValue()
+		case "copy", "move":
+			ok = ok && !v.noFrom && validPointer(v.From)
 		case "remove":
-			if strings.Trim(v.Path, " ") == "" {
-				return http.StatusBadRequest, fmt.Errorf("Patch: remove operation incorrectly specified")
-			}
-			return http.StatusNotImplemented, fmt.Errorf("Patch: json-patch 'remove' operation not implemented")
-		case "replace":
-			if strings.Trim(v.Path, " ") == "" || v.RawValue == nil {
-				return http.StatusBadRequest, fmt.Errorf("Patch: replace operation incorrectly specified")
-			}
-		case "test":
-			if strings.Trim(v.Path, " ") == "" || v.RawValue == nil {
-				return http.StatusBadRequest, fmt.Errorf("Patch: test operation incorrectly specified")
-			}
-			return http.StatusNotImplemented, fmt.Errorf("Patch: json-patch 'test' operation not implemented")
 		default:
 			return http.StatusBadRequest, fmt.Errorf("Patch: unsupported operation in patch")
 		}
+
+		if !ok {
+			return http.StatusBadRequest, fmt.Errorf("Patch: %s operation incorrectly specified", v.Operation)
+		}
 	}
 
 	return http.StatusOK, nil
 }
 
+// validPointer returns true if pointer is a JSON Pointer, being "" for the
+// whole document or beginning with /
+func validPointer(pointer string) bool {
+	_, err := jsonpointer.Parse(pointer)
+	return err == nil
+}
+
 // Scan hydrates a Patch with the value in the operation
 func (p *Patch) Scan() (int, error) {
 
-	switch p.RawValue.(type) {
+	switch v := p.RawValue.(type) {
 	case bool:
-		p.Bool = sql.NullBool{Bool: p.RawValue.(bool), Valid: true}
+		p.Bool = sql.NullBool{Bool: v, Valid: true}
 	case string:
-		p.String = sql.NullString{String: p.RawValue.(string), Valid: true}
+		p.String = sql.NullString{String: v, Valid: true}
+	case float64:
+		// float64(math.MaxInt64) is 2^63, which does not fit
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return http.StatusNotImplemented, fmt.Errorf("Patch: Currently only values of type boolean, string and integer patchable")
+		}
+		p.Int64 = sql.NullInt64{Int64: int64(v), Valid: true}
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return http.StatusNotImplemented, fmt.Errorf("Patch: Currently only values of type boolean, string and integer patchable")
+		}
+		p.Int64 = sql.NullInt64{Int64: n, Valid: true}
 	default:
-		return http.StatusNotImplemented, fmt.Errorf("Patch: Currently only values of type boolean and string patchable")
+		return http.StatusNotImplemented, fmt.Errorf("Patch: Currently only values of type boolean, string and integer patchable")
 	}
 
 	return http.StatusOK, nil
@@ -0,0 +1,94 @@
+package patch
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ToSQLUpdate turns replace and remove operations into the SET clause of a
+// Postgres UPDATE and its arguments, i.e.
+//
+//	set, args, status, err := patch.ToSQLUpdate(patches, map[string]string{
+//		"/name":    "name",
+//		"/enabled": "is_enabled",
+//	})
+//	if err != nil {
+//		render.Error(w, status, err)
+//		return
+//	}
+//	args = append(args, id)
+//	db.Exec(`UPDATE things SET `+set+` WHERE id = $`+strconv.Itoa(len(args)), args...)
+//
+// mapping is a whitelist of the paths that may be patched and the columns they
+// update. Values are checked with Scan, and a remove sets the column to NULL.
+// Columns are quoted, and values are only ever passed as arguments $1 to $n.
+// Test operations are skipped, so that the patches of a client using
+// optimistic concurrency can be given as is, and should be evaluated against
+// the current row with CheckTests first.
+func ToSQLUpdate(
+	patches []Patch,
+	mapping map[string]string,
+) (string, []interface{}, int, error) {
+	if status, err := Test(patches); err != nil {
+		return "", nil, status, err
+	}
+
+	sets := []string{}
+	args := []interface{}{}
+	seen := make(map[string]bool)
+
+	for _, p := range patches {
+		if p.Operation == "test" {
+			continue
+		}
+
+		column, ok := mapping[p.Path]
+		if !ok {
+			return "", nil, http.StatusBadRequest,
+				fmt.Errorf("Patch: %s cannot be patched", p.Path)
+		}
+
+		if seen[column] {
+			return "", nil, http.StatusBadRequest,
+				fmt.Errorf("Patch: %s is patched more than once", p.Path)
+		}
+		seen[column] = true
+
+		switch p.Operation {
+		case "replace":
+			if status, err := p.Scan(); err != nil {
+				return "", nil, status, err
+			}
+
+			args = append(args, p.value())
+			sets = append(sets, pq.QuoteIdentifier(column)+" = $"+strconv.Itoa(len(args)))
+
+		case "remove":
+			sets = append(sets, pq.QuoteIdentifier(column)+" = NULL")
+
+		default:
+			return "", nil, http.StatusBadRequest,
+				fmt.Errorf("Patch: '%s' operation cannot be applied as an update", p.Operation)
+		}
+	}
+
+	return strings.Join(sets, ", "), args, http.StatusOK, nil
+}
+
+// value returns the value hydrated by Scan
+func (p *Patch) value() interface{} {
+	switch {
+	case p.Bool.Valid:
+		return p.Bool
+	case p.String.Valid:
+		return p.String
+	case p.Int64.Valid:
+		return p.Int64
+	default:
+		return p.Time
+	}
+}
@@ -0,0 +1,54 @@
+package patch
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestToSQLUpdate(t *testing.T) {
+	mapping := map[string]string{
+		"/name":    "name",
+		"/enabled": "is_enabled",
+		"/size":    "size",
+	}
+
+	set, args, _, err := ToSQLUpdate([]Patch{
+		{Operation: "test", Path: "/version", RawValue: 3.0},
+		{Operation: "replace", Path: "/enabled", RawValue: true},
+		{Operation: "remove", Path: "/name"},
+		{Operation: "replace", Path: "/size", RawValue: 42.0},
+	}, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `"is_enabled" = $1, "name" = NULL, "size" = $2`
+	if set != expected {
+		t.Errorf("ToSQLUpdate() = %s should be %s", set, expected)
+	}
+
+	expectedArgs := []interface{}{
+		sql.NullBool{Bool: true, Valid: true},
+		sql.NullInt64{Int64: 42, Valid: true},
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("ToSQLUpdate() args = %v should be %v", args, expectedArgs)
+	}
+
+	for _, p := range []Patch{
+		{Operation: "replace", Path: "/id", RawValue: "1"},
+		{Operation: "add", Path: "/name", RawValue: "a"},
+		{Operation: "replace", Path: "/size", RawValue: 1.5},
+		{Operation: "replace", Path: "/size", RawValue: 1e19},
+		{Operation: "replace", Path: "/size", RawValue: -1e19},
+		{Operation: "replace", Path: "/size", RawValue: math.Inf(1)},
+	} {
+		_, _, status, err := ToSQLUpdate([]Patch{p}, mapping)
+		if err == nil || status < http.StatusBadRequest {
+			t.Errorf("ToSQLUpdate(%s %s) should fail", p.Operation, p.Path)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/cloudflare/service/jsonpointer"
+)
+
+// CheckTests evaluates the "test" operations within patches against the
+// current state of a resource, without applying any other operation. This
+// allows handlers which apply changes themselves, i.e. to a database, to
+// implement optimistic concurrency: a client includes test operations for the
+// values it last saw and the change is refused if they no longer hold.
+//
+// resource may be raw JSON ([]byte or json.RawMessage) or any value that can
+// be marshalled to JSON. A test whose value does not match returns 412
+// Precondition Failed, and a test of a location that does not exist returns
+// 409 Conflict.
+func CheckTests(resource interface{}, patches []Patch) (int, error) {
+	var document []byte
+
+	switch r := resource.(type) {
+	case []byte:
+		document = r
+	case json.RawMessage:
+		document = r
+	default:
+		var err error
+		if document, err = json.Marshal(resource); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	doc, err := decodeDocument(document)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for i, p := range patches {
+		if p.Operation != "test" {
+			continue
+		}
+
+		if err := test(doc, p); err != nil {
+			pe := err.(*Error)
+			pe.Index = i
+			return pe.Status, pe
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// test evaluates a single test operation against doc, returning an *Error if
+// it does not hold
+func test(doc interface{}, p Patch) error {
+	tokens, err := jsonpointer.Parse(p.Path)
+	if err != nil {
+		return &Error{Operation: p.Operation, Path: p.Path, Status: http.StatusBadRequest, Err: err}
+	}
+
+	v, err := jsonpointer.Get(doc, tokens)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, jsonpointer.ErrNotFound) {
+			status = http.StatusConflict
+		}
+
+		return &Error{Operation: p.Operation, Path: p.Path, Status: status, Err: err}
+	}
+
+	if !jsonEqual(v, p.RawValue) {
+		return &Error{
+			Operation: p.Operation,
+			Path:      p.Path,
+			Status:    http.StatusPreconditionFailed,
+			Err:       fmt.Errorf("Patch: test of %s failed, value does not match", p.Path),
+		}
+	}
+
+	return nil
+}
+
+// jsonEqual reports whether two decoded JSON values are equal as defined by
+// RFC 6902: numbers are equal if their values are numerically equal and
+// objects are equal regardless of member order
+func jsonEqual(a interface{}, b interface{}) bool {
+	if an, ok := number(a); ok {
+		bn, ok := number(b)
+		return ok && an.Cmp(bn) == 0
+	}
+
+	switch at := a.(type) {
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, av := range at {
+			bv, ok := bt[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !jsonEqual(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		bt, ok := b.(string)
+		return ok && at == bt
+	case bool:
+		bt, ok := b.(bool)
+		return ok && at == bt
+	case nil:
+		return b == nil
+	}
+
+	return false
+}
+
+// number returns the value of a JSON number, which may have been decoded as a
+// json.Number or a float64, or any Go integer or float
+func number(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	case float64:
+		return new(big.Rat).SetFloat64(n), true
+	case float32:
+		return new(big.Rat).SetFloat64(float64(n)), true
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	}
+
+	return nil, false
+}
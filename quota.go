@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/ratelimit"
+	"github.com/cloudflare/service/render"
+)
+
+// QuotaStore counts requests within fixed intervals and the requests in
+// flight. Implementations backed by a shared store (i.e. Redis) allow a quota
+// to apply across every instance of a service, the default MemoryQuotaStore
+// applies to a single process.
+type QuotaStore interface {
+	// Incr increments the count for key within the current interval and
+	// returns the new count and the time at which the interval ends
+	Incr(ctx context.Context, key string, interval time.Duration) (int64, time.Time, error)
+
+	// Acquire starts a request for key and returns true if fewer than limit
+	// are in flight. Each successful call is matched by a call to Release.
+	Acquire(ctx context.Context, key string, limit int64) (bool, error)
+
+	// Release ends a request started by Acquire
+	Release(ctx context.Context, key string) error
+}
+
+// Quota describes the limits that apply to a tenant. A zero value for a limit
+// means that the limit is not enforced.
+type Quota struct {
+	// Requests is the number of requests permitted per Interval
+	Requests int64
+	Interval time.Duration
+
+	// Concurrent is the number of requests that may be in flight at once
+	Concurrent int64
+}
+
+// QuotaFunc returns the Quota for a given tenant
+type QuotaFunc func(ctx context.Context, tenant string) Quota
+
+// TenantQuota returns Middleware that enforces the quota of each tenant, and
+// must be used after TenantScope. Requests that exceed a quota receive 429 Too
+// Many Requests, and all responses carry the X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset headers when a request rate
+// quota applies.
+//
+// If the store fails the request is allowed and the error is reported.
+func TenantQuota(store QuotaStore, quota QuotaFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tenant, ok := TenantFromContext(req.Context())
+			if !ok {
+				render.Error(
+					w,
+					http.StatusInternalServerError,
+					fmt.Errorf("tenant quota requires tenant scope"),
+				)
+				return
+			}
+
+			q := quota(req.Context(), tenant)
+
+			if q.Requests > 0 && q.Interval > 0 {
+				count, reset, err := store.Incr(req.Context(), "quota:"+tenant, q.Interval)
+				if err != nil {
+					ReportError(req, err)
+				} else {
+					remaining := q.Requests - count
+					if remaining < 0 {
+						remaining = 0
+					}
+
+					w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(q.Requests, 10))
+					w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+					w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+					if count > q.Requests {
+						metrics.Inc("tenant_quota_exceeded", "tenant", tenant, "limit", "rate")
+						w.Header().Set("Retry-After", retryAfter(reset))
+						render.Error(
+							w,
+							http.StatusTooManyRequests,
+							fmt.Errorf("quota of %d requests per %s exceeded", q.Requests, q.Interval),
+						)
+						return
+					}
+				}
+			}
+
+			if q.Concurrent > 0 {
+				key := "inflight:" + tenant
+
+				acquired, err := store.Acquire(req.Context(), key, q.Concurrent)
+				switch {
+				case err != nil:
+					ReportError(req, err)
+				case !acquired:
+					metrics.Inc("tenant_quota_exceeded", "tenant", tenant, "limit", "concurrent")
+					w.Header().Set("Retry-After", "1")
+					render.Error(
+						w,
+						http.StatusTooManyRequests,
+						fmt.Errorf("quota of %d concurrent requests exceeded", q.Concurrent),
+					)
+					return
+				default:
+					// The request may have been cancelled by the time it is
+					// released, which must not stop the release
+					defer func() {
+						if err := store.Release(context.WithoutCancel(req.Context()), key); err != nil {
+							ReportError(req, err)
+						}
+					}()
+				}
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// retryAfter returns the value of a Retry-After header for a given reset time,
+// rounded up to the nearest second
+func retryAfter(reset time.Time) string {
+	secs := int64(time.Until(reset)/time.Second) + 1
+	if secs < 1 {
+		secs = 1
+	}
+
+	return strconv.FormatInt(secs, 10)
+}
+
+// MemoryQuotaStore is a QuotaStore that holds counts in memory, and so only
+// applies quotas within a single process
+type MemoryQuotaStore struct {
+	mu       sync.Mutex
+	windows  map[string]quotaWindow
+	swept    time.Time
+	inFlight *ratelimit.Concurrency
+}
+
+type quotaWindow struct {
+	count int64
+	reset time.Time
+}
+
+// NewMemoryQuotaStore returns an empty MemoryQuotaStore
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{
+		windows:  make(map[string]quotaWindow),
+		inFlight: ratelimit.NewConcurrency(),
+	}
+}
+
+// Incr is part of the QuotaStore interface
+func (s *MemoryQuotaStore) Incr(
+	ctx context.Context,
+	key string,
+	interval time.Duration,
+) (int64, time.Time, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Periodically discard expired windows so that the map does not grow
+	// without bound as keys come and go
+	if now.Sub(s.swept) > time.Minute {
+		for k, w := range s.windows {
+			if !now.Before(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+		s.swept = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = quotaWindow{reset: now.Truncate(interval).Add(interval)}
+	}
+	w.count++
+	s.windows[key] = w
+
+	return w.count, w.reset, nil
+}
+
+// Acquire is part of the QuotaStore interface
+func (s *MemoryQuotaStore) Acquire(ctx context.Context, key string, limit int64) (bool, error) {
+	return s.inFlight.TryAcquire(key, limit), nil
+}
+
+// Release is part of the QuotaStore interface
+func (s *MemoryQuotaStore) Release(ctx context.Context, key string) error {
+	s.inFlight.Release(key)
+	return nil
+}
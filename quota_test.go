@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingQuotaStore is a QuotaStore whose backend is unavailable
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Incr(ctx context.Context, key string, interval time.Duration) (int64, time.Time, error) {
+	return 0, time.Time{}, fmt.Errorf("store unavailable")
+}
+
+func (failingQuotaStore) Acquire(ctx context.Context, key string, limit int64) (bool, error) {
+	return false, fmt.Errorf("store unavailable")
+}
+
+func (failingQuotaStore) Release(ctx context.Context, key string) error {
+	return fmt.Errorf("store unavailable")
+}
+
+// withQuota returns a handler that scopes requests to the tenant in the
+// X-Account-ID header and enforces quota with store
+func withQuota(store QuotaStore, quota Quota, next http.HandlerFunc) http.Handler {
+	q := func(ctx context.Context, tenant string) Quota { return quota }
+	return TenantScope(nil, TenantFromHeader("X-Account-ID"))(TenantQuota(store, q)(next))
+}
+
+func requestAs(h http.Handler, tenant string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Account-ID", tenant)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTenantQuotaRequests(t *testing.T) {
+	h := withQuota(NewMemoryQuotaStore(), Quota{Requests: 2, Interval: time.Hour}, func(w http.ResponseWriter, req *http.Request) {})
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := requestAs(h, "acme")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != remaining {
+			t.Errorf("request %d = %d with %s remaining, expected 200 with %s", i, rec.Code, rec.Header().Get("X-RateLimit-Remaining"), remaining)
+		}
+	}
+
+	rec := requestAs(h, "acme")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("a request over the quota = %d %v, expected %d with Retry-After", rec.Code, rec.Header(), http.StatusTooManyRequests)
+	}
+
+	if rec := requestAs(h, "initech"); rec.Code != http.StatusOK {
+		t.Errorf("the quota of another tenant should be separate, got %d", rec.Code)
+	}
+}
+
+func TestTenantQuotaConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	store := NewMemoryQuotaStore()
+
+	h := withQuota(store, Quota{Concurrent: 1}, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("hold") != "" {
+			started <- struct{}{}
+			<-release
+		}
+	})
+
+	done := make(chan int)
+	go func() {
+		req := httptest.NewRequest("GET", "/?hold=1", nil)
+		req.Header.Set("X-Account-ID", "acme")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		done <- rec.Code
+	}()
+	<-started
+
+	if rec := requestAs(h, "acme"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("a request over the concurrent quota = %d, expected %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := requestAs(h, "initech"); rec.Code != http.StatusOK {
+		t.Errorf("the concurrent quota of another tenant should be separate, got %d", rec.Code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("the held request = %d, expected 200", code)
+	}
+
+	if rec := requestAs(h, "acme"); rec.Code != http.StatusOK {
+		t.Errorf("a request after the release = %d, expected 200", rec.Code)
+	}
+	if n := store.inFlight.InFlight("inflight:acme"); n != 0 {
+		t.Errorf("every request should be released, %d still in flight", n)
+	}
+}
+
+func TestTenantQuotaStoreFailure(t *testing.T) {
+	h := withQuota(failingQuotaStore{}, Quota{Requests: 1, Interval: time.Hour, Concurrent: 1}, func(w http.ResponseWriter, req *http.Request) {})
+
+	for i := 0; i < 3; i++ {
+		if rec := requestAs(h, "acme"); rec.Code != http.StatusOK {
+			t.Errorf("request %d with the store unavailable = %d, expected it to be allowed", i, rec.Code)
+		}
+	}
+}
+
+func TestTenantQuotaWithoutScope(t *testing.T) {
+	q := func(ctx context.Context, tenant string) Quota { return Quota{} }
+	h := TenantQuota(NewMemoryQuotaStore(), q)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("a quota without tenant scope = %d, expected %d", rec.Code, http.StatusInternalServerError)
+	}
+}
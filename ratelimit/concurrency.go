@@ -0,0 +1,49 @@
+package ratelimit
+
+import "sync"
+
+// Concurrency limits the number of operations in progress per key, such as
+// per tenant. Keys are forgotten when they have nothing in progress.
+type Concurrency struct {
+	mu       sync.Mutex
+	inFlight map[string]int64
+}
+
+// NewConcurrency returns an empty Concurrency
+func NewConcurrency() *Concurrency {
+	return &Concurrency{inFlight: make(map[string]int64)}
+}
+
+// TryAcquire starts an operation for key and returns true if fewer than limit
+// are in progress, otherwise it returns false. Each successful call must be
+// matched by a call to Release.
+func (c *Concurrency) TryAcquire(key string, limit int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inFlight[key] >= limit {
+		return false
+	}
+	c.inFlight[key]++
+
+	return true
+}
+
+// Release ends an operation for key
+func (c *Concurrency) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight[key]--
+	if c.inFlight[key] <= 0 {
+		delete(c.inFlight, key)
+	}
+}
+
+// InFlight returns the number of operations in progress for key
+func (c *Concurrency) InFlight(key string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.inFlight[key]
+}
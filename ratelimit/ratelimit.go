@@ -0,0 +1,83 @@
+// Package ratelimit provides the primitives behind the service's rate and
+// concurrency limits, so that handlers can protect expensive operations with
+// the same code: a token bucket, a weighted semaphore, a sliding window
+// counter and a keyed concurrency limiter. All are safe for concurrent use.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket allows events at a steady rate with bursts. The bucket holds up
+// to burst tokens and is refilled at rate tokens per second, and each event
+// takes a token.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full TokenBucket
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Allow is AllowN(time.Now(), 1)
+func (b *TokenBucket) Allow() bool {
+	return b.AllowN(time.Now(), 1)
+}
+
+// AllowN takes n tokens and returns true if they are available at now,
+// otherwise it takes none and returns false
+func (b *TokenBucket) AllowN(now time.Time, n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+
+	return true
+}
+
+// Delay returns how long after now n tokens will be available, which is
+// suitable for a Retry-After header
+func (b *TokenBucket) Delay(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	missing := float64(n) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	if b.rate <= 0 || float64(n) > b.burst {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// refill adds the tokens accrued since the last call.
+// b.mu is held.
+func (b *TokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(10, 2)
+
+	if !b.AllowN(now, 1) || !b.AllowN(now, 1) {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if b.AllowN(now, 1) {
+		t.Fatal("expected the empty bucket to refuse")
+	}
+	if d := b.Delay(now, 1); d != 100*time.Millisecond {
+		t.Errorf("delay %s, expected 100ms", d)
+	}
+	if !b.AllowN(now.Add(100*time.Millisecond), 1) {
+		t.Error("expected a token after refilling")
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(3)
+
+	if !s.TryAcquire(2) {
+		t.Fatal("expected to acquire 2 of 3")
+	}
+	if s.TryAcquire(2) {
+		t.Fatal("expected not to acquire 2 more")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 2); err != context.DeadlineExceeded {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		s.Acquire(context.Background(), 3)
+		close(acquired)
+	}()
+
+	s.Release(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiter to acquire after release")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Unix(0, 0)
+	s := NewSlidingWindow(10, time.Minute)
+
+	if !s.AllowN(start, 10) {
+		t.Fatal("expected the limit to be allowed")
+	}
+	if s.AllowN(start.Add(30*time.Second), 1) {
+		t.Fatal("expected the full window to refuse")
+	}
+
+	// Half way through the next window half of the previous count remains
+	if c := s.Count(start.Add(90 * time.Second)); c != 5 {
+		t.Errorf("count %d, expected 5", c)
+	}
+	if !s.AllowN(start.Add(90*time.Second), 5) {
+		t.Error("expected the remainder to be allowed")
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	c := NewConcurrency()
+
+	if !c.TryAcquire("a", 1) || c.TryAcquire("a", 1) {
+		t.Fatal("expected a limit of 1 for a")
+	}
+	if !c.TryAcquire("b", 1) {
+		t.Fatal("expected b to be limited separately")
+	}
+
+	c.Release("a")
+	if c.InFlight("a") != 0 {
+		t.Errorf("%d in flight, expected 0", c.InFlight("a"))
+	}
+}
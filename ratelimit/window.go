@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindow counts events over a sliding window, approximated from the
+// counts of the current and previous fixed windows. It avoids the burst of up
+// to twice the limit that fixed windows allow at their boundaries.
+type SlidingWindow struct {
+	mu       sync.Mutex
+	limit    int64
+	window   time.Duration
+	start    time.Time
+	current  int64
+	previous int64
+}
+
+// NewSlidingWindow returns a SlidingWindow allowing limit events per window
+func NewSlidingWindow(limit int64, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{limit: limit, window: window}
+}
+
+// Allow is AllowN(time.Now(), 1)
+func (s *SlidingWindow) Allow() bool {
+	return s.AllowN(time.Now(), 1)
+}
+
+// AllowN records n events and returns true if they are within the limit at
+// now, otherwise it records none and returns false
+func (s *SlidingWindow) AllowN(now time.Time, n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count(now)+n > s.limit {
+		return false
+	}
+	s.current += n
+
+	return true
+}
+
+// Count returns the estimated number of events in the window ending at now
+func (s *SlidingWindow) Count(now time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count(now)
+}
+
+// count advances the fixed windows to now and returns the weighted count.
+// s.mu is held.
+func (s *SlidingWindow) count(now time.Time) int64 {
+	start := now.Truncate(s.window)
+	switch {
+	case start.Equal(s.start):
+	case start.Equal(s.start.Add(s.window)):
+		s.previous, s.current = s.current, 0
+		s.start = start
+	default:
+		s.previous, s.current = 0, 0
+		s.start = start
+	}
+
+	elapsed := float64(now.Sub(start)) / float64(s.window)
+
+	return s.current + int64(float64(s.previous)*(1-elapsed))
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	raven "github.com/getsentry/raven-go"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// Recover is middleware that recovers from a panic in a handler. The panic
+// and its stack are logged, sent to Sentry if the SENTRY_DSN environment
+// variable is set, and counted by the requests_panicked metric, and a JSON
+// 500 Internal Server Error is rendered. If the handler had already started
+// the response the connection is aborted instead, so that the client does not
+// mistake a truncated response for a complete one. Panics with
+// http.ErrAbortHandler are passed on, as they deliberately abort a response.
+//
+// It is applied to every request served by Run and RunTLS.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := newResponseWriter(w)
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			reportPanic(req, p, debug.Stack())
+
+			if rw.Written() {
+				panic(http.ErrAbortHandler)
+			}
+
+			render.Error(w, http.StatusInternalServerError, fmt.Errorf("internal server error"))
+		}()
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// reportPanic logs a panic in a handler and its stack, sends it to Sentry if
+// the SENTRY_DSN environment variable is set, and counts it by the
+// requests_panicked metric
+func reportPanic(req *http.Request, p interface{}, stack []byte) {
+	metrics.Inc("requests_panicked")
+
+	log.ErrorKV(
+		"panic serving request",
+		"method", req.Method,
+		"path", req.URL.Path,
+		"panic", fmt.Sprint(p),
+		"stack", string(stack),
+	)
+
+	if os.Getenv("SENTRY_DSN") != "" {
+		err, ok := p.(error)
+		if !ok {
+			err = fmt.Errorf("%v", p)
+		}
+		raven.CaptureError(err, Tags(req.Context()), raven.NewHttp(req))
+	}
+}
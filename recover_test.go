@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestRecover(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("nil map")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/things", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"internal server error"`) {
+		t.Errorf("a panic = %d %s, expected a JSON 500", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(out.String(), "nil map") || !strings.Contains(out.String(), "recover_test.go") {
+		t.Errorf("the panic and its stack should be logged: %q", out.String())
+	}
+
+	h = Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("after writing")
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("a panic after the response started = %v, expected http.ErrAbortHandler", p)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things", nil))
+}
@@ -0,0 +1,45 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// maxStack is the number of frames in the stack written in DevMode
+const maxStack = 16
+
+// causes returns the messages of the errors wrapped by err, outermost first
+func causes(err error) []string {
+	messages := []string{}
+	for err = errors.Unwrap(err); err != nil; err = errors.Unwrap(err) {
+		messages = append(messages, err.Error())
+	}
+
+	return messages
+}
+
+// stack returns the stack of the caller, skipping skip frames, up to the
+// frames of net/http and the runtime which are of no interest
+func stack(skip int) []string {
+	pcs := make([]uintptr, maxStack)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	lines := []string{}
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, "net/http.") ||
+			strings.HasPrefix(f.Function, "runtime.") {
+			break
+		}
+
+		lines = append(lines, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+		if !more {
+			break
+		}
+	}
+
+	return lines
+}
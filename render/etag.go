@@ -0,0 +1,112 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ETagOf returns a strong ETag for v, derived from its compact JSON. It
+// identifies the value rather than its formatting, so that the same value
+// has the same ETag whether or not it is indented, and so a handler can
+// compare the ETag of the current state of a resource with If-Match, see
+// CheckPreconditions.
+func ETagOf(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf(`"%x"`, sum[:16]), nil
+}
+
+// JSONWithETag is Request with an ETag header computed with ETagOf, after
+// the render options of the request are applied. A GET or HEAD request whose
+// If-None-Match matches the ETag receives 304 Not Modified without a body.
+func JSONWithETag(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	opts := OptionsFrom(req.Context())
+
+	v, err := opts.apply(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	etag, err := ETagOf(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	SetHeaders(w)
+	w.Header().Set("ETag", etag)
+
+	if status == http.StatusOK &&
+		(req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		etagMatches(req.Header.Get("If-None-Match"), etag, false) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	renderJSON(w, status, v, opts.indent())
+}
+
+// CheckPreconditions evaluates the If-Match and If-None-Match headers of a
+// request that modifies a resource, i.e. a PUT or PATCH, against the ETag of
+// the current state of the resource, or "" if it does not exist. If a
+// precondition fails it writes 412 Precondition Failed and returns false,
+// and the handler must not modify the resource. Requests without either
+// header pass, so clients opt in to optimistic concurrency:
+//
+//	current, _ := render.ETagOf(thing)
+//	if !render.CheckPreconditions(w, req, current) {
+//		return
+//	}
+func CheckPreconditions(w http.ResponseWriter, req *http.Request, etag string) bool {
+	if match := req.Header.Get("If-Match"); match != "" {
+		if etag == "" || !etagMatches(match, etag, true) {
+			Error(w, http.StatusPreconditionFailed,
+				fmt.Errorf("If-Match (%s) does not match the current ETag", match))
+			return false
+		}
+	}
+
+	if noneMatch := req.Header.Get("If-None-Match"); noneMatch != "" {
+		if etag != "" && etagMatches(noneMatch, etag, false) {
+			Error(w, http.StatusPreconditionFailed,
+				fmt.Errorf("If-None-Match (%s) matches the current ETag", noneMatch))
+			return false
+		}
+	}
+
+	return true
+}
+
+// etagMatches returns true if the comma-delimited list of ETags in a
+// conditional header matches etag. The strong comparison of If-Match never
+// matches a weak ETag, the weak comparison of If-None-Match ignores the W/
+// prefix.
+func etagMatches(header string, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONWithETag(t *testing.T) {
+	v := thing{A: 1}
+	etag, err := ETagOf(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	JSONWithETag(rec, httptest.NewRequest("GET", "/", nil), http.StatusOK, v)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag {
+		t.Fatalf("GET = %d with ETag %q, expected 200 with %q", rec.Code, rec.Header().Get("ETag"), etag)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	JSONWithETag(rec, req, http.StatusOK, v)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("GET with a matching If-None-Match = %d %q, expected 304", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	etag, _ := ETagOf(thing{A: 1})
+
+	tests := []struct {
+		header  string
+		value   string
+		current string
+		ok      bool
+	}{
+		{"", "", etag, true},
+		{"If-Match", etag, etag, true},
+		{"If-Match", `"stale"`, etag, false},
+		{"If-Match", "W/" + etag, etag, false},
+		{"If-Match", "*", "", false},
+		{"If-None-Match", "*", "", true},
+		{"If-None-Match", "*", etag, false},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+
+		ok := CheckPreconditions(rec, req, test.current)
+		if ok != test.ok {
+			t.Errorf("%s: %s with current %q = %v, expected %v", test.header, test.value, test.current, ok, test.ok)
+		}
+		if !ok && rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s: %s = %d, expected 412", test.header, test.value, rec.Code)
+		}
+	}
+}
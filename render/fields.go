@@ -0,0 +1,75 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// FilterFields returns the JSON representation of v with all but the named
+// top-level fields removed. Arrays are filtered element by element, and the
+// pagination.Pagination envelope is preserved with only its items filtered.
+// If no fields are given v is returned unaltered.
+func FilterFields(v interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keep[f] = true
+	}
+
+	return prune(doc, keep), nil
+}
+
+// prune removes the fields not in keep from doc
+func prune(doc interface{}, keep map[string]bool) interface{} {
+	switch d := doc.(type) {
+	case []interface{}:
+		for i := range d {
+			d[i] = prune(d[i], keep)
+		}
+	case map[string]interface{}:
+		// A paginated collection is filtered within its items
+		if _, paginated := d["totalPages"]; paginated {
+			if items, ok := d["items"].([]interface{}); ok {
+				d["items"] = prune(items, keep)
+				return d
+			}
+		}
+
+		for k := range d {
+			if !keep[k] {
+				delete(d, k)
+			}
+		}
+	}
+
+	return doc
+}
+
+// JSONFields will write a given interface{} to the http.ResponseWriter as JSON
+// containing only the named fields, see FilterFields, and set the HTTP status.
+func JSONFields(w http.ResponseWriter, status int, v interface{}, fields []string) {
+	filtered, err := FilterFields(v, fields)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	SetHeaders(w)
+	renderJSON(w, status, filtered, indentJSON)
+}
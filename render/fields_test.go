@@ -0,0 +1,59 @@
+package render
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilterFields(t *testing.T) {
+	type Thing struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Owner string `json:"owner"`
+	}
+
+	message := "FilterFields(%v) = %s should be %s"
+
+	fields := []string{"id", "name"}
+
+	filtered, err := FilterFields(Thing{ID: 1, Name: "a", Owner: "b"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(filtered)
+	expected := `{"id":1,"name":"a"}`
+	if string(b) != expected {
+		t.Errorf(message, fields, b, expected)
+	}
+
+	filtered, err = FilterFields([]Thing{{ID: 1}, {ID: 2}}, fields[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(filtered)
+	expected = `[{"id":1},{"id":2}]`
+	if string(b) != expected {
+		t.Errorf(message, fields[:1], b, expected)
+	}
+
+	// Pagination envelopes keep all of their fields
+	page := map[string]interface{}{
+		"totalPages": 1,
+		"items":      []Thing{{ID: 1, Name: "a"}},
+	}
+	filtered, err = FilterFields(page, fields[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(filtered)
+	expected = `{"items":[{"name":"a"}],"totalPages":1}`
+	if string(b) != expected {
+		t.Errorf(message, fields[1:], b, expected)
+	}
+
+	// No fields returns the input untouched
+	filtered, _ = FilterFields(Thing{ID: 1}, nil)
+	if _, ok := filtered.(Thing); !ok {
+		t.Errorf("FilterFields(nil) should not alter the value")
+	}
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// maxPooledJSONBuffer is the capacity above which a buffer is not returned to
+// the pool, so that one very large response does not pin its memory
+const maxPooledJSONBuffer = 1 << 20
+
+// indentJSON is whether JSON is indented by default, see SetIndent
+var indentJSON = true
+
+// jsonEncoder is a pooled encoder and the buffer it encodes into
+type jsonEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonEncoders = sync.Pool{
+	New: func() interface{} {
+		e := &jsonEncoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// writeJSON writes v as JSON with the status, indented if indent is true. It
+// writes the same bytes as json.Marshal, or json.MarshalIndent followed by a
+// newline, without their allocations. If v cannot be encoded nothing is
+// written and the error is returned.
+func writeJSON(w http.ResponseWriter, status int, v interface{}, indent bool) error {
+	e := jsonEncoders.Get().(*jsonEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledJSONBuffer {
+			jsonEncoders.Put(e)
+		}
+	}()
+
+	e.buf.Reset()
+	if indent {
+		e.enc.SetIndent("", "  ")
+	} else {
+		e.enc.SetIndent("", "")
+	}
+
+	if err := e.enc.Encode(v); err != nil {
+		return err
+	}
+
+	b := e.buf.Bytes()
+	if !indent {
+		// Encode terminates the value with a newline, json.Marshal does not
+		b = b[:len(b)-1]
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_, err := w.Write(b)
+
+	return err
+}
+
+// renderJSON writes v as JSON with writeJSON, or a 500 error if it cannot be
+// encoded
+func renderJSON(w http.ResponseWriter, status int, v interface{}, indent bool) {
+	if err := writeJSON(w, status, v, indent); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,148 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// MsgPack will write a given interface{} to the http.ResponseWriter as
+// MessagePack and set the HTTP status. The value is encoded as it would be as
+// JSON, so json struct tags apply.
+func MsgPack(w http.ResponseWriter, status int, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeMsgPack(&buf, doc); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/msgpack")
+	w.WriteHeader(status)
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+// encodeMsgPack writes a decoded JSON document as MessagePack
+func encodeMsgPack(buf *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+
+	case bool:
+		if t {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			encodeMsgPackInt(buf, i)
+			return nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+
+	case string:
+		n := len(t)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(t)
+
+	case []interface{}:
+		encodeMsgPackLen(buf, len(t), 0x90, 0xdc, 0xdd)
+		for _, e := range t {
+			if err := encodeMsgPack(buf, e); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		// Sorted keys give a stable encoding, as encoding/json does
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		encodeMsgPackLen(buf, len(t), 0x80, 0xde, 0xdf)
+		for _, k := range keys {
+			encodeMsgPack(buf, k)
+			if err := encodeMsgPack(buf, t[k]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: cannot encode %T", v)
+	}
+
+	return nil
+}
+
+// encodeMsgPackInt writes an integer in the smallest MessagePack form
+func encodeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// encodeMsgPackLen writes the header of an array or map of n elements
+func encodeMsgPackLen(buf *bytes.Buffer, n int, fix byte, b16 byte, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,262 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/unrolled/render"
+)
+
+// Encoder writes v to the http.ResponseWriter in a media type, setting the
+// Content-Type and the HTTP status
+type Encoder func(w http.ResponseWriter, status int, v interface{}) error
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{}
+
+	// mediaTypes holds the registered media types in order of preference for
+	// when the client accepts any of them
+	mediaTypes []string
+)
+
+func init() {
+	RegisterEncoder("application/json", func(w http.ResponseWriter, status int, v interface{}) error {
+		return writeJSON(w, status, v, indentJSON)
+	})
+	RegisterEncoder("application/xml", func(w http.ResponseWriter, status int, v interface{}) error {
+		return r.XML(w, status, v)
+	})
+	RegisterEncoder("text/xml", func(w http.ResponseWriter, status int, v interface{}) error {
+		return r.XML(w, status, v)
+	})
+	RegisterEncoder("application/msgpack", MsgPack)
+	RegisterEncoder("application/x-msgpack", MsgPack)
+}
+
+// RegisterEncoder adds an encoder for a media type to those that Negotiate
+// chooses between, replacing any existing encoder for the media type
+func RegisterEncoder(mediaType string, e Encoder) {
+	mediaType = strings.ToLower(mediaType)
+
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if _, ok := encoders[mediaType]; !ok {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	encoders[mediaType] = e
+}
+
+// MediaTypes returns the media types that Negotiate can write, in order of
+// preference
+func MediaTypes() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	return append([]string{}, mediaTypes...)
+}
+
+// ErrNotAcceptable is written by Negotiate with 406 Not Acceptable when the
+// Accept header matches none of the MediaTypes and the policy is
+// NotAcceptableReject. Error lists the MediaTypes in the response.
+var ErrNotAcceptable = errors.New("none of the media types in Accept can be produced")
+
+// NotAcceptablePolicy decides how Negotiate responds to a request whose
+// Accept header matches none of the MediaTypes
+type NotAcceptablePolicy int32
+
+// These constants identify the policies
+const (
+	// NotAcceptableFallback writes JSON regardless. It is the default.
+	NotAcceptableFallback NotAcceptablePolicy = iota
+	// NotAcceptableReject responds 406 Not Acceptable with ErrNotAcceptable
+	NotAcceptableReject
+)
+
+func (p NotAcceptablePolicy) String() string {
+	if p == NotAcceptableReject {
+		return "406"
+	}
+
+	return "json"
+}
+
+var notAcceptable int32 // sync/atomic NotAcceptablePolicy
+
+// SetNotAcceptablePolicy sets how Negotiate responds to requests for none of
+// the MediaTypes. Requests without an Accept header always receive JSON.
+func SetNotAcceptablePolicy(p NotAcceptablePolicy) {
+	atomic.StoreInt32(&notAcceptable, int32(p))
+}
+
+// GetNotAcceptablePolicy returns the policy set with SetNotAcceptablePolicy
+func GetNotAcceptablePolicy() NotAcceptablePolicy {
+	return NotAcceptablePolicy(atomic.LoadInt32(&notAcceptable))
+}
+
+// notAcceptableKey is the key of the NotAcceptablePolicy in a request context
+type notAcceptableKey struct{}
+
+// WithNotAcceptablePolicy returns a copy of ctx in which Negotiate applies p
+// rather than the policy set with SetNotAcceptablePolicy, so that services
+// sharing a process may each have their own
+func WithNotAcceptablePolicy(ctx context.Context, p NotAcceptablePolicy) context.Context {
+	return context.WithValue(ctx, notAcceptableKey{}, p)
+}
+
+// notAcceptablePolicy returns the policy that applies to a request context
+func notAcceptablePolicy(ctx context.Context) NotAcceptablePolicy {
+	if p, ok := ctx.Value(notAcceptableKey{}).(NotAcceptablePolicy); ok {
+		return p
+	}
+
+	return GetNotAcceptablePolicy()
+}
+
+// SetIndent sets whether JSON and XML are indented, which they are by
+// default. Disabling indentation gives smaller payloads in production. It
+// should be called before any responses are rendered.
+func SetIndent(indent bool) {
+	indentJSON = indent
+	r = render.New(
+		render.Options{
+			IndentJSON: indent,
+			IndentXML:  indent,
+		},
+	)
+}
+
+// Negotiate will write a given interface{} to the http.ResponseWriter in the
+// registered media type that best matches the Accept header of the request,
+// and set the HTTP status. JSON is written if the client expresses no
+// preference. If it accepts none of the registered media types the
+// NotAcceptablePolicy applies. The response varies by Accept, which is
+// declared in the Vary header for caches.
+//
+// The render options of the request context are applied, see WithOptions,
+// except that XML is never filtered or wrapped in an envelope.
+func Negotiate(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	mediaType, e, ok := negotiate(req.Header.Get("Accept"))
+	if !ok && notAcceptablePolicy(req.Context()) == NotAcceptableReject {
+		Error(w, http.StatusNotAcceptable, ErrNotAcceptable)
+		return
+	}
+
+	opts := OptionsFrom(req.Context())
+	switch mediaType {
+	case "application/json":
+		if opts.Indent != IndentDefault {
+			e = func(w http.ResponseWriter, status int, v interface{}) error {
+				return writeJSON(w, status, v, opts.indent())
+			}
+		}
+	case "application/xml", "text/xml":
+		if opts.Indent != IndentDefault {
+			e = func(w http.ResponseWriter, status int, v interface{}) error {
+				return opts.renderer().XML(w, status, v)
+			}
+		}
+		opts.Fields = nil
+		opts.Envelope = ""
+	}
+
+	v, err := opts.apply(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	SetHeaders(w)
+	if err := e(w, status, v); err != nil {
+		Error(w, http.StatusInternalServerError, err)
+	}
+}
+
+// acceptRange is a media range from an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate returns the media type and encoder that best match the Accept
+// header, or JSON and false if none match
+func negotiate(accept string) (string, Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	if strings.TrimSpace(accept) == "" {
+		return "application/json", encoders["application/json"], true
+	}
+
+	for _, ar := range parseAccept(accept) {
+		if ar.q <= 0 {
+			continue
+		}
+
+		if e, ok := encoders[ar.mediaType]; ok {
+			return ar.mediaType, e, true
+		}
+
+		if ar.mediaType == "*/*" || ar.mediaType == "*" {
+			return mediaTypes[0], encoders[mediaTypes[0]], true
+		}
+
+		if strings.HasSuffix(ar.mediaType, "/*") {
+			prefix := strings.TrimSuffix(ar.mediaType, "*")
+			for _, mt := range mediaTypes {
+				if strings.HasPrefix(mt, prefix) {
+					return mt, encoders[mt], true
+				}
+			}
+		}
+	}
+
+	return "application/json", encoders["application/json"], false
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred
+// first
+func parseAccept(accept string) []acceptRange {
+	ranges := []acceptRange{}
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		ar := acceptRange{
+			mediaType: strings.ToLower(strings.TrimSpace(params[0])),
+			q:         1,
+		}
+		if ar.mediaType == "" {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					ar.q = q
+				}
+			}
+		}
+
+		ranges = append(ranges, ar)
+	}
+
+	// More specific ranges win ties, i.e. application/json over */*
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	return ranges
+}
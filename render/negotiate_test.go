@@ -0,0 +1,177 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type thing struct {
+	A int `json:"a" xml:"a"`
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json; charset=UTF-8"},
+		{"*/*", "application/json; charset=UTF-8"},
+		{"application/xml", "text/xml; charset=UTF-8"},
+		{"text/html, application/msgpack;q=0.9, */*;q=0.1", "application/msgpack"},
+		{"application/json;q=0.5, application/xml", "text/xml; charset=UTF-8"},
+		{"image/png", "application/json; charset=UTF-8"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+
+		Negotiate(w, req, http.StatusOK, thing{A: 1})
+
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Accept %q: Content-Type %q, expected %q", test.accept, ct, test.contentType)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Accept %q: Vary %q, expected Accept", test.accept, vary)
+		}
+	}
+}
+
+func TestMsgPack(t *testing.T) {
+	w := httptest.NewRecorder()
+	MsgPack(w, http.StatusOK, map[string]interface{}{"a": 1, "b": []string{"x"}})
+
+	// fixmap(2) "a" 1 "b" fixarray(1) "x"
+	expected := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x91, 0xa1, 'x'}
+	if !bytes.Equal(w.Body.Bytes(), expected) {
+		t.Errorf("encoded % x, expected % x", w.Body.Bytes(), expected)
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	type item struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithOptions(req.Context(), Options{
+		Indent:   IndentOff,
+		Envelope: "result",
+		Fields:   []string{"a"},
+	}))
+	w := httptest.NewRecorder()
+
+	Request(w, req, http.StatusOK, item{A: 1, B: 2})
+
+	expected := `{"result":{"a":1}}`
+	if w.Body.String() != expected {
+		t.Errorf("Request() = %s, expected %s", w.Body.String(), expected)
+	}
+
+	// Requests without options are rendered as before
+	w = httptest.NewRecorder()
+	Negotiate(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, item{A: 1, B: 2})
+
+	if !bytes.Contains(w.Body.Bytes(), []byte("\n")) || !bytes.Contains(w.Body.Bytes(), []byte(`"b"`)) {
+		t.Errorf("Negotiate() = %s should be indented and unfiltered", w.Body.String())
+	}
+}
+
+func TestDevMode(t *testing.T) {
+	err := fmt.Errorf("loading thing: %w", fmt.Errorf("query: %w", errors.New("connection refused")))
+
+	w := httptest.NewRecorder()
+	Error(w, http.StatusInternalServerError, err)
+	if bytes.Contains(w.Body.Bytes(), []byte("causes")) {
+		t.Errorf("Error() = %s should not include the causes", w.Body.String())
+	}
+
+	DevMode = true
+	defer func() { DevMode = false }()
+
+	w = httptest.NewRecorder()
+	Error(w, http.StatusInternalServerError, err)
+
+	var e struct {
+		Causes []string `json:"causes"`
+		Stack  []string `json:"stack"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Causes) != 2 || e.Causes[1] != "connection refused" {
+		t.Errorf("Error() causes = %v should end with the root cause", e.Causes)
+	}
+	if len(e.Stack) == 0 || !strings.Contains(e.Stack[0], "TestDevMode") {
+		t.Errorf("Error() stack = %v should begin with the caller", e.Stack)
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	SetNotAcceptablePolicy(NotAcceptableReject)
+	defer SetNotAcceptablePolicy(NotAcceptableFallback)
+
+	tests := []struct {
+		accept string
+		status int
+	}{
+		{"image/png", http.StatusNotAcceptable},
+		{"", http.StatusOK},
+		{"image/png, */*;q=0.1", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		Negotiate(rec, req, http.StatusOK, thing{A: 1})
+
+		if rec.Code != test.status {
+			t.Errorf("Accept %q = %d, expected %d", test.accept, rec.Code, test.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "image/png")
+	Negotiate(rec, req, http.StatusOK, thing{A: 1})
+	if !strings.Contains(rec.Body.String(), "application/msgpack") {
+		t.Errorf("406 body %q should list the supported media types", rec.Body.String())
+	}
+}
+
+func TestWithNotAcceptablePolicy(t *testing.T) {
+	tests := []struct {
+		global NotAcceptablePolicy
+		policy NotAcceptablePolicy
+		status int
+	}{
+		{NotAcceptableFallback, NotAcceptableReject, http.StatusNotAcceptable},
+		{NotAcceptableReject, NotAcceptableFallback, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		SetNotAcceptablePolicy(test.global)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "image/png")
+		req = req.WithContext(WithNotAcceptablePolicy(req.Context(), test.policy))
+		Negotiate(rec, req, http.StatusOK, thing{A: 1})
+
+		if rec.Code != test.status {
+			t.Errorf("policy %s over %s = %d, expected %d", test.policy, test.global, rec.Code, test.status)
+		}
+	}
+
+	SetNotAcceptablePolicy(NotAcceptableFallback)
+}
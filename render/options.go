@@ -0,0 +1,114 @@
+package render
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/unrolled/render"
+)
+
+// Indent overrides whether a single response is indented
+type Indent int
+
+// These constants identify the indentation of a response
+const (
+	// IndentDefault indents as set by SetIndent
+	IndentDefault Indent = iota
+	// IndentOn indents the response, i.e. for ?pretty=1
+	IndentOn
+	// IndentOff does not indent the response
+	IndentOff
+)
+
+// Options override how the response to a single request is rendered
+type Options struct {
+	Indent Indent
+
+	// Envelope, if set, wraps the value in an object with this one member,
+	// i.e. {"result": v}
+	Envelope string
+
+	// Fields, if set, removes all but the named fields, see FilterFields
+	Fields []string
+}
+
+// optionsKey is the key of the Options in a request context
+type optionsKey struct{}
+
+// WithOptions returns a copy of ctx holding render options for a single
+// request, which are applied by Request and Negotiate, i.e.
+//
+//	if req.URL.Query().Get("pretty") == "1" {
+//		req = req.WithContext(render.WithOptions(req.Context(), render.Options{Indent: render.IndentOn}))
+//	}
+//
+// The options replace any already in ctx. The shared renderer is not
+// modified, so other requests are unaffected.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFrom returns the render options held by ctx, if any
+func OptionsFrom(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+var (
+	indented = render.New(render.Options{IndentJSON: true, IndentXML: true})
+	compact  = render.New(render.Options{})
+)
+
+// renderer returns the renderer for the indentation of the options
+func (o Options) renderer() *render.Render {
+	switch o.Indent {
+	case IndentOn:
+		return indented
+	case IndentOff:
+		return compact
+	default:
+		return r
+	}
+}
+
+// indent returns whether JSON is indented for the options
+func (o Options) indent() bool {
+	switch o.Indent {
+	case IndentOn:
+		return true
+	case IndentOff:
+		return false
+	default:
+		return indentJSON
+	}
+}
+
+// apply filters and wraps v as the options require
+func (o Options) apply(v interface{}) (interface{}, error) {
+	v, err := FilterFields(v, o.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Envelope != "" {
+		v = map[string]interface{}{o.Envelope: v}
+	}
+
+	return v, nil
+}
+
+// Request will write a given interface{} to the http.ResponseWriter as JSON
+// with the render options of the request context, see WithOptions, and set
+// the HTTP status.
+func Request(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	opts := OptionsFrom(req.Context())
+
+	v, err := opts.apply(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	SetHeaders(w)
+	renderJSON(w, status, v, opts.indent())
+}
@@ -1,9 +1,13 @@
 package render
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/unrolled/render"
+
+	"github.com/cloudflare/service/decoder"
 )
 
 var r = render.New(
@@ -12,18 +16,124 @@ var r = render.New(
 	},
 )
 
+// HeaderHook, if set, is called with the headers of every response written
+// by this package, and so every response that the framework generates, so
+// that organization-mandated headers can be added
+var HeaderHook func(h http.Header)
+
+// SetHeaders sets the headers that every response written by this package
+// carries: X-Content-Type-Options to stop browsers sniffing the body as HTML,
+// and any added by HeaderHook. It is called by the functions of this package
+// and need only be called directly when writing a response without them.
+func SetHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if HeaderHook != nil {
+		HeaderHook(w.Header())
+	}
+}
+
+// DevMode adds the chain of wrapped errors and a trimmed stack to the errors
+// written by Error, so that a developer running a service locally need not
+// look through the logs for each one. It exposes the internals of the service
+// and must not be set in production.
+var DevMode bool
+
+// ErrorBody is the JSON of every error written by Error. Message is kept in
+// the "error" member for clients that predate the others. Code is a
+// machine-readable code that clients can branch on, which for errors that do
+// not describe themselves is derived from the status, i.e. "not_found".
+type ErrorBody struct {
+	Message   string       `json:"error"`
+	Code      string       `json:"code"`
+	Details   interface{}  `json:"details,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	Supported []string     `json:"supported,omitempty"`
+	Causes    []string     `json:"causes,omitempty"`
+	Stack     []string     `json:"stack,omitempty"`
+}
+
+// FieldError is a problem with one field of a request, i.e. a validation
+// failure. Field is the path of the field, i.e. "address.postcode".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Describer is implemented by errors that describe themselves in the body
+// that Error writes, such as service.APIError
+type Describer interface {
+	error
+	Describe() ErrorBody
+}
+
+// statusCoder is implemented by errors that choose their status
+type statusCoder interface {
+	StatusCode() int
+}
+
 // Error will write a given error to the http.ResponseWriter as JSON
-// and set the HTTP status.
+// and set the HTTP status, see ErrorBody. An error that wraps a Describer is
+// written as it describes itself, and one that has a StatusCode method with
+// that status. An error from decoder.Decode for a Content-Type without a
+// decoder is always written as 415 Unsupported Media Type, with the
+// Content-Types that are supported, one reading a body beyond the limit of
+// http.MaxBytesReader as 413 Request Entity Too Large, and ErrNotAcceptable
+// lists the MediaTypes.
 func Error(w http.ResponseWriter, status int, err error) {
-	type ErrorJS struct {
-		Message string `json:"error"`
+	e := ErrorBody{Message: err.Error()}
+
+	var d Describer
+	if errors.As(err, &d) {
+		e = d.Describe()
+	}
+
+	var sc statusCoder
+	if errors.As(err, &sc) {
+		status = sc.StatusCode()
+	}
+
+	if errors.Is(err, decoder.ErrDecoderNotImplemented) {
+		status = http.StatusUnsupportedMediaType
+		e.Supported = decoder.ContentTypes()
+	}
+	var mb *http.MaxBytesError
+	if errors.As(err, &mb) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrNotAcceptable) {
+		e.Supported = MediaTypes()
+	}
+
+	if e.Code == "" {
+		e.Code = StatusCode(status)
+	}
+	if DevMode {
+		e.Causes = causes(err)
+		e.Stack = stack(2)
+	}
+
+	SetHeaders(w)
+	renderJSON(w, status, e, indentJSON)
+}
+
+// StatusCode returns the error code for a HTTP status, being its text in
+// snake case, i.e. "unsupported_media_type" for 415
+func StatusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
 	}
 
-	r.JSON(w, status, ErrorJS{Message: err.Error()})
+	text = strings.ToLower(text)
+	text = strings.Replace(text, "-", "_", -1)
+	return strings.Replace(text, " ", "_", -1)
 }
 
 // JSON will write a given interface{} to the http.ResponseWriter as JSON
 // and set the HTTP status.
 func JSON(w http.ResponseWriter, status int, v interface{}) {
-	r.JSON(w, status, v)
+	SetHeaders(w)
+	renderJSON(w, status, v, indentJSON)
 }
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/service/decoder"
+)
+
+func TestErrorUnsupportedMediaType(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, http.StatusBadRequest, fmt.Errorf("widget: %w", decoder.ErrDecoderNotImplemented))
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Error(ErrDecoderNotImplemented) = %d, expected 415", rec.Code)
+	}
+
+	var e struct {
+		Supported []string `json:"supported"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, contentType := range e.Supported {
+		found = found || contentType == "application/json"
+	}
+	if !found {
+		t.Errorf("supported = %v, expected application/json", e.Supported)
+	}
+}
+
+func TestJSONMatchesMarshal(t *testing.T) {
+	v := map[string]interface{}{"a": []int{1, 2}, "b": "<tag>"}
+
+	for _, indent := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		if err := writeJSON(rec, http.StatusOK, v, indent); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, _ := json.Marshal(v)
+		if indent {
+			expected, _ = json.MarshalIndent(v, "", "  ")
+			expected = append(expected, '\n')
+		}
+		if rec.Body.String() != string(expected) {
+			t.Errorf("writeJSON(indent=%v) = %q, expected %q", indent, rec.Body.String(), expected)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := writeJSON(rec, http.StatusOK, func() {}, false); err == nil || rec.Body.Len() != 0 {
+		t.Errorf("a value that cannot be encoded should write nothing and fail, wrote %q", rec.Body.String())
+	}
+}
+
+// benchmarkList is a list endpoint's response of the size that dominates CPU
+var benchmarkList = func() []map[string]interface{} {
+	items := make([]map[string]interface{}, 100)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"id":      i,
+			"name":    fmt.Sprintf("thing %d", i),
+			"tags":    []string{"a", "b", "c"},
+			"enabled": i%2 == 0,
+		}
+	}
+	return items
+}()
+
+// discardWriter is a http.ResponseWriter that discards the response, so that
+// the benchmarks measure encoding alone
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func BenchmarkJSONIndented(b *testing.B) {
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		writeJSON(w, http.StatusOK, benchmarkList, true)
+	}
+}
+
+func BenchmarkJSONCompact(b *testing.B) {
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		writeJSON(w, http.StatusOK, benchmarkList, false)
+	}
+}
+
+func BenchmarkMarshalIndent(b *testing.B) {
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		body, _ := json.MarshalIndent(benchmarkList, "", "  ")
+		w.Write(body)
+	}
+}
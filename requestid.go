@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/cloudflare/service/log"
+)
+
+// RequestIDHeader is the header that carries the ID of a request, which is
+// propagated from the caller if it sent one
+var RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength limits the length of a propagated request ID, so that a
+// caller cannot fill the logs
+const maxRequestIDLength = 128
+
+// RequestID is middleware that gives each request an ID, taken from the
+// RequestIDHeader of the request if it is valid or generated otherwise. The ID
+// is returned in the RequestIDHeader of the response, set as the request_id
+// tag, and added to the fields of a log.Logger stored in the request context,
+// so that handlers that log with log.FromContext or the log Context
+// functions tag every line with it. It can be added with WebService.Use.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			// Calls made with client.Propagate carry the generated ID
+			req.Header.Set(RequestIDHeader, id)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		req = SetTag(req, "request_id", id)
+
+		ctx := context.WithValue(req.Context(), requestIDKey, id)
+		ctx = log.NewContext(ctx, log.FromContext(ctx).With("request_id", id))
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the ID given to the request by RequestID, or "" if
+// there is none
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// validRequestID returns true if id is a non-empty, printable ASCII string
+// of at most maxRequestIDLength
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("cannot generate a request ID: %s", err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	var id string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id = RequestIDFrom(req.Context())
+		log.FromContext(req.Context()).Info("handled")
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	h.ServeHTTP(rec, req)
+	if id != "abc-123" || rec.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("the request ID %q should be propagated, got %q", "abc-123", id)
+	}
+	if !strings.Contains(out.String(), "handled request_id=abc-123") {
+		t.Errorf("the log line should be tagged with the request ID: %q", out.String())
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "has spaces")
+	h.ServeHTTP(rec, req)
+	if len(id) != 32 || id == "has spaces" || rec.Header().Get(RequestIDHeader) != id {
+		t.Errorf("an invalid request ID should be replaced, got %q", id)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResponseWriterInterfaces checks that the optional interfaces of the
+// http.ResponseWriter survive the server level middleware, so that
+// streaming, SSE and WebSocket handlers keep working
+func TestResponseWriterInterfaces(t *testing.T) {
+	stats := newRequestStats()
+
+	var missing []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			missing = append(missing, "http.Flusher")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			missing = append(missing, "http.Hijacker")
+		}
+		if _, ok := w.(http.CloseNotifier); !ok {
+			missing = append(missing, "http.CloseNotifier")
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			missing = append(missing, "io.ReaderFrom")
+		}
+		if _, ok := w.(http.Pusher); !ok {
+			missing = append(missing, "http.Pusher")
+		}
+
+		io.Copy(w, strings.NewReader("streamed"))
+		w.(http.Flusher).Flush()
+	})
+
+	srv := httptest.NewServer(serve(stats.middleware(h), true, ""))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if len(missing) > 0 {
+		t.Errorf("response writer does not implement %v", missing)
+	}
+	if string(body) != "streamed" {
+		t.Errorf("body %q, expected %q", body, "streamed")
+	}
+	if stats.bytes != int64(len("streamed")) {
+		t.Errorf("%d bytes recorded, expected %d", stats.bytes, len("streamed"))
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\n\r\nhijacked")
+		buf.Flush()
+	})
+
+	srv := httptest.NewServer(serve(newRequestStats().middleware(h), false, ""))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "hijacked" {
+		t.Errorf("body %q, expected %q", body, "hijacked")
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// ResponseSizePolicy decides what happens when a response exceeds the size
+// set with SetMaxResponseSize
+type ResponseSizePolicy int
+
+// These constants identify the response size policies
+const (
+	// ResponseSizeStream sends the response with chunked encoding, flushing
+	// each write past the limit so that it is not held in memory, and logs a
+	// warning. It is the default.
+	ResponseSizeStream ResponseSizePolicy = iota
+	// ResponseSizeAbort logs an error and refuses the response. If nothing
+	// has been sent the client receives a 500 error, otherwise the
+	// connection is aborted so that the client cannot mistake the truncated
+	// response for a complete one.
+	ResponseSizeAbort
+)
+
+func (p ResponseSizePolicy) String() string {
+	if p == ResponseSizeAbort {
+		return "abort"
+	}
+
+	return "stream"
+}
+
+// SetMaxResponseSize sets the size in bytes of the largest response the
+// controller's handlers are expected to write, and the policy applied to a
+// response that exceeds it. Each response that does is counted by the
+// response_size_exceeded metric.
+func (wc *WebController) SetMaxResponseSize(n int64, policy ResponseSizePolicy) {
+	wc.maxResponse = n
+	wc.maxResponsePolicy = policy
+}
+
+// withMaxResponseSize wraps h with the controller's response size limit, if
+// one is set
+func (wc *WebController) withMaxResponseSize(
+	h func(w http.ResponseWriter, req *http.Request),
+) func(w http.ResponseWriter, req *http.Request) {
+	if wc.maxResponse <= 0 {
+		return h
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		sw := &sizeWriter{
+			ResponseWriter: w,
+			req:            req,
+			route:          wc.Route,
+			max:            wc.maxResponse,
+			policy:         wc.maxResponsePolicy,
+		}
+		h(sw, req)
+		sw.writeHeader()
+	}
+}
+
+// sizeWriter enforces a response size limit. The status is held back until
+// the first write so that a response known to be too large can still be
+// refused with an error.
+type sizeWriter struct {
+	http.ResponseWriter
+	req    *http.Request
+	route  string
+	max    int64
+	policy ResponseSizePolicy
+
+	status   int
+	sent     bool
+	n        int64
+	exceeded bool
+}
+
+// WriteHeader is part of the http.ResponseWriter interface
+func (sw *sizeWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+}
+
+// Write is part of the http.ResponseWriter interface
+func (sw *sizeWriter) Write(b []byte) (int, error) {
+	if sw.exceeded && sw.policy == ResponseSizeAbort {
+		return 0, fmt.Errorf("response exceeds %d bytes", sw.max)
+	}
+
+	// The size is known before anything is sent if the handler declared it,
+	// or if it writes the whole response at once
+	size := sw.n + int64(len(b))
+	if cl, err := strconv.ParseInt(sw.Header().Get("Content-Length"), 10, 64); err == nil && cl > size {
+		size = cl
+	}
+
+	if size > sw.max && !sw.exceeded {
+		sw.exceed(size)
+
+		if sw.policy == ResponseSizeAbort {
+			if !sw.sent {
+				sw.sent = true
+				sw.Header().Del("Content-Length")
+				render.Error(
+					sw.ResponseWriter,
+					http.StatusInternalServerError,
+					fmt.Errorf("%s %s response is too large", sw.req.Method, sw.req.URL.Path),
+				)
+				return 0, fmt.Errorf("response exceeds %d bytes", sw.max)
+			}
+
+			panic(http.ErrAbortHandler)
+		}
+
+		if !sw.sent {
+			sw.Header().Del("Content-Length")
+		}
+	}
+
+	sw.writeHeader()
+	n, err := sw.ResponseWriter.Write(b)
+	sw.n += int64(n)
+
+	if sw.exceeded {
+		if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	return n, err
+}
+
+// Flush is part of the http.Flusher interface
+func (sw *sizeWriter) Flush() {
+	sw.writeHeader()
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is part of the http.Hijacker interface. The size of a hijacked
+// connection is not limited.
+func (sw *sizeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.Hijacker is not supported by the response writer")
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		// The status can no longer be sent
+		sw.sent = true
+	}
+
+	return conn, rw, err
+}
+
+// CloseNotify is part of the deprecated http.CloseNotifier interface. If the
+// wrapped writer does not support it the channel never receives.
+func (sw *sizeWriter) CloseNotify() <-chan bool {
+	if cn, ok := sw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// ReadFrom is part of the io.ReaderFrom interface. The content is copied
+// through Write so that the limit applies.
+func (sw *sizeWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{sw}, r)
+}
+
+// Push is part of the http.Pusher interface
+func (sw *sizeWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := sw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController
+func (sw *sizeWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// writeHeader sends the status held back by WriteHeader, if not yet sent
+func (sw *sizeWriter) writeHeader() {
+	if sw.sent {
+		return
+	}
+	sw.sent = true
+
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	sw.ResponseWriter.WriteHeader(sw.status)
+}
+
+// exceed records that the response exceeds the limit
+func (sw *sizeWriter) exceed(size int64) {
+	sw.exceeded = true
+
+	metrics.Inc("response_size_exceeded", "route", sw.route, "policy", sw.policy.String())
+
+	msg := fmt.Sprintf(
+		"%s %s response of at least %d bytes exceeds the limit of %d (%s)",
+		sw.req.Method, sw.req.URL.Path, size, sw.max, sw.policy,
+	)
+	if sw.policy == ResponseSizeAbort {
+		log.Error(msg)
+	} else {
+		log.Warning(msg)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+
+	for _, test := range []struct {
+		policy ResponseSizePolicy
+		status int
+		length int
+	}{
+		{ResponseSizeStream, http.StatusCreated, len(body)},
+		{ResponseSizeAbort, http.StatusInternalServerError, -1},
+	} {
+		wc := NewWebController("/big")
+		wc.SetMaxResponseSize(10, test.policy)
+		wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(body))
+		})
+
+		rec := httptest.NewRecorder()
+		GetHandler(wc)(rec, httptest.NewRequest("GET", "/big", nil))
+
+		if rec.Code != test.status {
+			t.Errorf("%s: status %d should be %d", test.policy, rec.Code, test.status)
+		}
+		if rec.Header().Get("Content-Length") != "" {
+			t.Errorf("%s: Content-Length should be removed", test.policy)
+		}
+		if test.length >= 0 && rec.Body.Len() != test.length {
+			t.Errorf("%s: body of %d bytes should be %d", test.policy, rec.Body.Len(), test.length)
+		}
+	}
+}
+
+func TestMaxResponseSizeHijack(t *testing.T) {
+	wc := NewWebController("/upgrade")
+	wc.SetMaxResponseSize(10, ResponseSizeAbort)
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Errorf("%T does not implement http.Flusher", w)
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("%T does not implement io.ReaderFrom", w)
+		}
+		if _, ok := w.(http.Pusher); !ok {
+			t.Errorf("%T does not implement http.Pusher", w)
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\n\r\nhijacked")
+		buf.Flush()
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(GetHandler(wc)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "hijacked" {
+		t.Errorf("body %q, expected %q", body, "hijacked")
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudflare/service/log"
+)
+
+// Router matches requests to the handlers of a WebService. The default is
+// gorilla/mux, and other routers can be used by implementing this interface
+// and setting WebService.NewRouter.
+type Router interface {
+	http.Handler
+
+	// Handle registers the handler for a route. Path variables in the route
+	// are written {name}, and must be made available to the handler via
+	// WithVars unless the router is gorilla/mux.
+	Handle(route string, h http.Handler)
+
+	// NotFound sets the handler for requests that match no route
+	NotFound(h http.Handler)
+}
+
+// Vars returns the path variables of the route that matched the request
+func Vars(req *http.Request) map[string]string {
+	if vars, ok := req.Context().Value(varsKey).(map[string]string); ok {
+		return vars
+	}
+
+	return mux.Vars(req)
+}
+
+// WithVars returns a request carrying the path variables that are returned by
+// Vars. Routers other than gorilla/mux use it to pass on the variables they
+// matched.
+func WithVars(req *http.Request, vars map[string]string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), varsKey, vars))
+}
+
+// muxRouter is the default Router
+type muxRouter struct {
+	r *mux.Router
+}
+
+// newMuxRouter returns a gorilla/mux Router.
+//
+// StrictSlash forces the routes to be applied literally...
+// i.e. Route /foo/ with requests /foo will redirect to /foo/
+// and route /bar with requests to /bar/ will redirect to /bar
+func newMuxRouter() *muxRouter {
+	return &muxRouter{r: mux.NewRouter().StrictSlash(true)}
+}
+
+func (m *muxRouter) Handle(route string, h http.Handler) {
+	m.r.Handle(route, h)
+}
+
+func (m *muxRouter) NotFound(h http.Handler) {
+	m.r.NotFoundHandler = h
+}
+
+func (m *muxRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.r.ServeHTTP(w, req)
+}
+
+// serveMuxRouter is a Router backed by net/http's ServeMux
+type serveMuxRouter struct {
+	mux *http.ServeMux
+}
+
+// NewServeMuxRouter returns a Router backed by net/http's ServeMux, which
+// removes the dependency on gorilla/mux at request time.
+//
+// Routes match literally, so unlike gorilla/mux there is no redirect between
+// /foo and /foo/. Path variables may not be constrained by a regular
+// expression, i.e. {id:[0-9]+}, and registering such a route is fatal.
+func NewServeMuxRouter() Router {
+	return &serveMuxRouter{mux: http.NewServeMux()}
+}
+
+func (s *serveMuxRouter) Handle(route string, h http.Handler) {
+	names := []string{}
+	for _, segment := range strings.Split(route, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+		if strings.Contains(name, ":") {
+			log.Fatalf("route %s: ServeMux does not support patterns in variables", route)
+		}
+		names = append(names, name)
+	}
+
+	// A trailing slash is a prefix match in ServeMux, {$} makes it exact
+	pattern := route
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "{$}"
+	}
+
+	if len(names) == 0 {
+		s.mux.Handle(pattern, h)
+		return
+	}
+
+	s.mux.Handle(pattern, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			vars := make(map[string]string, len(names))
+			for _, name := range names {
+				vars[name] = req.PathValue(name)
+			}
+			h.ServeHTTP(w, WithVars(req, vars))
+		},
+	))
+}
+
+func (s *serveMuxRouter) NotFound(h http.Handler) {
+	s.mux.Handle("/", h)
+}
+
+func (s *serveMuxRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// staticRouter is a fast path for routes without variables, which are matched
+// with a map lookup rather than by trying each route in turn. All routes are
+// also registered with the next Router, which serves everything the fast path
+// does not, including redirects for trailing slashes.
+type staticRouter struct {
+	next     Router
+	static   map[string]http.Handler
+	patterns [][]string
+}
+
+// newStaticRouter returns a Router that wraps next with the fast path
+func newStaticRouter(next Router) *staticRouter {
+	return &staticRouter{
+		next:   next,
+		static: make(map[string]http.Handler),
+	}
+}
+
+func (s *staticRouter) Handle(route string, h http.Handler) {
+	s.next.Handle(route, h)
+
+	if strings.Contains(route, "{") {
+		s.patterns = append(s.patterns, strings.Split(route, "/"))
+		return
+	}
+
+	// Routes are matched in the order they are added, so a route that an
+	// earlier route matches must be left to next
+	if _, ok := s.static[route]; ok {
+		return
+	}
+	for _, p := range s.patterns {
+		if shadows(p, route) {
+			return
+		}
+	}
+
+	s.static[route] = h
+}
+
+func (s *staticRouter) NotFound(h http.Handler) {
+	s.next.NotFound(h)
+}
+
+func (s *staticRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h, ok := s.static[req.URL.Path]; ok {
+		h.ServeHTTP(w, req)
+		return
+	}
+
+	s.next.ServeHTTP(w, req)
+}
+
+// shadows returns true if the pattern, split into segments, may match the
+// static route. Variables with a regular expression or that match the rest of
+// the path are assumed to match anything.
+func shadows(pattern []string, route string) bool {
+	segments := strings.Split(route, "/")
+
+	for _, p := range pattern {
+		if strings.Contains(p, "{") &&
+			(strings.Contains(p, ":") || strings.Contains(p, "...")) {
+			return true
+		}
+	}
+
+	if len(pattern) != len(segments) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if strings.Contains(p, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+
+		if p != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaticRouterOrder(t *testing.T) {
+	ws := NewWebService()
+
+	pattern := NewWebController("/things/{id}")
+	pattern.AddMethodHandler(Get, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pattern"))
+	})
+	ws.AddWebController(pattern)
+
+	static := NewWebController("/things/new")
+	static.AddMethodHandler(Get, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("static"))
+	})
+	ws.AddWebController(static)
+
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/things/new", nil))
+
+	if rec.Body.String() != "pattern" {
+		t.Errorf("body %q, expected the earlier pattern route to match", rec.Body.String())
+	}
+
+	if _, ok := ws.ValidateRoutes().(RouteConflictError); !ok {
+		t.Error("expected the unreachable route to be reported")
+	}
+}
+
+// benchmarkService returns a WebService with n controllers for static routes
+// and one for a route with a variable
+func benchmarkService(n int) *WebService {
+	ws := NewWebService()
+
+	for i := 0; i < n; i++ {
+		wc := NewWebController(fmt.Sprintf("/resources/r%d", i))
+		wc.AddMethodHandler(Get, func(w http.ResponseWriter, r *http.Request) {})
+		ws.AddWebController(wc)
+	}
+
+	wc := NewWebController("/items/{id}")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, r *http.Request) {})
+	ws.AddWebController(wc)
+
+	return &ws
+}
+
+func benchmarkRouter(b *testing.B, h http.Handler, path string) {
+	req := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkMuxStaticRoute(b *testing.B) {
+	benchmarkRouter(b, benchmarkService(500).BuildRouter(), "/resources/r499")
+}
+
+func BenchmarkFastPathStaticRoute(b *testing.B) {
+	benchmarkRouter(b, benchmarkService(500).Handler(), "/resources/r499")
+}
+
+func BenchmarkMuxPatternRoute(b *testing.B) {
+	benchmarkRouter(b, benchmarkService(500).BuildRouter(), "/items/1")
+}
+
+func BenchmarkFastPathPatternRoute(b *testing.B) {
+	benchmarkRouter(b, benchmarkService(500).Handler(), "/items/1")
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+)
+
+// SelfTestRoute is the path to the endpoint that runs the smoke tests added
+// with AddSelfTest. It is an operational route, and so is served on AdminAddr
+// when that is set. It requires the DebugToken if that is set, and is only
+// served if one of them is.
+var SelfTestRoute string = `/_selftest`
+
+// SelfTestTimeout limits the time that all of the smoke tests may take
+var SelfTestTimeout = 30 * time.Second
+
+// SelfTestResult is the outcome of a single smoke test
+type SelfTestResult struct {
+	Name       string  `json:"name"`
+	Passed     bool    `json:"passed"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"durationMs"`
+}
+
+// SelfTestReport is the response of SelfTestRoute. Passed is true only if
+// every test passed, and the response is then 200 OK, or 503 Service
+// Unavailable otherwise, so that deploy tooling can gate on the status.
+type SelfTestReport struct {
+	Version
+	Passed     bool             `json:"passed"`
+	DurationMS float64          `json:"durationMs"`
+	Tests      []SelfTestResult `json:"tests"`
+}
+
+// selfTests holds the smoke tests registered with a WebService. It is shared
+// by copies of the WebService.
+type selfTests struct {
+	mu    sync.RWMutex
+	tests []HealthChecker
+}
+
+// AddSelfTest registers a smoke test that is run, in the order added, on
+// each request to SelfTestRoute, i.e. a read-only database query or a check
+// that the configuration is sane. Unlike health checks they are only run on
+// demand, and so may be slower. A test that returns an error or panics
+// fails. A render round-trip test is always run first.
+func (ws *WebService) AddSelfTest(t HealthChecker) {
+	if ws.selftests == nil {
+		ws.selftests = &selfTests{}
+	}
+
+	ws.selftests.mu.Lock()
+	defer ws.selftests.mu.Unlock()
+
+	ws.selftests.tests = append(ws.selftests.tests, t)
+}
+
+// run runs the tests in order and returns the report
+func (s *selfTests) run(ctx context.Context) SelfTestReport {
+	s.mu.RLock()
+	tests := append([]HealthChecker{renderSelfTest}, s.tests...)
+	s.mu.RUnlock()
+
+	report := SelfTestReport{Passed: true, Tests: []SelfTestResult{}}
+	report.Hydrate()
+
+	ctx, cancel := context.WithTimeout(ctx, SelfTestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	for _, t := range tests {
+		r := runSelfTest(ctx, t)
+		if !r.Passed {
+			report.Passed = false
+			log.Warningf("self test %s failed: %s", r.Name, r.Error)
+		}
+
+		report.Tests = append(report.Tests, r)
+	}
+	report.DurationMS = float64(time.Since(start)) / float64(time.Millisecond)
+
+	return report
+}
+
+// runSelfTest runs a single test, recovering from a panic
+func runSelfTest(ctx context.Context, t HealthChecker) (r SelfTestResult) {
+	r.Name = t.Name()
+	start := time.Now()
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.Passed = false
+			r.Error = fmt.Sprintf("panic: %v", p)
+		}
+		r.DurationMS = float64(time.Since(start)) / float64(time.Millisecond)
+	}()
+
+	if err := t.Check(ctx); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	r.Passed = true
+	return r
+}
+
+// handler serves SelfTestRoute
+func (s *selfTests) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			render.Error(w, http.StatusMethodNotAllowed,
+				fmt.Errorf("%s is not allowed", req.Method))
+			return
+		}
+
+		report := s.run(req.Context())
+
+		status := http.StatusOK
+		if !report.Passed {
+			status = http.StatusServiceUnavailable
+		}
+
+		render.JSON(w, status, report)
+	})
+}
+
+// renderSelfTest checks that a value survives being rendered as JSON
+var renderSelfTest = HealthCheck("render", func(ctx context.Context) error {
+	type probe struct {
+		Value string `json:"value"`
+	}
+
+	rec := httptest.NewRecorder()
+	render.JSON(rec, http.StatusOK, probe{Value: "selftest"})
+
+	got := probe{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		return fmt.Errorf("rendered JSON cannot be decoded: %s", err)
+	}
+
+	if rec.Code != http.StatusOK || got.Value != "selftest" {
+		return fmt.Errorf("rendered %d %q, expected 200 %q", rec.Code, got.Value, "selftest")
+	}
+
+	return nil
+})
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	ws := NewWebService()
+	ws.AddSelfTest(HealthCheck("config", func(ctx context.Context) error {
+		return nil
+	}))
+
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, httptest.NewRequest("POST", SelfTestRoute, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("POST %s without a DebugToken or AdminAddr = %d, expected 404", SelfTestRoute, rec.Code)
+	}
+
+	ws.DebugToken = "s3cret"
+	handler := ws.Handler()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", SelfTestRoute, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST %s without the token = %d, expected 401", SelfTestRoute, rec.Code)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Set("X-Debug-Token", "s3cret")
+		handler.ServeHTTP(w, req)
+	})
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", SelfTestRoute, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST %s = %d %s", SelfTestRoute, rec.Code, rec.Body.String())
+	}
+
+	ws.AddSelfTest(HealthCheck("db", func(ctx context.Context) error {
+		return fmt.Errorf("connection refused")
+	}))
+	ws.AddSelfTest(HealthCheck("panics", func(ctx context.Context) error {
+		panic("boom")
+	}))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", SelfTestRoute, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s with a failing test = %d, expected %d", SelfTestRoute, rec.Code, http.StatusServiceUnavailable)
+	}
+
+	report := SelfTestReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed || len(report.Tests) != 4 {
+		t.Fatalf("report = %+v, expected 4 tests and a failure", report)
+	}
+	for i, name := range []string{"render", "config", "db", "panics"} {
+		r := report.Tests[i]
+		if r.Name != name || r.Passed != (i < 2) {
+			t.Errorf("test %d = %+v, expected %s to pass: %t", i, r, name, i < 2)
+		}
+	}
+}
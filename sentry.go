@@ -0,0 +1,35 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	raven "github.com/getsentry/raven-go"
+
+	"github.com/cloudflare/service/log"
+)
+
+// ReportError logs an error that occurred while serving a request and, if the
+// SENTRY_DSN environment variable is set, sends it to Sentry. Both the log
+// line and the Sentry event carry the tags set on the request.
+//
+// Errors for requests cancelled by the client, which are usually the
+// cancellation itself, are logged at INFO and not sent to Sentry.
+func ReportError(req *http.Request, err error) {
+	tags := tagString(req.Context())
+	if ClientCancelled(req) {
+		log.InfoDepth(1, fmt.Sprintf("%s %s: client cancelled: %s", req.Method, req.URL.Path, err))
+		return
+	}
+
+	if tags != "" {
+		log.ErrorDepth(1, fmt.Sprintf("%s %s: %s [%s]", req.Method, req.URL.Path, err, tags))
+	} else {
+		log.ErrorDepth(1, fmt.Sprintf("%s %s: %s", req.Method, req.URL.Path, err))
+	}
+
+	if os.Getenv("SENTRY_DSN") != "" {
+		raven.CaptureError(err, Tags(req.Context()), raven.NewHttp(req))
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+)
+
+// DefaultReadHeaderTimeout is the time allowed to read request headers when
+// WebService.ReadHeaderTimeout is not set. It prevents slowloris style attacks
+// where clients hold connections open by trickling headers.
+var DefaultReadHeaderTimeout = 10 * time.Second
+
+// DefaultIdleTimeout is the time a keep-alive connection may be idle before it
+// is closed when WebService.IdleTimeout is not set
+var DefaultIdleTimeout = 2 * time.Minute
+
+// server returns the http.Server for a listener serving h
+func (ws *WebService) server(addr string, h http.Handler) *http.Server {
+	readHeaderTimeout := ws.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
+	idleTimeout := ws.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       ws.ReadTimeout,
+		WriteTimeout:      ws.WriteTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    ws.MaxHeaderBytes,
+	}
+}
+
+// start listens on addr with the SocketOptions and serves h in the
+// background, sending any error other than the server being shut down to
+// errs. The connection limits apply to the public listener only, so that
+// operators can always reach the admin listener. TLS is terminated if
+// tlsConfig is not nil.
+func (ws *WebService) start(
+	addr string,
+	h http.Handler,
+	public bool,
+	tlsConfig *tls.Config,
+	errs chan<- error,
+) (*http.Server, error) {
+	ln, err := ws.SocketOptions.listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if public {
+		ln = newLimitListener(ln, ws.MaxConnections, ws.MaxConnectionsPerIP)
+	}
+
+	srv := ws.server(addr, h)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// ServeTLS rather than a tls.Listener so that HTTP/2 is enabled
+			srv.TLSConfig = tlsConfig
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+
+		if err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+
+	return srv, nil
+}
+
+// limitListener is a net.Listener that limits the number of open connections
+// in total and from each remote IP address. When the total is reached Accept
+// blocks until a connection closes, and connections from an address that has
+// reached its limit are closed immediately.
+type limitListener struct {
+	net.Listener
+	sem   chan struct{}
+	perIP int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+// newLimitListener returns ln limited to max connections and perIP
+// connections from each address, where zero means no limit
+func newLimitListener(ln net.Listener, max int, perIP int) net.Listener {
+	if max <= 0 && perIP <= 0 {
+		return ln
+	}
+
+	l := &limitListener{Listener: ln, perIP: perIP, conns: make(map[string]int)}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+
+	return l
+}
+
+// Accept is part of the net.Listener interface
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if l.sem != nil {
+			l.sem <- struct{}{}
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+
+		ip := remoteIP(c)
+		if l.perIP > 0 {
+			l.mu.Lock()
+			if l.conns[ip] >= l.perIP {
+				l.mu.Unlock()
+				metrics.Inc("connections_rejected", "reason", "per_ip")
+				c.Close()
+				l.release()
+				continue
+			}
+			l.conns[ip]++
+			l.mu.Unlock()
+		}
+
+		return &limitConn{Conn: c, l: l, ip: ip}, nil
+	}
+}
+
+// release frees a slot in the total connection limit
+func (l *limitListener) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// done is called once when a connection accepted by the listener closes
+func (l *limitListener) done(ip string) {
+	if l.perIP > 0 {
+		l.mu.Lock()
+		l.conns[ip]--
+		if l.conns[ip] <= 0 {
+			delete(l.conns, ip)
+		}
+		l.mu.Unlock()
+	}
+
+	l.release()
+}
+
+// limitConn notifies its listener when it is closed
+type limitConn struct {
+	net.Conn
+	l    *limitListener
+	ip   string
+	once sync.Once
+}
+
+// Close is part of the net.Conn interface
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.l.done(c.ip) })
+	return err
+}
+
+// remoteIP returns the IP address of the remote end of a connection
+func remoteIP(c net.Conn) string {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil {
+		return c.RemoteAddr().String()
+	}
+
+	return host
+}
@@ -1,16 +1,17 @@
 package service
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	gopprof "net/http/pprof"
 	"os"
-	"sort"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/codegangsta/negroni"
-	raven "github.com/getsentry/raven-go"
 	"github.com/gorilla/mux"
-	pprof "github.com/mistifyio/negroni-pprof"
 	"github.com/wblakecaldwell/profiler"
 
 	"github.com/cloudflare/service/log"
@@ -29,8 +30,15 @@ const (
 
 // EndPoint describes an endpoint that exists on this web service
 type EndPoint struct {
-	URL     string `json:"href"`
-	Methods string `json:"methods"`
+	URL        string   `json:"href"`
+	Methods    string   `json:"methods"`
+	Expand     []string `json:"expand,omitempty"`
+	Deprecated []string `json:"deprecated,omitempty"`
+
+	// Formats and NotAcceptable describe the content negotiation of
+	// render.Negotiate, and are only given for the endpoint index itself
+	Formats       []string `json:"formats,omitempty"`
+	NotAcceptable string   `json:"notAcceptable,omitempty"`
 }
 
 // EndPoints is a slice of all endpoints on this web service
@@ -50,22 +58,143 @@ func (slice EndPoints) Swap(i, j int) {
 
 // WebService represents a web server with a collection of controllers
 type WebService struct {
+	// AdminAddr is the address of an internal listener for the operational
+	// routes, being those that begin /_ such as /_heartbeat, /_version,
+	// /_metrics, /_profiler and /_debug. When set, the public listener only
+	// serves the routes of the service's own controllers.
+	AdminAddr string
+
+	// ReadHeaderTimeout is the time allowed to read the headers of a request,
+	// or DefaultReadHeaderTimeout if zero
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is the time allowed to read a whole request, including the
+	// body, and WriteTimeout the time allowed to write the response. Zero
+	// means no limit. See WebController.SetTimeout for per-route limits.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the time a keep-alive connection may be idle, or
+	// DefaultIdleTimeout if zero
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes limits the size of request headers, or
+	// http.DefaultMaxHeaderBytes if zero
+	MaxHeaderBytes int
+
+	// MaxConnections limits the number of open connections to the public
+	// listener, and MaxConnectionsPerIP the number from any one client. Zero
+	// means no limit.
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	// MaxBodySize limits the size in bytes of request bodies, larger bodies
+	// being refused with 413 Request Entity Too Large, and MaxJSONDepth the
+	// nesting of the JSON bodies decoded with decoder.Decode, or
+	// decoder.MaxJSONDepth if zero. Zero MaxBodySize means no limit. See
+	// WebController.SetMaxBodySize and SetMaxJSONDepth for per-route limits.
+	MaxBodySize  int64
+	MaxJSONDepth int
+
+	// SocketOptions tune the sockets of the listeners, i.e. the listen
+	// backlog and TCP_NODELAY
+	SocketOptions SocketOptions
+
+	// TLSConfig, if set, terminates TLS on the public listener. Set
+	// ClientAuth and ClientCAs to verify client certificates. See also
+	// RunTLS.
+	TLSConfig *tls.Config
+
+	// AccessLog enables logging of every request in the given format. It is
+	// off by default.
+	AccessLog AccessLogFormat
+
+	// TailLog holds the TRACE and DEBUG lines of each request that are not
+	// enabled and writes them if the request fails, or takes longer than
+	// TailLogThreshold if that is not zero. See the TailLog middleware.
+	TailLog          bool
+	TailLogThreshold time.Duration
+
+	// Tracing starts a span for each request, see TraceRequests. Spans are
+	// exported if an exporter is configured, i.e. by the OTEL_ environment
+	// variables, see tracing.NewOTLPExporterFromEnv.
+	Tracing bool
+
+	// RateLimit, if set, limits the rate of each client's requests to the
+	// public routes, see Throttle
+	RateLimit *RateLimit
+
+	// Compression, if set, compresses the responses of the public listener
+	// for clients that accept it, see Compress
+	Compression *Compression
+
+	// HeartbeatFormat is the format of the response of /_heartbeat to
+	// requests that do not ask for one with the format query parameter or
+	// the Accept header: JSON by default, or the text "ok" or "fail" for
+	// legacy monitors, or Prometheus gauges
+	HeartbeatFormat HeartbeatFormat
+
+	// NotAcceptable is the response of render.Negotiate to requests that
+	// accept none of the formats it can write: JSON regardless, the default,
+	// or 406 Not Acceptable with the supported formats
+	NotAcceptable render.NotAcceptablePolicy
+
+	// CORS is the CORS policy of the public controllers that do not declare
+	// their own with WebController.SetCORS. If nil cross-origin requests are
+	// not allowed.
+	CORS *CORSPolicy
+
+	// DisableDebugRoutes omits the profiler routes, /_profiler and
+	// /_debug/pprof, and the net/http/pprof handlers at /debug/pprof, so
+	// that they cannot be reached in production
+	DisableDebugRoutes bool
+
+	// DebugToken, if set, is required of requests to the profiler routes,
+	// as "Authorization: Bearer <token>" or an X-Debug-Token header. See
+	// also AdminAddr, which moves them to an internal listener.
+	DebugToken string
+
+	// StrictRoutes exits when the router is built if the routes conflict,
+	// rather than logging the conflicts as warnings. See ValidateRoutes.
+	StrictRoutes bool
+
+	// NewRouter returns the Router that requests are matched with, or a
+	// gorilla/mux router if nil
+	NewRouter func() Router
+
+	// ShutdownTimeout is the time allowed for in-flight requests to complete
+	// on shutdown, or DefaultShutdownTimeout if zero
+	ShutdownTimeout time.Duration
+
 	controllers []WebController
+	middleware  []Middleware
+	workers     []namedPool
+	stats       *requestStats
+	health      *healthChecks
+	logs        *logOverrides
+	selftests   *selfTests
+	warmups     *warmUps
+	slos        *sloTrackers
+	config      *ServiceConfig
+	configs     *configValues
 }
 
 // NewWebService provides a way to create a new blank WebService
 func NewWebService() WebService {
-	ws := WebService{}
+	ws := WebService{
+		stats:     newRequestStats(),
+		health:    &healthChecks{critical: make(map[string]bool)},
+		logs:      &logOverrides{},
+		selftests: &selfTests{},
+		warmups:   &warmUps{},
+		slos:      &sloTrackers{},
+		configs:   &configValues{},
+	}
 
-	// Heartbeat controller (echoes the default version info)
+	// Heartbeat controller (echoes the default version info and the outcome
+	// of any health checks)
 	heartbeatController := NewWebController(HeartbeatRoute)
-	heartbeatController.AddMethodHandler(Get,
-		func(w http.ResponseWriter, r *http.Request) {
-			v := Version{}
-			v.Hydrate()
-			render.JSON(w, http.StatusOK, v)
-		},
-	)
+	heartbeatController.AddMethodHandler(Get, ws.health.heartbeat)
 	ws.AddWebController(heartbeatController)
 
 	return ws
@@ -79,20 +208,110 @@ func (ws *WebService) AddWebController(wc WebController) {
 }
 
 // BuildRouter collects all of the controllers, wires up the routes and returns
-// the resulting router
+// the resulting gorilla/mux router, regardless of NewRouter. If AdminAddr is
+// set the operational routes are omitted, see BuildAdminRouter.
 func (ws *WebService) BuildRouter() *mux.Router {
-	// Router
-	//
-	// StrictSlash forces the routes to be applied literally...
-	// i.e. Route /foo/ with requests /foo will redirect to /foo/
-	// and route /bar with requests to /bar/ will redirect to /bar
-	r := mux.NewRouter().StrictSlash(true)
+	m := newMuxRouter()
+	ws.buildRouter(m, true, ws.AdminAddr == "")
+	return m.r
+}
+
+// BuildAdminRouter returns a gorilla/mux router for only the operational
+// routes, which are served on AdminAddr
+func (ws *WebService) BuildAdminRouter() *mux.Router {
+	m := newMuxRouter()
+	ws.buildRouter(m, false, true)
+	return m.r
+}
+
+// router returns a new Router from NewRouter, or the default, with a fast
+// path for routes without variables
+func (ws *WebService) router() Router {
+	if ws.NewRouter != nil {
+		return newStaticRouter(ws.NewRouter())
+	}
+
+	return newStaticRouter(newMuxRouter())
+}
+
+// routes returns the enabled controllers with a controller for each sub-path
+func (ws *WebService) routes() []WebController {
+	controllers := []WebController{}
+	for _, wc := range ws.controllers {
+		if !wc.enabled() {
+			continue
+		}
+		controllers = append(controllers, wc.withSubPaths()...)
+	}
+
+	return controllers
+}
+
+// isAdminRoute returns true if a route is one of the operational routes, all
+// of which begin /_
+func isAdminRoute(route string) bool {
+	return strings.HasPrefix(route, "/_")
+}
+
+// buildRouter wires up the public routes of the service's controllers and/or
+// the operational routes on r
+func (ws *WebService) buildRouter(r Router, public bool, admin bool) {
+	if ws.logs == nil {
+		ws.logs = &logOverrides{}
+	}
+
+	if ws.selftests == nil {
+		ws.selftests = &selfTests{}
+	}
+
+	if ws.warmups == nil {
+		ws.warmups = &warmUps{}
+	}
+
+	if ws.slos == nil {
+		ws.slos = &sloTrackers{}
+	}
+
+	if ws.health == nil {
+		ws.health = &healthChecks{critical: make(map[string]bool)}
+	}
+	ws.health.mu.Lock()
+	ws.health.format = ws.HeartbeatFormat
+	ws.health.mu.Unlock()
+
+	if ws.configs == nil {
+		ws.configs = &configValues{}
+	}
+
+	// The global rate limit is shared by the public routes, so that a client
+	// has one bucket whichever routes it requests
+	var global Middleware
+	if ws.RateLimit != nil {
+		global = Throttle(*ws.RateLimit)
+	}
 
 	// Controllers
+	if public {
+		ws.logDisabled()
+	}
+
+	if ws.CORS != nil {
+		ws.CORS.check()
+	}
+
 	rootSeen := false
 	versionSeen := false
 	links := EndPoints{}
-	for _, wc := range ws.controllers {
+	registered := []WebController{}
+	for _, wc := range ws.routes() {
+		if isAdminRoute(wc.Route) && !admin {
+			continue
+		}
+
+		if !isAdminRoute(wc.Route) && !public {
+			continue
+		}
+
 		if !rootSeen && wc.Route == root {
 			rootSeen = true
 		}
@@ -101,39 +320,102 @@ func (ws *WebService) BuildRouter() *mux.Router {
 			versionSeen = true
 		}
 
-		// Add the handler for a route, and rate-limit it using throttle
-		r.Handle(
-			wc.Route,
-			http.HandlerFunc(GetHandler(wc)),
-		)
+		if wc.cors == nil && ws.CORS != nil && !isAdminRoute(wc.Route) {
+			wc.cors = ws.CORS
+		}
+
+		if wc.maxBody == 0 {
+			wc.maxBody = ws.MaxBodySize
+		}
+		if wc.maxJSONDepth == 0 {
+			wc.maxJSONDepth = ws.MaxJSONDepth
+		}
+
+		registered = append(registered, wc)
 
-		links = append(links, EndPoint{URL: wc.Route, Methods: wc.GetAllowedMethods()})
-	}
-
-	// Profiling handlers
-	// XXX: should we add them using the public api too?
-	r.HandleFunc("/_profiler/info.html", profiler.MemStatsHTMLHandler)
-	links = append(links, EndPoint{URL: "/_profiler/info.html", Methods: "GET"})
-	r.HandleFunc("/_profiler/info", profiler.ProfilingInfoJSONHandler)
-	r.HandleFunc("/_profiler/start", profiler.StartProfilingHandler)
-	r.HandleFunc("/_profiler/stop", profiler.StopProfilingHandler)
-
-	r.HandleFunc("/_debug/pprof/", http.HandlerFunc(gopprof.Index))
-	links = append(links, EndPoint{URL: "/_debug/pprof", Methods: "GET"})
-	r.HandleFunc("/_debug/pprof/cmdline", http.HandlerFunc(gopprof.Cmdline))
-	r.HandleFunc("/_debug/pprof/profile", http.HandlerFunc(gopprof.Profile))
-	r.HandleFunc("/_debug/pprof/symbol", http.HandlerFunc(gopprof.Symbol))
-
-	if !versionSeen {
-		// If detailed version info is not provided, we echo the default
-		// This allows services to provide their own extended version info, i.e.
-		// database versioning as well as process versioning
-		r.HandleFunc(VersionRoute, func(w http.ResponseWriter, r *http.Request) {
-			v := Version{}
-			v.Hydrate()
-			render.JSON(w, http.StatusOK, v)
+		// Add the handler for a route, which applies the controller's rate
+		// limit and middleware, and rate-limit it using the global throttle
+		var h http.Handler = http.HandlerFunc(GetHandler(wc))
+		if global != nil && !isAdminRoute(wc.Route) {
+			h = global(h)
+		}
+		if wc.slo != nil {
+			h = ws.slos.middleware(wc.Route, *wc.slo, h)
+		}
+		h = withNotAcceptable(ws.NotAcceptable, h)
+
+		r.Handle(wc.Route, traceRoute(wc.Route, ws.logs.middleware(wc.Route, h)))
+
+		links = append(links, EndPoint{
+			URL:        wc.Route,
+			Methods:    wc.GetAllowedMethods(),
+			Expand:     wc.expand,
+			Deprecated: wc.deprecatedMethods(),
 		})
-		links = append(links, EndPoint{URL: VersionRoute, Methods: "GET"})
+	}
+
+	ws.checkRoutes(registered)
+
+	if admin && !ws.DisableDebugRoutes {
+		// Profiling handlers, which require the DebugToken if set
+		debug := func(h http.HandlerFunc) http.Handler {
+			return requireDebugToken(ws.DebugToken, h)
+		}
+
+		r.Handle("/_profiler/info.html", debug(profiler.MemStatsHTMLHandler))
+		links = append(links, EndPoint{URL: "/_profiler/info.html", Methods: "GET"})
+		r.Handle("/_profiler/info", debug(profiler.ProfilingInfoJSONHandler))
+		r.Handle("/_profiler/start", debug(profiler.StartProfilingHandler))
+		r.Handle("/_profiler/stop", debug(profiler.StopProfilingHandler))
+
+		r.Handle("/_debug/pprof/", debug(gopprof.Index))
+		links = append(links, EndPoint{URL: "/_debug/pprof", Methods: "GET"})
+		r.Handle("/_debug/pprof/cmdline", debug(gopprof.Cmdline))
+		r.Handle("/_debug/pprof/profile", debug(gopprof.Profile))
+		r.Handle("/_debug/pprof/symbol", debug(gopprof.Symbol))
+	}
+
+	if admin {
+		r.Handle("/_metrics", metricsHandler())
+		links = append(links, EndPoint{URL: "/_metrics", Methods: "GET"})
+
+		r.Handle(DocsRoute, ws.docsHandler())
+		links = append(links, EndPoint{URL: DocsRoute, Methods: "GET"})
+
+		if h := ws.protected(ws.logs.handler()); h != nil {
+			r.Handle(LogVerbosityRoute, h)
+			links = append(links, EndPoint{URL: LogVerbosityRoute, Methods: "GET, POST, DELETE"})
+		}
+
+		if h := ws.protected(ws.selftests.handler()); h != nil {
+			r.Handle(SelfTestRoute, h)
+			links = append(links, EndPoint{URL: SelfTestRoute, Methods: "GET, POST"})
+		}
+
+		r.Handle(ReadyRoute, ws.warmups.handler())
+		links = append(links, EndPoint{URL: ReadyRoute, Methods: "GET"})
+
+		r.Handle(SLORoute, ws.slos.handler())
+		links = append(links, EndPoint{URL: SLORoute, Methods: "GET"})
+
+		if h := ws.protected(ws.configHandler()); h != nil {
+			r.Handle(ConfigRoute, h)
+			links = append(links, EndPoint{URL: ConfigRoute, Methods: "GET"})
+		}
+
+		if !versionSeen {
+			// If detailed version info is not provided, we echo the default
+			// This allows services to provide their own extended version info,
+			// i.e. database versioning as well as process versioning
+			r.Handle(VersionRoute, http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					v := Version{}
+					v.Hydrate()
+					render.JSON(w, http.StatusOK, v)
+				},
+			))
+			links = append(links, EndPoint{URL: VersionRoute, Methods: "GET"})
+		}
 	}
 
 	// The last routes are the NotFound routes as we want to return JSON.
@@ -141,41 +423,159 @@ func (ws *WebService) BuildRouter() *mux.Router {
 	// This handles / on it's own, and we should only do this if no other
 	// route already registered /
 	if !rootSeen {
-		sort.Sort(links)
-		r.HandleFunc(root, func(w http.ResponseWriter, r *http.Request) {
-			render.JSON(w, http.StatusOK, links)
+		links = append(links, EndPoint{
+			URL:           root,
+			Methods:       "GET",
+			Formats:       render.MediaTypes(),
+			NotAcceptable: ws.NotAcceptable.String(),
 		})
+		r.Handle(root, endpointIndex(links))
 	}
 
-	// This is a wildcard route and will greedily consume all remaining routes
-	r.HandleFunc("/{path:.*}", func(w http.ResponseWriter, r *http.Request) {
+	r.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		render.Error(
 			w,
 			http.StatusNotFound,
-			fmt.Errorf("/%s not found", mux.Vars(r)["path"]),
+			fmt.Errorf("%s not found", r.URL.Path),
 		)
+	}))
+}
+
+// withNotAcceptable applies the NotAcceptable policy of a service to the
+// responses of h that are written with render.Negotiate
+func withNotAcceptable(p render.NotAcceptablePolicy, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(render.WithNotAcceptablePolicy(req.Context(), p)))
 	})
+}
+
+// Handler builds the router and wraps it in the middleware added via Use, and
+// the access log if enabled
+func (ws *WebService) Handler() http.Handler {
+	r := ws.router()
+	ws.buildRouter(r, true, ws.AdminAddr == "")
+
+	h := ws.health.middleware(chain(r, ws.middleware))
+	if ws.Compression != nil {
+		h = Compress(*ws.Compression)(h)
+	}
+
+	if ws.TailLog {
+		h = TailLog(ws.TailLogThreshold)(h)
+	}
+
+	if ws.Tracing {
+		h = TraceRequests(h)
+	}
+
+	return AccessLogger(ws.AccessLog)(h)
+}
 
-	return r
+// AdminHandler builds the router for the operational routes and wraps it in
+// the middleware added via Use, and the access log if enabled
+func (ws *WebService) AdminHandler() http.Handler {
+	r := ws.router()
+	ws.buildRouter(r, false, true)
+	return AccessLogger(ws.AccessLog)(chain(r, ws.middleware))
 }
 
-// Run collects all of the controllers, wires up the routes and starts the server
+// Run collects all of the controllers, wires up the routes and starts the
+// server. If AdminAddr is set a second server is started on it for the
+// operational routes. If TLSConfig is set the public server terminates TLS.
+//
+// On SIGINT or SIGTERM the servers stop accepting connections, in-flight
+// requests are given ShutdownTimeout to complete, the worker pools are
+// stopped, a ShutdownReport is logged and Run returns.
 func (ws *WebService) Run(addr string) {
-	n := negroni.New()
+	ws.run(addr, ws.TLSConfig)
+}
 
-	// Middleware for net/http/pprof
-	n.Use(pprof.Pprof())
+// RunTLS is Run with the public server terminating TLS using the certificate
+// and key in the files, which are PEM encoded. Any TLSConfig is used as the
+// basis of the configuration, so client certificates can be verified.
+func (ws *WebService) RunTLS(addr string, certFile string, keyFile string) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := &tls.Config{}
+	if ws.TLSConfig != nil {
+		cfg = ws.TLSConfig.Clone()
+	}
+	cfg.Certificates = append(cfg.Certificates, cert)
+
+	ws.run(addr, cfg)
+}
+
+// run serves until the process is signalled to stop
+func (ws *WebService) run(addr string, tlsConfig *tls.Config) {
+	if ws.stats == nil {
+		ws.stats = newRequestStats()
+	}
+
+	errs := make(chan error, 2)
+	servers := []*http.Server{}
 
-	// Send errors to sentry if the SENTRY_DSN environment variable is set
-	r := ws.BuildRouter()
-	hfn := r.ServeHTTP
-	if os.Getenv("SENTRY_DSN") != "" {
-		hfn = raven.RecoveryHandler(hfn)
+	if ws.AdminAddr != "" {
+		srv, err := ws.start(
+			ws.AdminAddr,
+			serve(ws.stats.middleware(ws.AdminHandler()), !ws.DisableDebugRoutes, ws.DebugToken),
+			false,
+			nil,
+			errs,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, srv)
+	}
+
+	public := serve(
+		ws.stats.middleware(ws.Handler()),
+		ws.AdminAddr == "" && !ws.DisableDebugRoutes,
+		ws.DebugToken,
+	)
+	srv, err := ws.start(addr, public, true, tlsConfig, errs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	servers = append(servers, srv)
+
+	// The routes have been built, and so ws.warmups and ws.health are set
+	go ws.warmups.run(public)
+
+	stop := make(chan struct{})
+	if HealthCheckInterval > 0 {
+		go ws.health.poll(HealthCheckInterval, stop)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case s := <-sig:
+		signal.Stop(sig)
+		close(stop)
+		ws.shutdown(s.String(), servers)
+	}
+}
+
+// serve wraps a handler with the server level middleware, including the
+// net/http/pprof middleware when withPprof is true
+func serve(h http.Handler, withPprof bool, debugToken string) http.Handler {
+	mw := []Middleware{}
+
+	// Middleware for net/http/pprof
+	if withPprof {
+		mw = append(mw, pprofMiddleware(debugToken))
 	}
 
-	// Apply mux routes
-	n.UseHandlerFunc(hfn)
+	// Render panics as JSON errors, and send them to Sentry if the
+	// SENTRY_DSN environment variable is set
+	mw = append(mw, Recover)
 
-	// Wrap ListenAndServe and start the server
-	log.Fatal(http.ListenAndServe(addr, n))
+	return chain(h, mw)
 }
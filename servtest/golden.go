@@ -0,0 +1,127 @@
+package servtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// update is set by the -update flag of go test, i.e.
+//
+//	go test ./... -update
+//
+// to rewrite the golden files with the actual responses rather than compare
+// against them
+var update = flag.Bool("update", false, "update the golden files of servtest")
+
+// Update is true when the UPDATE_GOLDEN environment variable is set, and then
+// the golden files are rewritten as with -update. It suits tests run by
+// tools that do not pass flags to the test binary, and tests may also set it.
+var Update = os.Getenv("UPDATE_GOLDEN") != ""
+
+// ignored replaces the value of an ignored field in a golden file
+const ignored = "<ignored>"
+
+// AssertGoldenJSON fails the test unless the JSON body matches the golden
+// file at path. Both are compared in a stable format, indented and with keys
+// sorted, and the values of any fields named in ignore, at any depth, are
+// replaced so that timestamps and IDs do not cause spurious failures.
+//
+// With -update, or when Update is true, the golden file is written instead.
+func AssertGoldenJSON(t testing.TB, path string, body []byte, ignore ...string) {
+	t.Helper()
+
+	actual, err := normalizeJSON(body, ignore)
+	if err != nil {
+		t.Fatalf("invalid JSON body: %s", err)
+	}
+
+	if *update || Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s, run with -update to create it", err)
+	}
+
+	expected, err := normalizeJSON(golden, ignore)
+	if err != nil {
+		t.Fatalf("invalid JSON in %s: %s", path, err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Errorf(
+			"response does not match %s\n--- expected\n%s--- actual\n%s",
+			path, expected, actual,
+		)
+	}
+}
+
+// AssertGoldenResponse is AssertGoldenJSON for the body of a recorded
+// response
+func AssertGoldenResponse(
+	t testing.TB,
+	path string,
+	rec *httptest.ResponseRecorder,
+	ignore ...string,
+) {
+	t.Helper()
+	AssertGoldenJSON(t, path, rec.Body.Bytes(), ignore...)
+}
+
+// normalizeJSON re-encodes JSON in the stable golden format
+func normalizeJSON(body []byte, ignore []string) ([]byte, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if len(ignore) > 0 {
+		skip := make(map[string]bool, len(ignore))
+		for _, field := range ignore {
+			skip[field] = true
+		}
+		v = ignoreFields(v, skip)
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// ignoreFields replaces the values of the named fields throughout v
+func ignoreFields(v interface{}, skip map[string]bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if skip[k] {
+				t[k] = ignored
+				continue
+			}
+			t[k] = ignoreFields(child, skip)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = ignoreFields(child, skip)
+		}
+	}
+
+	return v
+}
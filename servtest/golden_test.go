@@ -0,0 +1,14 @@
+package servtest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAssertGoldenResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.WriteString(`{"total":1,"items":[` +
+		`{"name":"foo","id":42,"createdAt":"2016-01-02T15:04:05Z"}]}`)
+
+	AssertGoldenResponse(t, "testdata/golden.json", rec, "id", "createdAt")
+}
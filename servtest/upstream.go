@@ -0,0 +1,277 @@
+// Package servtest provides helpers for testing services built with this
+// package, and the clients they use to call other services.
+package servtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/render"
+)
+
+// Call is a request received by an Upstream
+type Call struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Expectation is a request that an Upstream expects to receive, and the
+// response it returns when it does
+type Expectation struct {
+	method   string
+	path     string
+	header   http.Header
+	body     interface{}
+	hasBody  bool
+	status   int
+	response interface{}
+	latency  time.Duration
+	times    int
+	calls    int
+}
+
+// WithHeader requires that a matching request has the header set to value
+func (e *Expectation) WithHeader(key string, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// WithJSONBody requires that the body of a matching request is JSON that is
+// equal to v once both are decoded
+func (e *Expectation) WithJSONBody(v interface{}) *Expectation {
+	e.body = v
+	e.hasBody = true
+	return e
+}
+
+// RespondJSON sets the status and the value that is rendered as JSON in
+// response to a matching request. If v is nil no body is written.
+func (e *Expectation) RespondJSON(status int, v interface{}) *Expectation {
+	e.status = status
+	e.response = v
+	return e
+}
+
+// Delay injects latency before the response is written. The delay ends early
+// if the client gives up on the request.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.latency = d
+	return e
+}
+
+// Times sets the number of requests the expectation matches. By default an
+// expectation matches any number of requests, but must match at least one.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// matches returns true if the request satisfies the expectation
+func (e *Expectation) matches(c Call) bool {
+	if e.method != c.Method || e.path != c.Path {
+		return false
+	}
+
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+
+	for key, values := range e.header {
+		for _, value := range values {
+			if !hasValue(c.Header[key], value) {
+				return false
+			}
+		}
+	}
+
+	if e.hasBody && !jsonEqual(e.body, c.Body) {
+		return false
+	}
+
+	return true
+}
+
+// Upstream is a scriptable HTTP server that stands in for a service that the
+// service under test calls, so that the calls can be tested hermetically
+type Upstream struct {
+	// URL of the upstream, of the form http://ipaddr:port with no trailing
+	// slash
+	URL string
+
+	t            testing.TB
+	server       *httptest.Server
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+}
+
+// NewUpstream starts an Upstream, which is closed when the test completes.
+// Requests that match no expectation fail the test and receive a 501.
+func NewUpstream(t testing.TB) *Upstream {
+	u := &Upstream{t: t}
+	u.server = httptest.NewServer(http.HandlerFunc(u.serveHTTP))
+	u.URL = u.server.URL
+	t.Cleanup(u.Close)
+
+	return u
+}
+
+// Expect adds an expectation of a request with the method and path. Unless
+// RespondJSON is called the response is a 200 with no body.
+func (u *Upstream) Expect(method string, path string) *Expectation {
+	e := &Expectation{
+		method: method,
+		path:   path,
+		header: http.Header{},
+		status: http.StatusOK,
+	}
+
+	u.mu.Lock()
+	u.expectations = append(u.expectations, e)
+	u.mu.Unlock()
+
+	return e
+}
+
+// Calls returns the requests received so far, in the order they arrived
+func (u *Upstream) Calls() []Call {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	calls := make([]Call, len(u.calls))
+	copy(calls, u.calls)
+
+	return calls
+}
+
+// AssertCalled fails the test unless exactly n requests with the method and
+// path have been received
+func (u *Upstream) AssertCalled(method string, path string, n int) {
+	u.t.Helper()
+
+	count := 0
+	for _, c := range u.Calls() {
+		if c.Method == method && c.Path == path {
+			count++
+		}
+	}
+
+	if count != n {
+		u.t.Errorf("%s %s called %d times, expected %d", method, path, count, n)
+	}
+}
+
+// AssertExpectations fails the test for each expectation that has not been
+// met, being those that matched no request or fewer than the number set by
+// Times
+func (u *Upstream) AssertExpectations() {
+	u.t.Helper()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, e := range u.expectations {
+		switch {
+		case e.times == 0 && e.calls == 0:
+			u.t.Errorf("%s %s expected but not called", e.method, e.path)
+		case e.calls < e.times:
+			u.t.Errorf(
+				"%s %s called %d times, expected %d",
+				e.method, e.path, e.calls, e.times,
+			)
+		}
+	}
+}
+
+// Close shuts down the upstream. It is safe to call more than once.
+func (u *Upstream) Close() {
+	u.server.Close()
+}
+
+func (u *Upstream) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	c := Call{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Header: req.Header,
+		Body:   body,
+	}
+
+	u.mu.Lock()
+	u.calls = append(u.calls, c)
+	var match *Expectation
+	for _, e := range u.expectations {
+		if e.matches(c) {
+			match = e
+			match.calls++
+			break
+		}
+	}
+	u.mu.Unlock()
+
+	if match == nil {
+		u.t.Errorf("unexpected request %s %s", c.Method, c.Path)
+		render.Error(
+			w,
+			http.StatusNotImplemented,
+			fmt.Errorf("no expectation matches %s %s", c.Method, c.Path),
+		)
+		return
+	}
+
+	if match.latency > 0 {
+		select {
+		case <-time.After(match.latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if match.response == nil {
+		w.WriteHeader(match.status)
+		return
+	}
+
+	render.JSON(w, match.status, match.response)
+}
+
+// hasValue returns true if value is one of values
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonEqual returns true if the JSON encoding of expected and the JSON body
+// decode to equal values
+func jsonEqual(expected interface{}, body []byte) bool {
+	b, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+
+	var want, got interface{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		return false
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&got); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(want, got)
+}
@@ -0,0 +1,55 @@
+package servtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstream(t *testing.T) {
+	u := NewUpstream(t)
+	u.Expect("POST", "/widgets").
+		WithHeader("Content-Type", "application/json").
+		WithJSONBody(map[string]interface{}{"name": "foo"}).
+		RespondJSON(http.StatusCreated, map[string]int{"id": 1}).
+		Times(1)
+
+	resp, err := http.Post(
+		u.URL+"/widgets",
+		"application/json",
+		strings.NewReader(`{ "name": "foo" }`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status %d, expected %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	var v map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v["id"] != 1 {
+		t.Errorf("id %d, expected 1", v["id"])
+	}
+
+	u.AssertCalled("POST", "/widgets", 1)
+	u.AssertExpectations()
+}
+
+func TestUpstreamDelay(t *testing.T) {
+	u := NewUpstream(t)
+	u.Expect("GET", "/slow").Delay(time.Second)
+
+	client := http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Get(u.URL + "/slow"); err == nil {
+		t.Fatal("expected timeout")
+	}
+
+	u.AssertCalled("GET", "/slow", 1)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/tracing"
+	"github.com/cloudflare/service/worker"
+)
+
+// DefaultShutdownTimeout is the time allowed for in-flight requests to
+// complete on shutdown when WebService.ShutdownTimeout is not set
+var DefaultShutdownTimeout = 30 * time.Second
+
+// WorkerCancelGrace is the time allowed for worker pools to return once the
+// context of their work is cancelled, when they have not finished their queue
+// within the shutdown timeout
+var WorkerCancelGrace = 5 * time.Second
+
+// namedPool is a worker pool that is stopped when the service shuts down
+type namedPool struct {
+	name string
+	pool *worker.Pool
+}
+
+// AddWorkerPool registers a worker pool to be drained, after in-flight
+// requests have drained, when the service shuts down. The pool is given the
+// shutdown timeout to finish its queue before its work is cancelled.
+func (ws *WebService) AddWorkerPool(name string, p *worker.Pool) {
+	ws.workers = append(ws.workers, namedPool{name: name, pool: p})
+}
+
+// ShutdownReport summarises the life of a service, and is logged as JSON when
+// it shuts down so that a clean exit can be confirmed from the logs alone
+type ShutdownReport struct {
+	Signal          string           `json:"signal"`
+	UptimeSeconds   float64          `json:"uptimeSeconds"`
+	Requests        map[string]int64 `json:"requests"`
+	BytesServed     int64            `json:"bytesServed"`
+	InFlightAtDrain int64            `json:"inFlightAtDrain"`
+	DrainSeconds    float64          `json:"drainSeconds"`
+	DrainComplete   bool             `json:"drainComplete"`
+	WorkersStopped  []string         `json:"workersStopped"`
+
+	// WorkersCancelled lists the pools that did not finish their queue in
+	// time and had their work cancelled, and WorkersStuck the workers, named
+	// pool/id, that had still not returned after WorkerCancelGrace
+	WorkersCancelled []string `json:"workersCancelled"`
+	WorkersStuck     []string `json:"workersStuck"`
+}
+
+// shutdown gracefully stops the servers, waiting up to the shutdown timeout
+// for in-flight requests, then stops the worker pools and logs a report
+func (ws *WebService) shutdown(signal string, servers []*http.Server) ShutdownReport {
+	timeout := ws.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	report := ShutdownReport{
+		Signal:          signal,
+		InFlightAtDrain: atomic.LoadInt64(&ws.stats.inFlight),
+		DrainComplete:   true,
+		WorkersStopped:  []string{},
+
+		WorkersCancelled: []string{},
+		WorkersStuck:     []string{},
+	}
+
+	log.Infof("shutting down on %s with %d requests in flight", signal, report.InFlightAtDrain)
+
+	drainStart := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Warningf("server %s did not drain: %s", srv.Addr, err)
+			report.DrainComplete = false
+		}
+	}
+	cancel()
+	report.DrainSeconds = time.Since(drainStart).Seconds()
+
+	for _, w := range ws.workers {
+		result := w.pool.Drain(timeout, WorkerCancelGrace)
+
+		if !result.Drained {
+			log.Warningf(
+				"worker pool %s did not drain within %s, cancelled workers %v",
+				w.name, timeout, result.Cancelled,
+			)
+			report.WorkersCancelled = append(report.WorkersCancelled, w.name)
+		}
+
+		for _, id := range result.Stuck {
+			log.Errorf("worker %s/%d did not stop within %s of cancellation", w.name, id, WorkerCancelGrace)
+			report.WorkersStuck = append(report.WorkersStuck, fmt.Sprintf("%s/%d", w.name, id))
+		}
+
+		if len(result.Stuck) == 0 {
+			report.WorkersStopped = append(report.WorkersStopped, w.name)
+		}
+	}
+
+	report.UptimeSeconds = time.Since(ws.stats.started).Seconds()
+	report.Requests = ws.stats.byClass()
+	report.BytesServed = atomic.LoadInt64(&ws.stats.bytes)
+
+	b, _ := json.Marshal(report)
+	log.Infof("shutdown report: %s", b)
+
+	// Export any spans and write any log lines held by batching before the
+	// process exits
+	tracing.Flush()
+	log.Flush()
+
+	return report
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// SLORoute is the path to the endpoint that reports the error budgets of the
+// controllers that declare an SLO
+var SLORoute string = `/_slo`
+
+// DefaultSLOWindow is the window of an SLO that does not declare one
+var DefaultSLOWindow = 30 * 24 * time.Hour
+
+// sloBucketWidth is the resolution of the counts behind the SLO reports
+const sloBucketWidth = 5 * time.Minute
+
+// SLO is the service level objective of a controller. A zero target is not
+// tracked.
+type SLO struct {
+	// Availability is the fraction of requests that must not fail with a
+	// status of 500 or above, i.e. 0.999
+	Availability float64
+
+	// LatencyTarget is the fraction of requests that must be served within
+	// Latency, i.e. 0.99 within 250ms
+	Latency       time.Duration
+	LatencyTarget float64
+
+	// Window is the period over which the objective is measured, or
+	// DefaultSLOWindow if zero
+	Window time.Duration
+}
+
+// SetSLO declares the SLO of the controller. Its requests are then counted by
+// the slo_requests, slo_errors and slo_slow metrics, labelled by route, from
+// which burn rates can be alerted on, and its error budget is reported by
+// SLORoute. Requests cancelled by the client are not counted.
+func (wc *WebController) SetSLO(s SLO) {
+	if s.Window == 0 {
+		s.Window = DefaultSLOWindow
+	}
+
+	wc.slo = &s
+}
+
+// SLOReport is the state of the SLO of a route over its window. A budget
+// consumed of 1 or more means the objective has been missed. A burn rate is
+// the rate at which the error budget was consumed over the last hour or six
+// hours, relative to the rate that would consume exactly the budget over the
+// window.
+type SLOReport struct {
+	Route              string  `json:"route"`
+	Window             string  `json:"window"`
+	AvailabilityTarget float64 `json:"availabilityTarget,omitempty"`
+	LatencyMS          float64 `json:"latencyMs,omitempty"`
+	LatencyTarget      float64 `json:"latencyTarget,omitempty"`
+
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	Slow     int64 `json:"slow"`
+
+	ErrorBudgetConsumed   float64 `json:"errorBudgetConsumed"`
+	LatencyBudgetConsumed float64 `json:"latencyBudgetConsumed"`
+	BurnRate1h            float64 `json:"burnRate1h"`
+	BurnRate6h            float64 `json:"burnRate6h"`
+}
+
+// sloBucket counts the requests to a route within sloBucketWidth
+type sloBucket struct {
+	start    time.Time
+	requests int64
+	errors   int64
+	slow     int64
+}
+
+// sloTracker counts the requests to a route with an SLO
+type sloTracker struct {
+	route string
+	slo   SLO
+
+	mu      sync.Mutex
+	buckets []sloBucket
+}
+
+// sloTrackers holds the trackers of a WebService by route. It is shared by
+// copies of the WebService.
+type sloTrackers struct {
+	mu       sync.Mutex
+	trackers map[string]*sloTracker
+}
+
+// middleware returns the handler for a route with an SLO wrapped so that its
+// requests are counted
+func (s *sloTrackers) middleware(route string, slo SLO, next http.Handler) http.Handler {
+	s.mu.Lock()
+	if s.trackers == nil {
+		s.trackers = make(map[string]*sloTracker)
+	}
+	t, ok := s.trackers[route]
+	if !ok {
+		t = &sloTracker{route: route}
+		s.trackers[route] = t
+	}
+	t.slo = slo
+	s.mu.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(w)
+
+		next.ServeHTTP(rw, req)
+
+		if ClientCancelled(req) {
+			return
+		}
+
+		failed := rw.Status() >= http.StatusInternalServerError
+		slow := slo.Latency > 0 && time.Since(start) > slo.Latency
+		t.record(start, failed, slow)
+	})
+}
+
+// record counts a request
+func (t *sloTracker) record(now time.Time, failed bool, slow bool) {
+	metrics.Inc("slo_requests", "route", t.route)
+	if failed {
+		metrics.Inc("slo_errors", "route", t.route)
+	}
+	if slow {
+		metrics.Inc("slo_slow", "route", t.route)
+	}
+
+	start := now.Truncate(sloBucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.buckets); n == 0 || t.buckets[n-1].start.Before(start) {
+		// Buckets that have left the window are forgotten
+		cutoff := start.Add(-t.slo.Window)
+		i := 0
+		for i < len(t.buckets) && !t.buckets[i].start.After(cutoff) {
+			i++
+		}
+		t.buckets = append(t.buckets[i:], sloBucket{start: start})
+	}
+
+	b := &t.buckets[len(t.buckets)-1]
+	b.requests++
+	if failed {
+		b.errors++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+// report returns the state of the SLO at now
+func (t *sloTracker) report(now time.Time) SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := SLOReport{
+		Route:              t.route,
+		Window:             t.slo.Window.String(),
+		AvailabilityTarget: t.slo.Availability,
+		LatencyMS:          float64(t.slo.Latency) / float64(time.Millisecond),
+		LatencyTarget:      t.slo.LatencyTarget,
+	}
+
+	var requests1h, errors1h, requests6h, errors6h int64
+	for _, b := range t.buckets {
+		age := now.Sub(b.start)
+		if age > t.slo.Window {
+			continue
+		}
+
+		r.Requests += b.requests
+		r.Errors += b.errors
+		r.Slow += b.slow
+
+		if age <= 6*time.Hour {
+			requests6h += b.requests
+			errors6h += b.errors
+		}
+		if age <= time.Hour {
+			requests1h += b.requests
+			errors1h += b.errors
+		}
+	}
+
+	r.ErrorBudgetConsumed = budgetConsumed(r.Errors, r.Requests, t.slo.Availability)
+	r.LatencyBudgetConsumed = budgetConsumed(r.Slow, r.Requests, t.slo.LatencyTarget)
+	r.BurnRate1h = budgetConsumed(errors1h, requests1h, t.slo.Availability)
+	r.BurnRate6h = budgetConsumed(errors6h, requests6h, t.slo.Availability)
+
+	return r
+}
+
+// budgetConsumed returns the fraction of the budget of a target used by bad
+// requests, which over a short period is the burn rate
+func budgetConsumed(bad int64, total int64, target float64) float64 {
+	if total == 0 || target <= 0 || target >= 1 {
+		return 0
+	}
+
+	return float64(bad) / (float64(total) * (1 - target))
+}
+
+// handler serves SLORoute
+func (s *sloTrackers) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		trackers := make([]*sloTracker, 0, len(s.trackers))
+		for _, t := range s.trackers {
+			trackers = append(trackers, t)
+		}
+		s.mu.Unlock()
+
+		sort.Slice(trackers, func(i, j int) bool {
+			return trackers[i].route < trackers[j].route
+		})
+
+		now := time.Now()
+		reports := make([]SLOReport, 0, len(trackers))
+		for _, t := range trackers {
+			reports = append(reports, t.report(now))
+		}
+
+		render.JSON(w, http.StatusOK, reports)
+	})
+}
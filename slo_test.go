@@ -0,0 +1,52 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSLO(t *testing.T) {
+	ws := NewWebService()
+
+	wc := NewWebController("/things/{id}")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	wc.SetSLO(SLO{Availability: 0.9, Latency: time.Hour, LatencyTarget: 0.99})
+	ws.AddWebController(wc)
+
+	h := ws.Handler()
+	for i := 0; i < 9; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/1", nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/1?fail=1", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", SLORoute, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", SLORoute, rec.Code, rec.Body.String())
+	}
+
+	var reports []SLOReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &reports); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("GET %s = %+v, expected one report", SLORoute, reports)
+	}
+
+	r := reports[0]
+	if r.Route != "/things/{id}" || r.Requests != 10 || r.Errors != 1 || r.Slow != 0 {
+		t.Errorf("report = %+v, expected 10 requests and 1 error to /things/{id}", r)
+	}
+	if r.ErrorBudgetConsumed < 0.99 || r.ErrorBudgetConsumed > 1.01 {
+		t.Errorf("ErrorBudgetConsumed = %v, expected 1", r.ErrorBudgetConsumed)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StatsSnapshot holds the counters of a WebService at a point in time, for
+// applications that feed their own telemetry systems
+type StatsSnapshot struct {
+	Time   time.Time     `json:"time"`
+	Uptime time.Duration `json:"uptime"`
+
+	// InFlight is the number of requests being served
+	InFlight int64 `json:"inFlight"`
+
+	// Requests counts the requests served by status class, keyed "2xx", and
+	// those cancelled by the client, keyed "cancelled"
+	Requests     map[string]int64 `json:"requests"`
+	BytesWritten int64            `json:"bytesWritten"`
+
+	// Shed counts the requests refused by RenderUnavailable, i.e. by
+	// LoadShed, by reason. It is shared by every WebService of the process.
+	Shed map[string]int64 `json:"shed"`
+
+	// Health is the Health.Status of the last run of the health checks, or
+	// "unknown" if they have not run, and Degraded the dependencies that
+	// are degraded, see Degraded
+	Health   string   `json:"health"`
+	Degraded []string `json:"degraded,omitempty"`
+
+	// Ready is true once the warm-ups have run, see ReadyRoute
+	Ready bool `json:"ready"`
+}
+
+// Snapshot returns the current counters of the WebService. It does not run
+// the health checks.
+func (ws *WebService) Snapshot() StatsSnapshot {
+	now := time.Now()
+	s := StatsSnapshot{
+		Time:     now,
+		Requests: map[string]int64{},
+		Shed:     shedLog.byReason(),
+		Health:   "unknown",
+		Ready:    ws.warmups == nil || ws.warmups.ready(),
+	}
+
+	if ws.stats != nil {
+		s.Uptime = now.Sub(ws.stats.started)
+		s.InFlight = atomic.LoadInt64(&ws.stats.inFlight)
+		s.Requests = ws.stats.byClass()
+		s.BytesWritten = atomic.LoadInt64(&ws.stats.bytes)
+	}
+
+	if ws.health != nil {
+		ws.health.mu.RLock()
+		switch {
+		case ws.health.status != "":
+			s.Health = ws.health.status
+		case len(ws.health.checks) == 0:
+			s.Health = "ok"
+		}
+		ws.health.mu.RUnlock()
+
+		s.Degraded = ws.health.degraded()
+	}
+
+	return s
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	ws := NewWebService()
+	ws.AddHealthCheck(HealthCheck("cache", func(ctx context.Context) error {
+		return errors.New("evicted")
+	}), false)
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(wc)
+
+	if s := ws.Snapshot(); s.Health != "unknown" {
+		t.Errorf("Health before the checks run = %q, expected unknown", s.Health)
+	}
+
+	h := ws.stats.middleware(ws.Handler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", HeartbeatRoute, nil))
+
+	RenderUnavailable(httptest.NewRecorder(), "snapshot-test", time.Second, 0)
+
+	s := ws.Snapshot()
+	if s.Requests["2xx"] != 2 || s.Requests["4xx"] != 1 || s.InFlight != 0 {
+		t.Errorf("Requests = %v with %d in flight, expected two 2xx and one 4xx", s.Requests, s.InFlight)
+	}
+	if s.Health != "degraded" || len(s.Degraded) != 1 || s.Degraded[0] != "cache" {
+		t.Errorf("Health = %q, Degraded = %v, expected the cache to be degraded", s.Health, s.Degraded)
+	}
+	if s.Shed["snapshot-test"] != 1 || !s.Ready {
+		t.Errorf("Shed = %v, Ready = %v", s.Shed, s.Ready)
+	}
+}
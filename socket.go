@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// SocketOptions are the options of the sockets of the listeners, for
+// deployments that are sensitive to latency or that take bursts of
+// connections. The zero value leaves the defaults of Go and of the OS.
+type SocketOptions struct {
+	// Backlog is the length of the queue of connections that have not yet
+	// been accepted, or the default of the OS if zero, being
+	// net.core.somaxconn on Linux, which also caps it
+	Backlog int
+
+	// DisableNoDelay clears TCP_NODELAY, which Go sets, on accepted
+	// connections, so that Nagle's algorithm coalesces small writes
+	DisableNoDelay bool
+
+	// KeepAlive is the period of the TCP keep-alive probes of accepted
+	// connections, or 15 seconds if zero. Negative disables them.
+	KeepAlive time.Duration
+
+	// ReceiveBuffer and SendBuffer set SO_RCVBUF and SO_SNDBUF, in bytes, of
+	// the listener, which accepted connections inherit. Zero leaves the
+	// default of the OS, which may round or cap the size.
+	ReceiveBuffer int
+	SendBuffer    int
+}
+
+// listen listens on addr with the options
+func (o SocketOptions) listen(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: o.KeepAlive}
+	if o.ReceiveBuffer > 0 || o.SendBuffer > 0 {
+		lc.Control = o.control
+	}
+
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Backlog > 0 {
+		if err := setBacklog(ln, o.Backlog); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	if o.DisableNoDelay {
+		ln = delayListener{ln}
+	}
+
+	return ln, nil
+}
+
+// delayListener clears TCP_NODELAY on the connections it accepts
+type delayListener struct {
+	net.Listener
+}
+
+// Accept is part of the net.Listener interface
+func (l delayListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tc, ok := c.(*net.TCPConn); ok {
+		if err := tc.SetNoDelay(false); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package service
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+func (o SocketOptions) control(network string, address string, c syscall.RawConn) error {
+	return errors.New("socket buffer sizes are not supported on this platform")
+}
+
+func setBacklog(ln net.Listener, backlog int) error {
+	return errors.New("the listen backlog is not supported on this platform")
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package service
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSocketOptions(t *testing.T) {
+	ws := NewWebService()
+	err := ws.Configure(WithSocketOptions(SocketOptions{
+		Backlog:        16,
+		DisableNoDelay: true,
+		KeepAlive:      time.Minute,
+		ReceiveBuffer:  64 << 10,
+		SendBuffer:     64 << 10,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := ws.SocketOptions.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rc, err := c.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var noDelay, rcvBuf int
+	rc.Control(func(fd uintptr) {
+		noDelay, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+		rcvBuf, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	})
+
+	if noDelay != 0 {
+		t.Error("TCP_NODELAY is set on an accepted connection, expected it cleared")
+	}
+	if rcvBuf < 64<<10 {
+		t.Errorf("SO_RCVBUF = %d, expected at least %d", rcvBuf, 64<<10)
+	}
+
+	if err := ws.Configure(WithSocketOptions(SocketOptions{Backlog: -1})); err == nil {
+		t.Error("a negative backlog should fail")
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// control sets the buffer sizes of a socket before it is bound
+func (o SocketOptions) control(network string, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		if o.ReceiveBuffer > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer)
+		}
+		if err == nil && o.SendBuffer > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer)
+		}
+	})
+	if cerr != nil {
+		return cerr
+	}
+
+	return os.NewSyscallError("setsockopt", err)
+}
+
+// setBacklog sets the backlog of a listener. Go listens with the default of
+// the OS, and listening again on the socket changes it.
+func setBacklog(ln net.Listener, backlog int) error {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("cannot set the backlog of a %T", ln)
+	}
+
+	rc, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	cerr := rc.Control(func(fd uintptr) {
+		err = syscall.Listen(int(fd), backlog)
+	})
+	if cerr != nil {
+		return cerr
+	}
+
+	return os.NewSyscallError("listen", err)
+}
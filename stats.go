@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+)
+
+// requestStats counts the requests served by a WebService. Values are updated
+// and read atomically.
+type requestStats struct {
+	started  time.Time
+	inFlight int64
+	bytes    int64
+
+	// classes counts responses by status class, 1xx to 5xx, and cancelled
+	// the requests abandoned by the client, which are not counted by class
+	classes   [6]int64
+	cancelled int64
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{started: time.Now()}
+}
+
+// middleware returns Middleware that records every request in the stats
+func (s *requestStats) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&s.inFlight, 1)
+
+		rw := newResponseWriter(w)
+		defer func() {
+			atomic.AddInt64(&s.inFlight, -1)
+			atomic.AddInt64(&s.bytes, rw.bytes)
+			if ClientCancelled(req) {
+				atomic.AddInt64(&s.cancelled, 1)
+				metrics.Inc("requests_cancelled", "method", req.Method)
+				return
+			}
+			if class := rw.Status() / 100; class > 0 && class < len(s.classes) {
+				atomic.AddInt64(&s.classes[class], 1)
+			}
+		}()
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// byClass returns the number of responses in each status class, keyed "2xx",
+// and the number of requests cancelled by the client, keyed "cancelled"
+func (s *requestStats) byClass() map[string]int64 {
+	classes := make(map[string]int64)
+	for i := 1; i < len(s.classes); i++ {
+		classes[string(rune('0'+i))+"xx"] = atomic.LoadInt64(&s.classes[i])
+	}
+	classes["cancelled"] = atomic.LoadInt64(&s.cancelled)
+
+	return classes
+}
+
+// metricsHandler serves the metrics, first publishing the counts of slow and
+// failed log writes which the log package keeps in log.Stats
+func metricsHandler() http.Handler {
+	h := metrics.Handler()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		metrics.Set("log_writes_slow", log.Stats.Writes.Slow())
+		metrics.Set("log_writes_failed", log.Stats.Writes.Failures())
+		metrics.Set("log_writes_fallback", log.Stats.Writes.Fallbacks())
+
+		h.ServeHTTP(w, req)
+	})
+}
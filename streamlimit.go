@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/ratelimit"
+	"github.com/cloudflare/service/render"
+)
+
+// StreamRetryAfter is the Retry-After given to a stream that is refused
+// because a limit is reached
+var StreamRetryAfter = 5 * time.Second
+
+// StreamLimits limits the long-lived connections, such as server-sent event
+// streams and WebSockets, that may be open at once. A zero limit is not
+// enforced.
+type StreamLimits struct {
+	// PerIP limits the streams from each client IP address
+	PerIP int64
+
+	// PerIdentity limits the streams of each authenticated caller,
+	// identified by the Subject of their Identity
+	PerIdentity int64
+
+	// Total limits the streams across all clients
+	Total int64
+}
+
+// StreamLimitExceeded is rendered when a stream is refused with 429 Too Many
+// Requests because a limit is reached. Limit is "ip", "identity" or "total".
+type StreamLimitExceeded struct {
+	Message    string `json:"error"`
+	Limit      string `json:"limit"`
+	MaxStreams int64  `json:"maxStreams"`
+	RetryAfter int64  `json:"retryAfter"`
+}
+
+// LimitStreams returns Middleware that enforces limits on the streams of a
+// controller, i.e. so that a storm of dashboard tabs cannot exhaust the file
+// descriptors of the service. It should be added with WebController.Use to
+// the controllers that stream. The streams that are open are published as the
+// streams_open gauge, and those refused are counted by streams_refused.
+func LimitStreams(limits StreamLimits) Middleware {
+	open := ratelimit.NewConcurrency()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			keys := []streamKey{
+				{"total", "total", limits.Total},
+				{"ip", "ip:" + requestIP(req), limits.PerIP},
+			}
+			if id := streamIdentity(req); id != "" {
+				keys = append(keys, streamKey{"identity", "identity:" + id, limits.PerIdentity})
+			}
+
+			// The limits acquired are released when the stream ends, or
+			// if a later limit is reached
+			for _, k := range keys {
+				if k.max <= 0 {
+					continue
+				}
+
+				if !open.TryAcquire(k.key, k.max) {
+					refuseStream(w, k.limit, k.max)
+					return
+				}
+				defer open.Release(k.key)
+			}
+
+			metrics.Add("streams_open", 1)
+			defer metrics.Add("streams_open", -1)
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// streamKey is a limit on streams and the key it is counted by
+type streamKey struct {
+	limit string
+	key   string
+	max   int64
+}
+
+// streamIdentity returns the subject of the authenticated caller of a
+// request, or "" if it has not been authenticated
+func streamIdentity(req *http.Request) string {
+	if id, ok := IdentityFromContext(req.Context()); ok && id.Subject != "" {
+		return id.Subject
+	}
+
+	return ""
+}
+
+// refuseStream renders a StreamLimitExceeded
+func refuseStream(w http.ResponseWriter, limit string, max int64) {
+	secs := int64(StreamRetryAfter / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	metrics.Inc("streams_refused", "limit", limit)
+
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	render.JSON(w, http.StatusTooManyRequests, StreamLimitExceeded{
+		Message:    "too many streams",
+		Limit:      limit,
+		MaxStreams: max,
+		RetryAfter: secs,
+	})
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitStreams(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := LimitStreams(StreamLimits{PerIP: 1, PerIdentity: 2})(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			started <- struct{}{}
+			<-release
+		}),
+	)
+
+	stream := func(ip string, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/events", nil)
+		req.RemoteAddr = ip + ":1234"
+		req = WithIdentity(req, Identity{Subject: subject})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan struct{})
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		go func(ip string) {
+			stream(ip, "abc")
+			done <- struct{}{}
+		}(ip)
+		<-started
+	}
+
+	rec := stream("10.0.0.1", "other")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("a second stream from an IP = %d, expected %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	rec = stream("10.0.0.3", "abc")
+	refused := StreamLimitExceeded{}
+	json.Unmarshal(rec.Body.Bytes(), &refused)
+	if rec.Code != http.StatusTooManyRequests || refused.Limit != "identity" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("a third stream for a caller = %d %+v, expected the identity limit", rec.Code, refused)
+	}
+
+	close(release)
+	<-done
+	<-done
+
+	go func() { <-started }()
+	if rec := stream("10.0.0.1", "abc"); rec.Code != http.StatusOK {
+		t.Errorf("a stream once the others end = %d, expected %d", rec.Code, http.StatusOK)
+	}
+}
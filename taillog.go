@@ -0,0 +1,43 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/service/log"
+)
+
+// TailLog returns Middleware that holds the TRACE and DEBUG lines logged for
+// each request with the Context functions of the log package, such as
+// log.DebugContext, and writes them only if the request fails with a status
+// of 500 or above, or takes longer than threshold. A threshold of zero only
+// writes the lines of failed requests. This gives the detail of failures
+// without the cost of debug logging every request.
+func TailLog(threshold time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+
+			ctx, tail := log.WithTail(req.Context())
+			req = req.WithContext(ctx)
+
+			rw := newResponseWriter(w)
+			defer func() {
+				// The lines are most needed when the handler panics
+				if p := recover(); p != nil {
+					tail.Flush()
+					panic(p)
+				}
+
+				slow := threshold > 0 && time.Since(start) > threshold
+				if rw.Status() >= http.StatusInternalServerError || slow {
+					tail.Flush()
+				} else {
+					tail.Discard()
+				}
+			}()
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
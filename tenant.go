@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/render"
+)
+
+// TenantSource extracts a tenant identifier from a request, returning false if
+// the request does not carry one. A TenantSource may read the identifier from
+// anywhere, i.e. a claim within a token that has already been verified.
+type TenantSource func(req *http.Request) (string, bool)
+
+// TenantValidator checks that a tenant identifier is known and may use the
+// service. If it may not, the HTTP status and error to return are given.
+type TenantValidator func(ctx context.Context, tenant string) (int, error)
+
+// TenantFromHeader returns a TenantSource that reads the tenant identifier
+// from the given request header, i.e. "X-Account-ID"
+func TenantFromHeader(header string) TenantSource {
+	return func(req *http.Request) (string, bool) {
+		tenant := strings.TrimSpace(req.Header.Get(header))
+		return tenant, tenant != ""
+	}
+}
+
+// TenantFromSubdomain returns a TenantSource that reads the tenant identifier
+// from the label immediately to the left of domain in the request host, i.e.
+// "acme" for the host "acme.example.com" and domain "example.com"
+func TenantFromSubdomain(domain string) TenantSource {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+
+	return func(req *http.Request) (string, bool) {
+		host := strings.ToLower(req.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if !strings.HasSuffix(host, suffix) {
+			return "", false
+		}
+
+		sub := strings.TrimSuffix(host, suffix)
+		if i := strings.LastIndex(sub, "."); i >= 0 {
+			sub = sub[i+1:]
+		}
+
+		return sub, sub != ""
+	}
+}
+
+// TenantScope returns Middleware that identifies the tenant of each request by
+// trying each source in order. The tenant is checked by validate (which may be
+// nil to accept any tenant), stored in the request context, and attached to
+// the request as the "tenant" tag so that logs, metrics and Sentry events for
+// the request identify the tenant.
+//
+// Requests that do not identify a tenant are rejected with 400 Bad Request.
+func TenantScope(validate TenantValidator, sources ...TenantSource) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var (
+				tenant string
+				ok     bool
+			)
+
+			for _, source := range sources {
+				if tenant, ok = source(req); ok {
+					break
+				}
+			}
+
+			if !ok {
+				metrics.Inc("tenant_rejected", "reason", "missing")
+				render.Error(w, http.StatusBadRequest, fmt.Errorf("tenant not specified"))
+				return
+			}
+
+			if validate != nil {
+				if status, err := validate(req.Context(), tenant); err != nil {
+					metrics.Inc("tenant_rejected", "reason", "invalid")
+					log.Warningf("tenant %q rejected for %s %s: %s", tenant, req.Method, req.URL.Path, err)
+					render.Error(w, status, err)
+					return
+				}
+			}
+
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey, tenant))
+			req = SetTag(req, "tenant", tenant)
+			metrics.Inc("tenant_requests", "tenant", tenant)
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// TenantFromContext returns the tenant identified by the TenantScope
+// middleware for the request context
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/service/metrics"
+)
+
+func TestTenantSources(t *testing.T) {
+	header := TenantFromHeader("X-Account-ID")
+	subdomain := TenantFromSubdomain("example.com.")
+
+	tests := []struct {
+		source   TenantSource
+		host     string
+		header   string
+		expected string
+	}{
+		{header, "example.com", "acme", "acme"},
+		{header, "example.com", "  acme ", "acme"},
+		{header, "example.com", " ", ""},
+		{subdomain, "acme.example.com", "", "acme"},
+		{subdomain, "ACME.Example.com:8080", "", "acme"},
+		{subdomain, "api.acme.example.com", "", "acme"},
+		{subdomain, "example.com", "", ""},
+		{subdomain, "acme.example.org", "", ""},
+		{subdomain, "acmeexample.com", "", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		if test.header != "" {
+			req.Header.Set("X-Account-ID", test.header)
+		}
+
+		tenant, ok := test.source(req)
+		if tenant != test.expected || ok != (test.expected != "") {
+			t.Errorf("host %q and header %q = %q %t, expected %q", test.host, test.header, tenant, ok, test.expected)
+		}
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	validate := func(ctx context.Context, tenant string) (int, error) {
+		if tenant == "banned" {
+			return http.StatusForbidden, fmt.Errorf("tenant %s is suspended", tenant)
+		}
+		return 0, nil
+	}
+
+	var tenant, tag string
+	h := TenantScope(validate, TenantFromHeader("X-Account-ID"), TenantFromSubdomain("example.com"))(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tenant, _ = TenantFromContext(req.Context())
+			tag = Tags(req.Context())["tenant"]
+		}),
+	)
+
+	tests := []struct {
+		host     string
+		header   string
+		status   int
+		expected string
+	}{
+		{"acme.example.com", "", http.StatusOK, "acme"},
+		{"acme.example.com", "initech", http.StatusOK, "initech"},
+		{"example.com", "", http.StatusBadRequest, ""},
+		{"banned.example.com", "", http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		tenant, tag = "", ""
+		requests := metrics.Get("tenant_requests", "tenant", test.expected)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		if test.header != "" {
+			req.Header.Set("X-Account-ID", test.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.status || tenant != test.expected || tag != test.expected {
+			t.Errorf("host %q and header %q = %d, tenant %q, tag %q, expected %d and %q",
+				test.host, test.header, rec.Code, tenant, tag, test.status, test.expected)
+		}
+		if test.expected != "" && metrics.Get("tenant_requests", "tenant", test.expected) != requests+1 {
+			t.Errorf("the request for %q should be counted", test.expected)
+		}
+	}
+
+	if _, ok := TenantFromContext(context.Background()); ok {
+		t.Error("a context without a tenant should not report one")
+	}
+}
+
+func TestTenantScopeWithoutValidator(t *testing.T) {
+	var tenant string
+	h := TenantScope(nil, TenantFromHeader("X-Account-ID"))(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tenant, _ = TenantFromContext(req.Context())
+		}),
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Account-ID", "anyone")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || tenant != "anyone" {
+		t.Errorf("without a validator any tenant should be accepted, got %d %q", rec.Code, tenant)
+	}
+}
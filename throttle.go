@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/metrics"
+	"github.com/cloudflare/service/ratelimit"
+	"github.com/cloudflare/service/render"
+)
+
+// RateLimit limits the rate of requests from each client with a token bucket
+// per client: Rate requests per second are allowed with bursts of up to
+// Burst. Requests over the limit receive 429 Too Many Requests with a
+// Retry-After header.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+
+	// Key identifies the client of a request, or CallerKey if nil
+	Key func(req *http.Request) string
+}
+
+// SetRateLimit declares the rate limit of the controller, which applies to
+// each client's requests to the controller alone, and in addition to any
+// WebService.RateLimit
+func (wc *WebController) SetRateLimit(l RateLimit) {
+	wc.rateLimit = &l
+}
+
+// ClientIPKey identifies the client of a request by its IP address
+func ClientIPKey(req *http.Request) string {
+	return "ip:" + requestIP(req)
+}
+
+// CallerKey identifies the client of a request by the subject of its
+// authenticated Identity, and otherwise by its IP address. Credentials that
+// have not been authenticated are ignored, so that a client cannot have a
+// fresh bucket for each request by sending a different header each time.
+func CallerKey(req *http.Request) string {
+	if id := streamIdentity(req); id != "" {
+		return "caller:" + id
+	}
+
+	return ClientIPKey(req)
+}
+
+// Throttle returns Middleware that enforces a rate limit. Each call returns
+// middleware with its own buckets.
+func Throttle(l RateLimit) Middleware {
+	key := l.Key
+	if key == nil {
+		key = CallerKey
+	}
+
+	buckets := &keyedBuckets{rate: l.Rate, burst: l.Burst, buckets: make(map[string]*keyedBucket)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			now := time.Now()
+			b := buckets.get(key(req), now)
+
+			if !b.AllowN(now, 1) {
+				delay := b.Delay(now, 1)
+				secs := int64(math.Ceil(delay.Seconds()))
+				if secs < 1 || delay == time.Duration(math.MaxInt64) {
+					secs = 1
+				}
+
+				metrics.Inc("requests_throttled")
+				w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+				render.Error(
+					w,
+					http.StatusTooManyRequests,
+					fmt.Errorf("rate limit of %g requests per second exceeded", l.Rate),
+				)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// keyedBuckets holds a token bucket per client. Buckets that have not been
+// used for long enough to be full again are forgotten, every minute or
+// sooner if the number of buckets has grown by sweepGrowth since the last
+// sweep.
+type keyedBuckets struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*keyedBucket
+	swept   time.Time
+	kept    int
+}
+
+// sweepGrowth is the number of buckets added since the last sweep that
+// causes another
+const sweepGrowth = 10000
+
+type keyedBucket struct {
+	*ratelimit.TokenBucket
+	used time.Time
+}
+
+// get returns the bucket for a key
+func (k *keyedBuckets) get(key string, now time.Time) *ratelimit.TokenBucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now.Sub(k.swept) > time.Minute || len(k.buckets) >= k.kept+sweepGrowth {
+		k.swept = now
+		idle := time.Minute
+		if k.rate > 0 {
+			idle += time.Duration(float64(k.burst) / k.rate * float64(time.Second))
+		}
+
+		for key, b := range k.buckets {
+			if now.Sub(b.used) > idle {
+				delete(k.buckets, key)
+			}
+		}
+		k.kept = len(k.buckets)
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = &keyedBucket{TokenBucket: ratelimit.NewTokenBucket(k.rate, k.burst)}
+		k.buckets[key] = b
+	}
+	b.used = now
+
+	return b.TokenBucket
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestThrottle(t *testing.T) {
+	ws := NewWebService()
+	ws.RateLimit = &RateLimit{Rate: 1, Burst: 3}
+
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wc.SetRateLimit(RateLimit{Rate: 1, Burst: 2, Key: ClientIPKey})
+	ws.AddWebController(wc)
+
+	other := NewWebController("/others")
+	other.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(other)
+
+	h := ws.Handler()
+	get := func(path string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("/things", "10.0.0.1"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d, expected %d", i, rec.Code, http.StatusOK)
+		}
+	}
+
+	rec := get("/things", "10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("a request over the route limit = %d Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	if rec := get("/things", "10.0.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("another client = %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	// The global bucket of 10.0.0.1 has been emptied by its requests to
+	// /things
+	if rec := get("/others", "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("a request over the global limit = %d, expected %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	if rec := get(HeartbeatRoute, "10.0.0.1"); rec.Code != http.StatusOK {
+		t.Errorf("the operational routes should not be limited, got %d", rec.Code)
+	}
+}
+
+func TestCallerKeyIgnoresCredentials(t *testing.T) {
+	h := Throttle(RateLimit{Rate: 1, Burst: 1})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	codes := []int{}
+	for _, key := range []string{"random-1", "random-2"} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Api-Key", key)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	if codes[1] != http.StatusTooManyRequests {
+		t.Errorf("requests with unauthenticated credentials = %v, expected the second limited", codes)
+	}
+
+	req := WithIdentity(httptest.NewRequest("GET", "/things", nil), Identity{Subject: "robot"})
+	req.RemoteAddr = "10.0.0.1:1234"
+	if key := CallerKey(req); key != "caller:robot" {
+		t.Errorf("CallerKey of an authenticated request = %q, expected caller:robot", key)
+	}
+}
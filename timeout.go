@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/render"
+)
+
+// TimeoutStatus is the status returned when a controller's handler exceeds
+// the timeout set with SetTimeout. Services behind a proxy may prefer
+// http.StatusGatewayTimeout.
+var TimeoutStatus = http.StatusServiceUnavailable
+
+// SetTimeout limits the time the controller's handlers may take. A handler
+// that exceeds it has its request context cancelled, and the client receives
+// a JSON error with TimeoutStatus. Responses are buffered until the handler
+// returns, so SetTimeout is not suitable for controllers that stream. Writes
+// after the timeout return http.ErrHandlerTimeout, and a panic after the
+// timeout is reported as Recover reports panics.
+func (wc *WebController) SetTimeout(d time.Duration) {
+	wc.timeout = d
+}
+
+// withTimeout wraps h with the controller's timeout, if one is set
+func (wc *WebController) withTimeout(
+	h func(w http.ResponseWriter, req *http.Request),
+) func(w http.ResponseWriter, req *http.Request) {
+	if wc.timeout <= 0 {
+		return h
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), wc.timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				if !tw.timedOut {
+					panicked <- p
+					return
+				}
+
+				// Nothing waits for a handler that has timed out, so that
+				// its panic is reported here rather than by Recover
+				if p != http.ErrAbortHandler {
+					reportPanic(req, p, debug.Stack())
+				}
+			}()
+			h(tw, req.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			for k, v := range tw.header {
+				w.Header()[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			select {
+			case p := <-panicked:
+				// The handler panicked as it timed out
+				panic(p)
+			default:
+			}
+			tw.timedOut = true
+
+			// A client that has gone away is not sent the timeout error
+			if ClientCancelled(req) {
+				return
+			}
+
+			render.Error(
+				w,
+				TimeoutStatus,
+				fmt.Errorf("%s %s timed out", req.Method, req.URL.Path),
+			)
+		}
+	}
+}
+
+// timeoutWriter buffers a response until the handler returns, and discards
+// anything written after the timeout
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// Header is part of the http.ResponseWriter interface
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader is part of the http.ResponseWriter interface
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// Write is part of the http.ResponseWriter interface
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	return tw.buf.Write(b)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestTimeout(t *testing.T) {
+	late := make(chan error, 1)
+
+	wc := NewWebController("/slow")
+	wc.SetTimeout(10 * time.Millisecond)
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("fast") != "" {
+			w.Header().Set("X-Fast", "yes")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("done"))
+			return
+		}
+
+		<-req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := w.Write([]byte("too late"))
+		late <- err
+	})
+	h := http.HandlerFunc(GetHandler(wc))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/slow?fast=1", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "done" || rec.Header().Get("X-Fast") != "yes" {
+		t.Errorf("a handler within the timeout = %d %q, expected its response", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if rec.Code != TimeoutStatus || !strings.Contains(rec.Body.String(), "timed out") {
+		t.Errorf("a handler over the timeout = %d %q, expected %d", rec.Code, rec.Body.String(), TimeoutStatus)
+	}
+
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Errorf("a write after the timeout = %v, expected http.ErrHandlerTimeout", err)
+	}
+	if strings.Contains(rec.Body.String(), "too late") {
+		t.Errorf("a write after the timeout should be discarded: %q", rec.Body.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that may be written by another goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	var out syncBuffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	wc := NewWebController("/slow")
+	wc.SetTimeout(10 * time.Millisecond)
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("fast") != "" {
+			panic("before the timeout")
+		}
+
+		<-req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		panic("after the timeout")
+	})
+	h := http.HandlerFunc(GetHandler(wc))
+
+	func() {
+		defer func() {
+			if p := recover(); p != "before the timeout" {
+				t.Errorf("a panic within the timeout = %v, expected it to be passed on", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow?fast=1", nil))
+	}()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if rec.Code != TimeoutStatus {
+		t.Errorf("a handler over the timeout = %d, expected %d", rec.Code, TimeoutStatus)
+	}
+
+	for i := 0; i < 100 && !strings.Contains(out.String(), "after the timeout"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "after the timeout") || !strings.Contains(out.String(), "timeout_test.go") {
+		t.Errorf("a panic after the timeout and its stack should be logged: %q", out.String())
+	}
+}
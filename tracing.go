@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/service/tracing"
+)
+
+// TraceRequests is middleware that starts a server span for each request,
+// continuing the trace of the caller if it sent a traceparent header, and
+// stores it in the request context so that handlers can start child spans
+// with tracing.Start, and calls made with client.Transport carry the trace.
+// The span is named by the method and route, and has the method, path,
+// route and status as attributes. Requests that fail with a status of 500 or
+// above are marked as errors. It is added by WebService.Tracing.
+func TraceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, span := tracing.StartServer(req.Context(), req.Method, req.Header)
+		defer span.End()
+
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		SetTag(req, "trace_id", span.Context().TraceID.String())
+
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, req.WithContext(ctx))
+
+		status := rw.Status()
+		if ClientCancelled(req) {
+			status = StatusClientClosedRequest
+		}
+
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%s", http.StatusText(status)))
+		}
+	})
+}
+
+// traceRoute returns the handler for a route wrapped so that the span of
+// each request is named by its route, rather than its path, so that spans
+// can be grouped
+func traceRoute(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if span := tracing.FromContext(req.Context()); span != nil {
+			span.SetName(req.Method + " " + route)
+			span.SetAttribute("http.route", route)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+)
+
+// These limit the spans held for export. Spans are exported in batches of up
+// to MaxExportBatch, at least every ExportInterval, and spans ended while
+// MaxQueueSize are waiting are dropped and counted in the
+// tracing_spans_dropped metric.
+var (
+	MaxExportBatch = 512
+	MaxQueueSize   = 2048
+	ExportInterval = 5 * time.Second
+)
+
+// SpanData is a span that has ended, as it is exported
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string
+}
+
+// Exporter sends spans to a tracing backend
+type Exporter interface {
+	ExportSpans(spans []SpanData) error
+}
+
+// processor batches the spans ended for an exporter
+type processor struct {
+	exporter Exporter
+	queue    chan SpanData
+	flush    chan chan struct{}
+	stop     chan struct{}
+}
+
+var (
+	mu      sync.Mutex
+	current *processor
+)
+
+// SetExporter sets the exporter that sampled spans are sent to, flushing the
+// spans held for any previous exporter. A nil exporter, the default, means
+// spans are not exported.
+func SetExporter(e Exporter) {
+	var p *processor
+	if e != nil {
+		p = &processor{
+			exporter: e,
+			queue:    make(chan SpanData, MaxQueueSize),
+			flush:    make(chan chan struct{}),
+			stop:     make(chan struct{}),
+		}
+		go p.run()
+	}
+
+	mu.Lock()
+	old := current
+	current = p
+	mu.Unlock()
+
+	if old != nil {
+		old.wait()
+		close(old.stop)
+	}
+}
+
+// Flush exports the spans that have ended and waits for the export to
+// complete. It should be called before the process exits.
+func Flush() {
+	mu.Lock()
+	p := current
+	mu.Unlock()
+
+	if p != nil {
+		p.wait()
+	}
+}
+
+// export queues a span for the current exporter
+func export(s SpanData) {
+	mu.Lock()
+	p := current
+	mu.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	select {
+	case p.queue <- s:
+	default:
+		metrics.Inc("tracing_spans_dropped")
+	}
+}
+
+// wait asks run to export the queued spans and waits until it has
+func (p *processor) wait() {
+	done := make(chan struct{})
+	p.flush <- done
+	<-done
+}
+
+// run collects the queued spans into batches and exports them until stopped
+func (p *processor) run() {
+	t := time.NewTicker(ExportInterval)
+	defer t.Stop()
+
+	batch := []SpanData{}
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := p.exporter.ExportSpans(batch); err != nil {
+			metrics.Add("tracing_spans_dropped", int64(len(batch)))
+			log.Warningf("cannot export %d spans: %s", len(batch), err)
+		}
+		batch = []SpanData{}
+	}
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= MaxExportBatch {
+				send()
+			}
+
+		case <-t.C:
+			send()
+
+		case done := <-p.flush:
+			for len(p.queue) > 0 {
+				batch = append(batch, <-p.queue)
+				if len(batch) >= MaxExportBatch {
+					send()
+				}
+			}
+			send()
+			close(done)
+
+		case <-p.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector with the OTLP/HTTP
+// protocol, encoded as JSON
+type OTLPExporter struct {
+	// URL is the traces endpoint, i.e. http://localhost:4318/v1/traces
+	URL string
+
+	// Headers are added to each request, i.e. for authentication
+	Headers map[string]string
+
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+
+	// Client makes the requests, or a client with a 10s timeout if nil
+	Client *http.Client
+}
+
+// NewOTLPExporterFromEnv returns an OTLPExporter configured by the standard
+// OpenTelemetry environment variables, or nil if none is configured:
+//
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT the traces endpoint
+//	OTEL_EXPORTER_OTLP_ENDPOINT        the base URL, to which /v1/traces is added
+//	OTEL_EXPORTER_OTLP_HEADERS         headers, as key=value,key=value
+//	OTEL_EXPORTER_OTLP_PROTOCOL        must be http/json if set
+//	OTEL_SERVICE_NAME                  the service name, or the binary name
+//	OTEL_TRACES_SAMPLER_ARG            the SampleRatio of traceidratio samplers
+//	OTEL_SDK_DISABLED                  true disables the exporter
+func NewOTLPExporterFromEnv() (*OTLPExporter, error) {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+
+	e := &OTLPExporter{
+		URL:         os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		Headers:     map[string]string{},
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+	}
+
+	if e.URL == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil, nil
+		}
+		e.URL = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" && p != "http/json" {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL (%s) is not supported, only http/json", p)
+	}
+
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS must be key=value pairs")
+		}
+
+		k, _ := url.QueryUnescape(strings.TrimSpace(kv[0]))
+		v, _ := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		e.Headers[k] = v
+	}
+
+	if e.ServiceName == "" {
+		e.ServiceName = filepath.Base(os.Args[0])
+	}
+
+	switch os.Getenv("OTEL_TRACES_SAMPLER") {
+	case "traceidratio", "parentbased_traceidratio":
+		ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be a ratio from 0 to 1")
+		}
+		SampleRatio = ratio
+	}
+
+	return e, nil
+}
+
+// ExportSpans is part of the Exporter interface
+func (e *OTLPExporter) ExportSpans(spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded %s", e.URL, resp.Status)
+	}
+
+	return nil
+}
+
+// The types below are the parts of the OTLP JSON encoding that are used
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// request returns the OTLP request for spans
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+		}
+
+		if s.Parent != (SpanID{}) {
+			span.ParentSpanID = s.Parent.String()
+		}
+
+		if s.Error != "" {
+			// STATUS_CODE_ERROR
+			span.Status = &otlpStatus{Code: 2, Message: s.Error}
+		}
+
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: attributes(map[string]interface{}{
+			"service.name": e.ServiceName,
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/cloudflare/service/tracing"},
+			Spans: out,
+		}},
+	}}}
+}
+
+// attributes returns the OTLP encoding of attributes, in the order of their
+// keys
+func attributes(m map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, 0, len(m))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := m[k].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+
+		out = append(out, otlpAttribute{Key: k, Value: value})
+	}
+
+	return out
+}
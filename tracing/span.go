@@ -0,0 +1,289 @@
+// Package tracing records spans for the requests a service handles and the
+// work they do, propagates them between services with the W3C traceparent
+// header, and exports them to an OpenTelemetry collector over OTLP/HTTP.
+//
+// Spans are only exported once an exporter is set, i.e. from the standard
+// OTEL_ environment variables with NewOTLPExporterFromEnv, but the trace
+// context is propagated regardless. Handlers start child spans with Start:
+//
+//	ctx, span := tracing.Start(req.Context(), "load user")
+//	defer span.End()
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header that carries the trace
+// and the parent span of a request
+const TraceparentHeader = "Traceparent"
+
+// SampleRatio is the fraction of new traces that are sampled, and so
+// exported. Spans that continue a trace follow the decision of its caller.
+var SampleRatio = 1.0
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the ID in hex
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the ID in hex
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span that is propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if the trace and span IDs are not zero
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent returns the value of the traceparent header for sc
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses the value of a traceparent header, returning false
+// if it is not valid
+func ParseTraceparent(value string) (SpanContext, bool) {
+	sc := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	return sc, sc.IsValid()
+}
+
+// SpanKind is the role of a span, with the values used by OTLP
+type SpanKind int
+
+// These constants identify the kinds of span
+const (
+	// SpanKindInternal is work within a service
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is the handling of a request
+	SpanKindServer SpanKind = 2
+	// SpanKindClient is a request to another service
+	SpanKindClient SpanKind = 3
+)
+
+// Span is a timed operation within a trace. The methods of a nil Span do
+// nothing, so that code may trace whether or not a span was started.
+type Span struct {
+	mu         sync.Mutex
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// contextKey is the type of the keys this package stores in a context
+type contextKey int
+
+const spanKey contextKey = 0
+
+// FromContext returns the span carried by ctx, or nil if there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// Start starts a span that is a child of the span carried by ctx, or the
+// root of a new trace if there is none, and returns a copy of ctx that
+// carries it. The span must be ended with End.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, SpanKindInternal, SpanContext{})
+}
+
+// StartServer starts a span for the handling of a request, which continues
+// the trace of the caller if the header holds a valid traceparent
+func StartServer(ctx context.Context, name string, header http.Header) (context.Context, *Span) {
+	remote, _ := ParseTraceparent(header.Get(TraceparentHeader))
+	return start(ctx, name, SpanKindServer, remote)
+}
+
+// StartClient starts a span for a request to another service. The request
+// should carry the traceparent of the span, see Inject.
+func StartClient(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, SpanKindClient, SpanContext{})
+}
+
+// Inject sets the traceparent header for the span carried by ctx, if any
+func Inject(ctx context.Context, header http.Header) {
+	if s := FromContext(ctx); s != nil {
+		header.Set(TraceparentHeader, s.Context().Traceparent())
+	}
+}
+
+// start starts a span whose parent is remote if that is valid, or else the
+// span carried by ctx
+func start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	s := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+
+	parent := remote
+	if !parent.IsValid() {
+		if p := FromContext(ctx); p != nil {
+			parent = p.Context()
+		}
+	}
+
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.context.TraceID[:])
+		s.context.Sampled = mathrand.Float64() < SampleRatio
+	}
+	rand.Read(s.context.SpanID[:])
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Context returns the SpanContext of the span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.context
+}
+
+// SetName replaces the name of the span, i.e. once the route of a request
+// is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute adds an attribute to the span. Values should be strings,
+// booleans, integers or floats, and others are formatted as strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End ends the span and, if it is sampled, queues it for export. Only the
+// first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	data := s.data()
+	s.mu.Unlock()
+
+	if data.Context.Sampled {
+		export(data)
+	}
+}
+
+// String returns the name and IDs of the span
+func (s *Span) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("%s trace=%s span=%s", s.name, s.context.TraceID, s.context.SpanID)
+}
+
+// data returns a copy of the span for export. s.mu is held.
+func (s *Span) data() SpanData {
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+
+	return SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		Context:    s.context,
+		Parent:     s.parent,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: attributes,
+		Error:      s.err,
+	}
+}
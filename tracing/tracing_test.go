@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(value)
+	if !ok || !sc.Sampled || sc.Traceparent() != value {
+		t.Errorf("ParseTraceparent(%q) = %+v, %t", value, sc, ok)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("ParseTraceparent(%q) should not be valid", invalid)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := otlpRequest{}
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			t.Error(err)
+		}
+		requests <- r
+	}))
+	defer collector.Close()
+
+	SetExporter(&OTLPExporter{URL: collector.URL + "/v1/traces", ServiceName: "test"})
+	defer SetExporter(nil)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := StartServer(context.Background(), "GET /things", header)
+	_, child := Start(ctx, "load things")
+	child.SetAttribute("count", 3)
+	child.End()
+	server.End()
+
+	if child.Context().TraceID != server.Context().TraceID || server.Context().TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("spans should continue the trace of the caller: %s, %s", server, child)
+	}
+
+	Flush()
+
+	r := <-requests
+	if len(r.ResourceSpans) != 1 || len(r.ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Fatalf("the collector received %+v, expected 2 spans", r)
+	}
+	spans := r.ResourceSpans[0].ScopeSpans[0].Spans
+	if spans[0].Name != "load things" || spans[0].ParentSpanID != server.Context().SpanID.String() {
+		t.Errorf("the child span = %+v, expected a child of %s", spans[0], server)
+	}
+	if spans[1].ParentSpanID != "00f067aa0ba902b7" || spans[1].Kind != SpanKindServer {
+		t.Errorf("the server span = %+v, expected a child of the caller's span", spans[1])
+	}
+	if len(spans[0].Attributes) != 1 || spans[0].Attributes[0].Value["intValue"] != "3" {
+		t.Errorf("the child span has attributes %+v", spans[0].Attributes)
+	}
+}
@@ -0,0 +1,220 @@
+package transcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/cloudflare/service"
+	"github.com/cloudflare/service/render"
+)
+
+// populateProto fills a protobuf request message as populate does. Each part
+// of the request is unmarshalled into a new message with the proto3 JSON
+// mapping, so that int64 values may be strings, enums are named, and well
+// known types such as Timestamp take their JSON form, and is then merged into
+// the request message. A part that is invalid leaves the message unchanged.
+func populateProto(req *http.Request, m Method, msg proto.Message) error {
+	md := msg.ProtoReflect().Descriptor()
+	bound := make(map[string]bool)
+
+	switch m.Body {
+	case "":
+	case "*":
+		body, err := readJSON(req)
+		if err != nil {
+			return err
+		}
+		if err := mergeJSON(msg, nil, body); err != nil {
+			return err
+		}
+	default:
+		fields, err := protoFields(md, strings.Split(m.Body, "."))
+		if err != nil {
+			return err
+		}
+
+		body, err := readJSON(req)
+		if err != nil {
+			return err
+		}
+		if err := mergeJSON(msg, fields, body); err != nil {
+			return err
+		}
+		bound[m.Body] = true
+	}
+
+	for name, value := range service.Vars(req) {
+		if err := setProtoField(msg, name, value); err != nil {
+			return err
+		}
+		bound[name] = true
+	}
+
+	if m.Body == "*" {
+		return nil
+	}
+
+	for name, values := range req.URL.Query() {
+		if bound[name] {
+			continue
+		}
+
+		if _, err := protoFields(md, strings.Split(name, ".")); err != nil {
+			continue
+		}
+
+		for _, value := range values {
+			if err := setProtoField(msg, name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// protoFields resolves a path of proto or JSON field names to the fields of a
+// message descriptor
+func protoFields(md protoreflect.MessageDescriptor, path []string) ([]protoreflect.FieldDescriptor, error) {
+	fields := make([]protoreflect.FieldDescriptor, 0, len(path))
+
+	for i, name := range path {
+		if md == nil {
+			return nil, fmt.Errorf("field %s is not a message", path[i-1])
+		}
+
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field %s does not exist", name)
+		}
+
+		fields = append(fields, fd)
+
+		md = nil
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			md = fd.Message()
+		}
+	}
+
+	return fields, nil
+}
+
+// setProtoField parses a string value into the field identified by a dotted
+// path of proto or JSON names. Repeated fields have the value appended.
+func setProtoField(msg proto.Message, name string, value string) error {
+	fields, err := protoFields(msg.ProtoReflect().Descriptor(), strings.Split(name, "."))
+	if err != nil {
+		return err
+	}
+
+	fd := fields[len(fields)-1]
+	if fd.IsMap() {
+		return fmt.Errorf("%s cannot be set from a path or query parameter", name)
+	}
+
+	v, err := jsonValue(fd, value)
+	if err != nil {
+		return fmt.Errorf("%s (%s) %s", name, value, err)
+	}
+
+	if fd.IsList() {
+		v = append(append([]byte("["), v...), ']')
+	}
+
+	if err := mergeJSON(msg, fields, v); err != nil {
+		return fmt.Errorf("%s (%s) is not a valid %s", name, value, fd.Kind())
+	}
+
+	return nil
+}
+
+// jsonValue returns the proto3 JSON of a path or query parameter for a field
+func jsonValue(fd protoreflect.FieldDescriptor, value string) ([]byte, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("is not a boolean")
+		}
+		return []byte(strconv.FormatBool(b)), nil
+
+	case protoreflect.EnumKind:
+		// Enums are given by name or by number
+		if _, err := strconv.ParseInt(value, 10, 32); err == nil {
+			return []byte(value), nil
+		}
+	}
+
+	// Numbers, bytes and well known types such as Timestamp may all be
+	// given as JSON strings
+	return json.Marshal(value)
+}
+
+// mergeJSON unmarshals the JSON of the field at the end of a path, or of the
+// whole message if the path is empty, into a new message and merges it into
+// msg
+func mergeJSON(msg proto.Message, path []protoreflect.FieldDescriptor, value []byte) error {
+	for i := len(path) - 1; i >= 0; i-- {
+		name, _ := json.Marshal(path[i].JSONName())
+		value = []byte(fmt.Sprintf("{%s:%s}", name, value))
+	}
+
+	part := msg.ProtoReflect().New().Interface()
+	if err := protojson.Unmarshal(value, part); err != nil {
+		return err
+	}
+
+	proto.Merge(msg, part)
+
+	return nil
+}
+
+// readJSON reads a JSON request body, returning an empty object if there is
+// no body
+func readJSON(req *http.Request) ([]byte, error) {
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != "application/json" {
+			return nil, fmt.Errorf("request body must be application/json")
+		}
+	}
+
+	defer req.Body.Close()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return []byte("{}"), nil
+	}
+
+	return body, nil
+}
+
+// writeProto renders a protobuf message with the proto3 JSON mapping
+func writeProto(w http.ResponseWriter, status int, msg proto.Message) {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		render.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	render.SetHeaders(w)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,336 @@
+// Package transcode exposes unary RPC methods, such as those of a gRPC service
+// defined in protobuf, as JSON/HTTP controllers on a WebService in the style
+// of grpc-gateway. Each Method mirrors a google.api.http annotation:
+//
+//	rpc GetZone(GetZoneRequest) returns (Zone) {
+//	    option (google.api.http) = { get: "/v1/zones/{zone_id}" };
+//	}
+//
+// is registered as:
+//
+//	transcode.Method{
+//	    HTTPMethod: service.Get,
+//	    Pattern:    "/v1/zones/{zone_id}",
+//	    NewRequest: func() interface{} { return &pb.GetZoneRequest{} },
+//	    Invoke: func(ctx context.Context, req interface{}) (interface{}, error) {
+//	        return server.GetZone(ctx, req.(*pb.GetZoneRequest))
+//	    },
+//	}
+//
+// Request messages are populated from the JSON body, path variables and query
+// parameters. Protobuf messages are read and written with the proto3 JSON
+// mapping, and their fields are named by either their proto or their JSON
+// names. Other messages are decoded with the decoder package and rendered with
+// the render package, and their fields are named by their json tags.
+//
+// A path or query parameter that cannot be set leaves the request message as
+// it was, and query parameters that name no field are ignored.
+package transcode
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cloudflare/service"
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/render"
+)
+
+// Method describes a unary RPC method and its HTTP binding
+type Method struct {
+	// HTTPMethod is one of the service method iota values, i.e. service.Get
+	HTTPMethod int
+
+	// Pattern is the route, with path variables naming request fields. Nested
+	// fields are named with dots, i.e. "/v1/zones/{zone.id}".
+	Pattern string
+
+	// Body is "*" to decode the request body into the whole request message,
+	// the JSON name of a field to decode it into that field, or empty if the
+	// method takes no body
+	Body string
+
+	// NewRequest returns a pointer to a new, empty request message
+	NewRequest func() interface{}
+
+	// Invoke calls the method
+	Invoke func(ctx context.Context, req interface{}) (interface{}, error)
+}
+
+// StatusCoder may be implemented by errors returned from Invoke to choose the
+// HTTP status of the response
+type StatusCoder interface {
+	HTTPStatus() int
+}
+
+// ErrorStatus returns the HTTP status for an error returned from Invoke. It
+// may be replaced, i.e. to translate gRPC status codes.
+var ErrorStatus = func(err error) int {
+	if sc, ok := err.(StatusCoder); ok {
+		return sc.HTTPStatus()
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Register adds a WebController to ws for each distinct pattern in methods
+func Register(ws *service.WebService, methods ...Method) {
+	controllers := make(map[string]*service.WebController)
+	order := []string{}
+
+	for _, m := range methods {
+		wc, ok := controllers[m.Pattern]
+		if !ok {
+			c := service.NewWebController(m.Pattern)
+			wc = &c
+			controllers[m.Pattern] = wc
+			order = append(order, m.Pattern)
+		}
+
+		wc.AddMethodHandler(m.HTTPMethod, Handler(m))
+	}
+
+	for _, pattern := range order {
+		ws.AddWebController(*controllers[pattern])
+	}
+}
+
+// Handler returns the HTTP handler that transcodes requests for a method
+func Handler(m Method) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		msg := m.NewRequest()
+
+		if err := populate(req, m, msg); err != nil {
+			render.Error(w, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := m.Invoke(req.Context(), msg)
+		if err != nil {
+			status := ErrorStatus(err)
+			if status >= http.StatusInternalServerError {
+				service.ReportError(req, err)
+			}
+			render.Error(w, status, err)
+			return
+		}
+
+		if pm, ok := resp.(proto.Message); ok {
+			writeProto(w, http.StatusOK, pm)
+			return
+		}
+
+		render.JSON(w, http.StatusOK, resp)
+	}
+}
+
+// populate fills the request message from the body, path variables and query
+func populate(req *http.Request, m Method, msg interface{}) error {
+	if pm, ok := msg.(proto.Message); ok {
+		return populateProto(req, m, pm)
+	}
+
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("request message must be a pointer to a struct")
+	}
+
+	bound := make(map[string]bool)
+
+	switch m.Body {
+	case "":
+	case "*":
+		if err := decoder.Decode(req, msg); err != nil {
+			return err
+		}
+	default:
+		index, t, err := fieldIndex(v.Elem().Type(), strings.Split(m.Body, "."))
+		if err != nil {
+			return err
+		}
+
+		body := reflect.New(t)
+		if err := decoder.Decode(req, body.Interface()); err != nil {
+			return err
+		}
+		fieldByIndex(v.Elem(), index).Set(body.Elem())
+		bound[m.Body] = true
+	}
+
+	for name, value := range service.Vars(req) {
+		if err := setField(v.Elem(), name, value); err != nil {
+			return err
+		}
+		bound[name] = true
+	}
+
+	// As with grpc-gateway, query parameters populate any field not bound
+	// to the path or body
+	if m.Body != "*" {
+		if err := setQuery(v.Elem(), req.URL.Query(), bound); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setQuery sets the fields named by query parameters, ignoring parameters
+// which do not name a field
+func setQuery(v reflect.Value, query url.Values, bound map[string]bool) error {
+	for name, values := range query {
+		if bound[name] {
+			continue
+		}
+
+		if _, _, err := fieldIndex(v.Type(), strings.Split(name, ".")); err != nil {
+			continue
+		}
+
+		for _, value := range values {
+			if err := setField(v, name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldIndex resolves a path of JSON names to the indexes of the fields of a
+// struct type, and returns the type of the field. Nothing is allocated, so
+// that resolving an invalid path has no effect on a message.
+func fieldIndex(t reflect.Type, path []string) ([]int, reflect.Type, error) {
+	index := make([]int, 0, len(path))
+
+	for _, name := range path {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return nil, nil, fmt.Errorf("field %s is not a message", name)
+		}
+
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag == name {
+				index = append(index, i)
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, nil, fmt.Errorf("field %s does not exist", name)
+		}
+	}
+
+	return index, t, nil
+}
+
+// fieldByIndex returns the field of a struct found by fieldIndex, allocating
+// nested message pointers as required
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+
+		v = v.Field(i)
+	}
+
+	return v
+}
+
+// setField parses a string value into the field identified by a dotted path
+// of JSON names. Repeated fields have the value appended. The message is only
+// changed once the path and value are known to be valid.
+func setField(v reflect.Value, name string, value string) error {
+	index, t, err := fieldIndex(v.Type(), strings.Split(name, "."))
+	if err != nil {
+		return err
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		elem := reflect.New(t.Elem()).Elem()
+		if err := parseInto(elem, name, value); err != nil {
+			return err
+		}
+
+		field := fieldByIndex(v, index)
+		field.Set(reflect.Append(field, elem))
+		return nil
+	}
+
+	parsed := reflect.New(t).Elem()
+	if err := parseInto(parsed, name, value); err != nil {
+		return err
+	}
+	fieldByIndex(v, index).Set(parsed)
+
+	return nil
+}
+
+// parseInto parses a string into a scalar value
+func parseInto(field reflect.Value, name string, value string) error {
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s (%s) is not a boolean", name, value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s (%s) is not a number", name, value)
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s (%s) is not a number", name, value)
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s (%s) is not a number", name, value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		// bytes fields are base64 encoded as in the proto3 JSON mapping
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			if b, err = base64.URLEncoding.DecodeString(value); err != nil {
+				return fmt.Errorf("%s (%s) is not base64 encoded", name, value)
+			}
+		}
+		field.SetBytes(b)
+	default:
+		return fmt.Errorf("%s cannot be set from a path or query parameter", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/cloudflare/service"
+)
+
+type zone struct {
+	ID   string `json:"id"`
+	Plan string `json:"plan"`
+}
+
+type getRecord struct {
+	Name   string   `json:"name"`
+	Zone   *zone    `json:"zone"`
+	Limit  int      `json:"limit"`
+	Tags   []string `json:"tags"`
+	Secret []byte   `json:"secret"`
+}
+
+// serve registers m on a WebService and serves a request to it, returning
+// the response and the request message that was invoked, if any
+func serve(m Method, target string, body string) (*httptest.ResponseRecorder, interface{}) {
+	var invoked interface{}
+	invoke := m.Invoke
+	m.Invoke = func(ctx context.Context, req interface{}) (interface{}, error) {
+		invoked = req
+		if invoke != nil {
+			return invoke(ctx, req)
+		}
+		return req, nil
+	}
+
+	ws := service.NewWebService()
+	Register(&ws, m)
+
+	req := httptest.NewRequest(service.GetMethodName(m.HTTPMethod), target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, req)
+
+	return rec, invoked
+}
+
+func TestStructBinding(t *testing.T) {
+	newRequest := func() interface{} { return &getRecord{} }
+
+	tests := []struct {
+		name     string
+		method   Method
+		target   string
+		body     string
+		expected getRecord
+	}{
+		{
+			"path",
+			Method{HTTPMethod: service.Get, Pattern: "/zones/{zone.id}/records/{name}"},
+			"/zones/z1/records/www",
+			"",
+			getRecord{Name: "www", Zone: &zone{ID: "z1"}},
+		},
+		{
+			"query",
+			Method{HTTPMethod: service.Get, Pattern: "/records"},
+			"/records?limit=5&tags=a&tags=b&zone.plan=pro&secret=aGk%3D&unknown=1",
+			"",
+			getRecord{Limit: 5, Tags: []string{"a", "b"}, Zone: &zone{Plan: "pro"}, Secret: []byte("hi")},
+		},
+		{
+			"unknown query parameters leave the message unchanged",
+			Method{HTTPMethod: service.Get, Pattern: "/records"},
+			"/records?zone.nope=1&nope.id=1",
+			"",
+			getRecord{},
+		},
+		{
+			"body",
+			Method{HTTPMethod: service.Post, Pattern: "/records/{name}", Body: "*"},
+			"/records/www?limit=5",
+			`{"limit": 3, "zone": {"id": "z1"}}`,
+			getRecord{Name: "www", Limit: 3, Zone: &zone{ID: "z1"}},
+		},
+		{
+			"body field",
+			Method{HTTPMethod: service.Post, Pattern: "/records/{name}", Body: "zone"},
+			"/records/www?limit=5",
+			`{"id": "z1", "plan": "free"}`,
+			getRecord{Name: "www", Limit: 5, Zone: &zone{ID: "z1", Plan: "free"}},
+		},
+	}
+
+	for _, test := range tests {
+		test.method.NewRequest = newRequest
+		rec, invoked := serve(test.method, test.target, test.body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: %d %s", test.name, rec.Code, rec.Body.String())
+			continue
+		}
+
+		actual, _ := json.Marshal(invoked)
+		expected, _ := json.Marshal(test.expected)
+		if string(actual) != string(expected) {
+			t.Errorf("%s: bound %s, expected %s", test.name, actual, expected)
+		}
+	}
+}
+
+func TestStructBindingErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Method
+		target string
+		body   string
+	}{
+		{"invalid number", Method{HTTPMethod: service.Get, Pattern: "/records"}, "/records?limit=many", ""},
+		{"invalid base64", Method{HTTPMethod: service.Get, Pattern: "/records"}, "/records?secret=%25", ""},
+		{"path of a missing field", Method{HTTPMethod: service.Get, Pattern: "/records/{nope}"}, "/records/www", ""},
+		{"path beneath a scalar", Method{HTTPMethod: service.Get, Pattern: "/records/{name.id}"}, "/records/www", ""},
+		{"invalid body", Method{HTTPMethod: service.Post, Pattern: "/records", Body: "*"}, "/records", `{"limit": "x"}`},
+		{"body of a missing field", Method{HTTPMethod: service.Post, Pattern: "/records", Body: "nope"}, "/records", `{}`},
+	}
+
+	for _, test := range tests {
+		test.method.NewRequest = func() interface{} { return &getRecord{} }
+		rec, invoked := serve(test.method, test.target, test.body)
+		if rec.Code != http.StatusBadRequest || invoked != nil {
+			t.Errorf("%s: %d, expected %d without invoking the method", test.name, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSetFieldLeavesMessageOnError(t *testing.T) {
+	msg := &getRecord{}
+	v := reflect.ValueOf(msg).Elem()
+
+	if err := setField(v, "zone.nope", "1"); err == nil {
+		t.Error("setting a missing field should fail")
+	}
+	if err := setQuery(v, map[string][]string{"zone.nope": {"1"}}, nil); err != nil {
+		t.Error(err)
+	}
+	if msg.Zone != nil {
+		t.Errorf("an invalid path should not allocate the nested message, got %+v", msg.Zone)
+	}
+}
+
+func TestProtoBinding(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     Method
+		newRequest func() proto.Message
+		target     string
+		body       string
+		expected   proto.Message
+	}{
+		{
+			"path and query by proto and JSON names",
+			Method{HTTPMethod: service.Get, Pattern: "/fields/{name}"},
+			func() proto.Message { return &typepb.Field{} },
+			"/fields/id?kind=TYPE_INT64&number=3&packed=true&json_name=i&typeUrl=u&unknown=1",
+			"",
+			&typepb.Field{Name: "id", Kind: typepb.Field_TYPE_INT64, Number: 3, Packed: true, JsonName: "i", TypeUrl: "u"},
+		},
+		{
+			"enums by number and repeated messages",
+			Method{HTTPMethod: service.Get, Pattern: "/types/{name}"},
+			func() proto.Message { return &typepb.Type{} },
+			"/types/t?syntax=1&source_context.file_name=a.proto&oneofs=x&oneofs=y",
+			"",
+			&typepb.Type{
+				Name:          "t",
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+				SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+				Oneofs:        []string{"x", "y"},
+			},
+		},
+		{
+			"body with int64 as strings",
+			Method{HTTPMethod: service.Post, Pattern: "/options/{identifierValue}", Body: "*"},
+			func() proto.Message { return &descriptorpb.UninterpretedOption{} },
+			"/options/opt",
+			`{"negativeIntValue": "-5", "positiveIntValue": "7", "stringValue": "aGk="}`,
+			&descriptorpb.UninterpretedOption{
+				IdentifierValue:  proto.String("opt"),
+				NegativeIntValue: proto.Int64(-5),
+				PositiveIntValue: proto.Uint64(7),
+				StringValue:      []byte("hi"),
+			},
+		},
+		{
+			"body field",
+			Method{HTTPMethod: service.Post, Pattern: "/types/{name}", Body: "source_context"},
+			func() proto.Message { return &typepb.Type{} },
+			"/types/t?syntax=SYNTAX_PROTO3",
+			`{"fileName": "a.proto"}`,
+			&typepb.Type{
+				Name:          "t",
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+				SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		newRequest := test.newRequest
+		test.method.NewRequest = func() interface{} { return newRequest() }
+		rec, invoked := serve(test.method, test.target, test.body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: %d %s", test.name, rec.Code, rec.Body.String())
+			continue
+		}
+
+		if !proto.Equal(invoked.(proto.Message), test.expected) {
+			t.Errorf("%s: bound %v, expected %v", test.name, invoked, test.expected)
+		}
+	}
+}
+
+func TestProtoResponse(t *testing.T) {
+	m := Method{
+		HTTPMethod: service.Get,
+		Pattern:    "/options",
+		NewRequest: func() interface{} { return &descriptorpb.UninterpretedOption{} },
+		Invoke: func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &descriptorpb.UninterpretedOption{NegativeIntValue: proto.Int64(-5), AggregateValue: proto.String("a")}, nil
+		},
+	}
+
+	rec, _ := serve(m, "/options", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("%d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual["negativeIntValue"] != "-5" || actual["aggregateValue"] != "a" {
+		t.Errorf("response %s should have the proto3 JSON mapping", rec.Body.String())
+	}
+}
+
+func TestProtoBindingErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Method
+		target string
+		body   string
+	}{
+		{"invalid number", Method{HTTPMethod: service.Get, Pattern: "/fields"}, "/fields?number=many", ""},
+		{"invalid enum", Method{HTTPMethod: service.Get, Pattern: "/fields"}, "/fields?kind=TYPE_NOPE", ""},
+		{"invalid boolean", Method{HTTPMethod: service.Get, Pattern: "/fields"}, "/fields?packed=maybe", ""},
+		{"path of a missing field", Method{HTTPMethod: service.Get, Pattern: "/fields/{nope}"}, "/fields/x", ""},
+		{"path beneath a scalar", Method{HTTPMethod: service.Get, Pattern: "/fields/{name.id}"}, "/fields/x", ""},
+		{"unknown body field", Method{HTTPMethod: service.Post, Pattern: "/fields", Body: "*"}, "/fields", `{"nope": 1}`},
+		{"body of a missing field", Method{HTTPMethod: service.Post, Pattern: "/fields", Body: "nope"}, "/fields", `{}`},
+	}
+
+	for _, test := range tests {
+		test.method.NewRequest = func() interface{} { return &typepb.Field{} }
+		rec, invoked := serve(test.method, test.target, test.body)
+		if rec.Code != http.StatusBadRequest || invoked != nil {
+			t.Errorf("%s: %d, expected %d without invoking the method", test.name, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	msg := &typepb.Type{}
+	if err := setProtoField(msg, "source_context.file_name", "a.proto"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setProtoField(msg, "syntax", "SYNTAX_NOPE"); err == nil {
+		t.Error("setting an invalid enum should fail")
+	}
+	if msg.Syntax != typepb.Syntax_SYNTAX_PROTO2 || msg.SourceContext.GetFileName() != "a.proto" {
+		t.Errorf("an invalid value should leave the message unchanged, got %v", msg)
+	}
+}
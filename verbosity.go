@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/service/decoder"
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+)
+
+// LogVerbosityRoute is the path to the endpoint that raises the log
+// verbosity of matching requests for a while. It requires the DebugToken if
+// that is set, and is only served on AdminAddr or with the DebugToken.
+var LogVerbosityRoute string = `/_log/verbosity`
+
+// MaxLogOverrideDuration limits how long a log verbosity override may last
+var MaxLogOverrideDuration = time.Hour
+
+// LogOverride raises the log verbosity of the requests to a route, and/or of
+// the requests with a header, until it expires. It is created by a POST to
+// LogVerbosityRoute, i.e.
+//
+//	{"route": "/users/{id}", "level": "debug", "duration": "10m"}
+//
+// Handlers see the verbosity through the request context, and so must log
+// with the Context functions of the log package, such as log.DebugContext.
+type LogOverride struct {
+	ID       int64     `json:"id"`
+	Route    string    `json:"route,omitempty"`
+	Header   string    `json:"header,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Level    string    `json:"level"`
+	Duration string    `json:"duration,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// matches returns true if the override applies to a request to route
+func (o LogOverride) matches(route string, req *http.Request) bool {
+	if o.Route != "" && o.Route != route {
+		return false
+	}
+
+	if o.Header != "" && req.Header.Get(o.Header) != o.Value {
+		return false
+	}
+
+	return true
+}
+
+// logOverrides holds the log verbosity overrides of a WebService. It is
+// shared by copies of the WebService.
+type logOverrides struct {
+	mu        sync.RWMutex
+	overrides []LogOverride
+	nextID    int64
+
+	// n is the number of overrides, read without the lock so that requests
+	// pay nothing while there are none
+	n int32
+}
+
+// active returns the overrides that have not expired
+func (l *logOverrides) active() []LogOverride {
+	now := time.Now()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	active := []LogOverride{}
+	for _, o := range l.overrides {
+		if now.Before(o.Expires) {
+			active = append(active, o)
+		}
+	}
+
+	return active
+}
+
+// add validates and stores an override
+func (l *logOverrides) add(o LogOverride) (LogOverride, int, error) {
+	if o.Route == "" && o.Header == "" {
+		return o, http.StatusBadRequest,
+			fmt.Errorf("a route or a header is required")
+	}
+
+	if _, err := log.WithVerbosity(context.Background(), o.Level); err != nil {
+		return o, http.StatusBadRequest,
+			fmt.Errorf("level (%s) is not valid: %s", o.Level, err)
+	}
+
+	d, err := time.ParseDuration(o.Duration)
+	if err != nil || d <= 0 {
+		return o, http.StatusBadRequest,
+			fmt.Errorf("duration (%s) must be a positive duration such as 10m", o.Duration)
+	}
+
+	if d > MaxLogOverrideDuration {
+		return o, http.StatusBadRequest,
+			fmt.Errorf("duration (%s) cannot exceed %s", o.Duration, MaxLogOverrideDuration)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Expired overrides are discarded as new ones are added
+	now := time.Now()
+	overrides := []LogOverride{}
+	for _, e := range l.overrides {
+		if now.Before(e.Expires) {
+			overrides = append(overrides, e)
+		}
+	}
+
+	l.nextID++
+	o.ID = l.nextID
+	o.Expires = now.Add(d)
+	l.overrides = append(overrides, o)
+	atomic.StoreInt32(&l.n, int32(len(l.overrides)))
+
+	log.Warningf(
+		"log verbosity raised to %s for route=%q header=%q until %s",
+		o.Level, o.Route, o.Header, o.Expires.Format(time.RFC3339),
+	)
+
+	return o, http.StatusCreated, nil
+}
+
+// remove deletes the override with the id, or all overrides if id is zero
+func (l *logOverrides) remove(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	overrides := []LogOverride{}
+	for _, o := range l.overrides {
+		if id != 0 && o.ID != id {
+			overrides = append(overrides, o)
+		}
+	}
+	l.overrides = overrides
+	atomic.StoreInt32(&l.n, int32(len(l.overrides)))
+}
+
+// middleware returns the handler for a route wrapped so that requests that
+// match an override carry its verbosity in their context
+func (l *logOverrides) middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&l.n) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if level, ok := l.level(route, req); ok {
+			if ctx, err := log.WithVerbosity(req.Context(), level); err == nil {
+				req = req.WithContext(ctx)
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// level returns the level of the first active override that matches a
+// request to route
+func (l *logOverrides) level(route string, req *http.Request) (string, bool) {
+	now := time.Now()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, o := range l.overrides {
+		if now.Before(o.Expires) && o.matches(route, req) {
+			return o.Level, true
+		}
+	}
+
+	return "", false
+}
+
+// handler serves LogVerbosityRoute: GET lists the active overrides, POST
+// adds one and DELETE removes the one given by ?id=, or all of them
+func (l *logOverrides) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			render.JSON(w, http.StatusOK, l.active())
+
+		case http.MethodPost:
+			o := LogOverride{}
+			if err := decoder.Decode(req, &o); err != nil {
+				render.Error(w, http.StatusBadRequest, err)
+				return
+			}
+
+			o, status, err := l.add(o)
+			if err != nil {
+				render.Error(w, status, err)
+				return
+			}
+
+			render.JSON(w, status, o)
+
+		case http.MethodDelete:
+			var id int64
+			if req.URL.Query().Get("id") != "" {
+				var err error
+				id, err = strconv.ParseInt(req.URL.Query().Get("id"), 10, 64)
+				if err != nil {
+					render.Error(w, http.StatusBadRequest,
+						fmt.Errorf("id (%s) is not a number", req.URL.Query().Get("id")))
+					return
+				}
+			}
+
+			l.remove(id)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			render.Error(w, http.StatusMethodNotAllowed,
+				fmt.Errorf("%s is not allowed", req.Method))
+		}
+	})
+}
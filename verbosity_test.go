@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/service/log"
+)
+
+func TestLogOverride(t *testing.T) {
+	ws := NewWebService()
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(nil)
+
+	wc := NewWebController("/things/{id}")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		log.DebugContext(req.Context(), "detail for", req.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(wc)
+
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, httptest.NewRequest("DELETE", LogVerbosityRoute, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE %s without a DebugToken or AdminAddr = %d, expected 404", LogVerbosityRoute, rec.Code)
+	}
+
+	ws.DebugToken = "s3cret"
+	handler := ws.Handler()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("DELETE", LogVerbosityRoute, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE %s without the token = %d, expected 401", LogVerbosityRoute, rec.Code)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Set("X-Debug-Token", "s3cret")
+		handler.ServeHTTP(w, req)
+	})
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", LogVerbosityRoute, strings.NewReader(
+		`{"route":"/things/{id}","level":"debug","duration":"2h"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("an override longer than MaxLogOverrideDuration = %d, expected %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", LogVerbosityRoute, strings.NewReader(
+		`{"route":"/things/{id}","level":"debug","duration":"10m"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST %s = %d %s", LogVerbosityRoute, rec.Code, rec.Body.String())
+	}
+
+	overrides := ws.logs.active()
+	if len(overrides) != 1 || !overrides[0].matches("/things/{id}", httptest.NewRequest("GET", "/things/1", nil)) {
+		t.Errorf("active() = %+v should hold the override", overrides)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/1", nil))
+	if !strings.Contains(out.String(), "detail for") {
+		t.Errorf("a debug log should be written for a matching request: %q", out.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", LogVerbosityRoute, nil))
+	if rec.Code != http.StatusNoContent || len(ws.logs.active()) != 0 {
+		t.Errorf("DELETE %s = %d should remove the overrides", LogVerbosityRoute, rec.Code)
+	}
+}
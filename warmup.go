@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/render"
+)
+
+// ReadyRoute is the path to the readiness endpoint, which responds 503
+// Service Unavailable until the warm-ups added with WarmUp have run, and 200
+// OK after, so that an instance only receives traffic once it is warm
+var ReadyRoute string = `/_ready`
+
+// WarmUpTimeout limits the time that all of the warm-ups may take
+var WarmUpTimeout = time.Minute
+
+// WarmUpFunc makes synthetic requests with client, whose requests are served
+// in-process by the public handler of the WebService without using the
+// network. Requests may be to any host, i.e. http://localhost/things.
+type WarmUpFunc func(ctx context.Context, client *http.Client) error
+
+// warmUps holds the warm-ups of a WebService and whether they have run. It is
+// shared by copies of the WebService.
+type warmUps struct {
+	mu   sync.RWMutex
+	fns  []WarmUpFunc
+	done bool
+}
+
+// WarmUp adds a warm-up that Run calls before ReadyRoute responds 200 OK, to
+// fill caches, open connection pools and parse templates so that the first
+// real requests after a deploy are not slow. Warm-ups are run in order once
+// the listeners have started. A warm-up that fails is logged, and does not
+// prevent the instance becoming ready.
+func (ws *WebService) WarmUp(fn WarmUpFunc) {
+	if ws.warmups == nil {
+		ws.warmups = &warmUps{}
+	}
+
+	ws.warmups.mu.Lock()
+	defer ws.warmups.mu.Unlock()
+
+	ws.warmups.fns = append(ws.warmups.fns, fn)
+}
+
+// ready returns true once the warm-ups have run, or if there are none
+func (wu *warmUps) ready() bool {
+	wu.mu.RLock()
+	defer wu.mu.RUnlock()
+
+	return wu.done || len(wu.fns) == 0
+}
+
+// run runs the warm-ups against h and marks the WebService ready
+func (wu *warmUps) run(h http.Handler) {
+	wu.mu.RLock()
+	fns := append([]WarmUpFunc{}, wu.fns...)
+	wu.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), WarmUpTimeout)
+	defer cancel()
+
+	client := &http.Client{Transport: handlerTransport{h}}
+
+	start := time.Now()
+	for i, fn := range fns {
+		if err := fn(ctx, client); err != nil {
+			log.Warningf("warm-up %d of %d failed: %s", i+1, len(fns), err)
+		}
+	}
+
+	wu.mu.Lock()
+	wu.done = true
+	wu.mu.Unlock()
+
+	if len(fns) > 0 {
+		log.Infof("%d warm-ups took %s", len(fns), time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// handler serves ReadyRoute
+func (wu *warmUps) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		type readiness struct {
+			Ready bool `json:"ready"`
+		}
+
+		if !wu.ready() {
+			render.JSON(w, http.StatusServiceUnavailable, readiness{Ready: false})
+			return
+		}
+
+		render.JSON(w, http.StatusOK, readiness{Ready: true})
+	})
+}
+
+// handlerTransport is a http.RoundTripper that serves requests with a
+// handler in-process
+type handlerTransport struct {
+	h http.Handler
+}
+
+// RoundTrip is part of the http.RoundTripper interface
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	resp.Request = req
+
+	return resp, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	ws := NewWebService()
+
+	calls := 0
+	wc := NewWebController("/things")
+	wc.AddMethodHandler(Get, func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	ws.AddWebController(wc)
+
+	ws.WarmUp(func(ctx context.Context, client *http.Client) error {
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://localhost/things", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET /things = %d", resp.StatusCode)
+		}
+
+		return nil
+	})
+
+	h := ws.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", ReadyRoute, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s before warming up = %d, expected %d", ReadyRoute, rec.Code, http.StatusServiceUnavailable)
+	}
+
+	ws.warmups.run(h)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", ReadyRoute, nil))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("GET %s after warming up = %d with %d calls, expected %d with 1", ReadyRoute, rec.Code, calls, http.StatusOK)
+	}
+}
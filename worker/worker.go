@@ -0,0 +1,216 @@
+// Package worker runs background work on a bounded pool of goroutines, so that
+// work started by requests cannot grow without limit and can be stopped when
+// the service shuts down.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+
+	"github.com/cloudflare/service/log"
+	"github.com/cloudflare/service/metrics"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the queue has no capacity for
+	// more work
+	ErrQueueFull = fmt.Errorf("worker queue is full")
+
+	// ErrStopped is returned by Submit once the pool has been stopped
+	ErrStopped = fmt.Errorf("worker pool is stopped")
+)
+
+// Pool runs submitted work on a fixed number of goroutines
+type Pool struct {
+	work   chan func(ctx context.Context)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// busy and running hold 1 for each worker that is running work, and
+	// that has not returned, respectively
+	busy    []int32
+	running []int32
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// DrainResult describes how a pool stopped
+type DrainResult struct {
+	// Drained is true if the queue was finished before the timeout, so that
+	// no work had its context cancelled
+	Drained bool
+
+	// Cancelled lists the workers that were running work when the context
+	// was cancelled
+	Cancelled []int
+
+	// Stuck lists the workers that had not returned by the end of the grace
+	// period after cancellation
+	Stuck []int
+}
+
+// NewPool starts a pool of workers goroutines which take work from a queue
+// that holds up to queue items
+func NewPool(workers int, queue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queue < 0 {
+		queue = 0
+	}
+
+	p := &Pool{
+		work:    make(chan func(ctx context.Context), queue),
+		busy:    make([]int32, workers),
+		running: make([]int32, workers),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		p.running[i] = 1
+		go p.run(i)
+	}
+
+	return p
+}
+
+func (p *Pool) run(id int) {
+	defer p.wg.Done()
+	defer atomic.StoreInt32(&p.running[id], 0)
+
+	for fn := range p.work {
+		p.do(id, fn)
+	}
+}
+
+// do runs fn on the worker id. A panic in fn is reported rather than
+// crashing the process, and the worker goes on to the next work.
+func (p *Pool) do(id int, fn func(ctx context.Context)) {
+	atomic.StoreInt32(&p.busy[id], 1)
+	defer atomic.StoreInt32(&p.busy[id], 0)
+
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(r, debug.Stack())
+		}
+	}()
+
+	fn(p.ctx)
+}
+
+// reportPanic logs a panic in work and its stack, and sends it to Sentry with
+// the stack if the SENTRY_DSN environment variable is set
+func reportPanic(r interface{}, stack []byte) {
+	metrics.Inc("worker_panics")
+
+	message := fmt.Sprintf("panic in worker: %v", r)
+	log.ErrorKV(message, "stack", string(stack))
+
+	if os.Getenv("SENTRY_DSN") != "" {
+		packet := raven.NewPacketWithExtra(message, raven.Extra{"stacks": string(stack)})
+		raven.Capture(packet, map[string]string{"panic": "true"})
+	}
+}
+
+// Submit queues fn to be run by a worker. The context passed to fn is
+// cancelled when the pool is stopped. A panic in fn is logged and sent to
+// Sentry, and counted by the worker_panics metric.
+func (p *Pool) Submit(fn func(ctx context.Context)) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return ErrStopped
+	}
+
+	select {
+	case p.work <- fn:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stop stops the pool from accepting work, cancels the context of any work in
+// progress and waits for the workers to finish the queue
+func (p *Pool) Stop() {
+	p.close()
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Drain stops the pool in two phases. First it stops accepting work and waits
+// up to timeout for the queue to be finished. If the queue is not finished it
+// then cancels the context of the work, and waits up to grace for the workers
+// to return. Workers that do not return are reported as stuck and left
+// running.
+func (p *Pool) Drain(timeout time.Duration, grace time.Duration) DrainResult {
+	p.close()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	if wait(done, timeout) {
+		p.cancel()
+		return DrainResult{Drained: true}
+	}
+
+	result := DrainResult{}
+	for id := range p.busy {
+		if atomic.LoadInt32(&p.busy[id]) == 1 {
+			result.Cancelled = append(result.Cancelled, id)
+		}
+	}
+
+	p.cancel()
+	if wait(done, grace) {
+		return result
+	}
+
+	for id := range p.running {
+		if atomic.LoadInt32(&p.running[id]) == 1 {
+			result.Stuck = append(result.Stuck, id)
+		}
+	}
+
+	return result
+}
+
+// close stops the pool from accepting work
+func (p *Pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	close(p.work)
+}
+
+// wait returns true if done is closed within d
+func wait(done <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
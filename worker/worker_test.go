@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	p := NewPool(2, 2)
+	p.Submit(func(ctx context.Context) {})
+	if r := p.Drain(time.Second, time.Second); !r.Drained {
+		t.Errorf("expected the pool to drain, got %+v", r)
+	}
+	if err := p.Submit(func(ctx context.Context) {}); err != ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+}
+
+func TestDrainCancels(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{}, 2)
+	p := NewPool(2, 2)
+
+	// Worker that respects cancellation
+	p.Submit(func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+	})
+	// Worker that ignores it
+	p.Submit(func(ctx context.Context) {
+		started <- struct{}{}
+		<-release
+	})
+	<-started
+	<-started
+
+	r := p.Drain(10*time.Millisecond, 10*time.Millisecond)
+	if r.Drained {
+		t.Fatal("expected the pool not to drain")
+	}
+	if len(r.Cancelled) != 2 {
+		t.Errorf("cancelled %v, expected both workers", r.Cancelled)
+	}
+	if len(r.Stuck) != 1 {
+		t.Errorf("stuck %v, expected one worker", r.Stuck)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	p := NewPool(1, 2)
+	done := make(chan struct{})
+	p.Submit(func(ctx context.Context) { panic("malformed") })
+	p.Submit(func(ctx context.Context) { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the worker should run more work after a panic")
+	}
+	if r := p.Drain(time.Second, time.Second); !r.Drained {
+		t.Errorf("expected the pool to drain, got %+v", r)
+	}
+}